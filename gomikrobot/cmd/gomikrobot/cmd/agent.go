@@ -8,7 +8,9 @@ import (
 	"github.com/kamir/gomikrobot/internal/agent"
 	"github.com/kamir/gomikrobot/internal/bus"
 	"github.com/kamir/gomikrobot/internal/config"
-	"github.com/kamir/gomikrobot/internal/provider"
+	"github.com/kamir/gomikrobot/internal/day2day"
+	"github.com/kamir/gomikrobot/internal/intent"
+	"github.com/kamir/gomikrobot/internal/mcp"
 	"github.com/spf13/cobra"
 )
 
@@ -26,6 +28,7 @@ var agentCmd = &cobra.Command{
 func init() {
 	agentCmd.Flags().StringVarP(&agentMessage, "message", "m", "", "Message to send to the agent")
 	agentCmd.Flags().StringVarP(&agentSessionID, "session", "s", "cli:default", "Session ID")
+	addCassetteFlags(agentCmd)
 }
 
 func runAgent(cmd *cobra.Command, args []string) {
@@ -49,34 +52,64 @@ func runAgent(cmd *cobra.Command, args []string) {
 
 	// Setup components
 	msgBus := bus.NewMessageBus()
-	oaProv := provider.NewOpenAIProvider(cfg.Providers.OpenAI.APIKey, cfg.Providers.OpenAI.APIBase, cfg.Model.Name)
-	var prov provider.LLMProvider = oaProv
-
-	if cfg.Providers.LocalWhisper.Enabled {
-		prov = provider.NewLocalWhisperProvider(cfg.Providers.LocalWhisper, oaProv)
-	}
+	prov := buildProvider(cfg)
 
 	// Check API Key
-	if cfg.Providers.OpenAI.APIKey == "" {
-		fmt.Println("Error: API key not found. Set MIKROBOT_OPENAI_API_KEY, OPENROUTER_API_KEY, or use config.json")
+	if !hasProviderKey(cfg) {
+		fmt.Println("Error: API key not found. Set MIKROBOT_OPENAI_API_KEY, OPENROUTER_API_KEY, MIKROBOT_ANTHROPIC_API_KEY, or use config.json")
 		os.Exit(1)
 	}
 
+	// Day2Day tasks live in the timeline DB; without it dt* commands are
+	// answered with a notice.
+	var d2dStore *day2day.Store
+	if timeSvc, err := loadGroupTimeline(); err != nil {
+		fmt.Printf("Timeline warning: %v (day2day disabled)\n", err)
+	} else {
+		defer timeSvc.Close()
+		d2dStore = day2day.NewStore(timeSvc)
+	}
+
+	// Intent screening; a broken configuration falls back to the built-in rules
+	intentGuard, err := intent.NewGuard(cfg.Intent, prov, cfg.Model.Name)
+	if err != nil {
+		fmt.Printf("⚠️ Intent classifier: %v (using built-in rules)\n", err)
+		intentGuard = intent.DefaultGuard()
+	}
+
 	loop := agent.NewLoop(agent.LoopOptions{
-		Bus:           msgBus,
-		Provider:      prov,
-		Workspace:     cfg.Paths.Workspace,
-		WorkRepo:      cfg.Paths.WorkRepoPath,
-		SystemRepo:    cfg.Paths.SystemRepoPath,
-		Model:         cfg.Model.Name,
-		MaxIterations: cfg.Model.MaxToolIterations,
+		Bus:                   msgBus,
+		Provider:              prov,
+		Workspace:             cfg.Paths.Workspace,
+		WorkRepo:              cfg.Paths.WorkRepoPath,
+		SystemRepo:            cfg.Paths.SystemRepoPath,
+		Model:                 cfg.Model.Name,
+		MaxIterations:         cfg.Model.MaxToolIterations,
+		HistoryTokens:         cfg.Model.HistoryTokens,
+		ToolOutputChars:       cfg.Model.ToolOutputChars,
+		MaxParallelTools:      cfg.Model.MaxParallelTools,
+		MaxConcurrentSessions: cfg.Model.MaxConcurrentSessions,
+		Profiles:              cfg.AgentProfiles,
+		Intent:                intentGuard,
+		Day2DayStore:          d2dStore,
+		Tools:                 cfg.Tools,
 	})
 
 	fmt.Printf("🤖 GoMikroBot (%s)\n", cfg.Model.Name)
 	fmt.Println("Thinking...")
 
 	ctx := context.Background()
+	// MCP servers: their tools join the loop's registry
+	mcpMgr, err := mcp.NewManager(cfg.Tools.MCP, loop.Registry())
+	if err != nil {
+		fmt.Printf("⚠️ MCP: %v (no MCP servers started)\n", err)
+	} else {
+		mcpMgr.Start(ctx)
+	}
 	response, err := loop.ProcessDirect(ctx, agentMessage, agentSessionID)
+	if mcpMgr != nil {
+		mcpMgr.Close()
+	}
 	if err != nil {
 		fmt.Printf("Error: %v\n", err)
 		os.Exit(1)
@@ -0,0 +1,100 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+
+	"github.com/kamir/gomikrobot/internal/config"
+	"github.com/kamir/gomikrobot/internal/eval"
+	"github.com/spf13/cobra"
+)
+
+var (
+	evalJSON      bool
+	evalReport    string
+	evalRun       string
+	evalLive      bool
+	evalRecord    bool
+	evalWorkspace string
+)
+
+var evalCmd = &cobra.Command{
+	Use:   "eval [files or dirs...]",
+	Short: "Run conversation scenarios against the agent and report regressions",
+	Long: `Runs YAML or JSON scenarios through the agent loop and checks the tool
+calls, replies and written files. Scenarios use their scripted responses or
+recorded cassette; --live asks the configured provider instead, and --record
+does the same while rewriting each scenario's cassette.`,
+	Args: cobra.MinimumNArgs(1),
+	Run:  runEval,
+}
+
+func init() {
+	evalCmd.Flags().BoolVar(&evalJSON, "json", false, "Print the report as JSON")
+	evalCmd.Flags().StringVar(&evalReport, "report", "", "Also write the JSON report to this file")
+	evalCmd.Flags().StringVar(&evalRun, "run", "", "Only run scenarios whose name matches this regular expression")
+	evalCmd.Flags().BoolVar(&evalLive, "live", false, "Use the configured provider instead of scripts and cassettes")
+	evalCmd.Flags().BoolVar(&evalRecord, "record", false, "Like --live, and record each scenario's cassette")
+	evalCmd.Flags().StringVar(&evalWorkspace, "workspace", "", "Directory with the bootstrap prompt files (default: the configured workspace with --live)")
+}
+
+func runEval(cmd *cobra.Command, args []string) {
+	scenarios, err := eval.Load(args)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	opts := eval.Options{PromptDir: evalWorkspace}
+	if evalRun != "" {
+		re, err := regexp.Compile(evalRun)
+		if err != nil {
+			fmt.Printf("Error: --run: %v\n", err)
+			os.Exit(1)
+		}
+		opts.Filter = re
+	}
+
+	if evalLive || evalRecord {
+		cfg, err := config.Load()
+		if err != nil {
+			fmt.Printf("Config warning: %v (using defaults)\n", err)
+		}
+		if !hasProviderKey(cfg) {
+			fmt.Println("Error: --live needs an API key. Set MIKROBOT_OPENAI_API_KEY, OPENROUTER_API_KEY, MIKROBOT_ANTHROPIC_API_KEY, or use config.json")
+			os.Exit(1)
+		}
+		opts.Provider = buildProvider(cfg)
+		opts.Record = evalRecord
+		opts.Model = cfg.Model.Name
+		if opts.PromptDir == "" {
+			opts.PromptDir = cfg.Paths.Workspace
+		}
+	}
+
+	report := eval.RunAll(context.Background(), scenarios, opts)
+	if evalJSON {
+		_ = report.WriteJSON(os.Stdout)
+	} else {
+		report.WriteText(os.Stdout)
+	}
+	if evalReport != "" {
+		f, err := os.Create(evalReport)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		err = report.WriteJSON(f)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			fmt.Printf("Error: write report: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if report.Failed > 0 {
+		os.Exit(1)
+	}
+}
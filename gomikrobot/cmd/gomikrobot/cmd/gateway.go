@@ -6,6 +6,7 @@ import (
 	"crypto/tls"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"os"
@@ -23,7 +24,12 @@ import (
 	"github.com/kamir/gomikrobot/internal/bus"
 	"github.com/kamir/gomikrobot/internal/channels"
 	"github.com/kamir/gomikrobot/internal/config"
+	"github.com/kamir/gomikrobot/internal/costs"
+	"github.com/kamir/gomikrobot/internal/day2day"
 	"github.com/kamir/gomikrobot/internal/group"
+	"github.com/kamir/gomikrobot/internal/intent"
+	"github.com/kamir/gomikrobot/internal/journal"
+	"github.com/kamir/gomikrobot/internal/mcp"
 	"github.com/kamir/gomikrobot/internal/memory"
 	"github.com/kamir/gomikrobot/internal/orchestrator"
 	"github.com/kamir/gomikrobot/internal/policy"
@@ -48,6 +54,10 @@ var gatewayCmd = &cobra.Command{
 	Run:   runGateway,
 }
 
+func init() {
+	addCassetteFlags(gatewayCmd)
+}
+
 func runGateway(cmd *cobra.Command, args []string) {
 	printHeader("🌐 GoMikroBot Gateway")
 	fmt.Println("Starting GoMikroBot Gateway...")
@@ -116,12 +126,7 @@ func runGateway(cmd *cobra.Command, args []string) {
 	msgBus := bus.NewMessageBus()
 
 	// 4. Setup Providers
-	oaProv := provider.NewOpenAIProvider(cfg.Providers.OpenAI.APIKey, cfg.Providers.OpenAI.APIBase, cfg.Model.Name)
-	var prov provider.LLMProvider = oaProv
-
-	if cfg.Providers.LocalWhisper.Enabled {
-		prov = provider.NewLocalWhisperProvider(cfg.Providers.LocalWhisper, oaProv)
-	}
+	prov := buildProvider(cfg)
 
 	// 4b. Setup Policy Engine
 	policyEngine := policy.NewDefaultEngine()
@@ -133,7 +138,7 @@ func runGateway(cmd *cobra.Command, args []string) {
 
 	// 4c. Setup Memory System (requires Embedder-capable provider)
 	var memorySvc *memory.MemoryService
-	if embedder, ok := prov.(provider.Embedder); ok {
+	if embedder, ok := provider.AsEmbedder(prov); ok {
 		vecStore := memory.NewSQLiteVecStore(timeSvc.DB(), 1536)
 		memorySvc = memory.NewMemoryService(vecStore, embedder)
 		fmt.Println("🧠 Memory system initialized")
@@ -238,20 +243,35 @@ func runGateway(cmd *cobra.Command, args []string) {
 
 	gatewayStartTime := time.Now()
 
+	// Intent screening; a broken configuration falls back to the built-in rules
+	intentGuard, err := intent.NewGuard(cfg.Intent, prov, cfg.Model.Name)
+	if err != nil {
+		fmt.Printf("⚠️ Intent classifier: %v (using built-in rules)\n", err)
+		intentGuard = intent.DefaultGuard()
+	}
+
 	// 5. Setup Loop
 	loop := agent.NewLoop(agent.LoopOptions{
-		Bus:            msgBus,
-		Provider:       prov,
-		Timeline:       timeSvc,
-		Policy:         policyEngine,
-		MemoryService:  memorySvc,
-		GroupPublisher: groupPublisher,
-		Workspace:      cfg.Paths.Workspace,
-		WorkRepo:       workRepoPath,
-		SystemRepo:     systemRepoPath,
-		WorkRepoGetter: getWorkRepo,
-		Model:          cfg.Model.Name,
-		MaxIterations:  cfg.Model.MaxToolIterations,
+		Bus:                   msgBus,
+		Provider:              prov,
+		Timeline:              timeSvc,
+		Policy:                policyEngine,
+		MemoryService:         memorySvc,
+		GroupPublisher:        groupPublisher,
+		Workspace:             cfg.Paths.Workspace,
+		WorkRepo:              workRepoPath,
+		SystemRepo:            systemRepoPath,
+		WorkRepoGetter:        getWorkRepo,
+		Model:                 cfg.Model.Name,
+		MaxIterations:         cfg.Model.MaxToolIterations,
+		HistoryTokens:         cfg.Model.HistoryTokens,
+		ToolOutputChars:       cfg.Model.ToolOutputChars,
+		MaxParallelTools:      cfg.Model.MaxParallelTools,
+		MaxConcurrentSessions: cfg.Model.MaxConcurrentSessions,
+		Costs:                 costs.NewAccountant(cfg.Costs, timeSvc),
+		Profiles:              cfg.AgentProfiles,
+		Intent:                intentGuard,
+		Tools:                 cfg.Tools,
 	})
 
 	// 5b. Index soul files (non-blocking background)
@@ -276,13 +296,38 @@ func runGateway(cmd *cobra.Command, args []string) {
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
 
+	// MCP servers: their tools join the loop's registry
+	mcpMgr, err := mcp.NewManager(cfg.Tools.MCP, loop.Registry())
+	if err != nil {
+		fmt.Printf("⚠️ MCP: %v (no MCP servers started)\n", err)
+	} else {
+		mcpMgr.Start(ctx)
+		for _, st := range mcpMgr.Status() {
+			fmt.Printf("🔌 MCP server %s: connected=%v tools=%d\n", st.Name, st.Connected, len(st.Tools))
+		}
+	}
+
 	// Start Channels
 	if err := wa.Start(ctx); err != nil {
 		fmt.Printf("Failed to start WhatsApp: %v\n", err)
 	}
 
+	// Streaming partials for the web UI, keyed by web user id. They are only
+	// served to the chat panel and never forwarded to WhatsApp.
+	var webPartialsMu sync.Mutex
+	webPartials := make(map[string]*bus.OutboundMessage)
+
 	// Route web UI outbound to WhatsApp and timeline
 	msgBus.Subscribe("webui", func(msg *bus.OutboundMessage) {
+		webPartialsMu.Lock()
+		if msg.Partial {
+			webPartials[msg.ChatID] = msg
+			webPartialsMu.Unlock()
+			return
+		}
+		delete(webPartials, msg.ChatID)
+		webPartialsMu.Unlock()
+
 		go func() {
 			webUserID, err := strconv.ParseInt(msg.ChatID, 10, 64)
 			if err != nil {
@@ -709,6 +754,9 @@ func runGateway(cmd *cobra.Command, args []string) {
 						}
 					}
 				}
+				if output == "" && e.Classification == "LLM_RETRY" {
+					output = e.ContentText
+				}
 
 				spans = append(spans, span{
 					ID:       e.EventID,
@@ -741,11 +789,13 @@ func runGateway(cmd *cobra.Command, args []string) {
 			if decisions, err := timeSvc.ListPolicyDecisions(traceID); err == nil {
 				for _, d := range decisions {
 					policyDecisions = append(policyDecisions, map[string]any{
-						"tool":    d.Tool,
-						"tier":    d.Tier,
-						"allowed": d.Allowed,
-						"reason":  d.Reason,
-						"time":    d.CreatedAt.Format("15:04:05"),
+						"tool":       d.Tool,
+						"tier":       d.Tier,
+						"allowed":    d.Allowed,
+						"reason":     d.Reason,
+						"category":   d.Category,
+						"confidence": d.Confidence,
+						"time":       d.CreatedAt.Format("15:04:05"),
 					})
 				}
 			}
@@ -2477,6 +2527,27 @@ func runGateway(cmd *cobra.Command, args []string) {
 			json.NewEncoder(w).Encode(map[string]string{"status": "queued"})
 		})
 
+		// API: Web Chat streaming partial (GET)
+		mux.HandleFunc("/api/v1/webchat/partial", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Access-Control-Allow-Origin", "*")
+			w.Header().Set("Content-Type", "application/json")
+
+			webUserID := strings.TrimSpace(r.URL.Query().Get("web_user_id"))
+			webPartialsMu.Lock()
+			msg := webPartials[webUserID]
+			webPartialsMu.Unlock()
+
+			if msg == nil {
+				json.NewEncoder(w).Encode(map[string]any{"streaming": false})
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]any{
+				"streaming": true,
+				"trace_id":  msg.TraceID,
+				"content":   msg.Content,
+			})
+		})
+
 		// API: Tasks List (GET)
 		mux.HandleFunc("/api/v1/tasks", func(w http.ResponseWriter, r *http.Request) {
 			w.Header().Set("Access-Control-Allow-Origin", "*")
@@ -2501,18 +2572,103 @@ func runGateway(cmd *cobra.Command, args []string) {
 			json.NewEncoder(w).Encode(tasks)
 		})
 
-		// API: Task Detail (GET)
+		// API: Task Detail (GET), Cancel (POST /api/v1/tasks/{id}/cancel),
+		// file changes (GET /api/v1/tasks/{id}/changes) and their revert
+		// (POST /api/v1/tasks/{id}/revert[?force=true])
 		mux.HandleFunc("/api/v1/tasks/", func(w http.ResponseWriter, r *http.Request) {
 			w.Header().Set("Access-Control-Allow-Origin", "*")
+			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+			w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
 			w.Header().Set("Content-Type", "application/json")
+			if r.Method == "OPTIONS" {
+				return
+			}
 
 			taskID := strings.TrimPrefix(r.URL.Path, "/api/v1/tasks/")
+			taskID, action, _ := strings.Cut(taskID, "/")
 			taskID = strings.TrimSpace(taskID)
 			if taskID == "" {
 				http.Error(w, "task_id required", http.StatusBadRequest)
 				return
 			}
 
+			if action == "cancel" {
+				if r.Method != "POST" {
+					http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+					return
+				}
+				task, err := timeSvc.GetTask(taskID)
+				if err != nil {
+					http.Error(w, "task not found", http.StatusNotFound)
+					return
+				}
+				if !loop.CancelTask(taskID) {
+					http.Error(w, fmt.Sprintf("task is not running (status %s)", task.Status), http.StatusConflict)
+					return
+				}
+				json.NewEncoder(w).Encode(map[string]any{"task_id": taskID, "status": "cancelling"})
+				return
+			}
+			if action == "changes" {
+				changes, err := loop.FileChanges(taskID)
+				if err != nil {
+					http.Error(w, err.Error(), http.StatusServiceUnavailable)
+					return
+				}
+				out := make([]map[string]any, 0, len(changes))
+				for _, c := range changes {
+					out = append(out, map[string]any{
+						"id":            c.ID,
+						"trace_id":      c.TraceID,
+						"tool":          c.Tool,
+						"path":          c.Path,
+						"before_exists": c.BeforeExists,
+						"after_exists":  c.AfterExists,
+						"diff":          c.Diff(),
+						"created_at":    c.CreatedAt,
+						"reverted_at":   c.RevertedAt,
+					})
+				}
+				json.NewEncoder(w).Encode(out)
+				return
+			}
+			if action == "revert" {
+				if r.Method != "POST" {
+					http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+					return
+				}
+				task, err := timeSvc.GetTask(taskID)
+				if err != nil {
+					http.Error(w, "task not found", http.StatusNotFound)
+					return
+				}
+				if task.Status == timeline.TaskStatusProcessing {
+					http.Error(w, "task is still running", http.StatusConflict)
+					return
+				}
+				force := r.URL.Query().Get("force") == "true"
+				res, err := loop.RevertTask(taskID, force)
+				var conflict *journal.ConflictError
+				switch {
+				case errors.Is(err, journal.ErrNothingToRevert):
+					http.Error(w, err.Error(), http.StatusNotFound)
+					return
+				case errors.As(err, &conflict):
+					w.WriteHeader(http.StatusConflict)
+					json.NewEncoder(w).Encode(map[string]any{"error": "files changed since the task wrote them", "conflicts": conflict.Paths})
+					return
+				case err != nil:
+					http.Error(w, err.Error(), http.StatusInternalServerError)
+					return
+				}
+				json.NewEncoder(w).Encode(res)
+				return
+			}
+			if action != "" {
+				http.Error(w, "unknown task action", http.StatusNotFound)
+				return
+			}
+
 			task, err := timeSvc.GetTask(taskID)
 			if err != nil {
 				http.Error(w, "task not found", http.StatusNotFound)
@@ -2521,6 +2677,184 @@ func runGateway(cmd *cobra.Command, args []string) {
 			json.NewEncoder(w).Encode(task)
 		})
 
+		// API: Day2Day tasks. GET lists a day (?day=YYYY-MM-DD, default today;
+		// ?status=open|done|all, default open), POST creates a task.
+		mux.HandleFunc("/api/v1/day2day/tasks", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Access-Control-Allow-Origin", "*")
+			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+			w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+			w.Header().Set("Content-Type", "application/json")
+			if r.Method == "OPTIONS" {
+				return
+			}
+			d2d := loop.Day2Day()
+			if d2d == nil {
+				http.Error(w, "day2day task store not available", http.StatusServiceUnavailable)
+				return
+			}
+
+			if r.Method == "POST" {
+				var body day2day.Task
+				if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+					http.Error(w, "invalid body", http.StatusBadRequest)
+					return
+				}
+				task, err := d2d.Create(body)
+				if err != nil {
+					http.Error(w, err.Error(), http.StatusBadRequest)
+					return
+				}
+				w.WriteHeader(http.StatusCreated)
+				json.NewEncoder(w).Encode(task)
+				return
+			}
+			if r.Method != "GET" {
+				http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+
+			date := time.Now()
+			if v := r.URL.Query().Get("day"); v != "" {
+				t, ok := day2day.ParseDay(v, date)
+				if !ok {
+					http.Error(w, "invalid day", http.StatusBadRequest)
+					return
+				}
+				date = t
+			}
+			day, err := d2d.View(date)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			tasks := []day2day.Task{}
+			status := r.URL.Query().Get("status")
+			if status != "done" {
+				tasks = append(append(tasks, day.Open...), day.Snoozed...)
+			}
+			if status == "done" || status == "all" {
+				tasks = append(tasks, day.Done...)
+			}
+			next := int64(0)
+			if day.Next != nil {
+				next = day.Next.ID
+			}
+			json.NewEncoder(w).Encode(map[string]any{"day": day.Day, "next_task_id": next, "tasks": tasks})
+		})
+
+		// API: Day2Day task actions (POST /api/v1/day2day/tasks/{id}/complete,
+		// /snooze with {"until"}, /reschedule with {"due"}).
+		mux.HandleFunc("/api/v1/day2day/tasks/", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Access-Control-Allow-Origin", "*")
+			w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
+			w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+			w.Header().Set("Content-Type", "application/json")
+			if r.Method == "OPTIONS" {
+				return
+			}
+			if r.Method != "POST" {
+				http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			d2d := loop.Day2Day()
+			if d2d == nil {
+				http.Error(w, "day2day task store not available", http.StatusServiceUnavailable)
+				return
+			}
+
+			rawID, action, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/api/v1/day2day/tasks/"), "/")
+			id, err := strconv.ParseInt(rawID, 10, 64)
+			if err != nil {
+				http.Error(w, "invalid task id", http.StatusBadRequest)
+				return
+			}
+			var body struct {
+				Until string `json:"until"`
+				Due   string `json:"due"`
+			}
+			if action != "complete" {
+				if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+					http.Error(w, "invalid body", http.StatusBadRequest)
+					return
+				}
+			}
+
+			now := time.Now()
+			var result any
+			switch action {
+			case "complete":
+				task, next, cerr := d2d.Complete(id)
+				result, err = map[string]any{"task": task, "next": next}, cerr
+			case "snooze":
+				until, ok := day2day.ParseUntil(body.Until, now)
+				if !ok {
+					http.Error(w, "invalid until", http.StatusBadRequest)
+					return
+				}
+				result, err = d2d.Snooze(id, until)
+			case "reschedule":
+				due, ok := day2day.ParseDay(body.Due, now)
+				if !ok {
+					http.Error(w, "invalid due", http.StatusBadRequest)
+					return
+				}
+				result, err = d2d.Reschedule(id, due)
+			default:
+				http.Error(w, "unknown task action", http.StatusNotFound)
+				return
+			}
+			switch {
+			case errors.Is(err, day2day.ErrNotFound):
+				http.Error(w, "task not found", http.StatusNotFound)
+			case errors.Is(err, day2day.ErrNotOpen):
+				http.Error(w, "task is not open", http.StatusConflict)
+			case err != nil:
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+			default:
+				json.NewEncoder(w).Encode(result)
+			}
+		})
+
+		// API: Cost report (GET) — LLM spend by model, channel and sender.
+		// ?period=day|month (default month) or ?since=&until= (RFC3339 or YYYY-MM-DD).
+		mux.HandleFunc("/api/v1/costs", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Access-Control-Allow-Origin", "*")
+			w.Header().Set("Content-Type", "application/json")
+
+			now := time.Now()
+			period := r.URL.Query().Get("period")
+			if period == "" {
+				period = costs.PeriodMonth
+			}
+			since := costs.PeriodStart(period, now)
+			until := now.Add(time.Second)
+			for _, p := range []struct {
+				name string
+				dst  *time.Time
+			}{{"since", &since}, {"until", &until}} {
+				v := r.URL.Query().Get(p.name)
+				if v == "" {
+					continue
+				}
+				t, err := time.Parse(time.RFC3339, v)
+				if err != nil {
+					t, err = time.ParseInLocation("2006-01-02", v, time.Local)
+				}
+				if err != nil {
+					http.Error(w, "invalid "+p.name+": "+v, http.StatusBadRequest)
+					return
+				}
+				*p.dst = t
+			}
+
+			report, err := timeSvc.GetCostReport(since, until)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			json.NewEncoder(w).Encode(report)
+		})
+
 		// API: Pending Approvals (GET)
 		mux.HandleFunc("/api/v1/approvals/pending", func(w http.ResponseWriter, r *http.Request) {
 			w.Header().Set("Access-Control-Allow-Origin", "*")
@@ -2723,6 +3057,9 @@ func runGateway(cmd *cobra.Command, args []string) {
 		leaveCancel()
 	}
 	grpState.Clear()
+	if mcpMgr != nil {
+		mcpMgr.Close()
+	}
 	wa.Stop()
 	loop.Stop()
 	timeSvc.Close()
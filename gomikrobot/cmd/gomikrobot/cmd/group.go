@@ -284,6 +284,9 @@ func runGroupMembers(cmd *cobra.Command, args []string) {
 // Used by gateway when passing msgBus around
 func setupGroupBusSubscription(mgr *group.Manager, msgBus *bus.MessageBus) {
 	msgBus.Subscribe("group", func(msg *bus.OutboundMessage) {
+		if msg.Partial {
+			return // group tasks only receive the final response
+		}
 		go func() {
 			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 			defer cancel()
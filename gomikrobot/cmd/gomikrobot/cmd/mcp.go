@@ -0,0 +1,269 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/kamir/gomikrobot/internal/agent"
+	"github.com/kamir/gomikrobot/internal/approval"
+	"github.com/kamir/gomikrobot/internal/config"
+	"github.com/kamir/gomikrobot/internal/mcp"
+	"github.com/kamir/gomikrobot/internal/memory"
+	"github.com/kamir/gomikrobot/internal/policy"
+	"github.com/kamir/gomikrobot/internal/provider"
+	"github.com/kamir/gomikrobot/internal/session"
+	"github.com/kamir/gomikrobot/internal/timeline"
+	"github.com/kamir/gomikrobot/internal/tools"
+	"github.com/spf13/cobra"
+)
+
+// defaultMCPTools are the tools `gomikrobot mcp` offers when
+// tools.mcp.serve.tools is not set.
+var defaultMCPTools = []string{"recall", "remember", "day2day", "timeline_query", "group_submit_task"}
+
+const sessionURIPrefix = "gomikrobot://sessions/"
+
+var mcpCmd = &cobra.Command{
+	Use:   "mcp",
+	Short: "Serve tools and resources to MCP clients over stdio",
+	Long: "Runs GoMikroBot as an MCP server on stdin/stdout, so IDEs and other agents can use its memory, " +
+		"day2day tasks, timeline and group. Every tool call passes the policy engine; calls above the " +
+		"auto-approved tier are confirmed by the client's user.",
+	Run: runMCP,
+}
+
+func runMCP(cmd *cobra.Command, args []string) {
+	// Stdout carries the protocol; everything else is written to stderr.
+	out := os.Stdout
+	os.Stdout = os.Stderr
+
+	cfg, err := config.Load()
+	if err != nil {
+		fmt.Printf("Config warning: %v (using defaults)\n", err)
+	}
+	timeSvc, err := loadGroupTimeline()
+	if err != nil {
+		fmt.Printf("Error: timeline: %v\n", err)
+		os.Exit(1)
+	}
+	defer timeSvc.Close()
+
+	prov := buildProvider(cfg)
+	var memorySvc *memory.MemoryService
+	if embedder, ok := provider.AsEmbedder(prov); ok {
+		memorySvc = memory.NewMemoryService(memory.NewSQLiteVecStore(timeSvc.DB(), 1536), embedder)
+	}
+
+	// Only stale approvals of earlier MCP sessions are expired; a running
+	// gateway keeps its own.
+	approvals := approval.NewChannelManager(timeSvc, mcp.Channel)
+	loop := agent.NewLoop(agent.LoopOptions{
+		Provider:      prov,
+		Timeline:      timeSvc,
+		MemoryService: memorySvc,
+		Workspace:     cfg.Paths.Workspace,
+		WorkRepo:      cfg.Paths.WorkRepoPath,
+		SystemRepo:    cfg.Paths.SystemRepoPath,
+		Model:         cfg.Model.Name,
+		Tools:         cfg.Tools,
+		Approvals:     approvals,
+	})
+
+	all := loop.Registry()
+	if d2d := loop.Day2Day(); d2d != nil {
+		all.Register(tools.NewDay2DayTool(d2d))
+	}
+	all.Register(tools.NewTimelineQueryTool(timeSvc))
+	all.Register(tools.NewGroupSubmitTaskTool(gatewaySubmitter(cfg)))
+
+	names := cfg.Tools.MCP.Serve.Tools
+	if len(names) == 0 {
+		names = defaultMCPTools
+	}
+	exposed := tools.NewRegistry()
+	for _, name := range names {
+		if t, ok := all.Get(name); ok {
+			exposed.Register(t)
+		} else {
+			fmt.Printf("MCP warning: tool %q is not available\n", name)
+		}
+	}
+
+	engine := policy.NewDefaultEngine()
+	if cfg.Tools.MCP.Serve.MaxAutoTier != nil {
+		engine.MaxAutoTier = *cfg.Tools.MCP.Serve.MaxAutoTier
+	}
+
+	srv := &mcp.Server{
+		Info:         mcp.Implementation{Name: "gomikrobot", Version: version},
+		Instructions: "GoMikroBot personal assistant: long-term memory, day2day tasks, the message timeline and the agent group.",
+		Tools:        exposed,
+		Resources:    mcpResources(cfg),
+		Templates:    mcpTemplates(),
+		Gate: &mcp.Gate{
+			Policy:    engine,
+			Approvals: approvals,
+			Timeline:  timeSvc,
+			Sender:    mcp.Channel,
+			Timeout:   settingSeconds(timeSvc, "approval_timeout_seconds", 60*time.Second),
+
+			AllowClientApproval: cfg.Tools.MCP.Serve.AllowClientApproval,
+		},
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if err := srv.Serve(ctx, os.Stdin, out); err != nil && !errors.Is(err, context.Canceled) {
+		fmt.Printf("MCP server error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// gatewaySubmitter submits group tasks through the running gateway, which
+// holds the group membership.
+func gatewaySubmitter(cfg *config.Config) tools.SubmitFunc {
+	host := cfg.Gateway.Host
+	if host == "" || host == "0.0.0.0" {
+		host = "127.0.0.1"
+	}
+	port := cfg.Gateway.DashboardPort
+	if port == 0 {
+		port = 18791
+	}
+	endpoint := fmt.Sprintf("http://%s:%d/api/v1/group/tasks/submit", host, port)
+	return func(ctx context.Context, description, content string) (string, error) {
+		body, _ := json.Marshal(map[string]string{"description": description, "content": content})
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+		if err != nil {
+			return "", err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		if cfg.Gateway.AuthToken != "" {
+			req.Header.Set("Authorization", "Bearer "+cfg.Gateway.AuthToken)
+		}
+		resp, err := (&http.Client{Timeout: 15 * time.Second}).Do(req)
+		if err != nil {
+			return "", fmt.Errorf("gateway not reachable: %w", err)
+		}
+		defer resp.Body.Close()
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		if resp.StatusCode != http.StatusOK {
+			return "", fmt.Errorf("gateway: %s", strings.TrimSpace(string(data)))
+		}
+		var res struct {
+			TaskID string `json:"task_id"`
+		}
+		if err := json.Unmarshal(data, &res); err != nil {
+			return "", fmt.Errorf("gateway: %w", err)
+		}
+		return res.TaskID, nil
+	}
+}
+
+// mcpResources offers the bootstrap files and the session list.
+func mcpResources(cfg *config.Config) []mcp.ServedResource {
+	memoryBase := cfg.Paths.WorkRepoPath
+	if memoryBase == "" {
+		memoryBase = cfg.Paths.Workspace
+	}
+	readFile := func(path string) func(context.Context) (string, error) {
+		return func(context.Context) (string, error) {
+			data, err := os.ReadFile(path)
+			if errors.Is(err, os.ErrNotExist) {
+				return "", mcp.ErrResourceNotFound
+			}
+			return string(data), err
+		}
+	}
+	return []mcp.ServedResource{
+		{
+			Resource: mcp.Resource{URI: "gomikrobot://memory/MEMORY.md", Name: "MEMORY.md", Description: "Long-term memory notes", MimeType: "text/markdown"},
+			Read:     readFile(filepath.Join(expandHome(memoryBase), "memory", "MEMORY.md")),
+		},
+		{
+			Resource: mcp.Resource{URI: "gomikrobot://workspace/SOUL.md", Name: "SOUL.md", Description: "Personality and values of the agent", MimeType: "text/markdown"},
+			Read:     readFile(filepath.Join(expandHome(cfg.Paths.Workspace), "SOUL.md")),
+		},
+		{
+			Resource: mcp.Resource{URI: "gomikrobot://sessions", Name: "sessions", Description: "Conversation sessions, most recent first", MimeType: "application/json"},
+			Read: func(context.Context) (string, error) {
+				list := session.NewManager(cfg.Paths.Workspace).List()
+				sort.Slice(list, func(i, j int) bool { return list[i].UpdatedAt.After(list[j].UpdatedAt) })
+				type entry struct {
+					Key       string    `json:"key"`
+					URI       string    `json:"uri"`
+					UpdatedAt time.Time `json:"updated_at"`
+				}
+				entries := make([]entry, 0, len(list))
+				for _, s := range list {
+					entries = append(entries, entry{Key: s.Key, URI: sessionURIPrefix + url.PathEscape(s.Key), UpdatedAt: s.UpdatedAt})
+				}
+				data, err := json.MarshalIndent(entries, "", "  ")
+				return string(data), err
+			},
+		},
+	}
+}
+
+// mcpTemplates offers the message history of each session.
+func mcpTemplates() []mcp.ServedTemplate {
+	return []mcp.ServedTemplate{{
+		ResourceTemplate: mcp.ResourceTemplate{
+			URITemplate: sessionURIPrefix + "{key}",
+			Name:        "session",
+			Description: "Recent messages of a conversation session",
+			MimeType:    "application/json",
+		},
+		Prefix: sessionURIPrefix,
+		Read: func(_ context.Context, uri string) (string, error) {
+			key, err := url.PathUnescape(strings.TrimPrefix(uri, sessionURIPrefix))
+			if err != nil {
+				return "", mcp.ErrResourceNotFound
+			}
+			mgr := session.NewManager("")
+			for _, s := range mgr.List() {
+				if s.Key != key {
+					continue
+				}
+				data, err := json.MarshalIndent(mgr.GetOrCreate(key).GetHistory(200), "", "  ")
+				return string(data), err
+			}
+			return "", mcp.ErrResourceNotFound
+		},
+	}}
+}
+
+func expandHome(path string) string {
+	if strings.HasPrefix(path, "~") {
+		home, _ := os.UserHomeDir()
+		return filepath.Join(home, path[1:])
+	}
+	return path
+}
+
+// settingSeconds reads a duration in seconds from the timeline settings.
+func settingSeconds(tl *timeline.TimelineService, key string, def time.Duration) time.Duration {
+	val, err := tl.GetSetting(key)
+	if err != nil || val == "" {
+		return def
+	}
+	seconds, err := strconv.Atoi(strings.TrimSpace(val))
+	if err != nil || seconds <= 0 {
+		return def
+	}
+	return time.Duration(seconds) * time.Second
+}
@@ -0,0 +1,176 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/kamir/gomikrobot/internal/config"
+	"github.com/kamir/gomikrobot/internal/provider"
+	"github.com/spf13/cobra"
+)
+
+// Cassette flags shared by the agent and gateway commands.
+var (
+	recordCassette string
+	replayCassette string
+)
+
+// addCassetteFlags registers --record and --replay on cmd.
+func addCassetteFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&recordCassette, "record", "", "Record all provider calls to this cassette file")
+	cmd.Flags().StringVar(&replayCassette, "replay", "", "Serve provider calls from this cassette file instead of the network")
+}
+
+// buildProvider assembles the LLM provider stack shared by the agent and
+// gateway commands. With a failover chain configured, every entry becomes a
+// backend of a FailoverProvider. Otherwise Claude models go through the
+// native Messages API when an Anthropic key is configured and everything
+// else uses the OpenAI-compatible client. The Messages API only chats, so
+// with an OpenAI key transcription, speech and embeddings still go to
+// OpenAI. The local Whisper and TTS wrappers
+// are layered on top when enabled. With --replay the whole stack is replaced by
+// a cassette, and with --record it is wrapped in a recorder.
+func buildProvider(cfg *config.Config) provider.LLMProvider {
+	if replayCassette != "" {
+		replayer, err := provider.NewReplayer(replayCassette)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("📼 Replaying provider calls from %s\n", replayCassette)
+		return replayer
+	}
+
+	var prov provider.LLMProvider
+	if chain := buildFailoverChain(cfg); chain != nil {
+		prov = chain
+	} else if useAnthropic(cfg) {
+		prov = provider.NewAnthropicProvider(cfg.Providers.Anthropic.APIKey, cfg.Providers.Anthropic.APIBase, cfg.Model.Name)
+		if cfg.Providers.OpenAI.APIKey != "" {
+			media := provider.NewOpenAIProvider(cfg.Providers.OpenAI.APIKey, cfg.Providers.OpenAI.APIBase, cfg.Model.Name)
+			prov = provider.NewSplitProvider(prov, media)
+		}
+	} else {
+		prov = provider.NewOpenAIProvider(cfg.Providers.OpenAI.APIKey, cfg.Providers.OpenAI.APIBase, cfg.Model.Name)
+	}
+
+	if cfg.Providers.LocalWhisper.Enabled {
+		prov = provider.NewLocalWhisperProvider(cfg.Providers.LocalWhisper, prov)
+	}
+	if cfg.Providers.LocalTTS.Enabled {
+		prov = provider.NewLocalTTSProvider(cfg.Providers.LocalTTS, prov)
+	}
+
+	if recordCassette != "" {
+		recorder, err := provider.NewRecorder(prov, recordCassette)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("📼 Recording provider calls to %s\n", recordCassette)
+		prov = recorder
+	}
+	return prov
+}
+
+// buildFailoverChain returns a FailoverProvider for the configured chain,
+// or nil when no usable chain entry exists.
+func buildFailoverChain(cfg *config.Config) *provider.FailoverProvider {
+	fo := cfg.Providers.Failover
+	var targets []provider.FailoverTarget
+	for _, entry := range fo.Chain {
+		model := entry.Model
+		if model == "" {
+			model = cfg.Model.Name
+		}
+		prov, err := newNamedProvider(cfg, entry.Provider, model)
+		if err != nil {
+			fmt.Printf("⚠️  Failover: skipping %s: %v\n", entry.Provider, err)
+			continue
+		}
+		targets = append(targets, provider.FailoverTarget{
+			Name:     strings.ToLower(entry.Provider),
+			Provider: prov,
+			Model:    model,
+		})
+	}
+	if len(targets) == 0 {
+		return nil
+	}
+
+	chain := provider.NewFailoverProvider(targets)
+	if fo.FailureThreshold > 0 {
+		chain.FailureThreshold = fo.FailureThreshold
+	}
+	if fo.CooldownSeconds > 0 {
+		chain.Cooldown = time.Duration(fo.CooldownSeconds) * time.Second
+	}
+	return chain
+}
+
+// newNamedProvider creates a provider by its config name. OpenAI-compatible
+// services default to their public endpoints unless apiBase is set.
+func newNamedProvider(cfg *config.Config, name, model string) (provider.LLMProvider, error) {
+	p := cfg.Providers
+	compatible := func(pc config.ProviderConfig, defaultBase string, needsKey bool) (provider.LLMProvider, error) {
+		if needsKey && pc.APIKey == "" {
+			return nil, fmt.Errorf("no API key configured")
+		}
+		base := pc.APIBase
+		if base == "" {
+			base = defaultBase
+		}
+		return provider.NewOpenAIProvider(pc.APIKey, base, model), nil
+	}
+
+	switch strings.ToLower(name) {
+	case "anthropic":
+		if p.Anthropic.APIKey == "" {
+			return nil, fmt.Errorf("no API key configured")
+		}
+		return provider.NewAnthropicProvider(p.Anthropic.APIKey, p.Anthropic.APIBase, model), nil
+	case "openai":
+		return compatible(p.OpenAI, "https://api.openai.com/v1", true)
+	case "openrouter":
+		return compatible(p.OpenRouter, "https://openrouter.ai/api/v1", true)
+	case "deepseek":
+		return compatible(p.DeepSeek, "https://api.deepseek.com/v1", true)
+	case "groq":
+		return compatible(p.Groq, "https://api.groq.com/openai/v1", true)
+	case "gemini":
+		return compatible(p.Gemini, "https://generativelanguage.googleapis.com/v1beta/openai", true)
+	case "vllm":
+		return compatible(p.VLLM, "http://localhost:8000/v1", false)
+	default:
+		return nil, fmt.Errorf("unknown provider %q", name)
+	}
+}
+
+// useAnthropic reports whether the configured model should be served by the
+// native Anthropic provider.
+func useAnthropic(cfg *config.Config) bool {
+	if cfg.Providers.Anthropic.APIKey == "" {
+		return false
+	}
+	model := strings.ToLower(cfg.Model.Name)
+	return strings.HasPrefix(model, "anthropic/") || strings.HasPrefix(model, "claude")
+}
+
+// hasProviderKey reports whether any API key for the active provider is set,
+// or a replay cassette makes keys unnecessary.
+func hasProviderKey(cfg *config.Config) bool {
+	if replayCassette != "" {
+		return true
+	}
+	for _, entry := range cfg.Providers.Failover.Chain {
+		if _, err := newNamedProvider(cfg, entry.Provider, entry.Model); err == nil {
+			return true
+		}
+	}
+	if useAnthropic(cfg) {
+		return true
+	}
+	return cfg.Providers.OpenAI.APIKey != ""
+}
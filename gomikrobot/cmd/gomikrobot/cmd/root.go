@@ -42,4 +42,6 @@ func init() {
 	rootCmd.AddCommand(gatewayCmd)
 	rootCmd.AddCommand(groupCmd)
 	rootCmd.AddCommand(ksharkCmd)
+	rootCmd.AddCommand(evalCmd)
+	rootCmd.AddCommand(mcpCmd)
 }
@@ -5,9 +5,12 @@ import (
 	"os"
 
 	"github.com/kamir/gomikrobot/cmd/gomikrobot/cmd"
+	"github.com/kamir/gomikrobot/internal/sandbox"
 )
 
 func main() {
+	// Sandboxed exec commands start as this binary; Init takes over there.
+	sandbox.Init()
 	if err := cmd.Execute(); err != nil {
 		os.Exit(1)
 	}
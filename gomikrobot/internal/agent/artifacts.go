@@ -0,0 +1,120 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/kamir/gomikrobot/internal/provider"
+	"github.com/kamir/gomikrobot/internal/timeline"
+	"github.com/kamir/gomikrobot/internal/tools"
+)
+
+// defaultToolOutputChars is the tool result size above which the output is
+// spilled to an artifact when not configured.
+const defaultToolOutputChars = 16000
+
+// Lines of a spilled output shown to the model.
+const (
+	previewHeadLines = 40
+	previewTailLines = 20
+)
+
+// artifactsDir returns the scratch directory for tool outputs.
+func artifactsDir(workspace string) string {
+	if strings.HasPrefix(workspace, "~") {
+		home, _ := os.UserHomeDir()
+		workspace = filepath.Join(home, workspace[1:])
+	}
+	return filepath.Join(workspace, "artifacts")
+}
+
+// spillToolOutput saves a tool result longer than the configured limit as
+// an artifact and returns a head/tail preview with its handle in place of
+// the result, plus the artifact ID. Shorter results, and the output of
+// read_artifact itself (whose pages are cut at the same limit), are
+// returned unchanged. If saving fails the result is cut at the limit.
+func (l *Loop) spillToolOutput(rs *requestState, toolName, result string) (string, string) {
+	limit := l.outputLimit()
+	if len(result) <= limit || toolName == "read_artifact" || l.artifacts == nil {
+		return result, ""
+	}
+
+	id, err := l.saveArtifact(rs, toolName, result)
+	if err != nil {
+		slog.Warn("Failed to save tool output artifact", "tool", toolName, "error", err)
+		return result[:limit] + fmt.Sprintf("\n[output cut at %d of %d characters]", limit, len(result)), ""
+	}
+	slog.Info("Tool output saved as artifact", "tool", toolName, "artifact", id, "chars", len(result))
+	return tools.Preview(toolName, id, result, previewHeadLines, previewTailLines), id
+}
+
+// spillAttachments replaces text-like attachments of msg longer than the
+// tool output limit with a preview of an artifact holding them, so the
+// model reads them with read_artifact like a large tool result. Attachments
+// that cannot be saved are left to the provider, which cuts them.
+func (l *Loop) spillAttachments(rs *requestState, msg *provider.Message) {
+	if l.artifacts == nil {
+		return
+	}
+	for i, part := range msg.Parts {
+		if part.Type != provider.PartFile || !part.IsTextLike() {
+			continue
+		}
+		data, err := part.Bytes()
+		if err != nil || len(data) <= l.outputLimit() {
+			continue
+		}
+		source := "attachment " + part.Name
+		id, err := l.saveArtifact(rs, source, string(data))
+		if err != nil {
+			slog.Warn("Failed to save attachment artifact", "attachment", part.Name, "error", err)
+			continue
+		}
+		slog.Info("Attachment saved as artifact", "attachment", part.Name, "artifact", id, "chars", len(data))
+		msg.Parts[i] = provider.TextPart(tools.Preview(source, id, string(data), previewHeadLines, previewTailLines))
+	}
+}
+
+func (l *Loop) outputLimit() int {
+	if l.toolOutputChars > 0 {
+		return l.toolOutputChars
+	}
+	return defaultToolOutputChars
+}
+
+// saveArtifact stores content from source (a tool or attachment) and
+// records an ARTIFACT event in the trace.
+func (l *Loop) saveArtifact(rs *requestState, source, content string) (string, error) {
+	id, path, err := l.artifacts.Save(content)
+	if err != nil {
+		return "", err
+	}
+	if l.timeline != nil && rs.TraceID != "" {
+		meta, _ := json.Marshal(map[string]any{
+			"artifact_id": id,
+			"path":        path,
+			"tool":        source,
+			"task_id":     rs.TaskID,
+			"chars":       len(content),
+			"lines":       strings.Count(content, "\n") + 1,
+		})
+		_ = l.timeline.AddEvent(&timeline.TimelineEvent{
+			EventID:        fmt.Sprintf("ARTIFACT_%s_%s", rs.TraceID, id),
+			TraceID:        rs.TraceID,
+			Timestamp:      time.Now(),
+			SenderID:       "AGENT",
+			SenderName:     "Tool",
+			EventType:      "SYSTEM",
+			ContentText:    fmt.Sprintf("artifact=%s tool=%s chars=%d", id, source, len(content)),
+			Classification: "ARTIFACT",
+			Authorized:     true,
+			Metadata:       string(meta),
+		})
+	}
+	return id, nil
+}
@@ -0,0 +1,110 @@
+package agent
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kamir/gomikrobot/internal/provider"
+	"github.com/kamir/gomikrobot/internal/timeline"
+	"github.com/kamir/gomikrobot/internal/tools"
+)
+
+// bigOutputTool returns a fixed, large result.
+type bigOutputTool struct{ out string }
+
+func (t *bigOutputTool) Name() string               { return "big_output" }
+func (t *bigOutputTool) Description() string        { return "test tool" }
+func (t *bigOutputTool) Parameters() map[string]any { return map[string]any{"type": "object"} }
+func (t *bigOutputTool) Execute(context.Context, map[string]any) (string, error) {
+	return t.out, nil
+}
+
+func TestLargeToolOutputIsSpilledToArtifact(t *testing.T) {
+	tl := newTestTimeline(t)
+	tmpDir := t.TempDir()
+	loop := NewLoop(LoopOptions{
+		Provider:        &mockProvider{},
+		Timeline:        tl,
+		Workspace:       tmpDir,
+		WorkRepo:        tmpDir,
+		ToolOutputChars: 1000,
+	})
+	var sb strings.Builder
+	for i := 0; i < 400; i++ {
+		sb.WriteString("commit abcdef some message\n")
+	}
+	sb.WriteString("NEEDLE in the last line")
+	loop.registry.Register(&bigOutputTool{out: sb.String()})
+
+	ctx := withRequest(context.Background(), &requestState{TraceID: "trace-artifact-001"})
+	result := loop.executeToolCall(ctx, provider.ToolCall{ID: "b1", Name: "big_output"})
+	if len(result) > 4000 || !strings.Contains(result, "read_artifact") || !strings.Contains(result, "NEEDLE") {
+		t.Fatalf("expected a short preview with handle and tail, got %d chars:\n%s", len(result), result)
+	}
+
+	events, err := tl.GetEvents(timeline.FilterArgs{TraceID: "trace-artifact-001", Limit: 10})
+	if err != nil {
+		t.Fatalf("get events: %v", err)
+	}
+	var id string
+	for _, ev := range events {
+		if ev.Classification == "ARTIFACT" {
+			id = strings.TrimPrefix(strings.Fields(ev.ContentText)[0], "artifact=")
+		}
+	}
+	if id == "" || !strings.Contains(result, id) {
+		t.Fatalf("expected an ARTIFACT event linked to the trace, got id %q", id)
+	}
+
+	// The full output is readable through read_artifact, which is never spilled.
+	page := loop.executeToolCall(ctx, provider.ToolCall{ID: "r1", Name: "read_artifact",
+		Arguments: map[string]any{"id": id, "pattern": "NEEDLE"}})
+	if page != "401: NEEDLE in the last line" {
+		t.Fatalf("unexpected read_artifact result %q", page)
+	}
+	if short := loop.executeToolCall(ctx, provider.ToolCall{ID: "r2", Name: "read_artifact",
+		Arguments: map[string]any{"id": id, "limit": float64(1000)}}); strings.Contains(short, "saved as artifact") {
+		t.Fatal("read_artifact output must not be spilled again")
+	}
+	if tool, ok := loop.registry.Get("read_artifact"); !ok || tools.ToolTier(tool) != tools.TierReadOnly {
+		t.Fatal("read_artifact should be registered as a read-only tool")
+	}
+}
+
+func TestLargeTextAttachmentIsSpilledToArtifact(t *testing.T) {
+	tmpDir := t.TempDir()
+	loop := NewLoop(LoopOptions{
+		Provider:        &mockProvider{},
+		Workspace:       tmpDir,
+		WorkRepo:        tmpDir,
+		ToolOutputChars: 1000,
+	})
+	path := filepath.Join(tmpDir, "server.log")
+	if err := os.WriteFile(path, []byte(strings.Repeat("GET /health 200\n", 500)+"PANIC at the end"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	small := filepath.Join(tmpDir, "note.txt")
+	if err := os.WriteFile(small, []byte("short note"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	msg := provider.Message{Role: "user", Content: "what happened?"}
+	for _, p := range []string{path, small} {
+		part, err := provider.MediaPart(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		msg.Parts = append(msg.Parts, part)
+	}
+
+	loop.spillAttachments(&requestState{}, &msg)
+	if msg.Parts[0].Type != provider.PartText || !strings.Contains(msg.Parts[0].Text, "read_artifact") ||
+		!strings.Contains(msg.Parts[0].Text, "PANIC at the end") || len(msg.Parts[0].Text) > 4000 {
+		t.Fatalf("expected a preview of the log, got %+v", msg.Parts[0])
+	}
+	if msg.Parts[1].Type != provider.PartFile {
+		t.Errorf("small attachment must stay inline, got %+v", msg.Parts[1])
+	}
+}
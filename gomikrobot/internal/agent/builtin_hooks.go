@@ -0,0 +1,338 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/kamir/gomikrobot/internal/policy"
+	"github.com/kamir/gomikrobot/internal/timeline"
+)
+
+// ragHook adds relevant semantic memory to the system prompt of the first
+// LLM call of a turn.
+type ragHook struct {
+	NopHook
+	l *Loop
+}
+
+func (h *ragHook) BeforeLLM(ctx context.Context, call *LLMCall) error {
+	if call.Iteration > 0 || h.l.memoryService == nil {
+		return nil
+	}
+	msgs := call.Request.Messages
+	for i := len(msgs) - 1; i >= 0; i-- {
+		if msgs[i].Role == "user" {
+			call.Request.Messages = h.l.injectRAGContext(ctx, msgs, msgs[i].Content)
+			break
+		}
+	}
+	return nil
+}
+
+// quotaHook enforces the daily token quota and the spend budgets before
+// each LLM call (H-014). A soft-budget warning is appended to the reply.
+type quotaHook struct {
+	NopHook
+	l *Loop
+}
+
+func (h *quotaHook) BeforeLLM(ctx context.Context, call *LLMCall) error {
+	note, err := h.l.checkTokenQuota(ctx)
+	if err != nil {
+		return err
+	}
+	if note != "" {
+		requestFrom(ctx).budgetNote = note
+	}
+	return nil
+}
+
+func (h *quotaHook) OnFinalResponse(ctx context.Context, resp *FinalResponse) {
+	if note := requestFrom(ctx).budgetNote; note != "" && resp.Reason == FinishComplete {
+		resp.Content += "\n\n" + note
+	}
+}
+
+// policyHook checks each tool call against the profile and the policy
+// engine, asking for approval where required (H-011).
+type policyHook struct {
+	NopHook
+	l *Loop
+}
+
+func (h *policyHook) BeforeTool(ctx context.Context, exec *ToolExecution) error {
+	l := h.l
+	tier, decision := l.toolPolicy(ctx, exec.Call.Name, exec.Call.Arguments)
+	if l.policy != nil {
+		h.publishAudit(exec, tier, decision)
+	}
+	if denied, reason := l.enforcePolicy(ctx, exec.Call.Name, tier, exec.Call.Arguments, decision); denied {
+		slog.Warn("Tool denied by policy", "tool", exec.Call.Name, "reason", reason)
+		return fmt.Errorf("Policy denied: %s", reason)
+	}
+	return nil
+}
+
+// publishAudit publishes the decision as an audit event to the group.
+func (h *policyHook) publishAudit(exec *ToolExecution, tier int, decision policy.Decision) {
+	l := h.l
+	if l.groupPublisher == nil || !l.groupPublisher.Active() || exec.TraceID == "" {
+		return
+	}
+	action := "ALLOW"
+	if !decision.Allow {
+		action = "DENY"
+	}
+	detail := fmt.Sprintf("tool=%s tier=%d sender=%s action=%s reason=%s", exec.Call.Name, tier, exec.Sender, action, decision.Reason)
+	traceID := exec.TraceID
+	go func() {
+		pubCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		_ = l.groupPublisher.PublishAudit(pubCtx, "policy_decision", traceID, detail)
+	}()
+}
+
+// usageHook records token usage and cost of each LLM call (H-013) and
+// counts the tokens against a sub-agent's budget.
+type usageHook struct {
+	NopHook
+	l *Loop
+}
+
+func (h *usageHook) AfterLLM(ctx context.Context, call *LLMCall) {
+	call.Cost = h.l.trackTokens(ctx, call.Response)
+	if h.l.tokenBudget > 0 {
+		h.l.tokensUsed += call.Response.Usage.TotalTokens
+	}
+}
+
+// artifactHook replaces large tool results with a preview and saves the
+// full output as an artifact (see artifacts.go).
+type artifactHook struct {
+	NopHook
+	l *Loop
+}
+
+func (h *artifactHook) AfterTool(ctx context.Context, exec *ToolExecution) {
+	result, id := h.l.spillToolOutput(requestFrom(ctx), exec.Call.Name, exec.Result)
+	if id != "" {
+		exec.Result = result
+		exec.Meta["artifact_id"] = id
+	}
+}
+
+// traceHook logs LLM and tool spans to the timeline for end-to-end trace
+// visibility.
+type traceHook struct {
+	NopHook
+	l *Loop
+}
+
+func (h *traceHook) AfterLLM(ctx context.Context, call *LLMCall) {
+	l := h.l
+	if l.timeline == nil || call.TraceID == "" {
+		return
+	}
+	req, resp := call.Request, call.Response
+
+	// Build rich metadata for LLM span
+	llmMeta := map[string]any{
+		"model":             req.Model,
+		"temperature":       req.Temperature,
+		"max_tokens":        req.MaxTokens,
+		"duration_ms":       call.Duration.Milliseconds(),
+		"finish_reason":     resp.FinishReason,
+		"prompt_tokens":     resp.Usage.PromptTokens,
+		"completion_tokens": resp.Usage.CompletionTokens,
+		"total_tokens":      resp.Usage.TotalTokens,
+		"cached_tokens":     resp.Usage.CachedTokens,
+		"cost_usd":          call.Cost,
+		"response_text":     truncateStr(resp.Content, 10240),
+		"message_count":     len(req.Messages),
+	}
+	if call.Agent != "" {
+		llmMeta["agent"] = call.Agent
+	}
+	if call.Profile != "" {
+		llmMeta["profile"] = call.Profile
+	}
+	// Backend that actually served the call (failover chains)
+	if resp.Provider != "" {
+		llmMeta["provider"] = resp.Provider
+		llmMeta["served_model"] = resp.Model
+	}
+	// System prompt preview (first message if role=system)
+	if len(req.Messages) > 0 && req.Messages[0].Role == "system" {
+		llmMeta["system_prompt"] = truncateStr(req.Messages[0].Content, 2048)
+	}
+	// Last user message
+	for j := len(req.Messages) - 1; j >= 0; j-- {
+		if req.Messages[j].Role == "user" {
+			llmMeta["last_user_message"] = truncateStr(req.Messages[j].Content, 2048)
+			if n := len(req.Messages[j].Parts); n > 0 {
+				llmMeta["attachments"] = n
+			}
+			break
+		}
+	}
+	// Tool calls requested
+	if len(resp.ToolCalls) > 0 {
+		tcList := make([]map[string]any, len(resp.ToolCalls))
+		for ti, tc := range resp.ToolCalls {
+			tcList[ti] = map[string]any{
+				"name":      tc.Name,
+				"arguments": tc.Arguments,
+			}
+		}
+		llmMeta["tool_calls"] = tcList
+	}
+	llmMetaJSON, _ := json.Marshal(llmMeta)
+
+	_ = l.timeline.AddEvent(&timeline.TimelineEvent{
+		EventID:        fmt.Sprintf("LLM_%s_%d_%d", call.TraceID, call.Iteration, time.Now().UnixNano()),
+		TraceID:        call.TraceID,
+		Timestamp:      call.Started,
+		SenderID:       "AGENT",
+		SenderName:     "LLM",
+		EventType:      "SYSTEM",
+		ContentText:    llmSpanContent(call),
+		Classification: "LLM",
+		Authorized:     true,
+		Metadata:       string(llmMetaJSON),
+	})
+}
+
+func (h *traceHook) AfterTool(ctx context.Context, exec *ToolExecution) {
+	l := h.l
+	if l.timeline == nil || exec.TraceID == "" {
+		return
+	}
+	// Build rich metadata for TOOL span
+	toolMeta := map[string]any{
+		"tool_name":    exec.Call.Name,
+		"tool_call_id": exec.Call.ID,
+		"arguments":    exec.Call.Arguments,
+		"duration_ms":  exec.Duration.Milliseconds(),
+		"result":       truncateStr(exec.Result, 10240),
+	}
+	for k, v := range exec.Meta {
+		toolMeta[k] = v
+	}
+	if exec.Agent != "" {
+		toolMeta["agent"] = exec.Agent
+	}
+	if exec.Err != nil {
+		toolMeta["error"] = exec.Err.Error()
+	}
+	toolMetaJSON, _ := json.Marshal(toolMeta)
+
+	_ = l.timeline.AddEvent(&timeline.TimelineEvent{
+		EventID:        fmt.Sprintf("TOOL_%s_%s_%d", exec.TraceID, exec.Call.Name, time.Now().UnixNano()),
+		TraceID:        exec.TraceID,
+		Timestamp:      exec.Started,
+		SenderID:       "AGENT",
+		SenderName:     "Tool",
+		EventType:      "SYSTEM",
+		ContentText:    toolSpanContent(exec),
+		Classification: "TOOL",
+		Authorized:     true,
+		Metadata:       string(toolMetaJSON),
+	})
+}
+
+// groupTraceHook publishes LLM, tool and task spans to the group traces
+// topic.
+type groupTraceHook struct {
+	NopHook
+	l *Loop
+}
+
+func (h *groupTraceHook) active(traceID string) bool {
+	return h.l.groupPublisher != nil && h.l.groupPublisher.Active() && traceID != ""
+}
+
+func (h *groupTraceHook) AfterLLM(ctx context.Context, call *LLMCall) {
+	if h.active(call.TraceID) {
+		h.publishSpan(call.TraceID, "LLM", fmt.Sprintf("LLM call: %s", call.Request.Model), llmSpanContent(call), call.Duration)
+	}
+}
+
+func (h *groupTraceHook) AfterTool(ctx context.Context, exec *ToolExecution) {
+	if h.active(exec.TraceID) {
+		h.publishSpan(exec.TraceID, "TOOL", fmt.Sprintf("Tool: %s", exec.Call.Name), toolSpanContent(exec), exec.Duration)
+	}
+}
+
+// OnFinalResponse publishes the reply as the TASK span. A sub-agent's
+// reply is part of its parent's task.
+func (h *groupTraceHook) OnFinalResponse(ctx context.Context, resp *FinalResponse) {
+	if resp.Agent != "" || !h.active(resp.TraceID) {
+		return
+	}
+	h.publish(map[string]string{
+		"trace_id":  resp.TraceID,
+		"span_type": "TASK",
+		"title":     fmt.Sprintf("Task from %s via %s", resp.Sender, resp.Channel),
+		"content":   resp.Content,
+	})
+}
+
+func (h *groupTraceHook) publishSpan(traceID, spanType, title, content string, dur time.Duration) {
+	now := time.Now()
+	h.publish(map[string]string{
+		"trace_id":    traceID,
+		"span_type":   spanType,
+		"title":       title,
+		"content":     content,
+		"started_at":  now.Add(-dur).Format(time.RFC3339),
+		"ended_at":    now.Format(time.RFC3339),
+		"duration_ms": fmt.Sprintf("%d", dur.Milliseconds()),
+	})
+}
+
+func (h *groupTraceHook) publish(payload map[string]string) {
+	go func() {
+		pubCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		_ = h.l.groupPublisher.PublishTrace(pubCtx, payload)
+	}()
+}
+
+// llmSpanContent is the one-line summary of an LLM span.
+func llmSpanContent(call *LLMCall) string {
+	resp := call.Response
+	content := fmt.Sprintf("model=%s tokens=%d duration=%dms", call.Request.Model, resp.Usage.TotalTokens, call.Duration.Milliseconds())
+	if len(resp.ToolCalls) > 0 {
+		names := make([]string, len(resp.ToolCalls))
+		for ti, tc := range resp.ToolCalls {
+			names[ti] = tc.Name
+		}
+		content += fmt.Sprintf(" → tools: %s", strings.Join(names, ", "))
+	}
+	if resp.Provider != "" {
+		content += fmt.Sprintf(" served_by=%s/%s", resp.Provider, resp.Model)
+	}
+	if call.Cost > 0 {
+		content += fmt.Sprintf(" cost=$%.4f", call.Cost)
+	}
+	if call.Agent != "" {
+		content = call.Agent + ": " + content
+	}
+	return content
+}
+
+// toolSpanContent is the one-line summary of a tool span.
+func toolSpanContent(exec *ToolExecution) string {
+	content := fmt.Sprintf("tool=%s duration=%dms result_len=%d", exec.Call.Name, exec.Duration.Milliseconds(), exec.OutputChars)
+	if id, ok := exec.Meta["artifact_id"].(string); ok {
+		content += " artifact=" + id
+	}
+	if exec.Agent != "" {
+		content = exec.Agent + ": " + content
+	}
+	return content
+}
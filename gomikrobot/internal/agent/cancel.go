@@ -0,0 +1,136 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/kamir/gomikrobot/internal/timeline"
+)
+
+// errTaskCancelled is the cancel cause of a task stopped by the user.
+var errTaskCancelled = errors.New("task cancelled")
+
+// taskCancelled reports whether ctx was cancelled by a stop command or the
+// API, as opposed to a deadline or shutdown.
+func taskCancelled(ctx context.Context) bool {
+	return errors.Is(context.Cause(ctx), errTaskCancelled)
+}
+
+// inflightTask is a message being processed, registered so that a stop
+// command or the API can cancel it.
+type inflightTask struct {
+	taskID string
+	sender string
+	cancel context.CancelCauseFunc
+}
+
+// cancelCommands are the chat messages that stop the running task.
+var cancelCommands = map[string]bool{
+	"stop":      true,
+	"cancel":    true,
+	"/stop":     true,
+	"/cancel":   true,
+	"stopp":     true,
+	"abbrechen": true,
+}
+
+// parseCancelCommand reports whether a message asks to stop the task that
+// is running in its chat.
+func parseCancelCommand(content string) bool {
+	return cancelCommands[strings.ToLower(strings.TrimSpace(content))]
+}
+
+// trackInflight registers the task running for sessionKey and returns a
+// function that removes it again.
+func (l *Loop) trackInflight(sessionKey string, t *inflightTask) func() {
+	l.inflightMu.Lock()
+	l.inflight[sessionKey] = t
+	l.inflightMu.Unlock()
+	return func() {
+		l.inflightMu.Lock()
+		if l.inflight[sessionKey] == t {
+			delete(l.inflight, sessionKey)
+		}
+		l.inflightMu.Unlock()
+	}
+}
+
+// cancelSession cancels the task running for sessionKey on behalf of
+// sender. Only the task's own sender or an internal message may cancel it.
+// It returns the task ID and whether a task was cancelled.
+func (l *Loop) cancelSession(sessionKey, sender string, internal bool) (string, bool) {
+	l.inflightMu.Lock()
+	t, ok := l.inflight[sessionKey]
+	l.inflightMu.Unlock()
+	if !ok || (!internal && t.sender != sender) {
+		return "", false
+	}
+	t.cancel(errTaskCancelled)
+	return t.taskID, true
+}
+
+// CancelTask cancels the in-flight task with the given ID: its context is
+// cancelled, which stops LLM calls, approval waits and running exec
+// commands. It returns false if the task is not running.
+func (l *Loop) CancelTask(taskID string) bool {
+	if taskID == "" {
+		return false
+	}
+	l.inflightMu.Lock()
+	var found *inflightTask
+	for _, t := range l.inflight {
+		if t.taskID == taskID {
+			found = t
+			break
+		}
+	}
+	l.inflightMu.Unlock()
+	if found == nil {
+		return false
+	}
+	found.cancel(errTaskCancelled)
+	return true
+}
+
+// cancelledResponse tells the user that the task was stopped and which
+// tool calls had already run.
+func cancelledResponse(rs *requestState) string {
+	steps := rs.doneSteps()
+	if len(steps) == 0 {
+		return "🛑 Task cancelled. No tools had run yet."
+	}
+	var sb strings.Builder
+	sb.WriteString("🛑 Task cancelled. Already done:\n")
+	for _, s := range steps {
+		sb.WriteString("- " + s + "\n")
+	}
+	return strings.TrimRight(sb.String(), "\n")
+}
+
+// cancelEvent records the cancellation in the trace.
+func (l *Loop) cancelEvent(rs *requestState) {
+	if l.timeline == nil || rs.TraceID == "" {
+		return
+	}
+	steps := rs.doneSteps()
+	meta, _ := json.Marshal(map[string]any{
+		"task_id":    rs.TaskID,
+		"done_steps": steps,
+	})
+	_ = l.timeline.AddEvent(&timeline.TimelineEvent{
+		EventID:        fmt.Sprintf("CANCEL_%s_%d", rs.TraceID, time.Now().UnixNano()),
+		TraceID:        rs.TraceID,
+		Timestamp:      time.Now(),
+		SenderID:       "AGENT",
+		SenderName:     "Loop",
+		EventType:      "SYSTEM",
+		ContentText:    fmt.Sprintf("task cancelled after %d tool calls", len(steps)),
+		Classification: "CANCELLED",
+		Authorized:     true,
+		Metadata:       string(meta),
+	})
+}
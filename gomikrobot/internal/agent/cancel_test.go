@@ -0,0 +1,193 @@
+package agent
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kamir/gomikrobot/internal/bus"
+	"github.com/kamir/gomikrobot/internal/provider"
+	"github.com/kamir/gomikrobot/internal/timeline"
+	"github.com/kamir/gomikrobot/internal/tools"
+)
+
+// hangingProvider requests one tool call, then blocks until the request
+// context is cancelled.
+type hangingProvider struct {
+	mockProvider
+	mu      sync.Mutex
+	n       int
+	blocked chan struct{}
+}
+
+func (p *hangingProvider) Chat(ctx context.Context, req *provider.ChatRequest) (*provider.ChatResponse, error) {
+	p.mu.Lock()
+	p.n++
+	n := p.n
+	p.mu.Unlock()
+	if n == 1 {
+		return &provider.ChatResponse{
+			ToolCalls: []provider.ToolCall{{ID: "c1", Name: "probe_read", Arguments: map[string]any{"id": "a"}}},
+			Usage:     provider.Usage{TotalTokens: 1},
+		}, nil
+	}
+	close(p.blocked)
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestParseCancelCommand(t *testing.T) {
+	for _, in := range []string{"stop", " Stop ", "/cancel", "abbrechen"} {
+		if !parseCancelCommand(in) {
+			t.Errorf("expected %q to be a cancel command", in)
+		}
+	}
+	for _, in := range []string{"stop the music", "cancel my meeting", ""} {
+		if parseCancelCommand(in) {
+			t.Errorf("expected %q not to be a cancel command", in)
+		}
+	}
+}
+
+func TestStopCommandCancelsRunningTask(t *testing.T) {
+	msgBus := bus.NewMessageBus()
+	tl := newTestTimeline(t)
+	tmpDir := t.TempDir()
+	prov := &hangingProvider{blocked: make(chan struct{})}
+	loop := NewLoop(LoopOptions{
+		Bus:       msgBus,
+		Provider:  prov,
+		Timeline:  tl,
+		Workspace: tmpDir,
+		WorkRepo:  tmpDir,
+		Model:     "mock-model",
+	})
+	var running, peak int32
+	var mu sync.Mutex
+	var order []string
+	loop.registry.Register(&probeTool{name: "probe_read", tier: tools.TierReadOnly,
+		running: &running, peak: &peak, mu: &mu, order: &order})
+
+	replies := make(chan *bus.OutboundMessage, 8)
+	msgBus.Subscribe("test", func(msg *bus.OutboundMessage) { replies <- msg })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	go msgBus.DispatchOutbound(ctx)
+	go func() { _ = loop.Run(ctx) }()
+
+	chatID := "cancel" + time.Now().Format("150405.000000")
+	t.Cleanup(func() { loop.sessions.Delete("test:" + chatID) })
+
+	if loop.CancelTask("no-such-task") {
+		t.Fatal("CancelTask should report false for unknown tasks")
+	}
+
+	msgBus.PublishInbound(&bus.InboundMessage{Channel: "test", SenderID: "u", ChatID: chatID,
+		Content: "do something long", Timestamp: time.Now()})
+	select {
+	case <-prov.blocked:
+	case <-time.After(3 * time.Second):
+		t.Fatal("provider was never called a second time")
+	}
+	// Another sender in the chat cannot stop u's task.
+	if _, ok := loop.cancelSession("test:"+chatID, "intruder", false); ok {
+		t.Fatal("a different external sender must not cancel the task")
+	}
+	msgBus.PublishInbound(&bus.InboundMessage{Channel: "test", SenderID: "u", ChatID: chatID,
+		Content: "stop", Timestamp: time.Now()})
+
+	var got []string
+	var taskID string
+	for len(got) < 2 {
+		select {
+		case msg := <-replies:
+			got = append(got, msg.Content)
+			if msg.TaskID != "" {
+				taskID = msg.TaskID
+			}
+		case <-time.After(3 * time.Second):
+			t.Fatalf("timed out waiting for replies, got %v", got)
+		}
+	}
+	if got[0] != "Cancelling the running task…" {
+		t.Fatalf("expected cancel acknowledgement first, got %q", got[0])
+	}
+	if !strings.Contains(got[1], "Task cancelled") || !strings.Contains(got[1], "probe_read") {
+		t.Fatalf("expected summary of done steps, got %q", got[1])
+	}
+
+	task, err := tl.GetTask(taskID)
+	if err != nil {
+		t.Fatalf("get task: %v", err)
+	}
+	if task.Status != timeline.TaskStatusCancelled {
+		t.Fatalf("expected status cancelled, got %s", task.Status)
+	}
+	if loop.CancelTask(taskID) {
+		t.Fatal("finished task should no longer be cancellable")
+	}
+}
+
+func TestStopWithoutRunningTaskIsAMessage(t *testing.T) {
+	msgBus := bus.NewMessageBus()
+	tmpDir := t.TempDir()
+	loop := NewLoop(LoopOptions{
+		Bus:       msgBus,
+		Provider:  &mockProvider{responses: []provider.ChatResponse{{Content: "Stopped the timer."}}},
+		Workspace: tmpDir,
+		WorkRepo:  tmpDir,
+		Model:     "mock-model",
+	})
+	replies := make(chan *bus.OutboundMessage, 4)
+	msgBus.Subscribe("test", func(msg *bus.OutboundMessage) { replies <- msg })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	go msgBus.DispatchOutbound(ctx)
+	go func() { _ = loop.Run(ctx) }()
+
+	chatID := "idle" + time.Now().Format("150405.000000")
+	t.Cleanup(func() { loop.sessions.Delete("test:" + chatID) })
+	msgBus.PublishInbound(&bus.InboundMessage{Channel: "test", SenderID: "u", ChatID: chatID,
+		Content: "stop", Timestamp: time.Now()})
+	select {
+	case msg := <-replies:
+		if msg.Content != "Stopped the timer." {
+			t.Fatalf("expected the stop message to reach the LLM, got %q", msg.Content)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("timed out waiting for the reply")
+	}
+}
+
+func TestRedeliveredCancelledMessageIsNotRerun(t *testing.T) {
+	tl := newTestTimeline(t)
+	mock := &mockProvider{}
+	loop := NewLoop(LoopOptions{
+		Provider:  mock,
+		Timeline:  tl,
+		Workspace: t.TempDir(),
+		Model:     "mock-model",
+	})
+	task, err := tl.CreateTask(&timeline.AgentTask{IdempotencyKey: "wa:msg-1", Channel: "test", ChatID: "u", SenderID: "u"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tl.UpdateTaskStatus(task.TaskID, timeline.TaskStatusCancelled, "🛑 Task cancelled.", "task cancelled"); err != nil {
+		t.Fatal(err)
+	}
+
+	resp, taskID, err := loop.processMessage(context.Background(), &bus.InboundMessage{
+		Channel: "test", SenderID: "u", ChatID: "u", TraceID: "trace-redelivered",
+		IdempotencyKey: "wa:msg-1", Content: "do something long", Timestamp: time.Now(),
+	})
+	if err != nil || taskID != task.TaskID || resp != "🛑 Task cancelled." {
+		t.Fatalf("expected the cancelled task's result, got %q %q %v", resp, taskID, err)
+	}
+	if mock.calls != 0 {
+		t.Errorf("redelivered message must not be processed again, got %d LLM calls", mock.calls)
+	}
+}
@@ -0,0 +1,119 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/kamir/gomikrobot/internal/provider"
+	"github.com/kamir/gomikrobot/internal/session"
+	"github.com/kamir/gomikrobot/internal/timeline"
+)
+
+// compactionPrompt instructs the model to fold older turns into the
+// rolling summary.
+const compactionPrompt = `You maintain the running summary of a chat between a user and an assistant.
+Merge the previous summary and the new messages into one updated summary.
+Keep facts, names, dates, decisions, open tasks and user preferences; drop greetings and small talk.
+Write in the language of the conversation, as compact bullet points, at most about 400 words.
+Reply with the summary only.`
+
+// compactSession summarizes the oldest uncompacted turns once the session
+// history exceeds the context builder's token budget. The newest turns
+// filling half the budget are kept verbatim; everything before them is
+// folded into the rolling summary in the session metadata. The raw
+// messages stay in the session file. Failures leave the session as it was.
+func (l *Loop) compactSession(ctx context.Context, sess *session.Session) {
+	rs := requestFrom(ctx)
+	summary, upTo := sess.Summary()
+	// The last message is the current user turn, which is never compacted.
+	pending := sess.MessagesFrom(upTo)
+	if len(pending) < 2 {
+		return
+	}
+	pending = pending[:len(pending)-1]
+
+	budget := l.contextBuilder.historyBudget()
+	total := 0
+	for _, m := range pending {
+		total += messageTokens(m)
+	}
+	if total <= budget {
+		return
+	}
+
+	// Keep the newest messages that fit in half the budget.
+	keep, used := 0, 0
+	for i := len(pending) - 1; i >= 0; i-- {
+		used += messageTokens(pending[i])
+		if used > budget/2 {
+			break
+		}
+		keep++
+	}
+	fold := pending[:len(pending)-keep]
+	if len(fold) == 0 {
+		return
+	}
+
+	var transcript strings.Builder
+	if summary != "" {
+		transcript.WriteString("Previous summary:\n" + summary + "\n\n")
+	}
+	transcript.WriteString("New messages:\n")
+	for _, m := range fold {
+		fmt.Fprintf(&transcript, "[%s] %s: %s\n", m.Timestamp.Format("2006-01-02 15:04"), m.Role, m.Content)
+	}
+
+	start := time.Now()
+	resp, err := l.provider.Chat(ctx, &provider.ChatRequest{
+		Messages: []provider.Message{
+			{Role: "system", Content: compactionPrompt},
+			{Role: "user", Content: transcript.String()},
+		},
+		Model:       l.requestModel(rs),
+		MaxTokens:   1024,
+		Temperature: 0.2,
+	})
+	if err != nil {
+		slog.Warn("Session compaction failed", "session", sess.Key, "error", err)
+		return
+	}
+	newSummary := strings.TrimSpace(resp.Content)
+	if newSummary == "" {
+		return
+	}
+	cost := l.trackTokens(ctx, resp)
+
+	sess.SetSummary(newSummary, upTo+len(fold))
+	slog.Info("Session compacted", "session", sess.Key, "messages", len(fold),
+		"covered", upTo+len(fold), "tokens_before", total, "summary_tokens", estimateTokens(newSummary))
+
+	if l.timeline != nil && rs.TraceID != "" {
+		meta, _ := json.Marshal(map[string]any{
+			"session":         sess.Key,
+			"folded_messages": len(fold),
+			"covered":         upTo + len(fold),
+			"history_tokens":  total,
+			"budget_tokens":   budget,
+			"summary":         truncateStr(newSummary, 4096),
+			"total_tokens":    resp.Usage.TotalTokens,
+			"cost_usd":        cost,
+		})
+		_ = l.timeline.AddEvent(&timeline.TimelineEvent{
+			EventID:        fmt.Sprintf("COMPACT_%s_%d", rs.TraceID, time.Now().UnixNano()),
+			TraceID:        rs.TraceID,
+			Timestamp:      start,
+			SenderID:       "AGENT",
+			SenderName:     "LLM",
+			EventType:      "SYSTEM",
+			ContentText:    fmt.Sprintf("compacted %d messages into summary (history ~%d tokens, budget %d)", len(fold), total, budget),
+			Classification: "COMPACTION",
+			Authorized:     true,
+			Metadata:       string(meta),
+		})
+	}
+}
@@ -0,0 +1,103 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kamir/gomikrobot/internal/provider"
+)
+
+// recordingProvider returns scripted answers and keeps every request.
+type recordingProvider struct {
+	mockProvider
+	requests []*provider.ChatRequest
+}
+
+func (r *recordingProvider) Chat(ctx context.Context, req *provider.ChatRequest) (*provider.ChatResponse, error) {
+	r.requests = append(r.requests, req)
+	return r.mockProvider.Chat(ctx, req)
+}
+
+func TestCompactSessionFoldsOldTurns(t *testing.T) {
+	tmpDir := t.TempDir()
+	prov := &recordingProvider{mockProvider: mockProvider{responses: []provider.ChatResponse{
+		{Content: "- User asked twenty questions about plants", Usage: provider.Usage{TotalTokens: 50}},
+		{Content: "Here you go", Usage: provider.Usage{TotalTokens: 20}},
+	}}}
+	loop := NewLoop(LoopOptions{
+		Provider:      prov,
+		Workspace:     tmpDir,
+		WorkRepo:      tmpDir,
+		Model:         "mock-model",
+		HistoryTokens: 300,
+	})
+
+	key := fmt.Sprintf("test:compact-%d", time.Now().UnixNano())
+	sess := loop.sessions.GetOrCreate(key)
+	t.Cleanup(func() { loop.sessions.Delete(key) })
+	for i := 0; i < 20; i++ {
+		sess.AddMessage("user", fmt.Sprintf("question %d: %s", i, strings.Repeat("leaf ", 20)))
+	}
+
+	resp, err := loop.ProcessDirect(context.Background(), "what did I ask first?", key)
+	if err != nil {
+		t.Fatalf("ProcessDirect: %v", err)
+	}
+	if resp != "Here you go" {
+		t.Fatalf("unexpected response %q", resp)
+	}
+
+	summary, upTo := sess.Summary()
+	if summary != "- User asked twenty questions about plants" {
+		t.Fatalf("unexpected summary %q", summary)
+	}
+	if upTo == 0 || upTo >= 20 {
+		t.Fatalf("expected part of the history to be summarized, upTo=%d", upTo)
+	}
+	if len(sess.Messages) != 22 {
+		t.Fatalf("raw history must be kept, got %d messages", len(sess.Messages))
+	}
+
+	if len(prov.requests) != 2 {
+		t.Fatalf("expected summary call and answer call, got %d", len(prov.requests))
+	}
+	if !strings.Contains(prov.requests[0].Messages[1].Content, "question 0:") {
+		t.Fatal("summary request should contain the oldest turn")
+	}
+	if strings.Contains(prov.requests[0].Messages[1].Content, "what did I ask first?") {
+		t.Fatal("the current message must not be summarized")
+	}
+	answer := prov.requests[1].Messages
+	if !strings.Contains(answer[0].Content, "twenty questions about plants") {
+		t.Fatal("answer request should carry the summary in the system prompt")
+	}
+	for _, m := range answer[1:] {
+		if strings.HasPrefix(m.Content, "question 0:") {
+			t.Fatal("summarized turns should not be sent verbatim")
+		}
+	}
+}
+
+func TestCompactSessionUnderBudgetIsNoop(t *testing.T) {
+	tmpDir := t.TempDir()
+	prov := &recordingProvider{}
+	loop := NewLoop(LoopOptions{Provider: prov, Workspace: tmpDir, WorkRepo: tmpDir})
+
+	key := fmt.Sprintf("test:nocompact-%d", time.Now().UnixNano())
+	sess := loop.sessions.GetOrCreate(key)
+	t.Cleanup(func() { loop.sessions.Delete(key) })
+	sess.AddMessage("user", "hi")
+	sess.AddMessage("assistant", "hello")
+	sess.AddMessage("user", "how are you?")
+
+	loop.compactSession(context.Background(), sess)
+	if len(prov.requests) != 0 {
+		t.Fatalf("expected no summary call, got %d", len(prov.requests))
+	}
+	if summary, upTo := sess.Summary(); summary != "" || upTo != 0 {
+		t.Fatalf("expected no summary, got %q/%d", summary, upTo)
+	}
+}
@@ -28,6 +28,34 @@ type ContextBuilder struct {
 	workRepo  string
 	systemRepo string
 	registry  *tools.Registry
+	// historyTokens is the estimated token budget for session history.
+	historyTokens int
+	// bootstrap overrides bootstrapFiles and allowTool filters the listed
+	// tools; both are set per agent profile (see forProfile).
+	bootstrap []string
+	allowTool func(name string) bool
+}
+
+// defaultHistoryTokens is the history budget when none is configured.
+const defaultHistoryTokens = 12000
+
+// estimateTokens approximates the token count of a text (about four
+// characters per token for English and German prose).
+func estimateTokens(text string) int {
+	return len(text)/4 + 1
+}
+
+// messageTokens estimates a history message including role overhead.
+func messageTokens(msg session.Message) int {
+	return estimateTokens(msg.Content) + 4
+}
+
+// historyBudget returns the configured or default history token budget.
+func (b *ContextBuilder) historyBudget() int {
+	if b.historyTokens > 0 {
+		return b.historyTokens
+	}
+	return defaultHistoryTokens
 }
 
 // NewContextBuilder creates a new ContextBuilder.
@@ -40,6 +68,20 @@ func NewContextBuilder(workspace string, workRepo string, systemRepo string, reg
 	}
 }
 
+// forProfile returns a builder that loads the profile's bootstrap files and
+// lists only the tools it allows. A nil profile returns b itself.
+func (b *ContextBuilder) forProfile(p *agentProfile) *ContextBuilder {
+	if p == nil {
+		return b
+	}
+	c := *b
+	if len(p.BootstrapFiles) > 0 {
+		c.bootstrap = p.BootstrapFiles
+	}
+	c.allowTool = p.allowsTool
+	return &c
+}
+
 // BuildSystemPrompt constructs the full system prompt from files and runtime info.
 func (b *ContextBuilder) BuildSystemPrompt() string {
 	var parts []string
@@ -147,7 +189,11 @@ func (b *ContextBuilder) loadBootstrapFiles() string {
 		wsPath = filepath.Join(home, wsPath[1:])
 	}
 
-	for _, filename := range bootstrapFiles {
+	files := bootstrapFiles
+	if b.bootstrap != nil {
+		files = b.bootstrap
+	}
+	for _, filename := range files {
 		path := filepath.Join(wsPath, filename)
 		content, err := os.ReadFile(path)
 		if err == nil {
@@ -190,6 +236,9 @@ func (b *ContextBuilder) buildSkillsSummary() string {
 	var sb strings.Builder
 	sb.WriteString("You have the following tools available:\n")
 	for _, tool := range tools {
+		if b.allowTool != nil && !b.allowTool(tool.Name()) {
+			continue
+		}
 		sb.WriteString(fmt.Sprintf("- %s: %s\n", tool.Name(), tool.Description()))
 	}
 
@@ -318,12 +367,15 @@ func (b *ContextBuilder) BuildIdentityEnvelope(agentID, agentName, model string)
 }
 
 // BuildMessages constructs the message list for the LLM.
+// Media holds local paths of attachments (images, documents) that belong to
+// the current message; they are attached as multimodal content parts.
 func (b *ContextBuilder) BuildMessages(
 	sess *session.Session,
 	currentMessage string,
 	channel string,
 	chatID string,
 	messageType string,
+	media []string,
 ) []provider.Message {
 
 	systemPrompt := b.BuildSystemPrompt()
@@ -340,6 +392,12 @@ func (b *ContextBuilder) BuildMessages(
 		systemPrompt += "\n\n## Request Context\nThis is an EXTERNAL request from an authorized user. Be helpful and professional. Do NOT expose system internals (paths, configs, keys). Prefer read-only operations. Tool access may be restricted by policy."
 	}
 
+	// Older turns that were compacted are replaced by their rolling summary.
+	summary, upTo := sess.Summary()
+	if summary != "" {
+		systemPrompt += "\n\n## Conversation Summary\nEarlier messages in this conversation, summarized:\n" + summary
+	}
+
 	messages := []provider.Message{
 		{Role: "system", Content: systemPrompt},
 	}
@@ -353,7 +411,7 @@ func (b *ContextBuilder) BuildMessages(
 	// sess.AddMessage("user", content) -> then calls BuildMessages
 	// So the last message in session IS the current message.
 
-	history := sess.GetHistory(50)
+	history := sess.MessagesFrom(upTo)
 
 	// We want to format history for the LLM.
 	// If the last message in history is the current message, we should exclude it from the "history" block
@@ -366,6 +424,19 @@ func (b *ContextBuilder) BuildMessages(
 		historyMessages = history
 	}
 
+	// Keep the newest messages that fit the token budget. Compaction
+	// normally keeps the history below it; this guards against a failed
+	// or pending summary.
+	budget := b.historyBudget()
+	start := len(historyMessages)
+	for used := 0; start > 0; start-- {
+		used += messageTokens(historyMessages[start-1])
+		if used > budget {
+			break
+		}
+	}
+	historyMessages = historyMessages[start:]
+
 	for _, msg := range historyMessages {
 		messages = append(messages, provider.Message{
 			Role:    msg.Role,
@@ -374,10 +445,19 @@ func (b *ContextBuilder) BuildMessages(
 	}
 
 	// Add current message
-	messages = append(messages, provider.Message{
+	current := provider.Message{
 		Role:    "user",
 		Content: currentMessage,
-	})
+	}
+	for _, path := range media {
+		part, err := provider.MediaPart(path)
+		if err != nil {
+			current.Parts = append(current.Parts, provider.TextPart(fmt.Sprintf("[Attachment %s unavailable: %v]", filepath.Base(path), err)))
+			continue
+		}
+		current.Parts = append(current.Parts, part)
+	}
+	messages = append(messages, current)
 
 	return messages
 }
@@ -6,6 +6,7 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/kamir/gomikrobot/internal/provider"
 	"github.com/kamir/gomikrobot/internal/session"
 	"github.com/kamir/gomikrobot/internal/tools"
 )
@@ -56,7 +57,7 @@ func TestBuildMessages(t *testing.T) {
 	// So let's simulate that
 	sess.AddMessage("user", "Current msg")
 
-	msgs := builder.BuildMessages(sess, "Current msg", "cli", "default", "")
+	msgs := builder.BuildMessages(sess, "Current msg", "cli", "default", "", nil)
 
 	// Expect:
 	// 1. System
@@ -84,7 +85,7 @@ func TestBuildMessagesInternalContext(t *testing.T) {
 	sess := session.NewSession("test:int")
 	sess.AddMessage("user", "hello")
 
-	msgs := builder.BuildMessages(sess, "hello", "whatsapp", "owner@s.whatsapp.net", "internal")
+	msgs := builder.BuildMessages(sess, "hello", "whatsapp", "owner@s.whatsapp.net", "internal", nil)
 
 	if len(msgs) == 0 {
 		t.Fatal("Expected messages")
@@ -104,7 +105,7 @@ func TestBuildMessagesExternalContext(t *testing.T) {
 	sess := session.NewSession("test:ext")
 	sess.AddMessage("user", "hello")
 
-	msgs := builder.BuildMessages(sess, "hello", "whatsapp", "user@s.whatsapp.net", "external")
+	msgs := builder.BuildMessages(sess, "hello", "whatsapp", "user@s.whatsapp.net", "external", nil)
 
 	if len(msgs) == 0 {
 		t.Fatal("Expected messages")
@@ -117,3 +118,61 @@ func TestBuildMessagesExternalContext(t *testing.T) {
 		t.Error("System prompt should not contain internal request context")
 	}
 }
+
+func TestBuildMessagesAttachesMedia(t *testing.T) {
+	tmpDir := t.TempDir()
+	img := filepath.Join(tmpDir, "photo.jpg")
+	if err := os.WriteFile(img, []byte("\xff\xd8\xff"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	builder := NewContextBuilder(tmpDir, "", "", tools.NewRegistry())
+	sess := session.NewSession("whatsapp:123")
+	sess.AddMessage("user", "[Image Message] what is this?")
+
+	msgs := builder.BuildMessages(sess, "[Image Message] what is this?", "whatsapp", "123", "internal",
+		[]string{img, filepath.Join(tmpDir, "missing.png")})
+
+	current := msgs[len(msgs)-1]
+	if len(current.Parts) != 2 {
+		t.Fatalf("expected 2 parts, got %d", len(current.Parts))
+	}
+	if current.Parts[0].Type != provider.PartImage || current.Parts[0].MimeType != "image/jpeg" {
+		t.Errorf("unexpected image part %+v", current.Parts[0])
+	}
+	if current.Parts[1].Type != provider.PartText || !strings.Contains(current.Parts[1].Text, "missing.png") {
+		t.Errorf("expected text note for missing media, got %+v", current.Parts[1])
+	}
+}
+
+func TestBuildMessagesUsesSummaryAndTokenBudget(t *testing.T) {
+	builder := NewContextBuilder(t.TempDir(), "", "", tools.NewRegistry())
+	builder.historyTokens = 100
+	sess := session.NewSession("test:summary")
+
+	sess.AddMessage("user", "old question about the garden")
+	sess.AddMessage("assistant", "old answer about the garden")
+	sess.SetSummary("- User plans a garden party on Saturday", 2)
+	for i := 0; i < 10; i++ {
+		sess.AddMessage("user", strings.Repeat("x", 120))
+	}
+	sess.AddMessage("assistant", "latest answer")
+	sess.AddMessage("user", "Current msg")
+
+	msgs := builder.BuildMessages(sess, "Current msg", "cli", "default", "", nil)
+
+	if !strings.Contains(msgs[0].Content, "## Conversation Summary") || !strings.Contains(msgs[0].Content, "garden party") {
+		t.Fatalf("expected summary in system prompt, got %q", msgs[0].Content)
+	}
+	for _, m := range msgs[1:] {
+		if strings.Contains(m.Content, "old question") {
+			t.Fatal("summarized messages should not be sent verbatim")
+		}
+	}
+	// Each filler message is ~34 tokens, so only two fit beside the last answer.
+	if len(msgs) != 5 {
+		t.Fatalf("expected system + 3 history + current, got %d messages", len(msgs))
+	}
+	if msgs[len(msgs)-2].Content != "latest answer" || msgs[len(msgs)-1].Content != "Current msg" {
+		t.Fatalf("expected the newest history to be kept, got %+v", msgs[len(msgs)-2:])
+	}
+}
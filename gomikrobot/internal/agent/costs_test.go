@@ -0,0 +1,122 @@
+package agent
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kamir/gomikrobot/internal/bus"
+	"github.com/kamir/gomikrobot/internal/config"
+	"github.com/kamir/gomikrobot/internal/costs"
+	"github.com/kamir/gomikrobot/internal/provider"
+	"github.com/kamir/gomikrobot/internal/timeline"
+)
+
+func TestLoopRecordsCostPerTask(t *testing.T) {
+	tl := newTestTimeline(t)
+	tmpDir := t.TempDir()
+	mock := &mockProvider{responses: []provider.ChatResponse{
+		{Content: "done", Usage: provider.Usage{PromptTokens: 1_000_000, CompletionTokens: 100_000, TotalTokens: 1_100_000}},
+	}}
+
+	loop := NewLoop(LoopOptions{
+		Bus:       bus.NewMessageBus(),
+		Provider:  mock,
+		Timeline:  tl,
+		Workspace: tmpDir,
+		WorkRepo:  tmpDir,
+		Model:     "mock-model",
+		Costs: costs.NewAccountant(config.CostsConfig{
+			Prices: map[string]config.ModelPrice{"mock-model": {Input: 1, Output: 10}},
+		}, tl),
+	})
+
+	_, taskID, err := loop.processMessage(context.Background(), &bus.InboundMessage{
+		Channel:   "whatsapp",
+		SenderID:  "alice",
+		ChatID:    "alice",
+		TraceID:   "trace-cost-001",
+		Content:   "hello",
+		Timestamp: time.Now(),
+	})
+	if err != nil {
+		t.Fatalf("processMessage: %v", err)
+	}
+
+	task, err := tl.GetTask(taskID)
+	if err != nil {
+		t.Fatalf("get task: %v", err)
+	}
+	if task.CostUSD < 1.99 || task.CostUSD > 2.01 {
+		t.Fatalf("expected task cost 2.00, got %v", task.CostUSD)
+	}
+	spent, err := tl.SpendSince(time.Now().Add(-time.Hour), "whatsapp", "alice")
+	if err != nil || spent < 1.99 || spent > 2.01 {
+		t.Fatalf("expected recorded spend 2.00, got %v (%v)", spent, err)
+	}
+
+	events, err := tl.GetEvents(timeline.FilterArgs{TraceID: "trace-cost-001", Limit: 100})
+	if err != nil {
+		t.Fatalf("get events: %v", err)
+	}
+	found := false
+	for _, ev := range events {
+		if ev.Classification == "LLM" && strings.Contains(ev.Metadata, `"cost_usd":2`) {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatal("expected cost_usd on the LLM span")
+	}
+}
+
+func TestLoopBudgetHardStopAndSoftWarning(t *testing.T) {
+	tl := newTestTimeline(t)
+	tmpDir := t.TempDir()
+	mock := &mockProvider{}
+
+	acc := costs.NewAccountant(config.CostsConfig{Budgets: []config.BudgetConfig{
+		{Scope: costs.ScopeSender, Match: "bob", Period: costs.PeriodDay, HardUSD: 1},
+		{Scope: costs.ScopeChannel, Period: costs.PeriodMonth, SoftUSD: 0.5},
+	}}, tl)
+	loop := NewLoop(LoopOptions{
+		Bus:       bus.NewMessageBus(),
+		Provider:  mock,
+		Timeline:  tl,
+		Workspace: tmpDir,
+		WorkRepo:  tmpDir,
+		Model:     "mock-model",
+		Costs:     acc,
+	})
+
+	_ = tl.RecordLLMUsage(&timeline.LLMUsageRecord{Channel: "whatsapp", Sender: "bob", Model: "mock-model", CostUSD: 1.5})
+
+	resp, _, err := loop.processMessage(context.Background(), &bus.InboundMessage{
+		Channel: "whatsapp", SenderID: "bob", ChatID: "bob", Content: "hi", Timestamp: time.Now(),
+	})
+	if err != nil {
+		t.Fatalf("processMessage: %v", err)
+	}
+	if !strings.Contains(resp, "Spend limit reached") || mock.calls != 0 {
+		t.Fatalf("expected hard stop without LLM call, got %q (calls=%d)", resp, mock.calls)
+	}
+
+	// Alice is not limited by bob's budget but the channel is past its
+	// soft threshold: she gets an answer with a one-time note.
+	resp, _, err = loop.processMessage(context.Background(), &bus.InboundMessage{
+		Channel: "whatsapp", SenderID: "alice", ChatID: "alice", Content: "hi", Timestamp: time.Now(),
+	})
+	if err != nil {
+		t.Fatalf("processMessage: %v", err)
+	}
+	if !strings.HasPrefix(resp, "mock response") || !strings.Contains(resp, "warning threshold") {
+		t.Fatalf("expected answer with budget note, got %q", resp)
+	}
+	resp, _, _ = loop.processMessage(context.Background(), &bus.InboundMessage{
+		Channel: "whatsapp", SenderID: "alice", ChatID: "alice", Content: "again", Timestamp: time.Now(),
+	})
+	if strings.Contains(resp, "warning threshold") {
+		t.Fatalf("soft warning should be given once per period, got %q", resp)
+	}
+}
@@ -0,0 +1,106 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/kamir/gomikrobot/internal/day2day"
+	"github.com/kamir/gomikrobot/internal/session"
+)
+
+// Session metadata of an open dtu/dtp capture.
+const (
+	day2DayCaptureModeKey   = "day2day_capture_mode"
+	day2DayCaptureBufferKey = "day2day_capture_buffer"
+)
+
+// newDay2Day returns the day plan service on store, rendering the daily
+// files into the system repo, or nil without a store.
+func (l *Loop) newDay2Day(store *day2day.Store) *day2day.Service {
+	if store == nil {
+		return nil
+	}
+	return day2day.NewService(store, day2day.Options{
+		Dir:      l.day2DayTasksDir,
+		Provider: l.provider,
+		Model:    l.model,
+	})
+}
+
+// Day2Day returns the day plan service, or nil when the loop has no task
+// store.
+func (l *Loop) Day2Day() *day2day.Service {
+	return l.day2day
+}
+
+// handleDay2Day answers day2day commands and status questions without the
+// LLM. Between dtu/dtp and dtc, every message of the session is captured.
+func (l *Loop) handleDay2Day(ctx context.Context, sess *session.Session, content string) (string, bool) {
+	raw := strings.TrimSpace(content)
+	if raw == "" {
+		return "", false
+	}
+	cmd, isCmd := day2day.ParseCommand(raw)
+	if l.day2day == nil {
+		if isCmd {
+			return "Day2Day: kein Task-Speicher verfügbar (Timeline-DB fehlt).", true
+		}
+		return "", false
+	}
+
+	if statusText, ok := l.day2day.Status(raw); ok {
+		return statusText, true
+	}
+
+	captureMode, captureBuffer := getDay2DayCapture(sess)
+	if captureMode != "" {
+		if isCmd && cmd.Kind == "dtc" {
+			clearDay2DayCapture(sess)
+			if strings.TrimSpace(captureBuffer) == "" {
+				return "Day2Day: capture was empty. Send dtu/dtp then content, end with dtc.", true
+			}
+			return l.day2day.Run(ctx, day2day.Command{Kind: captureMode, Text: captureBuffer}), true
+		}
+		captureBuffer = strings.TrimSpace(captureBuffer + "\n" + raw)
+		setDay2DayCapture(sess, captureMode, captureBuffer)
+		return "Day2Day: captured. Send dtc to close.", true
+	}
+
+	if !isCmd {
+		return "", false
+	}
+	if cmd.StartsCapture() {
+		setDay2DayCapture(sess, cmd.Kind, "")
+		return fmt.Sprintf("Day2Day: %s capture started. Send dtc to close.", cmd.Kind), true
+	}
+	return l.day2day.Run(ctx, cmd), true
+}
+
+func getDay2DayCapture(sess *session.Session) (string, string) {
+	modeRaw, _ := sess.GetMetadata(day2DayCaptureModeKey)
+	bufRaw, _ := sess.GetMetadata(day2DayCaptureBufferKey)
+	mode, _ := modeRaw.(string)
+	buf, _ := bufRaw.(string)
+	return strings.TrimSpace(mode), strings.TrimSpace(buf)
+}
+
+func setDay2DayCapture(sess *session.Session, mode, buffer string) {
+	sess.SetMetadata(day2DayCaptureModeKey, mode)
+	sess.SetMetadata(day2DayCaptureBufferKey, buffer)
+}
+
+func clearDay2DayCapture(sess *session.Session) {
+	sess.DeleteMetadata(day2DayCaptureModeKey)
+	sess.DeleteMetadata(day2DayCaptureBufferKey)
+}
+
+// day2DayTasksDir is where the daily markdown views are written.
+func (l *Loop) day2DayTasksDir() (string, error) {
+	base := l.systemRepoPath()
+	if base == "" {
+		return "", fmt.Errorf("system repo not found")
+	}
+	return filepath.Join(base, "operations", "day2day", "tasks"), nil
+}
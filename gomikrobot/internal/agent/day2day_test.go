@@ -0,0 +1,59 @@
+package agent
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kamir/gomikrobot/internal/provider"
+)
+
+func TestDay2DayConsolidationMergesTasksViaLLM(t *testing.T) {
+	tmpDir := t.TempDir()
+	mock := &mockProvider{
+		responses: []provider.ChatResponse{
+			{Content: "Sure! Here you go."}, // invalid, triggers the re-ask
+			{Content: `{"merge": [{"into": 2, "ids": [1], "title": ""}], "next": 3}`},
+		},
+	}
+	loop := NewLoop(LoopOptions{
+		Provider:      mock,
+		Timeline:      newTestTimeline(t),
+		Workspace:     tmpDir,
+		WorkRepo:      tmpDir,
+		SystemRepo:    tmpDir,
+		Model:         "mock-model",
+		MaxIterations: 5,
+	})
+
+	ctx := context.Background()
+	if _, err := loop.ProcessDirect(ctx, "dtu - Draft the report\n- Write the report draft\n- Call Bob", "cli:d2d"); err != nil {
+		t.Fatal(err)
+	}
+	resp, err := loop.ProcessDirect(ctx, "dts", "cli:d2d")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp != "Konsolidiert. Open: 2 | Done: 0" {
+		t.Errorf("unexpected response %q", resp)
+	}
+
+	data, err := os.ReadFile(filepath.Join(tmpDir, "operations", "day2day", "tasks", time.Now().Format("2006-01-02")+".md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	contents := string(data)
+	tasks := contents[strings.Index(contents, "## Tasks"):strings.Index(contents, "## Progress Log")]
+	if strings.Contains(tasks, "Draft the report") || !strings.Contains(tasks, "- [ ] Write the report draft") {
+		t.Errorf("expected merged tasks, got:\n%s", tasks)
+	}
+	if next := contents[strings.Index(contents, "## Next Step"):]; !strings.Contains(next, "Call Bob") {
+		t.Errorf("expected LLM-suggested next step, got:\n%s", next)
+	}
+	if mock.calls != 2 {
+		t.Errorf("expected one re-ask, got %d calls", mock.calls)
+	}
+}
@@ -0,0 +1,184 @@
+package agent
+
+import (
+	"context"
+	"time"
+
+	"github.com/kamir/gomikrobot/internal/provider"
+)
+
+// Hook extends the agent loop at fixed points of a turn, e.g. to redact
+// data, log or rewrite responses. Embed NopHook and override only the
+// methods you need.
+//
+// The hooks from LoopOptions.Hooks run in their order within the built-in
+// ones (see hookChain): after memory, quota and usage accounting, but
+// before the policy check, artifact spilling and the trace spans, so they
+// see everything before it is published to the group.
+// BeforeTool and AfterTool may be called concurrently for read-only tool
+// calls that run in parallel.
+type Hook interface {
+	// BeforeLLM runs before each LLM call and may change call.Request. An
+	// error ends the turn; its message becomes the reply.
+	BeforeLLM(ctx context.Context, call *LLMCall) error
+	// AfterLLM runs after each successful LLM call and may change
+	// call.Response.
+	AfterLLM(ctx context.Context, call *LLMCall)
+	// BeforeTool runs before each tool call and may change its arguments.
+	// An error skips the tool; its message becomes the tool result.
+	BeforeTool(ctx context.Context, exec *ToolExecution) error
+	// AfterTool runs after each executed tool call and may change
+	// exec.Result.
+	AfterTool(ctx context.Context, exec *ToolExecution)
+	// OnFinalResponse runs once when the loop has its reply and may change
+	// resp.Content.
+	OnFinalResponse(ctx context.Context, resp *FinalResponse)
+}
+
+// NopHook implements Hook with methods that do nothing.
+type NopHook struct{}
+
+func (NopHook) BeforeLLM(context.Context, *LLMCall) error        { return nil }
+func (NopHook) AfterLLM(context.Context, *LLMCall)               {}
+func (NopHook) BeforeTool(context.Context, *ToolExecution) error { return nil }
+func (NopHook) AfterTool(context.Context, *ToolExecution)        {}
+func (NopHook) OnFinalResponse(context.Context, *FinalResponse)  {}
+
+// Turn identifies the turn a hook is called for.
+type Turn struct {
+	TaskID      string
+	TraceID     string
+	Sender      string
+	Channel     string // empty for direct (CLI) calls
+	ChatID      string
+	MessageType string
+	Profile     string // agent profile name, empty if none applies
+	Agent       string // "sub-agent" in child loops, empty otherwise
+}
+
+// LLMCall is one call to the model.
+type LLMCall struct {
+	Turn
+	Iteration int // 0 for the first call of the turn
+	Request   *provider.ChatRequest
+	Response  *provider.ChatResponse // nil in BeforeLLM
+	Started   time.Time
+	Duration  time.Duration
+	Cost      float64 // USD, set by the usage hook
+}
+
+// ToolExecution is one tool call requested by the model.
+type ToolExecution struct {
+	Turn
+	Call        provider.ToolCall
+	Result      string // content of the tool result message
+	Err         error  // error returned by the tool
+	Started     time.Time
+	Duration    time.Duration
+	OutputChars int            // length of the result before AfterTool hooks
+	Meta        map[string]any // extra span metadata set by hooks
+}
+
+// Reasons a turn ended, passed to OnFinalResponse.
+const (
+	FinishComplete      = "complete"       // the model answered without tool calls
+	FinishStopped       = "stopped"        // a BeforeLLM hook ended the turn
+	FinishAborted       = "aborted"        // a tool result carried toolAbortMarker
+	FinishTokenBudget   = "token_budget"   // a sub-agent spent its token budget
+	FinishMaxIterations = "max_iterations" // the iteration limit was reached
+)
+
+// FinalResponse is the reply of the loop to one turn.
+type FinalResponse struct {
+	Turn
+	Content string
+	Reason  string
+}
+
+// hookChain returns the loop's own cross-cutting features (see
+// builtin_hooks.go) around the given hooks. Their order is significant:
+//
+//   - Memory, quota and usage come first, so custom hooks see the request
+//     with memory added and the cost of the call.
+//   - Policy comes after the custom hooks, so the arguments that are
+//     checked, shown for approval and audited are the ones the tool runs
+//     with.
+//   - Artifact spilling and the spans come last, so what is saved,
+//     recorded and published is what the custom hooks left (e.g. redacted
+//     content).
+func (l *Loop) hookChain(extra []Hook) []Hook {
+	chain := []Hook{
+		&ragHook{l: l},   // BeforeLLM: semantic memory on the first call
+		&quotaHook{l: l}, // BeforeLLM: token quota and spend budgets; final: budget note
+		&usageHook{l: l}, // AfterLLM: token and cost accounting
+	}
+	chain = append(chain, extra...)
+	return append(chain,
+		&policyHook{l: l},     // BeforeTool: profile allowlist, policy engine, approvals, group audit
+		&artifactHook{l: l},   // AfterTool: spill large results
+		&traceHook{l: l},      // AfterLLM, AfterTool: timeline spans
+		&groupTraceHook{l: l}, // AfterLLM, AfterTool, final: group trace spans
+	)
+}
+
+// setHooks installs the given hooks within the built-in chain.
+func (l *Loop) setHooks(extra []Hook) {
+	l.extraHooks = extra
+	l.hooks = l.hookChain(extra)
+}
+
+// turn describes the request for hooks.
+func (l *Loop) turn(rs *requestState) Turn {
+	t := Turn{
+		TaskID:      rs.TaskID,
+		TraceID:     rs.TraceID,
+		Sender:      rs.Sender,
+		Channel:     rs.Channel,
+		ChatID:      rs.ChatID,
+		MessageType: rs.MessageType,
+		Agent:       l.agentName,
+	}
+	if rs.Profile != nil {
+		t.Profile = rs.Profile.Name
+	}
+	return t
+}
+
+func (l *Loop) beforeLLM(ctx context.Context, call *LLMCall) error {
+	for _, h := range l.hooks {
+		if err := h.BeforeLLM(ctx, call); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (l *Loop) afterLLM(ctx context.Context, call *LLMCall) {
+	for _, h := range l.hooks {
+		h.AfterLLM(ctx, call)
+	}
+}
+
+func (l *Loop) beforeTool(ctx context.Context, exec *ToolExecution) error {
+	for _, h := range l.hooks {
+		if err := h.BeforeTool(ctx, exec); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (l *Loop) afterTool(ctx context.Context, exec *ToolExecution) {
+	for _, h := range l.hooks {
+		h.AfterTool(ctx, exec)
+	}
+}
+
+// finalResponse passes the reply of the turn through OnFinalResponse.
+func (l *Loop) finalResponse(ctx context.Context, reason, content string) string {
+	resp := &FinalResponse{Turn: l.turn(requestFrom(ctx)), Content: content, Reason: reason}
+	for _, h := range l.hooks {
+		h.OnFinalResponse(ctx, resp)
+	}
+	return resp.Content
+}
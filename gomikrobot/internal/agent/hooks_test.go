@@ -0,0 +1,314 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kamir/gomikrobot/internal/bus"
+	"github.com/kamir/gomikrobot/internal/policy"
+	"github.com/kamir/gomikrobot/internal/provider"
+	"github.com/kamir/gomikrobot/internal/timeline"
+	"github.com/kamir/gomikrobot/internal/tools"
+)
+
+// redactingHook masks card numbers sent to the model, blocks one tool and
+// rewrites results and replies, recording every call.
+type redactingHook struct {
+	NopHook
+	mu    sync.Mutex
+	calls []string
+}
+
+func (h *redactingHook) record(s string) {
+	h.mu.Lock()
+	h.calls = append(h.calls, s)
+	h.mu.Unlock()
+}
+
+func (h *redactingHook) BeforeLLM(_ context.Context, call *LLMCall) error {
+	h.record(fmt.Sprintf("before_llm:%d", call.Iteration))
+	for i := range call.Request.Messages {
+		call.Request.Messages[i].Content = strings.ReplaceAll(call.Request.Messages[i].Content, "4111", "[card]")
+	}
+	return nil
+}
+
+func (h *redactingHook) AfterLLM(_ context.Context, call *LLMCall) {
+	h.record(fmt.Sprintf("after_llm:%d", call.Iteration))
+}
+
+func (h *redactingHook) BeforeTool(_ context.Context, exec *ToolExecution) error {
+	h.record("before_tool:" + exec.Call.Name)
+	if exec.Call.Name == "probe_blocked" {
+		return errors.New("blocked by hook")
+	}
+	return nil
+}
+
+func (h *redactingHook) AfterTool(_ context.Context, exec *ToolExecution) {
+	h.record("after_tool:" + exec.Call.Name)
+	exec.Result = strings.ToUpper(exec.Result)
+}
+
+func (h *redactingHook) OnFinalResponse(_ context.Context, resp *FinalResponse) {
+	h.record("final:" + resp.Reason)
+	resp.Content += " (checked)"
+}
+
+func TestHooksRunAtEachStep(t *testing.T) {
+	tmpDir := t.TempDir()
+	prov := &recordingProvider{mockProvider: mockProvider{responses: []provider.ChatResponse{
+		{ToolCalls: []provider.ToolCall{
+			{ID: "t1", Name: "probe_write", Arguments: map[string]any{"id": "a"}},
+			{ID: "t2", Name: "probe_blocked", Arguments: map[string]any{"id": "b"}},
+		}, Usage: provider.Usage{TotalTokens: 10}},
+		{Content: "done", Usage: provider.Usage{TotalTokens: 10}},
+	}}}
+	hook := &redactingHook{}
+	loop := NewLoop(LoopOptions{
+		Provider:  prov,
+		Workspace: tmpDir,
+		WorkRepo:  tmpDir,
+		Hooks:     []Hook{hook},
+	})
+	var running, peak int32
+	var mu sync.Mutex
+	var order []string
+	for _, name := range []string{"probe_write", "probe_blocked"} {
+		loop.registry.Register(&probeTool{name: name, tier: tools.TierWrite, running: &running, peak: &peak, mu: &mu, order: &order})
+	}
+	defer loop.sessions.Delete("test:hooks")
+
+	resp, err := loop.ProcessDirect(context.Background(), "my card is 4111", "test:hooks")
+	if err != nil {
+		t.Fatalf("process: %v", err)
+	}
+	if resp != "done (checked)" {
+		t.Errorf("expected the reply to be rewritten, got %q", resp)
+	}
+
+	want := []string{"before_llm:0", "after_llm:0", "before_tool:probe_write", "after_tool:probe_write",
+		"before_tool:probe_blocked", "before_llm:1", "after_llm:1", "final:complete"}
+	if strings.Join(hook.calls, ",") != strings.Join(want, ",") {
+		t.Errorf("hook calls:\n got %v\nwant %v", hook.calls, want)
+	}
+	if len(order) != 1 || order[0] != "a" {
+		t.Errorf("blocked tool must not run, executed %v", order)
+	}
+
+	if len(prov.requests) != 2 {
+		t.Fatalf("expected 2 LLM calls, got %d", len(prov.requests))
+	}
+	for _, m := range prov.requests[0].Messages {
+		if strings.Contains(m.Content, "4111") {
+			t.Fatalf("card number reached the model: %q", m.Content)
+		}
+	}
+	var results []string
+	for _, m := range prov.requests[1].Messages {
+		if m.Role == "tool" {
+			results = append(results, m.Content)
+		}
+	}
+	if strings.Join(results, "|") != "RESULT A|blocked by hook" {
+		t.Errorf("unexpected tool results %q", results)
+	}
+}
+
+// piiHook masks a secret in tool arguments, model responses and tool
+// results.
+type piiHook struct{ NopHook }
+
+func (piiHook) AfterLLM(_ context.Context, call *LLMCall) {
+	call.Response.Content = strings.ReplaceAll(call.Response.Content, "s3cret", "[pii]")
+}
+
+func (piiHook) BeforeTool(_ context.Context, exec *ToolExecution) error {
+	exec.Call.Arguments["id"] = "masked"
+	return nil
+}
+
+func (piiHook) AfterTool(_ context.Context, exec *ToolExecution) {
+	exec.Result = strings.ReplaceAll(exec.Result, "s3cret", "[pii]")
+}
+
+// argsPolicy allows everything and records the arguments it was shown.
+type argsPolicy struct{ args []any }
+
+func (p *argsPolicy) Evaluate(ctx policy.Context) policy.Decision {
+	p.args = append(p.args, ctx.Arguments["id"])
+	return policy.Decision{Allow: true, Tier: ctx.Tier}
+}
+
+func TestCustomHooksRunBeforePolicyAndSpans(t *testing.T) {
+	tl := newTestTimeline(t)
+	tmpDir := t.TempDir()
+	prov := &mockProvider{responses: []provider.ChatResponse{
+		{Content: "thinking about s3cret", ToolCalls: []provider.ToolCall{
+			{ID: "t1", Name: "big_output", Arguments: map[string]any{"id": "raw"}},
+		}},
+		{Content: "done with s3cret"},
+	}}
+	pol := &argsPolicy{}
+	loop := NewLoop(LoopOptions{
+		Provider:  prov,
+		Timeline:  tl,
+		Policy:    pol,
+		Workspace: tmpDir,
+		WorkRepo:  tmpDir,
+		Hooks:     []Hook{piiHook{}},
+	})
+	loop.registry.Register(&bigOutputTool{out: "the s3cret value"})
+	defer loop.sessions.Delete("test:pii")
+
+	ctx := withRequest(context.Background(), &requestState{TraceID: "trace-pii-001"})
+	if _, err := loop.ProcessDirect(ctx, "hello", "test:pii"); err != nil {
+		t.Fatalf("process: %v", err)
+	}
+	if len(pol.args) != 1 || pol.args[0] != "masked" {
+		t.Errorf("policy must see the arguments the hook left, saw %v", pol.args)
+	}
+
+	events, err := tl.GetEvents(timeline.FilterArgs{Limit: 100})
+	if err != nil {
+		t.Fatalf("get events: %v", err)
+	}
+	spans := 0
+	for _, ev := range events {
+		if ev.Classification != "LLM" && ev.Classification != "TOOL" {
+			continue
+		}
+		spans++
+		if strings.Contains(ev.ContentText+ev.Metadata, "s3cret") {
+			t.Errorf("%s span leaks the redacted value: %s %s", ev.Classification, ev.ContentText, ev.Metadata)
+		}
+	}
+	if spans < 3 {
+		t.Errorf("expected LLM and TOOL spans, got %d", spans)
+	}
+}
+
+// stopHook ends the turn before the model is called.
+type stopHook struct{ NopHook }
+
+func (stopHook) BeforeLLM(context.Context, *LLMCall) error {
+	return errors.New("Outside office hours.")
+}
+
+func TestBeforeLLMErrorEndsTurn(t *testing.T) {
+	tmpDir := t.TempDir()
+	prov := &mockProvider{}
+	loop := NewLoop(LoopOptions{
+		Provider:  prov,
+		Workspace: tmpDir,
+		WorkRepo:  tmpDir,
+		Hooks:     []Hook{stopHook{}},
+	})
+	defer loop.sessions.Delete("test:stop-hook")
+
+	resp, err := loop.ProcessDirect(context.Background(), "hello", "test:stop-hook")
+	if err != nil {
+		t.Fatalf("process: %v", err)
+	}
+	if resp != "Outside office hours." || prov.calls != 0 {
+		t.Fatalf("expected the hook to answer without an LLM call, got %q after %d calls", resp, prov.calls)
+	}
+}
+
+// recordingGroup collects what the loop publishes to the group.
+type recordingGroup struct {
+	mu     sync.Mutex
+	traces []map[string]string
+	audits []string
+}
+
+func (g *recordingGroup) Active() bool { return true }
+
+func (g *recordingGroup) PublishTrace(_ context.Context, payload interface{}) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.traces = append(g.traces, payload.(map[string]string))
+	return nil
+}
+
+func (g *recordingGroup) PublishAudit(_ context.Context, eventType, traceID, detail string) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.audits = append(g.audits, eventType+" "+detail)
+	return nil
+}
+
+// replyRedactingHook masks a secret in the final reply.
+type replyRedactingHook struct{ NopHook }
+
+func (replyRedactingHook) OnFinalResponse(_ context.Context, resp *FinalResponse) {
+	resp.Content = strings.ReplaceAll(resp.Content, "s3cret", "[pii]")
+}
+
+func TestGroupPublishingRunsThroughHooks(t *testing.T) {
+	tmpDir := t.TempDir()
+	prov := &mockProvider{responses: []provider.ChatResponse{
+		{ToolCalls: []provider.ToolCall{{ID: "p1", Name: "spawn_agent", Arguments: map[string]any{
+			"task": "Look it up", "tools": []any{"probe_read"},
+		}}}},
+		{Content: "child found s3cret"},
+		{Content: "the answer is s3cret"},
+	}}
+	group := &recordingGroup{}
+	loop := NewLoop(LoopOptions{
+		Bus:            bus.NewMessageBus(),
+		Provider:       prov,
+		Policy:         &argsPolicy{},
+		GroupPublisher: group,
+		Workspace:      tmpDir,
+		WorkRepo:       tmpDir,
+		Hooks:          []Hook{replyRedactingHook{}},
+	})
+	loop.registry.Register(&probeTool{name: "probe_read", tier: tools.TierReadOnly,
+		running: new(int32), peak: new(int32), mu: &sync.Mutex{}, order: &[]string{}})
+
+	chatID := "group" + time.Now().Format("150405.000000")
+	t.Cleanup(func() { loop.sessions.Delete("test:" + chatID) })
+	resp, _, err := loop.processMessage(context.Background(), &bus.InboundMessage{
+		Channel: "test", SenderID: "u", ChatID: chatID, TraceID: "trace-group-001",
+		Content: "What is it?", Timestamp: time.Now(),
+	})
+	if err != nil {
+		t.Fatalf("processMessage: %v", err)
+	}
+	if resp != "the answer is [pii]" {
+		t.Fatalf("unexpected response %q", resp)
+	}
+
+	// Publishing is asynchronous.
+	var tasks []map[string]string
+	var audits []string
+	for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		group.mu.Lock()
+		tasks = tasks[:0]
+		for _, tr := range group.traces {
+			if tr["span_type"] == "TASK" {
+				tasks = append(tasks, tr)
+			}
+		}
+		audits = append(audits[:0], group.audits...)
+		group.mu.Unlock()
+		if len(tasks) > 0 && len(audits) > 0 {
+			break
+		}
+	}
+	if len(tasks) != 1 {
+		t.Fatalf("expected one TASK span for the parent only, got %v", tasks)
+	}
+	if tasks[0]["content"] != "the answer is [pii]" || tasks[0]["title"] != "Task from u via test" {
+		t.Errorf("TASK span must carry the reply the hooks left, got %v", tasks[0])
+	}
+	if len(audits) == 0 || !strings.Contains(audits[0], "policy_decision tool=spawn_agent") || !strings.Contains(audits[0], "action=ALLOW") {
+		t.Errorf("expected a policy audit for spawn_agent, got %v", audits)
+	}
+}
@@ -0,0 +1,35 @@
+package agent
+
+import (
+	"context"
+
+	"github.com/kamir/gomikrobot/internal/intent"
+	"github.com/kamir/gomikrobot/internal/timeline"
+)
+
+// screenMessage classifies a user message before the LLM sees it and
+// records the verdict as a policy decision. Blocked messages get the reply
+// configured for the channel and category.
+func (l *Loop) screenMessage(ctx context.Context, rs *requestState, channel, content string) (string, bool) {
+	res, blocked := l.intent.Check(ctx, intent.Input{Text: content, Channel: channel, Sender: rs.Sender})
+	if res.Classifier == "" {
+		return "", false
+	}
+	if l.timeline != nil {
+		_ = l.timeline.LogPolicyDecision(&timeline.PolicyDecisionRecord{
+			TraceID:    rs.TraceID,
+			TaskID:     rs.TaskID,
+			Tool:       "intent:" + res.Classifier,
+			Sender:     rs.Sender,
+			Channel:    channel,
+			Allowed:    !blocked,
+			Reason:     res.Reason,
+			Category:   res.Category,
+			Confidence: res.Confidence,
+		})
+	}
+	if !blocked {
+		return "", false
+	}
+	return l.intent.Response(channel, res.Category), true
+}
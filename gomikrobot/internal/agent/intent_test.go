@@ -0,0 +1,106 @@
+package agent
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/kamir/gomikrobot/internal/bus"
+	"github.com/kamir/gomikrobot/internal/config"
+	"github.com/kamir/gomikrobot/internal/costs"
+	"github.com/kamir/gomikrobot/internal/intent"
+	"github.com/kamir/gomikrobot/internal/provider"
+)
+
+func TestBlockedMessageIsLoggedWithChannelResponse(t *testing.T) {
+	tl := newTestTimeline(t)
+	guard, err := intent.NewGuard(config.IntentConfig{
+		Responses: map[string]string{"web": "That request was refused.", "default": "Nein."},
+	}, nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mock := &mockProvider{responses: []provider.ChatResponse{{Content: "Hello!"}}}
+	loop := NewLoop(LoopOptions{
+		Provider:      mock,
+		Timeline:      tl,
+		Workspace:     t.TempDir(),
+		Model:         "mock-model",
+		MaxIterations: 3,
+		Intent:        guard,
+	})
+
+	ctx := context.Background()
+	resp, err := loop.ProcessDirectWithTrace(ctx, "please wipe the repo", "web:u1", "trace-blocked")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp != "That request was refused." || mock.calls != 0 {
+		t.Errorf("expected channel response without LLM call, got %q (%d calls)", resp, mock.calls)
+	}
+	if resp, _ := loop.ProcessDirectWithTrace(ctx, "rm -rf /", "cli:u1", "trace-cli"); resp != "Nein." {
+		t.Errorf("expected default response, got %q", resp)
+	}
+	if resp, _ := loop.ProcessDirectWithTrace(ctx, "hi", "web:u1", "trace-ok"); resp != "Hello!" {
+		t.Errorf("expected LLM answer, got %q", resp)
+	}
+
+	decisions, err := tl.ListPolicyDecisions("trace-blocked")
+	if err != nil || len(decisions) != 1 {
+		t.Fatalf("expected one decision, got %v %+v", err, decisions)
+	}
+	d := decisions[0]
+	if d.Tool != "intent:rules" || d.Allowed || d.Category != intent.CategoryAttack || d.Confidence != 1 || d.Channel != "web" {
+		t.Errorf("unexpected decision %+v", d)
+	}
+	if decisions, _ := tl.ListPolicyDecisions("trace-ok"); len(decisions) != 1 || !decisions[0].Allowed || decisions[0].Category != intent.CategorySafe {
+		t.Errorf("expected allowed safe decision, got %+v", decisions)
+	}
+	loop.sessions.Delete("web:u1")
+	loop.sessions.Delete("cli:u1")
+}
+
+func TestClassifierUsageIsMetered(t *testing.T) {
+	tl := newTestTimeline(t)
+	mock := &mockProvider{responses: []provider.ChatResponse{
+		{Content: `{"category": "safe", "confidence": 0.9, "reason": "greeting"}`, Usage: provider.Usage{PromptTokens: 1_000_000, TotalTokens: 1_000_000}},
+		{Content: "Hello!", Usage: provider.Usage{PromptTokens: 1_000_000, TotalTokens: 1_000_000}},
+	}}
+	guard, err := intent.NewGuard(config.IntentConfig{Classifier: "llm"}, mock, "mock-model")
+	if err != nil {
+		t.Fatal(err)
+	}
+	loop := NewLoop(LoopOptions{
+		Bus:       bus.NewMessageBus(),
+		Provider:  mock,
+		Timeline:  tl,
+		Workspace: t.TempDir(),
+		Model:     "mock-model",
+		Intent:    guard,
+		Costs: costs.NewAccountant(config.CostsConfig{
+			Prices: map[string]config.ModelPrice{"mock-model": {Input: 1}},
+		}, tl),
+	})
+
+	_, taskID, err := loop.processMessage(context.Background(), &bus.InboundMessage{
+		Channel:   "whatsapp",
+		SenderID:  "alice",
+		ChatID:    "alice",
+		TraceID:   "trace-intent-usage",
+		Content:   "hello",
+		Timestamp: time.Now(),
+	})
+	if err != nil {
+		t.Fatalf("processMessage: %v", err)
+	}
+	if mock.calls != 2 {
+		t.Fatalf("expected classifier and agent call, got %d", mock.calls)
+	}
+	spent, err := tl.SpendSince(time.Now().Add(-time.Hour), "whatsapp", "alice")
+	if err != nil || spent < 1.99 || spent > 2.01 {
+		t.Errorf("expected classifier and agent spend 2.00, got %v (%v)", spent, err)
+	}
+	if task, err := tl.GetTask(taskID); err != nil || task.CostUSD < 1.99 || task.CostUSD > 2.01 {
+		t.Errorf("expected task cost 2.00, got %+v (%v)", task, err)
+	}
+}
@@ -0,0 +1,196 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/kamir/gomikrobot/internal/journal"
+	"github.com/kamir/gomikrobot/internal/timeline"
+	"github.com/kamir/gomikrobot/internal/tools"
+)
+
+// errNoJournal is returned by reverts when the loop has no timeline.
+var errNoJournal = errors.New("file journal not available")
+
+// undoCommands are the chat messages that revert the last turn's files.
+var undoCommands = map[string]bool{
+	"undo":        true,
+	"/undo":       true,
+	"rückgängig":  true,
+	"/rückgängig": true,
+}
+
+// parseUndoCommand reports whether a message asks to undo the last turn.
+func parseUndoCommand(content string) bool {
+	return undoCommands[strings.ToLower(strings.TrimSpace(content))]
+}
+
+// snapshotFiles reads the files a tool call may change. It returns nil if
+// the tool changes no files or there is no journal.
+func (l *Loop) snapshotFiles(call *ToolExecution) []journal.Snapshot {
+	if l.journal == nil {
+		return nil
+	}
+	t, ok := l.registry.Get(call.Call.Name)
+	if !ok {
+		return nil
+	}
+	fc, ok := t.(tools.FileChanger)
+	if !ok {
+		return nil
+	}
+	var snaps []journal.Snapshot
+	for _, path := range fc.ChangedFiles(call.Call.Arguments) {
+		snaps = append(snaps, journal.Take(path))
+	}
+	return snaps
+}
+
+// journalChanges records each snapshotted file whose content changed and
+// notes the journal IDs in the tool span.
+func (l *Loop) journalChanges(exec *ToolExecution, before []journal.Snapshot) {
+	var ids []int64
+	for _, b := range before {
+		a := journal.Take(b.Path)
+		if b.Err == nil && a.Err == nil && b.Equal(a) {
+			continue
+		}
+		if b.Err != nil || a.Err != nil {
+			slog.Warn("File change not journaled", "path", b.Path, "before_error", b.Err, "after_error", a.Err)
+			continue
+		}
+		c := &journal.Change{
+			TraceID:      exec.TraceID,
+			TaskID:       exec.TaskID,
+			Channel:      exec.Channel,
+			ChatID:       exec.ChatID,
+			Tool:         exec.Call.Name,
+			Path:         b.Path,
+			BeforeExists: b.Exists,
+			BeforeMode:   b.Mode,
+			Before:       b.Content,
+			AfterExists:  a.Exists,
+			After:        a.Content,
+		}
+		if err := l.journal.Record(c); err != nil {
+			slog.Warn("File change not journaled", "path", b.Path, "error", err)
+			continue
+		}
+		ids = append(ids, c.ID)
+	}
+	if len(ids) > 0 {
+		exec.Meta["file_changes"] = ids
+	}
+}
+
+// handleUndo answers the undo command by reverting the files of the last
+// turn in the chat that changed any. Undo writes files, so the policy
+// engine checks it like a tier 1 tool call named "undo".
+func (l *Loop) handleUndo(ctx context.Context, content string) (string, bool) {
+	if !parseUndoCommand(content) {
+		return "", false
+	}
+	if l.journal == nil {
+		return "Undo is not available: no file journal.", true
+	}
+	rs := requestFrom(ctx)
+	if denied, reason := l.checkPolicy(ctx, "undo", tools.TierWrite, nil, false); denied {
+		return fmt.Sprintf("Undo is not allowed: %s", reason), true
+	}
+	res, err := l.journal.UndoLast(rs.Channel, rs.ChatID)
+	var conflict *journal.ConflictError
+	switch {
+	case errors.Is(err, journal.ErrNothingToRevert):
+		return "Nothing to undo.", true
+	case errors.As(err, &conflict):
+		return fmt.Sprintf("⚠️ Cannot undo: these files were changed since:\n%s\nNothing was reverted.",
+			bulletList(l.displayPaths(conflict.Paths))), true
+	case err != nil:
+		return fmt.Sprintf("Undo failed: %v", err), true
+	}
+	l.revertEvent(rs.TraceID, res, false)
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "↩️ Reverted %d file(s) of the last turn.", res.Files())
+	if len(res.Restored) > 0 {
+		sb.WriteString("\nRestored:\n" + bulletList(l.displayPaths(res.Restored)))
+	}
+	if len(res.Removed) > 0 {
+		sb.WriteString("\nRemoved:\n" + bulletList(l.displayPaths(res.Removed)))
+	}
+	return sb.String(), true
+}
+
+// RevertTask restores the files changed by a task to their state before
+// it. Unless force is set it fails with a *journal.ConflictError when a
+// file changed since the task wrote it.
+func (l *Loop) RevertTask(taskID string, force bool) (*journal.RevertResult, error) {
+	if l.journal == nil {
+		return nil, errNoJournal
+	}
+	res, err := l.journal.RevertTask(taskID, force)
+	if err != nil {
+		return nil, err
+	}
+	l.revertEvent(res.TraceID, res, force)
+	return res, nil
+}
+
+// FileChanges returns the journaled file changes of a task.
+func (l *Loop) FileChanges(taskID string) ([]journal.Change, error) {
+	if l.journal == nil {
+		return nil, errNoJournal
+	}
+	return l.journal.TaskChanges(taskID)
+}
+
+// revertEvent records a revert in the trace of the reverted turn.
+func (l *Loop) revertEvent(traceID string, res *journal.RevertResult, force bool) {
+	if l.timeline == nil || traceID == "" {
+		return
+	}
+	meta, _ := json.Marshal(map[string]any{
+		"task_id":  res.TaskID,
+		"restored": res.Restored,
+		"removed":  res.Removed,
+		"force":    force,
+	})
+	_ = l.timeline.AddEvent(&timeline.TimelineEvent{
+		EventID:        fmt.Sprintf("REVERT_%s_%d", traceID, time.Now().UnixNano()),
+		TraceID:        traceID,
+		Timestamp:      time.Now(),
+		SenderID:       "AGENT",
+		SenderName:     "Journal",
+		EventType:      "SYSTEM",
+		ContentText:    fmt.Sprintf("reverted %d file(s)", res.Files()),
+		Classification: "FILE_REVERT",
+		Authorized:     true,
+		Metadata:       string(meta),
+	})
+}
+
+// displayPaths shortens paths inside the work repo to repo-relative ones.
+func (l *Loop) displayPaths(paths []string) []string {
+	root := l.currentWorkRepo()
+	out := make([]string, len(paths))
+	for i, p := range paths {
+		out[i] = p
+		if root == "" {
+			continue
+		}
+		if rel, err := filepath.Rel(root, p); err == nil && !strings.HasPrefix(rel, "..") {
+			out[i] = rel
+		}
+	}
+	return out
+}
+
+func bulletList(items []string) string {
+	return "- " + strings.Join(items, "\n- ")
+}
@@ -0,0 +1,76 @@
+package agent
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kamir/gomikrobot/internal/bus"
+	"github.com/kamir/gomikrobot/internal/policy"
+	"github.com/kamir/gomikrobot/internal/provider"
+)
+
+func TestUndoRevertsLastTurnFiles(t *testing.T) {
+	repo := t.TempDir()
+	notes := filepath.Join(repo, "notes.md")
+	if err := os.WriteFile(notes, []byte("old\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	created := filepath.Join(repo, "new", "todo.md")
+	mock := &mockProvider{responses: []provider.ChatResponse{
+		{ToolCalls: []provider.ToolCall{
+			{ID: "t1", Name: "edit_file", Arguments: map[string]any{"path": notes, "old_text": "old", "new_text": "new"}},
+			{ID: "t2", Name: "write_file", Arguments: map[string]any{"path": created, "content": "- milk\n"}},
+		}},
+		{Content: "Done."},
+	}}
+	loop := NewLoop(LoopOptions{
+		Provider:      mock,
+		Timeline:      newTestTimeline(t),
+		Workspace:     t.TempDir(),
+		WorkRepo:      repo,
+		Model:         "mock-model",
+		MaxIterations: 3,
+		Policy:        policy.NewDefaultEngine(),
+	})
+	defer loop.sessions.Delete("cli:undo-test")
+
+	ctx := context.Background()
+	if _, err := loop.ProcessDirectWithTrace(ctx, "update my notes", "cli:undo-test", "trace-undo"); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(notes); string(data) != "new\n" {
+		t.Fatalf("edit not applied: %q", data)
+	}
+
+	// Undo writes files: an external sender may not revert the owner's turn.
+	stranger := withRequest(ctx, &requestState{Sender: "stranger", Channel: "cli", ChatID: "undo-test", MessageType: bus.MessageTypeExternal})
+	if resp, _ := loop.handleUndo(stranger, "undo"); !strings.Contains(resp, "not allowed") {
+		t.Errorf("expected external undo to be denied, got %q", resp)
+	}
+	if data, _ := os.ReadFile(notes); string(data) != "new\n" {
+		t.Fatalf("denied undo changed the notes: %q", data)
+	}
+
+	resp, err := loop.ProcessDirect(ctx, "undo", "cli:undo-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(resp, "Reverted 2 file(s)") || !strings.Contains(resp, "new/todo.md") {
+		t.Errorf("unexpected undo reply %q", resp)
+	}
+	if data, _ := os.ReadFile(notes); string(data) != "old\n" {
+		t.Errorf("notes not restored: %q", data)
+	}
+	if _, err := os.Stat(created); !os.IsNotExist(err) {
+		t.Errorf("created file not removed: %v", err)
+	}
+	if resp, _ := loop.ProcessDirect(ctx, "undo", "cli:undo-test"); resp != "Nothing to undo." {
+		t.Errorf("expected nothing left to undo, got %q", resp)
+	}
+	if mock.calls != 2 {
+		t.Errorf("undo must not call the LLM, got %d calls", mock.calls)
+	}
+}
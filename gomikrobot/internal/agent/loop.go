@@ -4,16 +4,22 @@ package agent
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
 	"os"
 	"path/filepath"
-	"regexp"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/kamir/gomikrobot/internal/approval"
 	"github.com/kamir/gomikrobot/internal/bus"
+	"github.com/kamir/gomikrobot/internal/config"
+	"github.com/kamir/gomikrobot/internal/costs"
+	"github.com/kamir/gomikrobot/internal/day2day"
+	"github.com/kamir/gomikrobot/internal/intent"
+	"github.com/kamir/gomikrobot/internal/journal"
 	"github.com/kamir/gomikrobot/internal/memory"
 	"github.com/kamir/gomikrobot/internal/policy"
 	"github.com/kamir/gomikrobot/internal/provider"
@@ -43,6 +49,36 @@ type LoopOptions struct {
 	WorkRepoGetter func() string
 	Model          string
 	MaxIterations  int
+	// MaxParallelTools bounds concurrent read-only tool calls in one
+	// response (0 = default, 1 = sequential).
+	MaxParallelTools int
+	// HistoryTokens is the token budget for session history before older
+	// turns are compacted into a summary (0 = default).
+	HistoryTokens int
+	// MaxConcurrentSessions bounds how many sessions are processed at the
+	// same time (0 = default).
+	MaxConcurrentSessions int
+	// ToolOutputChars is the tool result size above which the output is
+	// saved as an artifact and previewed (0 = default).
+	ToolOutputChars int
+	// Costs prices LLM calls and enforces spend budgets (optional).
+	Costs *costs.Accountant
+	// Profiles are the per-chat agent profiles and their bindings.
+	Profiles config.AgentProfilesConfig
+	// Hooks run at each step of a turn within the built-in hooks (see
+	// hookChain).
+	Hooks []Hook
+	// Day2DayStore holds the day plan tasks (default: a store on Timeline).
+	Day2DayStore *day2day.Store
+	// Intent screens user messages before the LLM (default: the built-in
+	// attack rules).
+	Intent *intent.Guard
+	// Tools configures the web tools; web_search is only registered when a
+	// search API key is set.
+	Tools config.ToolsConfig
+	// Approvals gates tool calls that need approval (default: a manager on
+	// Timeline, which expires all pending approvals on creation).
+	Approvals *approval.Manager
 }
 
 // Loop is the core agent processing engine.
@@ -63,15 +99,46 @@ type Loop struct {
 	workRepoGetter func() string
 	model          string
 	maxIterations  int
-	running        bool
-	// activeTaskID tracks the current task being processed (for token accounting).
-	activeTaskID string
-	// activeSender tracks the sender of the current message (for policy checks).
-	activeSender      string
-	activeChannel     string
-	activeChatID      string
-	activeTraceID     string
-	activeMessageType string
+	// maxParallelTools bounds concurrent read-only tool calls (1 = sequential).
+	maxParallelTools int
+	costs            *costs.Accountant
+	profiles         *profileSet
+	running          bool
+
+	// Hooks run at each step of a turn: extraHooks from LoopOptions within
+	// the built-in ones (see hookChain).
+	hooks      []Hook
+	extraHooks []Hook
+
+	// Large tool outputs are spilled here (see artifacts.go).
+	artifacts       *tools.ArtifactStore
+	toolOutputChars int
+
+	// Day plan tasks behind the dt* commands (see day2day.go).
+	day2day *day2day.Service
+
+	// Screens user messages before the LLM (see intent.go).
+	intent *intent.Guard
+
+	// Before/after contents of files changed by tools, for undo (see
+	// journal.go). Nil without a timeline.
+	journal *journal.Journal
+
+	// Set on sub-agent loops only (see subagent.go): the token budget of
+	// the run, the tokens used so far and the label on its spans.
+	tokenBudget int
+	tokensUsed  int
+	agentName   string
+
+	// Per-session workers started by Run (see workers.go).
+	workersMu sync.Mutex
+	workers   map[string]*sessionWorker
+	workerWG  sync.WaitGroup
+	slots     chan struct{}
+
+	// Tasks in progress by session key, for cancellation (see cancel.go).
+	inflightMu sync.Mutex
+	inflight   map[string]*inflightTask
 }
 
 // NewLoop creates a new agent loop.
@@ -80,38 +147,67 @@ func NewLoop(opts LoopOptions) *Loop {
 	if maxIter == 0 {
 		maxIter = 20
 	}
+	maxSessions := opts.MaxConcurrentSessions
+	if maxSessions <= 0 {
+		maxSessions = defaultConcurrentSessions
+	}
 
 	registry := tools.NewRegistry()
 
 	// Create context builder
 	ctxBuilder := NewContextBuilder(opts.Workspace, opts.WorkRepo, opts.SystemRepo, registry)
+	ctxBuilder.historyTokens = opts.HistoryTokens
 
 	loop := &Loop{
-		bus:            opts.Bus,
-		provider:       opts.Provider,
-		timeline:       opts.Timeline,
-		policy:         opts.Policy,
-		memoryService:  opts.MemoryService,
-		groupPublisher: opts.GroupPublisher,
-		approvalMgr:    approval.NewManager(opts.Timeline),
-		registry:       registry,
-		sessions:       session.NewManager(opts.Workspace),
-		contextBuilder: ctxBuilder,
-		workspace:      opts.Workspace,
-		workRepo:       opts.WorkRepo,
-		systemRepo:     opts.SystemRepo,
-		workRepoGetter: opts.WorkRepoGetter,
-		model:          opts.Model,
-		maxIterations:  maxIter,
+		bus:              opts.Bus,
+		provider:         opts.Provider,
+		timeline:         opts.Timeline,
+		policy:           opts.Policy,
+		memoryService:    opts.MemoryService,
+		groupPublisher:   opts.GroupPublisher,
+		approvalMgr:      opts.Approvals,
+		registry:         registry,
+		sessions:         session.NewManager(opts.Workspace),
+		contextBuilder:   ctxBuilder,
+		workspace:        opts.Workspace,
+		workRepo:         opts.WorkRepo,
+		systemRepo:       opts.SystemRepo,
+		workRepoGetter:   opts.WorkRepoGetter,
+		model:            opts.Model,
+		maxIterations:    maxIter,
+		costs:            opts.Costs,
+		profiles:         newProfileSet(opts.Profiles),
+		artifacts:        tools.NewArtifactStore(artifactsDir(opts.Workspace)),
+		toolOutputChars:  opts.ToolOutputChars,
+		maxParallelTools: opts.MaxParallelTools,
+		workers:          map[string]*sessionWorker{},
+		slots:            make(chan struct{}, maxSessions),
+		inflight:         map[string]*inflightTask{},
+	}
+
+	if loop.approvalMgr == nil {
+		loop.approvalMgr = approval.NewManager(opts.Timeline)
 	}
 
 	// Register default tools
-	loop.registerDefaultTools()
+	loop.registerDefaultTools(opts.Tools)
+	loop.setHooks(opts.Hooks)
+	if opts.Day2DayStore == nil && opts.Timeline != nil {
+		opts.Day2DayStore = day2day.NewStore(opts.Timeline)
+	}
+	loop.day2day = loop.newDay2Day(opts.Day2DayStore)
+	loop.intent = opts.Intent
+	if loop.intent == nil {
+		loop.intent = intent.DefaultGuard()
+	}
+	if opts.Timeline != nil {
+		loop.journal = journal.New(opts.Timeline)
+	}
 
 	return loop
 }
 
-func (l *Loop) registerDefaultTools() {
+func (l *Loop) registerDefaultTools(cfg config.ToolsConfig) {
 	l.registry.Register(tools.NewReadFileTool())
 	repoGetter := l.workRepoGetter
 	if repoGetter == nil {
@@ -121,7 +217,24 @@ func (l *Loop) registerDefaultTools() {
 	l.registry.Register(tools.NewEditFileTool(repoGetter))
 	l.registry.Register(tools.NewListDirTool())
 	l.registry.Register(tools.NewResolvePathTool(repoGetter))
-	l.registry.Register(tools.NewExecTool(0, true, l.workspace, repoGetter))
+	execTool := tools.NewExecTool(0, true, l.workspace, repoGetter)
+	execTool.Sandbox = cfg.Exec.Sandbox
+	execTool.SandboxProfiles = cfg.Exec.SandboxProfiles
+	l.registry.Register(execTool)
+	readArtifact := tools.NewReadArtifactTool(l.artifacts)
+	readArtifact.MaxChars = l.toolOutputChars
+	l.registry.Register(readArtifact)
+	l.registry.Register(&spawnAgentTool{parent: l})
+	l.registry.Register(tools.NewWebFetchTool(cfg.Web.Fetch))
+
+	if search := cfg.Web.Search; search.APIKey != "" {
+		backend, err := tools.NewSearchBackend(search.Backend, search.APIKey)
+		if err != nil {
+			slog.Warn("web_search not registered", "error", err)
+		} else {
+			l.registry.Register(tools.NewWebSearchTool(backend, search.MaxResults))
+		}
+	}
 
 	// Register memory tools only when memory service is available.
 	if l.memoryService != nil {
@@ -139,7 +252,7 @@ func (l *Loop) Run(ctx context.Context) error {
 		msg, err := l.bus.ConsumeInbound(ctx)
 		if err != nil {
 			if ctx.Err() != nil {
-				return nil // Context cancelled, normal shutdown
+				break // Context cancelled, normal shutdown
 			}
 			slog.Error("Failed to consume message", "error", err)
 			continue
@@ -170,30 +283,54 @@ func (l *Loop) Run(ctx context.Context) error {
 			continue
 		}
 
-		response, taskID, err := l.processMessage(ctx, msg)
-		if err != nil {
-			slog.Error("Failed to process message", "error", err)
-			response = fmt.Sprintf("Error: %v", err)
-		}
-
-		if response != "" {
-			l.bus.PublishOutbound(&bus.OutboundMessage{
-				Channel: msg.Channel,
-				ChatID:  msg.ChatID,
-				TraceID: msg.TraceID,
-				TaskID:  taskID,
-				Content: response,
-			})
-			// Optimistic delivery mark
-			if l.timeline != nil && taskID != "" {
-				_ = l.timeline.UpdateTaskDelivery(taskID, timeline.DeliverySent, nil)
+		// Intercept stop/cancel for the task running in this chat. Like
+		// approval responses it bypasses the session queue. Without a
+		// running task of this sender it is an ordinary message.
+		if parseCancelCommand(msg.Content) {
+			internal := msg.MessageType() == bus.MessageTypeInternal
+			if _, ok := l.cancelSession(SessionKey(msg.Channel, msg.ChatID), msg.SenderID, internal); ok {
+				l.bus.PublishOutbound(&bus.OutboundMessage{
+					Channel: msg.Channel,
+					ChatID:  msg.ChatID,
+					TraceID: msg.TraceID,
+					Content: "Cancelling the running task…",
+				})
+				continue
 			}
 		}
+
+		// Messages of one session run in order; sessions run concurrently.
+		l.dispatch(ctx, msg)
 	}
 
+	l.workerWG.Wait()
 	return nil
 }
 
+// handleInbound processes one bus message and publishes the response.
+func (l *Loop) handleInbound(ctx context.Context, msg *bus.InboundMessage) {
+	response, taskID, err := l.processMessage(ctx, msg)
+	if err != nil {
+		slog.Error("Failed to process message", "error", err)
+		response = fmt.Sprintf("Error: %v", err)
+	}
+
+	if response != "" {
+		l.bus.PublishOutbound(&bus.OutboundMessage{
+			Channel: msg.Channel,
+			ChatID:  msg.ChatID,
+			TraceID: msg.TraceID,
+			TaskID:  taskID,
+			Content: response,
+			Voice:   msg.WantsVoiceReply(),
+		})
+		// Optimistic delivery mark
+		if l.timeline != nil && taskID != "" {
+			_ = l.timeline.UpdateTaskDelivery(taskID, timeline.DeliverySent, nil)
+		}
+	}
+}
+
 // Stop signals the agent loop to stop.
 func (l *Loop) Stop() {
 	l.running = false
@@ -206,6 +343,23 @@ func (l *Loop) ProcessDirect(ctx context.Context, content, sessionKey string) (s
 
 // ProcessDirectWithTrace processes a message with an explicit trace id.
 func (l *Loop) ProcessDirectWithTrace(ctx context.Context, content, sessionKey, traceID string) (string, error) {
+	return l.processDirect(ctx, content, nil, sessionKey, traceID)
+}
+
+// DeleteSession removes a session's history from memory and disk.
+func (l *Loop) DeleteSession(key string) bool {
+	return l.sessions.Delete(key)
+}
+
+// Registry returns the loop's tool registry, for tools that are added at
+// runtime (MCP servers).
+func (l *Loop) Registry() *tools.Registry {
+	return l.registry
+}
+
+// processDirect runs one user turn. Media are local attachment paths that
+// are passed to the model alongside the text of this turn only.
+func (l *Loop) processDirect(ctx context.Context, content string, media []string, sessionKey, traceID string) (string, error) {
 	// Extract channel and chatID from key if possible
 	parts := strings.SplitN(sessionKey, ":", 2)
 	channel, chatID := "cli", "default"
@@ -217,37 +371,64 @@ func (l *Loop) ProcessDirectWithTrace(ctx context.Context, content, sessionKey,
 	}
 
 	// CLI direct calls are always internal (owner). Bus-routed messages
-	// have activeMessageType set by processMessage before calling here.
-	if l.activeMessageType == "" {
-		l.activeMessageType = bus.MessageTypeInternal
+	// carry the request state set by processMessage.
+	rs := requestFrom(ctx)
+	if rs.MessageType == "" {
+		rs = &requestState{MessageType: bus.MessageTypeInternal, TraceID: traceID,
+			Profile: l.profiles.resolve(channel, chatID, "")}
+		ctx = withRequest(ctx, rs)
 	}
 
+	// Meter helper LLM calls (intent classification, day2day consolidation)
+	// like the agent's own, with the request's sender and channel
+	reqCtx := ctx
+	ctx = provider.WithUsageObserver(ctx, func(resp *provider.ChatResponse) {
+		l.trackTokens(reqCtx, resp)
+	})
+
 	// Get or create session
 	sess := l.sessions.GetOrCreate(sessionKey)
 	sess.AddMessage("user", content)
 
-	if response, handled := l.handleDay2Day(sess, content); handled {
+	if response, handled := l.handleUndo(ctx, content); handled {
 		sess.AddMessage("assistant", response)
 		l.sessions.Save(sess)
 		return response, nil
 	}
 
-	if isAttackIntent(content) {
-		response := "Ey, du spinnst wohl? Hä? 💣 👮‍♂️ 🔒"
+	if response, handled := l.handleDay2Day(ctx, sess, content); handled {
 		sess.AddMessage("assistant", response)
 		l.sessions.Save(sess)
 		return response, nil
 	}
 
-	// Build messages using the context builder
-	messages := l.contextBuilder.BuildMessages(sess, content, channel, chatID, l.activeMessageType)
+	if response, blocked := l.screenMessage(ctx, rs, channel, content); blocked {
+		sess.AddMessage("assistant", response)
+		l.sessions.Save(sess)
+		return response, nil
+	}
+
+	// Record provider retries (rate limits, flaky upstreams) in the trace
+	if l.timeline != nil && rs.TraceID != "" {
+		ctx = provider.WithRetryObserver(ctx, l.retrySpan(rs.TraceID))
+	}
+
+	// Fold older turns into the rolling summary when history is over budget
+	l.compactSession(ctx, sess)
 
-	// Inject RAG context from semantic memory
-	messages = l.injectRAGContext(ctx, messages, content)
+	// Build messages using the context builder
+	messages := l.contextBuilder.forProfile(rs.Profile).BuildMessages(sess, content, channel, chatID, rs.MessageType, media)
+	l.spillAttachments(rs, &messages[len(messages)-1])
 
-	// Run the agentic loop
+	// Run the agentic loop (semantic memory is added by the RAG hook)
 	response, err := l.runAgentLoop(ctx, messages)
 	if err != nil {
+		if taskCancelled(ctx) {
+			response = cancelledResponse(rs)
+			sess.AddMessage("assistant", response)
+			l.sessions.Save(sess)
+			return response, errTaskCancelled
+		}
 		return "", err
 	}
 
@@ -258,504 +439,6 @@ func (l *Loop) ProcessDirectWithTrace(ctx context.Context, content, sessionKey,
 	return response, nil
 }
 
-func isAttackIntent(content string) bool {
-	lower := strings.ToLower(content)
-	if lower == "" {
-		return false
-	}
-	badPatterns := []string{
-		`(?i)\bdelete\b.*\brepo\b`,
-		`(?i)\brepo\b.*\bdelete\b`,
-		`(?i)\bremove\b.*\brepo\b`,
-		`(?i)\brepo\b.*\bremove\b`,
-		`(?i)\bwipe\b.*\brepo\b`,
-		`(?i)\bdelete\b.*\bcontent\b`,
-		`(?i)\bdelete\b.*\ball\b.*\bfiles\b`,
-		`(?i)\bremove\b.*\ball\b.*\bfiles\b`,
-		`(?i)\brm\s+-rf\b`,
-		`(?i)\blösch\b.*\brepo\b`,
-		`(?i)\blösch\b.*\ball\b`,
-		`(?i)\bdatei(en)?\b.*\blösch\b`,
-	}
-	for _, pattern := range badPatterns {
-		if re, err := regexp.Compile(pattern); err == nil && re.MatchString(lower) {
-			return true
-		}
-	}
-	return false
-}
-
-func (l *Loop) handleDay2Day(sess *session.Session, content string) (string, bool) {
-	raw := strings.TrimSpace(content)
-	if raw == "" {
-		return "", false
-	}
-
-	if statusText, ok := l.handleDay2DayStatus(raw); ok {
-		return statusText, true
-	}
-
-	cmd, ok := parseDay2DayCommand(raw)
-	captureMode, captureBuffer := getDay2DayCapture(sess)
-	if captureMode != "" {
-		if ok && cmd.Kind == "dtc" {
-			if strings.TrimSpace(captureBuffer) == "" {
-				clearDay2DayCapture(sess)
-				return "Day2Day: capture was empty. Send dtu/dtp then content, end with dtc.", true
-			}
-			clearDay2DayCapture(sess)
-			return l.applyDay2DayCommand(captureMode, captureBuffer), true
-		}
-		captureBuffer = strings.TrimSpace(captureBuffer + "\n" + raw)
-		setDay2DayCapture(sess, captureMode, captureBuffer)
-		return "Day2Day: captured. Send dtc to close.", true
-	}
-
-	if !ok {
-		return "", false
-	}
-
-	switch cmd.Kind {
-	case "dtu", "dtp":
-		if cmd.Text == "" {
-			setDay2DayCapture(sess, cmd.Kind, "")
-			return fmt.Sprintf("Day2Day: %s capture started. Send dtc to close.", cmd.Kind), true
-		}
-		return l.applyDay2DayCommand(cmd.Kind, cmd.Text), true
-	case "dts":
-		return l.consolidateDay2Day(time.Now()), true
-	case "dtn":
-		return l.planNextDay2Day(time.Now()), true
-	case "dta":
-		return l.planAllDay2Day(time.Now()), true
-	case "dtc":
-		return "Day2Day: no open capture. Send dtu or dtp to start.", true
-	default:
-		return "", false
-	}
-}
-
-type day2DayCommand struct {
-	Kind string
-	Text string
-}
-
-func parseDay2DayCommand(input string) (day2DayCommand, bool) {
-	fields := strings.Fields(input)
-	if len(fields) == 0 {
-		return day2DayCommand{}, false
-	}
-	cmd := strings.ToLower(fields[0])
-	switch cmd {
-	case "dtu", "dtp", "dts", "dtc", "dtn", "dta":
-		text := ""
-		if len(fields) > 1 {
-			text = strings.TrimSpace(input[len(fields[0]):])
-		}
-		return day2DayCommand{Kind: cmd, Text: strings.TrimSpace(text)}, true
-	default:
-		return day2DayCommand{}, false
-	}
-}
-
-const (
-	day2DayCaptureModeKey   = "day2day_capture_mode"
-	day2DayCaptureBufferKey = "day2day_capture_buffer"
-)
-
-func getDay2DayCapture(sess *session.Session) (string, string) {
-	modeRaw, _ := sess.GetMetadata(day2DayCaptureModeKey)
-	bufRaw, _ := sess.GetMetadata(day2DayCaptureBufferKey)
-	mode, _ := modeRaw.(string)
-	buf, _ := bufRaw.(string)
-	return strings.TrimSpace(mode), strings.TrimSpace(buf)
-}
-
-func setDay2DayCapture(sess *session.Session, mode, buffer string) {
-	sess.SetMetadata(day2DayCaptureModeKey, mode)
-	sess.SetMetadata(day2DayCaptureBufferKey, buffer)
-}
-
-func clearDay2DayCapture(sess *session.Session) {
-	sess.DeleteMetadata(day2DayCaptureModeKey)
-	sess.DeleteMetadata(day2DayCaptureBufferKey)
-}
-
-func (l *Loop) handleDay2DayStatus(input string) (string, bool) {
-	date, ok := parseStatusDate(input)
-	if !ok {
-		return "", false
-	}
-
-	contents, path, err := l.loadDay2Day(date)
-	if err != nil {
-		return "Day2Day Fehler: Bot-System-Repo nicht gefunden.", true
-	}
-	if contents == "" {
-		return fmt.Sprintf("Day2Day: keine Datei gefunden für %s (%s). Pfad: %s", date.Format("2006-01-02"), date.Weekday(), path), true
-	}
-
-	open, done := parseTasks(contents)
-	next := nextSuggestion(contents)
-	var sb strings.Builder
-	sb.WriteString(fmt.Sprintf("Day2Day Status — %s (%s)\n", date.Format("2006-01-02"), date.Weekday()))
-	sb.WriteString(fmt.Sprintf("Open: %d | Done: %d\n", len(open), len(done)))
-	if next != "" {
-		sb.WriteString(fmt.Sprintf("Next: %s\n", next))
-	}
-	if len(open) > 0 {
-		sb.WriteString("Open Tasks:\n")
-		for i, task := range open {
-			if i >= 5 {
-				sb.WriteString("... (more)\n")
-				break
-			}
-			sb.WriteString(fmt.Sprintf("- %s\n", task))
-		}
-	}
-	return strings.TrimSpace(sb.String()), true
-}
-
-func parseStatusDate(input string) (time.Time, bool) {
-	lower := strings.ToLower(input)
-	if !(strings.Contains(lower, "status") && (strings.Contains(lower, "task") || strings.Contains(lower, "aufgabe") || strings.Contains(lower, "day2day"))) {
-		return time.Time{}, false
-	}
-	if m := regexp.MustCompile(`\b\d{4}-\d{2}-\d{2}\b`).FindString(lower); m != "" {
-		if t, err := time.Parse("2006-01-02", m); err == nil {
-			return t, true
-		}
-	}
-	now := time.Now()
-	switch {
-	case strings.Contains(lower, "yesterday") || strings.Contains(lower, "gestern"):
-		return now.AddDate(0, 0, -1), true
-	case strings.Contains(lower, "tomorrow") || strings.Contains(lower, "morgen"):
-		return now.AddDate(0, 0, 1), true
-	default:
-		return now, true
-	}
-}
-
-func (l *Loop) applyDay2DayCommand(kind, text string) string {
-	date := time.Now()
-	contents, path, err := l.loadOrInitDay2Day(date)
-	if err != nil {
-		return "Day2Day Fehler: Bot-System-Repo nicht gefunden."
-	}
-
-	updated := contents
-	switch kind {
-	case "dtu":
-		tasks := extractTasksFromText(text)
-		updated = addTasks(updated, tasks)
-		updated = appendProgress(updated, fmt.Sprintf("- %s: UPDATE — %s\n", time.Now().Format("15:04"), strings.TrimSpace(text)))
-	case "dtp":
-		updated = appendProgress(updated, fmt.Sprintf("- %s: PROGRESS — %s\n", time.Now().Format("15:04"), strings.TrimSpace(text)))
-	}
-
-	next := nextSuggestion(updated)
-	updated = setNextStep(updated, next)
-
-	if err := os.WriteFile(path, []byte(updated), 0644); err != nil {
-		return "Day2Day Fehler: Konnte Tagesdatei nicht schreiben."
-	}
-	if next == "" {
-		return "Aktualisiert. Keine offenen Tasks gefunden."
-	}
-	return fmt.Sprintf("Aktualisiert. Nächster Schritt: %s", next)
-}
-
-func (l *Loop) consolidateDay2Day(date time.Time) string {
-	contents, path, err := l.loadOrInitDay2Day(date)
-	if err != nil {
-		return "Day2Day Fehler: Bot-System-Repo nicht gefunden."
-	}
-
-	open, done := parseTasks(contents)
-	open = uniqueTasks(open)
-	done = uniqueTasks(done)
-	updated := setTasks(contents, open, done)
-	updated = setConsolidatedState(updated, len(open), len(done), time.Now())
-	next := nextSuggestion(updated)
-	updated = setNextStep(updated, next)
-
-	if err := os.WriteFile(path, []byte(updated), 0644); err != nil {
-		return "Day2Day Fehler: Konnte Tagesdatei nicht schreiben."
-	}
-	return fmt.Sprintf("Konsolidiert. Open: %d | Done: %d", len(open), len(done))
-}
-
-func (l *Loop) planNextDay2Day(date time.Time) string {
-	contents, _, err := l.loadDay2Day(date)
-	if err != nil || contents == "" {
-		return "Day2Day: keine Tagesdatei gefunden."
-	}
-	next := nextSuggestion(contents)
-	if next == "" {
-		return "Day2Day: keine offenen Tasks."
-	}
-	return fmt.Sprintf("Vorschlag Nächster Schritt: %s", next)
-}
-
-func (l *Loop) planAllDay2Day(date time.Time) string {
-	contents, _, err := l.loadDay2Day(date)
-	if err != nil || contents == "" {
-		return "Day2Day: keine Tagesdatei gefunden."
-	}
-	open, _ := parseTasks(contents)
-	if len(open) == 0 {
-		return "Day2Day: keine offenen Tasks."
-	}
-	var sb strings.Builder
-	sb.WriteString("Vorschlag Alle offenen Schritte:\n")
-	for _, task := range open {
-		sb.WriteString(fmt.Sprintf("- %s\n", task))
-	}
-	return strings.TrimSpace(sb.String())
-}
-
-func (l *Loop) day2DayTasksDir() (string, error) {
-	base := l.systemRepoPath()
-	if base == "" {
-		return "", fmt.Errorf("system repo not found")
-	}
-	return filepath.Join(base, "operations", "day2day", "tasks"), nil
-}
-
-func (l *Loop) loadOrInitDay2Day(date time.Time) (string, string, error) {
-	dir, err := l.day2DayTasksDir()
-	if err != nil {
-		return "", "", err
-	}
-	path := filepath.Join(dir, date.Format("2006-01-02")+".md")
-	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
-		return "", "", err
-	}
-	if data, err := os.ReadFile(path); err == nil {
-		return string(data), path, nil
-	}
-	header := fmt.Sprintf("# Day2Day — %s (%s)\n\n", date.Format("2006-01-02"), date.Weekday())
-	template := header +
-		"## Tasks\n\n" +
-		"## Progress Log\n\n" +
-		"## Notes / Context\n\n" +
-		"## Consolidated State\n\n" +
-		"## Next Step\n\n"
-	return template, path, nil
-}
-
-func (l *Loop) loadDay2Day(date time.Time) (string, string, error) {
-	dir, err := l.day2DayTasksDir()
-	if err != nil {
-		return "", "", err
-	}
-	path := filepath.Join(dir, date.Format("2006-01-02")+".md")
-	data, err := os.ReadFile(path)
-	if err != nil {
-		if os.IsNotExist(err) {
-			return "", path, nil
-		}
-		return "", path, err
-	}
-	return string(data), path, nil
-}
-
-func extractTasksFromText(text string) []string {
-	lines := strings.Split(text, "\n")
-	var tasks []string
-	for _, line := range lines {
-		t := strings.TrimSpace(line)
-		t = strings.TrimPrefix(t, "-")
-		t = strings.TrimPrefix(t, "*")
-		t = strings.TrimPrefix(t, "+")
-		t = strings.TrimSpace(t)
-		if t == "" {
-			continue
-		}
-		tasks = append(tasks, t)
-	}
-	return tasks
-}
-
-func parseTasks(contents string) ([]string, []string) {
-	var open []string
-	var done []string
-	lines := strings.Split(contents, "\n")
-	inTasks := false
-	for _, line := range lines {
-		if strings.HasPrefix(line, "## ") {
-			inTasks = strings.TrimSpace(line) == "## Tasks"
-			continue
-		}
-		if !inTasks {
-			continue
-		}
-		if strings.HasPrefix(line, "- [ ]") {
-			open = append(open, strings.TrimSpace(strings.TrimPrefix(line, "- [ ]")))
-		} else if strings.HasPrefix(strings.ToLower(line), "- [x]") {
-			done = append(done, strings.TrimSpace(strings.TrimPrefix(line, "- [x]")))
-		}
-	}
-	return open, done
-}
-
-func addTasks(contents string, tasks []string) string {
-	if len(tasks) == 0 {
-		return contents
-	}
-	open, done := parseTasks(contents)
-	existing := map[string]bool{}
-	for _, t := range open {
-		existing[strings.ToLower(t)] = true
-	}
-	for _, t := range done {
-		existing[strings.ToLower(t)] = true
-	}
-	var toAdd []string
-	for _, t := range tasks {
-		if !existing[strings.ToLower(t)] {
-			toAdd = append(toAdd, t)
-		}
-	}
-	if len(toAdd) == 0 {
-		return contents
-	}
-	taskLines := ""
-	for _, t := range toAdd {
-		taskLines += fmt.Sprintf("- [ ] %s\n", t)
-	}
-	return insertIntoSection(contents, "## Tasks", taskLines)
-}
-
-func setTasks(contents string, open, done []string) string {
-	var sb strings.Builder
-	sb.WriteString("## Tasks\n")
-	for _, t := range open {
-		sb.WriteString(fmt.Sprintf("- [ ] %s\n", t))
-	}
-	for _, t := range done {
-		sb.WriteString(fmt.Sprintf("- [x] %s\n", t))
-	}
-	return replaceSection(contents, "## Tasks", sb.String())
-}
-
-func setConsolidatedState(contents string, openCount, doneCount int, at time.Time) string {
-	block := fmt.Sprintf("## Consolidated State\n- Open: %d\n- Done: %d\n- Last Consolidation: %s\n",
-		openCount, doneCount, at.Format("15:04"))
-	return replaceSection(contents, "## Consolidated State", block)
-}
-
-func setNextStep(contents, next string) string {
-	if next == "" {
-		next = "none"
-	}
-	block := fmt.Sprintf("## Next Step\n- %s\n", next)
-	return replaceSection(contents, "## Next Step", block)
-}
-
-func insertIntoSection(contents, header, insert string) string {
-	lines := strings.Split(contents, "\n")
-	var out []string
-	inSection := false
-	inserted := false
-	for i, line := range lines {
-		out = append(out, line)
-		if strings.TrimSpace(line) == header {
-			inSection = true
-			continue
-		}
-		if inSection && strings.HasPrefix(line, "## ") && strings.TrimSpace(line) != header {
-			if !inserted {
-				out = append(out[:len(out)-1], strings.Split(strings.TrimRight(insert, "\n"), "\n")...)
-				out = append(out, line)
-				inserted = true
-			}
-			inSection = false
-		}
-		if i == len(lines)-1 && inSection && !inserted {
-			out = append(out, strings.Split(strings.TrimRight(insert, "\n"), "\n")...)
-			inserted = true
-		}
-	}
-	if !inserted {
-		return contents + "\n" + header + "\n" + insert
-	}
-	return strings.Join(out, "\n")
-}
-
-func replaceSection(contents, header, newBlock string) string {
-	lines := strings.Split(contents, "\n")
-	start := -1
-	end := len(lines)
-	for i, line := range lines {
-		if strings.TrimSpace(line) == header {
-			start = i
-			continue
-		}
-		if start != -1 && strings.HasPrefix(line, "## ") && i > start {
-			end = i
-			break
-		}
-	}
-	if start == -1 {
-		return contents + "\n" + strings.TrimRight(newBlock, "\n") + "\n"
-	}
-	newLines := append([]string{}, lines[:start]...)
-	newLines = append(newLines, strings.Split(strings.TrimRight(newBlock, "\n"), "\n")...)
-	newLines = append(newLines, lines[end:]...)
-	return strings.Join(newLines, "\n")
-}
-
-func uniqueTasks(tasks []string) []string {
-	seen := map[string]bool{}
-	var out []string
-	for _, t := range tasks {
-		key := strings.ToLower(strings.TrimSpace(t))
-		if key == "" || seen[key] {
-			continue
-		}
-		seen[key] = true
-		out = append(out, strings.TrimSpace(t))
-	}
-	return out
-}
-
-func appendProgress(contents, line string) string {
-	if strings.Contains(contents, "## Progress Log") {
-		parts := strings.Split(contents, "## Progress Log")
-		if len(parts) >= 2 {
-			return parts[0] + "## Progress Log\n" + "\n" + line + parts[1]
-		}
-	}
-	return contents + "\n## Progress Log\n" + line
-}
-
-func markDone(contents, doneText string) string {
-	lines := strings.Split(contents, "\n")
-	lowerDone := strings.ToLower(doneText)
-	for i, line := range lines {
-		if strings.Contains(line, "- [ ]") {
-			taskText := strings.ToLower(line)
-			if lowerDone != "" && strings.Contains(taskText, lowerDone) {
-				lines[i] = strings.Replace(line, "- [ ]", "- [x]", 1)
-				break
-			}
-		}
-	}
-	return strings.Join(lines, "\n")
-}
-
-func nextSuggestion(contents string) string {
-	lines := strings.Split(contents, "\n")
-	for _, line := range lines {
-		if strings.HasPrefix(line, "- [ ]") {
-			return strings.TrimSpace(strings.TrimPrefix(line, "- [ ]"))
-		}
-	}
-	return ""
-}
-
 func (l *Loop) systemRepoPath() string {
 	if l.systemRepo != "" {
 		path := l.systemRepo
@@ -847,7 +530,7 @@ func (l *Loop) processMessage(ctx context.Context, msg *bus.InboundMessage) (res
 			slog.Warn("Dedup lookup failed", "error", lookupErr)
 		} else if existing != nil {
 			switch existing.Status {
-			case timeline.TaskStatusCompleted:
+			case timeline.TaskStatusCompleted, timeline.TaskStatusCancelled:
 				slog.Info("Dedup hit: returning cached result", "task_id", existing.TaskID)
 				return existing.ContentOut, existing.TaskID, nil
 			case timeline.TaskStatusProcessing:
@@ -857,6 +540,13 @@ func (l *Loop) processMessage(ctx context.Context, msg *bus.InboundMessage) (res
 		}
 	}
 
+	// Agent profile bound to this channel, chat or sender
+	profile := l.profiles.resolve(msg.Channel, msg.ChatID, msg.SenderID)
+	profileName := ""
+	if profile != nil {
+		profileName = profile.Name
+	}
+
 	// CREATE TASK (H-004)
 	if l.timeline != nil {
 		task, createErr := l.timeline.CreateTask(&timeline.AgentTask{
@@ -867,6 +557,7 @@ func (l *Loop) processMessage(ctx context.Context, msg *bus.InboundMessage) (res
 			SenderID:       msg.SenderID,
 			ContentIn:      msg.Content,
 			MessageType:    msg.MessageType(),
+			Profile:        profileName,
 		})
 		if createErr != nil {
 			slog.Warn("Failed to create task", "error", createErr)
@@ -876,154 +567,101 @@ func (l *Loop) processMessage(ctx context.Context, msg *bus.InboundMessage) (res
 		}
 	}
 
-	// Set active context for policy checks and token tracking
-	l.activeTaskID = taskID
-	l.activeSender = msg.SenderID
-	l.activeChannel = msg.Channel
-	l.activeChatID = msg.ChatID
-	l.activeTraceID = msg.TraceID
-	l.activeMessageType = msg.MessageType()
+	// Request context for policy checks, token tracking and tracing
+	rs := &requestState{
+		TaskID:      taskID,
+		Sender:      msg.SenderID,
+		Channel:     msg.Channel,
+		ChatID:      msg.ChatID,
+		TraceID:     msg.TraceID,
+		MessageType: msg.MessageType(),
+		Profile:     profile,
+	}
+	ctx = withRequest(ctx, rs)
+
+	// Make the task cancellable by a stop command or the API
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	untrack := l.trackInflight(sessionKey, &inflightTask{taskID: taskID, sender: msg.SenderID, cancel: cancel})
+	defer untrack()
 
 	// PROCESS
-	response, err = l.ProcessDirectWithTrace(ctx, msg.Content, sessionKey, msg.TraceID)
+	response, err = l.processDirect(ctx, msg.Content, msg.Media, sessionKey, msg.TraceID)
+	cancelled := errors.Is(err, errTaskCancelled)
+	if cancelled {
+		err = nil
+		l.cancelEvent(rs)
+	}
 
 	// UPDATE TASK
 	if l.timeline != nil && taskID != "" {
-		if err != nil {
+		if cancelled {
+			_ = l.timeline.UpdateTaskStatus(taskID, timeline.TaskStatusCancelled, response, errTaskCancelled.Error())
+		} else if err != nil {
 			_ = l.timeline.UpdateTaskStatus(taskID, timeline.TaskStatusFailed, "", err.Error())
 		} else {
 			_ = l.timeline.UpdateTaskStatus(taskID, timeline.TaskStatusCompleted, response, "")
 		}
 	}
 
-	// PUBLISH TRACE to group (if active)
-	if l.groupPublisher != nil && l.groupPublisher.Active() && msg.TraceID != "" {
-		go func() {
-			pubCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-			defer cancel()
-			_ = l.groupPublisher.PublishTrace(pubCtx, map[string]string{
-				"trace_id":  msg.TraceID,
-				"span_type": "TASK",
-				"title":     fmt.Sprintf("Task from %s via %s", msg.SenderID, msg.Channel),
-				"content":   response,
-			})
-		}()
-	}
-
 	return response, taskID, err
 }
 
 func (l *Loop) runAgentLoop(ctx context.Context, messages []provider.Message) (string, error) {
-	toolDefs := l.buildToolDefinitions()
+	rs := requestFrom(ctx)
+	toolDefs := l.buildToolDefinitions(rs.Profile)
+	model := l.requestModel(rs)
+	temperature := l.requestTemperature(rs)
+
+	for i := 0; i < l.requestMaxIterations(rs); i++ {
+		// Stop between steps once the task was cancelled
+		if taskCancelled(ctx) {
+			return "", errTaskCancelled
+		}
 
-	for i := 0; i < l.maxIterations; i++ {
-		// QUOTA CHECK (H-014): check daily token limit before LLM call
-		if err := l.checkTokenQuota(); err != nil {
-			return err.Error(), nil
+		call := &LLMCall{
+			Turn:      l.turn(rs),
+			Iteration: i,
+			Request: &provider.ChatRequest{
+				Messages:    messages,
+				Tools:       toolDefs,
+				Model:       model,
+				MaxTokens:   4096,
+				Temperature: temperature,
+			},
+		}
+		// Quota checks, RAG context and custom hooks; an error ends the turn
+		if err := l.beforeLLM(ctx, call); err != nil {
+			return l.finalResponse(ctx, FinishStopped, err.Error()), nil
 		}
+		messages = call.Request.Messages
 
 		// Call LLM
-		llmStart := time.Now()
-		resp, err := l.provider.Chat(ctx, &provider.ChatRequest{
-			Messages:    messages,
-			Tools:       toolDefs,
-			Model:       l.model,
-			MaxTokens:   4096,
-			Temperature: 0.7,
-		})
-		llmDuration := time.Since(llmStart)
+		call.Started = time.Now()
+		resp, err := l.callLLM(ctx, call.Request)
+		call.Duration = time.Since(call.Started)
 		if err != nil {
 			return "", fmt.Errorf("LLM call failed: %w", err)
 		}
 
-		// TOKEN TRACKING (H-013): record usage
-		l.trackTokens(resp.Usage)
-
-		// Build LLM span summary
-		toolCallSummary := ""
-		if len(resp.ToolCalls) > 0 {
-			names := make([]string, len(resp.ToolCalls))
-			for ti, tc := range resp.ToolCalls {
-				names[ti] = tc.Name
-			}
-			toolCallSummary = fmt.Sprintf(" → tools: %s", strings.Join(names, ", "))
-		}
-		llmContent := fmt.Sprintf("model=%s tokens=%d duration=%dms%s", l.model, resp.Usage.TotalTokens, llmDuration.Milliseconds(), toolCallSummary)
-
-		// Log LLM span to timeline for end-to-end trace visibility
-		if l.timeline != nil && l.activeTraceID != "" {
-			// Build rich metadata for LLM span
-			llmMeta := map[string]any{
-				"model":             l.model,
-				"temperature":       0.7,
-				"max_tokens":        4096,
-				"duration_ms":       llmDuration.Milliseconds(),
-				"finish_reason":     resp.FinishReason,
-				"prompt_tokens":     resp.Usage.PromptTokens,
-				"completion_tokens": resp.Usage.CompletionTokens,
-				"total_tokens":      resp.Usage.TotalTokens,
-				"response_text":     truncateStr(resp.Content, 10240),
-				"message_count":     len(messages),
-			}
-			// System prompt preview (first message if role=system)
-			if len(messages) > 0 && messages[0].Role == "system" {
-				llmMeta["system_prompt"] = truncateStr(messages[0].Content, 2048)
-			}
-			// Last user message
-			for j := len(messages) - 1; j >= 0; j-- {
-				if messages[j].Role == "user" {
-					llmMeta["last_user_message"] = truncateStr(messages[j].Content, 2048)
-					break
-				}
-			}
-			// Tool calls requested
-			if len(resp.ToolCalls) > 0 {
-				tcList := make([]map[string]any, len(resp.ToolCalls))
-				for ti, tc := range resp.ToolCalls {
-					tcList[ti] = map[string]any{
-						"name":      tc.Name,
-						"arguments": tc.Arguments,
-					}
-				}
-				llmMeta["tool_calls"] = tcList
-			}
-			llmMetaJSON, _ := json.Marshal(llmMeta)
-
-			_ = l.timeline.AddEvent(&timeline.TimelineEvent{
-				EventID:        fmt.Sprintf("LLM_%s_%d_%d", l.activeTraceID, i, time.Now().UnixNano()),
-				TraceID:        l.activeTraceID,
-				Timestamp:      llmStart,
-				SenderID:       "AGENT",
-				SenderName:     "LLM",
-				EventType:      "SYSTEM",
-				ContentText:    llmContent,
-				Classification: "LLM",
-				Authorized:     true,
-				Metadata:       string(llmMetaJSON),
-			})
-		}
-		// Publish LLM span to group traces topic
-		if l.groupPublisher != nil && l.groupPublisher.Active() && l.activeTraceID != "" {
-			go func(traceID, content string, dur time.Duration) {
-				pubCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-				defer cancel()
-				now := time.Now()
-				_ = l.groupPublisher.PublishTrace(pubCtx, map[string]string{
-					"trace_id":    traceID,
-					"span_type":   "LLM",
-					"title":       fmt.Sprintf("LLM call: %s", l.model),
-					"content":     content,
-					"started_at":  now.Add(-dur).Format(time.RFC3339),
-					"ended_at":    now.Format(time.RFC3339),
-					"duration_ms": fmt.Sprintf("%d", dur.Milliseconds()),
-				})
-			}(l.activeTraceID, llmContent, llmDuration)
-		}
+		// Token tracking, trace spans and custom hooks
+		call.Response = resp
+		l.afterLLM(ctx, call)
+		resp = call.Response
 
 		// Check for tool calls
 		if len(resp.ToolCalls) == 0 {
 			// No tool calls, return the response
-			return resp.Content, nil
+			return l.finalResponse(ctx, FinishComplete, resp.Content), nil
+		}
+
+		// Sub-agents stop once their token budget is spent
+		if l.tokenBudget > 0 && l.tokensUsed >= l.tokenBudget {
+			partial := fmt.Sprintf("Token budget of %d exhausted before finishing.", l.tokenBudget)
+			if resp.Content != "" {
+				partial = resp.Content + "\n\n" + partial
+			}
+			return l.finalResponse(ctx, FinishTokenBudget, partial), nil
 		}
 
 		// Add assistant message with tool calls
@@ -1033,89 +671,182 @@ func (l *Loop) runAgentLoop(ctx context.Context, messages []provider.Message) (s
 			ToolCalls: resp.ToolCalls,
 		})
 
-		// Execute each tool call
-		for _, tc := range resp.ToolCalls {
-			// POLICY CHECK (H-011): evaluate before tool execution
-			if denied, reason := l.checkToolPolicy(ctx, tc.Name, tc.Arguments); denied {
-				slog.Warn("Tool denied by policy", "tool", tc.Name, "reason", reason)
-				messages = append(messages, provider.Message{
-					Role:       "tool",
-					Content:    fmt.Sprintf("Policy denied: %s", reason),
-					ToolCallID: tc.ID,
-				})
-				continue
-			}
-
-			toolStart := time.Now()
-			result, err := l.registry.Execute(ctx, tc.Name, tc.Arguments)
-			toolDuration := time.Since(toolStart)
-			if err != nil {
-				result = fmt.Sprintf("Error: %v", err)
-			}
-
-			// Log tool span to timeline for end-to-end trace visibility
-			toolContent := fmt.Sprintf("tool=%s duration=%dms result_len=%d", tc.Name, toolDuration.Milliseconds(), len(result))
-			if l.timeline != nil && l.activeTraceID != "" {
-				// Build rich metadata for TOOL span
-				toolMeta := map[string]any{
-					"tool_name":    tc.Name,
-					"tool_call_id": tc.ID,
-					"arguments":    tc.Arguments,
-					"duration_ms":  toolDuration.Milliseconds(),
-					"result":       truncateStr(result, 10240),
-				}
-				if err != nil {
-					toolMeta["error"] = err.Error()
-				}
-				toolMetaJSON, _ := json.Marshal(toolMeta)
-
-				_ = l.timeline.AddEvent(&timeline.TimelineEvent{
-					EventID:        fmt.Sprintf("TOOL_%s_%s_%d", l.activeTraceID, tc.Name, time.Now().UnixNano()),
-					TraceID:        l.activeTraceID,
-					Timestamp:      toolStart,
-					SenderID:       "AGENT",
-					SenderName:     "Tool",
-					EventType:      "SYSTEM",
-					ContentText:    toolContent,
-					Classification: "TOOL",
-					Authorized:     true,
-					Metadata:       string(toolMetaJSON),
-				})
-			}
-			// Publish tool span to group traces topic
-			if l.groupPublisher != nil && l.groupPublisher.Active() && l.activeTraceID != "" {
-				go func(traceID, toolN, content string, dur time.Duration) {
-					pubCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-					defer cancel()
-					now := time.Now()
-					_ = l.groupPublisher.PublishTrace(pubCtx, map[string]string{
-						"trace_id":    traceID,
-						"span_type":   "TOOL",
-						"title":       fmt.Sprintf("Tool: %s", toolN),
-						"content":     content,
-						"started_at":  now.Add(-dur).Format(time.RFC3339),
-						"ended_at":    now.Format(time.RFC3339),
-						"duration_ms": fmt.Sprintf("%d", dur.Milliseconds()),
-					})
-				}(l.activeTraceID, tc.Name, toolContent, toolDuration)
-			}
-
-			if strings.Contains(result, "Ey, du spinnst wohl? Hä?") {
-				return "Ey, du spinnst wohl? Hä? 💣 👮‍♂️ 🔒", nil
+		// Execute the tool calls. Consecutive read-only calls run
+		// concurrently; results keep the order the model asked for.
+		results := l.executeToolCalls(ctx, resp.ToolCalls)
+		for ti, tc := range resp.ToolCalls {
+			if strings.Contains(results[ti], toolAbortMarker) {
+				return l.finalResponse(ctx, FinishAborted, l.intent.Response(requestFrom(ctx).Channel, intent.CategoryAttack)), nil
 			}
 
 			// Add tool result
 			messages = append(messages, provider.Message{
 				Role:       "tool",
-				Content:    result,
+				Content:    results[ti],
 				ToolCallID: tc.ID,
 			})
+		}
+	}
 
-			slog.Debug("Tool executed", "name", tc.Name, "result_length", len(result))
+	return l.finalResponse(ctx, FinishMaxIterations, "Max iterations reached. Please try a simpler request."), nil
+}
+
+// defaultParallelTools bounds concurrent read-only tool calls in one batch.
+const defaultParallelTools = 4
+
+// toolAbortMarker in a tool result ends the turn (see attack detection).
+const toolAbortMarker = "Ey, du spinnst wohl? Hä?"
+
+// executeToolCalls runs one response's tool calls and returns their results
+// in the same order. Runs of consecutive tier-0 calls execute concurrently
+// with at most defaultParallelTools workers; tier-1/2 calls, which may write or
+// wait for approval, run one at a time in order. Execution stops after a
+// result carrying toolAbortMarker; later results stay empty.
+func (l *Loop) executeToolCalls(ctx context.Context, calls []provider.ToolCall) []string {
+	results := make([]string, len(calls))
+	workers := l.maxParallelTools
+	if workers <= 0 {
+		workers = defaultParallelTools
+	}
+
+	for i := 0; i < len(calls); {
+		// Collect the run of read-only calls starting at i.
+		j := i
+		for j < len(calls) && workers > 1 && l.toolTier(calls[j]) == tools.TierReadOnly {
+			j++
+		}
+		if j-i < 2 {
+			results[i] = l.executeToolCall(ctx, calls[i])
+			if strings.Contains(results[i], toolAbortMarker) {
+				return results
+			}
+			i++
+			continue
 		}
+
+		sem := make(chan struct{}, workers)
+		var wg sync.WaitGroup
+		for k := i; k < j; k++ {
+			wg.Add(1)
+			sem <- struct{}{}
+			go func(k int) {
+				defer wg.Done()
+				defer func() { <-sem }()
+				results[k] = l.executeToolCall(ctx, calls[k])
+			}(k)
+		}
+		wg.Wait()
+		for k := i; k < j; k++ {
+			if strings.Contains(results[k], toolAbortMarker) {
+				return results
+			}
+		}
+		i = j
 	}
+	return results
+}
 
-	return "Max iterations reached. Please try a simpler request.", nil
+// toolTier returns the risk tier of a call of a registered tool. Unknown
+// tools are treated as tier 2 so they never run in a parallel batch.
+func (l *Loop) toolTier(call provider.ToolCall) int {
+	if t, ok := l.registry.Get(call.Name); ok {
+		return tools.CallTier(t, call.Arguments)
+	}
+	return tools.TierHighRisk
+}
+
+// executeToolCall runs one tool call between the BeforeTool hooks (policy)
+// and the AfterTool hooks (artifacts, spans). It returns the content for
+// the tool result message.
+func (l *Loop) executeToolCall(ctx context.Context, tc provider.ToolCall) string {
+	rs := requestFrom(ctx)
+	if taskCancelled(ctx) {
+		return "Skipped: task cancelled"
+	}
+	exec := &ToolExecution{Turn: l.turn(rs), Call: tc, Meta: map[string]any{}}
+	if err := l.beforeTool(ctx, exec); err != nil {
+		return err.Error()
+	}
+
+	// Files are read after the hooks, which may have changed the arguments.
+	snapshots := l.snapshotFiles(exec)
+	toolCtx := ctx
+	if rs.Profile != nil && rs.Profile.Sandbox != "" {
+		toolCtx = tools.WithSandbox(ctx, rs.Profile.Sandbox)
+	}
+	exec.Started = time.Now()
+	result, err := l.registry.Execute(toolCtx, exec.Call.Name, exec.Call.Arguments)
+	exec.Duration = time.Since(exec.Started)
+	if err != nil {
+		result = fmt.Sprintf("Error: %v", err)
+	}
+	exec.Result, exec.Err, exec.OutputChars = result, err, len(result)
+	l.journalChanges(exec, snapshots)
+	l.afterTool(ctx, exec)
+
+	if !taskCancelled(ctx) {
+		rs.addStep(fmt.Sprintf("%s %s", tc.Name, truncateStr(formatArgsPreview(exec.Call.Arguments), 80)))
+	}
+	slog.Debug("Tool executed", "name", tc.Name, "result_length", len(exec.Result))
+	return exec.Result
+}
+
+// streamUpdateInterval throttles partial outbound updates while streaming.
+const streamUpdateInterval = 500 * time.Millisecond
+
+// callLLM sends the request to the provider. When the provider can stream
+// and the message came in over the bus, the text generated so far is
+// published as partial outbound updates so channels can show progress.
+// Otherwise it is a plain Chat call.
+func (l *Loop) callLLM(ctx context.Context, req *provider.ChatRequest) (*provider.ChatResponse, error) {
+	rs := requestFrom(ctx)
+	if _, ok := l.provider.(provider.StreamingProvider); !ok || l.bus == nil || rs.Channel == "" {
+		return l.provider.Chat(ctx, req)
+	}
+
+	channel, chatID, traceID, taskID := rs.Channel, rs.ChatID, rs.TraceID, rs.TaskID
+	var text strings.Builder
+	var lastUpdate time.Time
+	return provider.StreamChat(ctx, l.provider, req, func(d provider.StreamDelta) {
+		text.WriteString(d.Content)
+		if time.Since(lastUpdate) < streamUpdateInterval {
+			return
+		}
+		lastUpdate = time.Now()
+		l.bus.PublishOutbound(&bus.OutboundMessage{
+			Channel: channel,
+			ChatID:  chatID,
+			TraceID: traceID,
+			TaskID:  taskID,
+			Content: text.String(),
+			Partial: true,
+		})
+	})
+}
+
+// retrySpan returns a retry observer that logs each retried provider call
+// as an LLM_RETRY span on the given trace.
+func (l *Loop) retrySpan(traceID string) func(provider.RetryEvent) {
+	return func(ev provider.RetryEvent) {
+		meta, _ := json.Marshal(map[string]any{
+			"op":       ev.Op,
+			"attempt":  ev.Attempt,
+			"delay_ms": ev.Delay.Milliseconds(),
+			"error":    truncateStr(ev.Err.Error(), 2048),
+		})
+		_ = l.timeline.AddEvent(&timeline.TimelineEvent{
+			EventID:        fmt.Sprintf("LLM_RETRY_%s_%d_%d", traceID, ev.Attempt, time.Now().UnixNano()),
+			TraceID:        traceID,
+			Timestamp:      time.Now(),
+			SenderID:       "AGENT",
+			SenderName:     "LLM",
+			EventType:      "SYSTEM",
+			ContentText:    fmt.Sprintf("%s attempt %d failed, retrying in %dms: %s", ev.Op, ev.Attempt, ev.Delay.Milliseconds(), truncateStr(ev.Err.Error(), 200)),
+			Classification: "LLM_RETRY",
+			Authorized:     true,
+			Metadata:       string(meta),
+		})
+	}
 }
 
 // truncateStr returns s trimmed to maxLen characters.
@@ -1126,57 +857,78 @@ func truncateStr(s string, maxLen int) string {
 	return s[:maxLen]
 }
 
-// checkToolPolicy evaluates whether a tool call should proceed.
-// Returns (denied bool, reason string).
-func (l *Loop) checkToolPolicy(ctx context.Context, toolName string, args map[string]any) (bool, string) {
-	if l.policy == nil {
-		return false, ""
-	}
-
+// toolPolicy evaluates a tool call against the profile's allowlist and
+// the policy engine. It returns the tier of the call and the decision.
+func (l *Loop) toolPolicy(ctx context.Context, toolName string, args map[string]any) (int, policy.Decision) {
+	rs := requestFrom(ctx)
 	tier := tools.TierReadOnly
 	if t, ok := l.registry.Get(toolName); ok {
-		tier = tools.ToolTier(t)
+		tier = tools.CallTier(t, args)
+	}
+	// Tools outside the profile's allowlist are never offered to the model;
+	// a call naming one anyway is denied without asking for approval.
+	return tier, l.policyDecision(ctx, toolName, tier, args, !rs.Profile.allowsTool(toolName))
+}
+
+// checkPolicy evaluates an action of the given tier like a tool call and
+// waits for approval where required. Returns (denied bool, reason string).
+func (l *Loop) checkPolicy(ctx context.Context, toolName string, tier int, args map[string]any, profileDenied bool) (bool, string) {
+	return l.enforcePolicy(ctx, toolName, tier, args, l.policyDecision(ctx, toolName, tier, args, profileDenied))
+}
+
+// policyDecision evaluates an action of the given tier with the policy
+// engine and logs the decision to the timeline. Without an engine only the
+// profile's allowlist applies.
+func (l *Loop) policyDecision(ctx context.Context, toolName string, tier int, args map[string]any, profileDenied bool) policy.Decision {
+	rs := requestFrom(ctx)
+	if profileDenied {
+		// rs.Profile is set: without a profile every tool is allowed.
+		return l.logPolicyDecision(rs, toolName, tier, policy.Decision{Reason: "tool_not_in_profile: " + rs.Profile.Name, Tier: tier})
+	}
+	if l.policy == nil {
+		return policy.Decision{Allow: true, Tier: tier}
 	}
 
 	policyCtx := policy.Context{
-		Sender:      l.activeSender,
-		Channel:     l.activeChannel,
+		Sender:      rs.Sender,
+		Channel:     rs.Channel,
 		Tool:        toolName,
 		Tier:        tier,
 		Arguments:   args,
-		TraceID:     l.activeTraceID,
-		MessageType: l.activeMessageType,
+		TraceID:     rs.TraceID,
+		MessageType: rs.MessageType,
 	}
-
-	decision := l.policy.Evaluate(policyCtx)
-
-	// Log policy decision (H-015)
-	if l.timeline != nil {
-		_ = l.timeline.LogPolicyDecision(&timeline.PolicyDecisionRecord{
-			TraceID: l.activeTraceID,
-			TaskID:  l.activeTaskID,
-			Tool:    toolName,
-			Tier:    tier,
-			Sender:  l.activeSender,
-			Channel: l.activeChannel,
-			Allowed: decision.Allow,
-			Reason:  decision.Reason,
-		})
-	}
-	// Publish policy decision as audit event to group
-	if l.groupPublisher != nil && l.groupPublisher.Active() && l.activeTraceID != "" {
-		action := "ALLOW"
-		if !decision.Allow {
-			action = "DENY"
-		}
-		detail := fmt.Sprintf("tool=%s tier=%d sender=%s action=%s reason=%s", toolName, tier, l.activeSender, action, decision.Reason)
-		go func(traceID, det string) {
-			pubCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-			defer cancel()
-			_ = l.groupPublisher.PublishAudit(pubCtx, "policy_decision", traceID, det)
-		}(l.activeTraceID, detail)
+	if rs.Profile != nil {
+		policyCtx.MaxAutoTier = rs.Profile.MaxAutoTier
+		policyCtx.ExternalMaxTier = rs.Profile.ExternalMaxTier
 	}
+	return l.logPolicyDecision(rs, toolName, tier, l.policy.Evaluate(policyCtx))
+}
+
+// logPolicyDecision records a decision in the timeline (H-015) and
+// returns it.
+func (l *Loop) logPolicyDecision(rs *requestState, toolName string, tier int, decision policy.Decision) policy.Decision {
+	if l.policy == nil || l.timeline == nil {
+		return decision
+	}
+	_ = l.timeline.LogPolicyDecision(&timeline.PolicyDecisionRecord{
+		TraceID: rs.TraceID,
+		TaskID:  rs.TaskID,
+		Tool:    toolName,
+		Tier:    tier,
+		Sender:  rs.Sender,
+		Channel: rs.Channel,
+		Allowed: decision.Allow,
+		Reason:  decision.Reason,
+	})
+	return decision
+}
 
+// enforcePolicy applies a policy decision: tier 2+ actions of internal
+// messages that need approval wait for it. Returns (denied bool, reason
+// string).
+func (l *Loop) enforcePolicy(ctx context.Context, toolName string, tier int, args map[string]any, decision policy.Decision) (bool, string) {
+	rs := requestFrom(ctx)
 	if !decision.Allow {
 		// Interactive approval gate for tier 2+ internal messages
 		if decision.RequiresApproval && l.approvalMgr != nil && l.bus != nil {
@@ -1184,10 +936,10 @@ func (l *Loop) checkToolPolicy(ctx context.Context, toolName string, args map[st
 				Tool:      toolName,
 				Tier:      tier,
 				Arguments: args,
-				Sender:    l.activeSender,
-				Channel: l.activeChannel,
-				TraceID: l.activeTraceID,
-				TaskID:  l.activeTaskID,
+				Sender:    rs.Sender,
+				Channel:   rs.Channel,
+				TraceID:   rs.TraceID,
+				TaskID:    rs.TaskID,
 			}
 			approvalID := l.approvalMgr.Create(req)
 
@@ -1197,10 +949,10 @@ func (l *Loop) checkToolPolicy(ctx context.Context, toolName string, args map[st
 				toolName, tier, argsPreview, approvalID, approvalID)
 
 			l.bus.PublishOutbound(&bus.OutboundMessage{
-				Channel: l.activeChannel,
-				ChatID:  l.activeChatID,
-				TraceID: l.activeTraceID,
-				TaskID:  l.activeTaskID,
+				Channel: rs.Channel,
+				ChatID:  rs.ChatID,
+				TraceID: rs.TraceID,
+				TaskID:  rs.TaskID,
 				Content: prompt,
 			})
 
@@ -1276,52 +1028,133 @@ func (l *Loop) approvalTimeout() time.Duration {
 	return time.Duration(seconds) * time.Second
 }
 
-// trackTokens persists token usage for the active task.
-func (l *Loop) trackTokens(usage provider.Usage) {
-	if l.timeline == nil || l.activeTaskID == "" {
-		return
-	}
-	if usage.TotalTokens > 0 {
-		_ = l.timeline.UpdateTaskTokens(l.activeTaskID, usage.PromptTokens, usage.CompletionTokens, usage.TotalTokens)
+// trackTokens persists token usage and cost for the active task and
+// returns the cost of the call in USD.
+func (l *Loop) trackTokens(ctx context.Context, resp *provider.ChatResponse) float64 {
+	rs := requestFrom(ctx)
+	usage := resp.Usage
+	model := resp.Model
+	if model == "" {
+		model = l.requestModel(rs)
+	}
+	if model == "" {
+		model = l.provider.DefaultModel()
+	}
+	cost := l.costs.Cost(model, usage.PromptTokens, usage.CompletionTokens, usage.CachedTokens)
+
+	if l.timeline == nil || usage.TotalTokens == 0 {
+		return cost
+	}
+	channel := rs.Channel
+	if channel == "" {
+		channel = "cli"
+	}
+	_ = l.timeline.RecordLLMUsage(&timeline.LLMUsageRecord{
+		TraceID:          rs.TraceID,
+		TaskID:           rs.TaskID,
+		Channel:          channel,
+		Sender:           rs.Sender,
+		Model:            model,
+		Provider:         resp.Provider,
+		PromptTokens:     usage.PromptTokens,
+		CompletionTokens: usage.CompletionTokens,
+		CachedTokens:     usage.CachedTokens,
+		CostUSD:          cost,
+	})
+	if rs.TaskID != "" {
+		_ = l.timeline.UpdateTaskTokens(rs.TaskID, usage.PromptTokens, usage.CompletionTokens, usage.TotalTokens)
+		if cost > 0 {
+			_ = l.timeline.AddTaskCost(rs.TaskID, cost)
+		}
 	}
+	return cost
 }
 
-// checkTokenQuota checks if the daily token limit has been exceeded.
-func (l *Loop) checkTokenQuota() error {
+// checkTokenQuota checks the daily token limit and the spend budgets. A
+// hard limit returns an error; the first soft-budget warning in a period
+// returns a note for the user.
+func (l *Loop) checkTokenQuota(ctx context.Context) (string, error) {
+	rs := requestFrom(ctx)
 	if l.timeline == nil {
-		return nil
-	}
-	limitStr, err := l.timeline.GetSetting("daily_token_limit")
-	if err != nil || limitStr == "" {
-		return nil // No quota configured
-	}
-	var limit int
-	if _, err := fmt.Sscanf(limitStr, "%d", &limit); err != nil || limit <= 0 {
-		return nil
+		return "", nil
+	}
+	if limitStr, err := l.timeline.GetSetting("daily_token_limit"); err == nil && limitStr != "" {
+		var limit int
+		if _, err := fmt.Sscanf(limitStr, "%d", &limit); err == nil && limit > 0 {
+			// Fail open on read errors
+			if used, err := l.timeline.GetDailyTokenUsage(); err == nil && used >= limit {
+				return "", fmt.Errorf("Daily token quota exceeded (%d/%d). Please try again tomorrow or ask an admin to increase the limit.", used, limit)
+			}
+		}
 	}
-	used, err := l.timeline.GetDailyTokenUsage()
-	if err != nil {
-		return nil // Fail open
+
+	channel := rs.Channel
+	if channel == "" {
+		channel = "cli"
+	}
+	status := l.costs.Check(channel, rs.Sender)
+	switch status.Level {
+	case costs.LevelHard:
+		slog.Warn("Spend budget exhausted", "scope", status.Budget.Scope, "period", status.Budget.Period,
+			"spent", status.Spent, "limit", status.Budget.HardUSD, "channel", channel, "sender", rs.Sender)
+		l.budgetEvent(rs, status)
+		return "", fmt.Errorf("%s", status.Message())
+	case costs.LevelSoft:
+		if status.FirstWarning {
+			slog.Warn("Spend budget warning", "scope", status.Budget.Scope, "period", status.Budget.Period,
+				"spent", status.Spent, "threshold", status.Budget.SoftUSD, "channel", channel, "sender", rs.Sender)
+			l.budgetEvent(rs, status)
+			return status.Message(), nil
+		}
 	}
-	if used >= limit {
-		return fmt.Errorf("Daily token quota exceeded (%d/%d). Please try again tomorrow or ask an admin to increase the limit.", used, limit)
+	return "", nil
+}
+
+// budgetEvent records a budget warning or stop in the active trace.
+func (l *Loop) budgetEvent(rs *requestState, status costs.Status) {
+	if rs.TraceID == "" {
+		return
 	}
-	return nil
+	meta, _ := json.Marshal(map[string]any{
+		"scope":     status.Budget.Scope,
+		"match":     status.Budget.Match,
+		"period":    status.Budget.Period,
+		"spent_usd": status.Spent,
+		"soft_usd":  status.Budget.SoftUSD,
+		"hard_usd":  status.Budget.HardUSD,
+		"hard_stop": status.Level == costs.LevelHard,
+	})
+	_ = l.timeline.AddEvent(&timeline.TimelineEvent{
+		EventID:        fmt.Sprintf("BUDGET_%s_%d", rs.TraceID, time.Now().UnixNano()),
+		TraceID:        rs.TraceID,
+		Timestamp:      time.Now(),
+		SenderID:       "AGENT",
+		SenderName:     "Budget",
+		EventType:      "SYSTEM",
+		ContentText:    status.Message(),
+		Classification: "BUDGET",
+		Authorized:     true,
+		Metadata:       string(meta),
+	})
 }
 
-func (l *Loop) buildToolDefinitions() []provider.ToolDefinition {
+// buildToolDefinitions lists the registered tools the profile allows.
+func (l *Loop) buildToolDefinitions(profile *agentProfile) []provider.ToolDefinition {
 	toolList := l.registry.List()
-	defs := make([]provider.ToolDefinition, len(toolList))
+	defs := make([]provider.ToolDefinition, 0, len(toolList))
 
-	for i, tool := range toolList {
-		defs[i] = provider.ToolDefinition{
+	for _, tool := range toolList {
+		if !profile.allowsTool(tool.Name()) {
+			continue
+		}
+		defs = append(defs, provider.ToolDefinition{
 			Type: "function",
 			Function: provider.FunctionDef{
 				Name:        tool.Name(),
 				Description: tool.Description(),
 				Parameters:  tool.Parameters(),
 			},
-		}
+		})
 	}
 
 	return defs
@@ -0,0 +1,122 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/kamir/gomikrobot/internal/provider"
+	"github.com/kamir/gomikrobot/internal/tools"
+)
+
+// probeTool records how many of its calls run at the same time.
+type probeTool struct {
+	name    string
+	tier    int
+	delay   time.Duration
+	running *int32
+	peak    *int32
+	mu      *sync.Mutex
+	order   *[]string
+}
+
+func (t *probeTool) Name() string               { return t.name }
+func (t *probeTool) Description() string        { return "test probe" }
+func (t *probeTool) Parameters() map[string]any { return map[string]any{"type": "object"} }
+func (t *probeTool) Tier() int                  { return t.tier }
+func (t *probeTool) Execute(_ context.Context, params map[string]any) (string, error) {
+	n := atomic.AddInt32(t.running, 1)
+	for {
+		p := atomic.LoadInt32(t.peak)
+		if n <= p || atomic.CompareAndSwapInt32(t.peak, p, n) {
+			break
+		}
+	}
+	time.Sleep(t.delay)
+	atomic.AddInt32(t.running, -1)
+
+	id := tools.GetString(params, "id", "")
+	t.mu.Lock()
+	*t.order = append(*t.order, id)
+	t.mu.Unlock()
+	return "result " + id, nil
+}
+
+func TestExecuteToolCallsParallelReadOnly(t *testing.T) {
+	tmpDir := t.TempDir()
+	loop := NewLoop(LoopOptions{
+		Provider:         &mockProvider{},
+		Workspace:        tmpDir,
+		WorkRepo:         tmpDir,
+		MaxParallelTools: 2,
+	})
+
+	var running, readPeak, writePeak int32
+	var mu sync.Mutex
+	var order []string
+	loop.registry.Register(&probeTool{name: "probe_read", tier: tools.TierReadOnly, delay: 30 * time.Millisecond,
+		running: &running, peak: &readPeak, mu: &mu, order: &order})
+	var writeRunning int32
+	loop.registry.Register(&probeTool{name: "probe_write", tier: tools.TierWrite, delay: 5 * time.Millisecond,
+		running: &writeRunning, peak: &writePeak, mu: &mu, order: &order})
+
+	call := func(name, id string) provider.ToolCall {
+		return provider.ToolCall{ID: "call_" + id, Name: name, Arguments: map[string]any{"id": id}}
+	}
+	calls := []provider.ToolCall{
+		call("probe_read", "r1"), call("probe_read", "r2"), call("probe_read", "r3"), call("probe_read", "r4"),
+		call("probe_write", "w1"), call("probe_write", "w2"),
+		call("probe_read", "r5"),
+	}
+
+	results := loop.executeToolCalls(context.Background(), calls)
+
+	for i, c := range calls {
+		want := fmt.Sprintf("result %s", c.Arguments["id"])
+		if results[i] != want {
+			t.Fatalf("result %d = %q, want %q", i, results[i], want)
+		}
+	}
+	if readPeak != 2 {
+		t.Fatalf("expected read-only calls to run 2 at a time, peak was %d", readPeak)
+	}
+	if writePeak != 1 {
+		t.Fatalf("expected write calls to run sequentially, peak was %d", writePeak)
+	}
+	// The writes run after the whole read batch and before the trailing read.
+	if len(order) != len(calls) || order[4] != "w1" || order[5] != "w2" || order[6] != "r5" {
+		t.Fatalf("unexpected execution order: %v", order)
+	}
+}
+
+func TestExecuteToolCallsSequentialWhenDisabled(t *testing.T) {
+	tmpDir := t.TempDir()
+	loop := NewLoop(LoopOptions{
+		Provider:         &mockProvider{},
+		Workspace:        tmpDir,
+		WorkRepo:         tmpDir,
+		MaxParallelTools: 1,
+	})
+
+	var running, peak int32
+	var mu sync.Mutex
+	var order []string
+	loop.registry.Register(&probeTool{name: "probe_read", tier: tools.TierReadOnly, delay: 10 * time.Millisecond,
+		running: &running, peak: &peak, mu: &mu, order: &order})
+
+	calls := []provider.ToolCall{
+		{ID: "a", Name: "probe_read", Arguments: map[string]any{"id": "a"}},
+		{ID: "b", Name: "probe_read", Arguments: map[string]any{"id": "b"}},
+		{ID: "c", Name: "probe_read", Arguments: map[string]any{"id": "c"}},
+	}
+	loop.executeToolCalls(context.Background(), calls)
+	if peak != 1 {
+		t.Fatalf("expected sequential execution, peak was %d", peak)
+	}
+	if fmt.Sprint(order) != "[a b c]" {
+		t.Fatalf("unexpected order: %v", order)
+	}
+}
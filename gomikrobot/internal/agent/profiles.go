@@ -0,0 +1,115 @@
+package agent
+
+import (
+	"log/slog"
+
+	"github.com/kamir/gomikrobot/internal/config"
+)
+
+// agentProfile is the named profile in effect for one request.
+type agentProfile struct {
+	Name string
+	config.AgentProfile
+	tools map[string]bool // allowlist; nil allows all tools
+}
+
+// allowsTool reports whether the profile permits the named tool.
+func (p *agentProfile) allowsTool(name string) bool {
+	return p == nil || p.tools == nil || p.tools[name]
+}
+
+// profileSet resolves the agent profile for a message from config bindings.
+type profileSet struct {
+	profiles map[string]*agentProfile
+	bindings []config.ProfileBinding
+	fallback string
+}
+
+// newProfileSet prepares the configured profiles. Bindings and a default
+// that name unknown profiles are dropped with a warning.
+func newProfileSet(cfg config.AgentProfilesConfig) *profileSet {
+	ps := &profileSet{profiles: map[string]*agentProfile{}}
+	for name, p := range cfg.Profiles {
+		ap := &agentProfile{Name: name, AgentProfile: p}
+		if len(p.Tools) > 0 {
+			ap.tools = map[string]bool{}
+			for _, t := range p.Tools {
+				ap.tools[t] = true
+			}
+		}
+		ps.profiles[name] = ap
+	}
+	for _, b := range cfg.Bindings {
+		if _, ok := ps.profiles[b.Profile]; !ok {
+			slog.Warn("Ignoring binding to unknown agent profile", "profile", b.Profile)
+			continue
+		}
+		ps.bindings = append(ps.bindings, b)
+	}
+	if cfg.Default != "" {
+		if _, ok := ps.profiles[cfg.Default]; ok {
+			ps.fallback = cfg.Default
+		} else {
+			slog.Warn("Unknown default agent profile", "profile", cfg.Default)
+		}
+	}
+	return ps
+}
+
+// resolve returns the profile for a message, or nil when no binding
+// matches and no default is set. Empty binding fields match anything. The
+// most specific matching binding wins: a sender match outweighs a chat
+// match, which outweighs a channel match; earlier bindings win ties.
+func (ps *profileSet) resolve(channel, chatID, sender string) *agentProfile {
+	if ps == nil {
+		return nil
+	}
+	best, bestScore := "", -1
+	for _, b := range ps.bindings {
+		score := 0
+		for _, f := range []struct {
+			want, got string
+			weight    int
+		}{{b.Channel, channel, 1}, {b.ChatID, chatID, 2}, {b.Sender, sender, 4}} {
+			if f.want == "" {
+				continue
+			}
+			if f.want != f.got {
+				score = -1
+				break
+			}
+			score += f.weight
+		}
+		if score > bestScore {
+			best, bestScore = b.Profile, score
+		}
+	}
+	if best == "" {
+		best = ps.fallback
+	}
+	return ps.profiles[best]
+}
+
+// Per-request settings, taking the profile in effect into account.
+
+func (l *Loop) requestModel(rs *requestState) string {
+	if rs.Profile != nil && rs.Profile.Model != "" {
+		return rs.Profile.Model
+	}
+	return l.model
+}
+
+func (l *Loop) requestTemperature(rs *requestState) float64 {
+	if rs.Profile != nil && rs.Profile.Temperature != nil {
+		return *rs.Profile.Temperature
+	}
+	return 0.7
+}
+
+// requestMaxIterations does not apply to sub-agents, which have their own.
+func (l *Loop) requestMaxIterations(rs *requestState) int {
+	if rs.Profile != nil && rs.Profile.MaxIterations > 0 && l.agentName == "" {
+		return rs.Profile.MaxIterations
+	}
+	return l.maxIterations
+}
@@ -0,0 +1,118 @@
+package agent
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kamir/gomikrobot/internal/bus"
+	"github.com/kamir/gomikrobot/internal/config"
+	"github.com/kamir/gomikrobot/internal/provider"
+)
+
+func TestProfileResolution(t *testing.T) {
+	ps := newProfileSet(config.AgentProfilesConfig{
+		Default: "basic",
+		Profiles: map[string]config.AgentProfile{
+			"basic": {}, "family": {}, "owner": {}, "guest": {},
+		},
+		Bindings: []config.ProfileBinding{
+			{Profile: "guest", Channel: "whatsapp"},
+			{Profile: "family", Channel: "whatsapp", ChatID: "family@g.us"},
+			{Profile: "owner", Sender: "owner@s.whatsapp.net"},
+			{Profile: "missing", Channel: "telegram"},
+		},
+	})
+
+	cases := []struct {
+		channel, chatID, sender, want string
+	}{
+		{"whatsapp", "family@g.us", "aunt@s.whatsapp.net", "family"},
+		{"whatsapp", "family@g.us", "owner@s.whatsapp.net", "owner"},
+		{"whatsapp", "owner@s.whatsapp.net", "owner@s.whatsapp.net", "owner"},
+		{"whatsapp", "friend@s.whatsapp.net", "friend@s.whatsapp.net", "guest"},
+		{"telegram", "42", "someone", "basic"},
+	}
+	for _, c := range cases {
+		p := ps.resolve(c.channel, c.chatID, c.sender)
+		if p == nil || p.Name != c.want {
+			t.Errorf("resolve(%s, %s, %s) = %v, want %s", c.channel, c.chatID, c.sender, p, c.want)
+		}
+	}
+
+	if p := newProfileSet(config.AgentProfilesConfig{}).resolve("cli", "default", ""); p != nil {
+		t.Fatalf("expected no profile without config, got %s", p.Name)
+	}
+}
+
+func TestProfileAppliesToRequest(t *testing.T) {
+	tl := newTestTimeline(t)
+	tmpDir := t.TempDir()
+	_ = os.WriteFile(filepath.Join(tmpDir, "SOUL.md"), []byte("owner soul"), 0o644)
+	_ = os.WriteFile(filepath.Join(tmpDir, "FAMILY.md"), []byte("be kind to the family"), 0o644)
+
+	temp := 0.1
+	prov := &recordingProvider{mockProvider: mockProvider{responses: []provider.ChatResponse{
+		{ToolCalls: []provider.ToolCall{{ID: "w1", Name: "write_file", Arguments: map[string]any{"path": "x.txt", "content": "x"}}},
+			Usage: provider.Usage{TotalTokens: 10}},
+		{Content: "I may only read.", Usage: provider.Usage{TotalTokens: 10}},
+	}}}
+	loop := NewLoop(LoopOptions{
+		Bus:       bus.NewMessageBus(),
+		Provider:  prov,
+		Timeline:  tl,
+		Workspace: tmpDir,
+		WorkRepo:  tmpDir,
+		Model:     "big-model",
+		Profiles: config.AgentProfilesConfig{
+			Profiles: map[string]config.AgentProfile{"family": {
+				Model:          "small-model",
+				Temperature:    &temp,
+				Tools:          []string{"read_file"},
+				BootstrapFiles: []string{"FAMILY.md"},
+			}},
+			Bindings: []config.ProfileBinding{{Profile: "family", Channel: "test"}},
+		},
+	})
+
+	chatID := "profile" + time.Now().Format("150405.000000")
+	t.Cleanup(func() { loop.sessions.Delete("test:" + chatID) })
+	_, taskID, err := loop.processMessage(context.Background(), &bus.InboundMessage{
+		Channel: "test", SenderID: "aunt", ChatID: chatID, TraceID: "trace-profile-001",
+		Content: "write a file", Timestamp: time.Now(),
+	})
+	if err != nil {
+		t.Fatalf("processMessage: %v", err)
+	}
+
+	req := prov.requests[0]
+	if req.Model != "small-model" || req.Temperature != 0.1 {
+		t.Fatalf("expected profile model and temperature, got %s / %v", req.Model, req.Temperature)
+	}
+	if len(req.Tools) != 1 || req.Tools[0].Function.Name != "read_file" {
+		t.Fatalf("expected only read_file to be offered, got %v", req.Tools)
+	}
+	system := req.Messages[0].Content
+	if !strings.Contains(system, "be kind to the family") || strings.Contains(system, "owner soul") {
+		t.Fatal("expected the profile's bootstrap files in place of the default set")
+	}
+
+	last := prov.requests[1].Messages
+	if got := last[len(last)-1].Content; !strings.Contains(got, "tool_not_in_profile") {
+		t.Fatalf("expected write_file to be denied by the profile, got %q", got)
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, "x.txt")); err == nil {
+		t.Fatal("write_file must not have run")
+	}
+
+	task, err := tl.GetTask(taskID)
+	if err != nil {
+		t.Fatalf("get task: %v", err)
+	}
+	if task.Profile != "family" {
+		t.Fatalf("expected profile recorded on task, got %q", task.Profile)
+	}
+}
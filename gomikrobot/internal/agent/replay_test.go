@@ -0,0 +1,66 @@
+package agent
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/kamir/gomikrobot/internal/provider"
+)
+
+// TestReplayConversationWithToolCalls records a conversation that uses a
+// tool and replays it from the cassette without the original provider.
+func TestReplayConversationWithToolCalls(t *testing.T) {
+	tmpDir := t.TempDir()
+	cassette := filepath.Join(tmpDir, "cassette.json")
+	notes := filepath.Join(tmpDir, "notes.md")
+
+	mock := &mockProvider{
+		responses: []provider.ChatResponse{
+			{ToolCalls: []provider.ToolCall{{
+				ID:        "call_1",
+				Name:      "write_file",
+				Arguments: map[string]any{"path": notes, "content": "hello"},
+			}}},
+			{Content: "Saved your note.", FinishReason: "stop"},
+		},
+	}
+	recorder, err := provider.NewRecorder(mock, cassette)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newLoop := func(p provider.LLMProvider) *Loop {
+		return NewLoop(LoopOptions{
+			Provider:      p,
+			Workspace:     tmpDir,
+			WorkRepo:      tmpDir,
+			Model:         "mock-model",
+			MaxIterations: 5,
+		})
+	}
+
+	want, err := newLoop(recorder).ProcessDirect(context.Background(), "save hello to notes.md", "cli:record")
+	if err != nil {
+		t.Fatalf("record run: %v", err)
+	}
+	os.Remove(notes)
+
+	replayer, err := provider.NewReplayer(cassette)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := newLoop(replayer).ProcessDirect(context.Background(), "save hello to notes.md", "cli:replay")
+	if err != nil {
+		t.Fatalf("replay run: %v", err)
+	}
+	if got != want || got != "Saved your note." {
+		t.Errorf("replayed response %q, recorded %q", got, want)
+	}
+	if data, err := os.ReadFile(notes); err != nil || string(data) != "hello" {
+		t.Errorf("expected the replayed tool call to write notes.md, got %q (%v)", data, err)
+	}
+	if mock.calls != 2 {
+		t.Errorf("replay must not call the original provider, got %d calls", mock.calls)
+	}
+}
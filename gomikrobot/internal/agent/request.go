@@ -0,0 +1,58 @@
+package agent
+
+import (
+	"context"
+	"sync"
+)
+
+// requestState is the per-message state of one agent turn: who sent it,
+// where the answer goes and which task and trace it belongs to. It travels
+// in the context, so turns running concurrently for different sessions
+// never see each other's state.
+type requestState struct {
+	TaskID      string
+	Sender      string
+	Channel     string // empty for direct calls, which must not stream
+	ChatID      string
+	TraceID     string
+	MessageType string
+	Profile     *agentProfile // nil when no profile applies
+
+	// budgetNote is a spend-budget warning appended to the reply.
+	budgetNote string
+
+	// steps lists the tool calls executed so far, reported when the task
+	// is cancelled. Tool calls may run in parallel, hence the mutex.
+	mu    sync.Mutex
+	steps []string
+}
+
+// addStep records a finished tool call.
+func (r *requestState) addStep(step string) {
+	r.mu.Lock()
+	r.steps = append(r.steps, step)
+	r.mu.Unlock()
+}
+
+// doneSteps returns the tool calls executed so far.
+func (r *requestState) doneSteps() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.steps...)
+}
+
+type requestStateKey struct{}
+
+// withRequest returns a context carrying req.
+func withRequest(ctx context.Context, req *requestState) context.Context {
+	return context.WithValue(ctx, requestStateKey{}, req)
+}
+
+// requestFrom returns the request state of ctx, or an empty state when the
+// context carries none.
+func requestFrom(ctx context.Context) *requestState {
+	if req, ok := ctx.Value(requestStateKey{}).(*requestState); ok {
+		return req
+	}
+	return &requestState{}
+}
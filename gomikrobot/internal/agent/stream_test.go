@@ -0,0 +1,106 @@
+package agent
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kamir/gomikrobot/internal/bus"
+	"github.com/kamir/gomikrobot/internal/provider"
+)
+
+// streamingMockProvider streams its canned responses word by word.
+type streamingMockProvider struct {
+	mockProvider
+	chunks []string
+}
+
+func (m *streamingMockProvider) ChatStream(ctx context.Context, req *provider.ChatRequest, onDelta func(provider.StreamDelta)) (*provider.ChatResponse, error) {
+	for _, c := range m.chunks {
+		onDelta(provider.StreamDelta{Content: c})
+	}
+	return m.Chat(ctx, req)
+}
+
+func TestProcessMessageStreamsPartials(t *testing.T) {
+	msgBus := bus.NewMessageBus()
+	tmpDir := t.TempDir()
+
+	mock := &streamingMockProvider{
+		mockProvider: mockProvider{responses: []provider.ChatResponse{{Content: "Hello there"}}},
+		chunks:       []string{"Hello", " there"},
+	}
+	loop := NewLoop(LoopOptions{
+		Bus:       msgBus,
+		Provider:  mock,
+		Workspace: tmpDir,
+		WorkRepo:  tmpDir,
+		Model:     "mock-model",
+	})
+
+	var mu sync.Mutex
+	var partials []*bus.OutboundMessage
+	msgBus.Subscribe("webui", func(msg *bus.OutboundMessage) {
+		mu.Lock()
+		defer mu.Unlock()
+		if msg.Partial {
+			partials = append(partials, msg)
+		}
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	go msgBus.DispatchOutbound(ctx)
+
+	response, _, err := loop.processMessage(ctx, &bus.InboundMessage{
+		Channel:  "webui",
+		SenderID: "webui:tester",
+		ChatID:   "42",
+		TraceID:  "trace-stream-001",
+		Content:  "Say hello",
+	})
+	if err != nil {
+		t.Fatalf("processMessage error: %v", err)
+	}
+	if response != "Hello there" {
+		t.Fatalf("unexpected response %q", response)
+	}
+
+	deadline := time.After(2 * time.Second)
+	for {
+		mu.Lock()
+		n := len(partials)
+		mu.Unlock()
+		if n > 0 {
+			break
+		}
+		select {
+		case <-deadline:
+			t.Fatal("expected at least one partial outbound update")
+		case <-time.After(20 * time.Millisecond):
+		}
+	}
+
+	mu.Lock()
+	first := partials[0]
+	mu.Unlock()
+	if first.ChatID != "42" || first.TraceID != "trace-stream-001" || first.Content != "Hello" {
+		t.Errorf("unexpected partial %+v", first)
+	}
+
+	// Direct calls after the bus message must not stream anywhere.
+	mu.Lock()
+	before := len(partials)
+	mu.Unlock()
+	if _, err := loop.ProcessDirect(ctx, "Say hello again", "webui:42"); err != nil {
+		t.Fatalf("ProcessDirect error: %v", err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	mu.Lock()
+	after := len(partials)
+	mu.Unlock()
+	if after != before {
+		t.Errorf("expected no partial updates for a direct call, got %d", after-before)
+	}
+}
@@ -0,0 +1,247 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/kamir/gomikrobot/internal/provider"
+	"github.com/kamir/gomikrobot/internal/timeline"
+	"github.com/kamir/gomikrobot/internal/tools"
+)
+
+// Sub-agent limits. The caller may ask for less, never for more.
+const (
+	defaultSubAgentIterations = 8
+	maxSubAgentIterations     = 20
+	defaultSubAgentTokens     = 50000
+	maxSubAgentTokens         = 200000
+)
+
+// subAgentPrompt is the system prompt of a child loop.
+const subAgentPrompt = `You are a sub-agent working for the main assistant.
+Work only on the task below, using the tools you have. You cannot talk to the user.
+When you are done, reply with the final result only: concise, complete and self-contained,
+because the main assistant sees nothing but this answer.`
+
+// spawnAgentTool delegates a focused sub-task to a child loop with its own
+// message history, a restricted tool set and its own budget. Only the
+// child's final answer goes back into the parent's context.
+type spawnAgentTool struct {
+	parent *Loop
+}
+
+func (t *spawnAgentTool) Name() string { return "spawn_agent" }
+
+func (t *spawnAgentTool) Description() string {
+	return "Delegate a focused sub-task (e.g. research something in the repo and summarize) to a sub-agent. " +
+		"The sub-agent starts with an empty history, may use only the listed tools (default: the read-only ones) " +
+		"and returns just its final answer. Use it to keep large intermediate results out of the conversation."
+}
+
+func (t *spawnAgentTool) Parameters() map[string]any {
+	return map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"task": map[string]any{
+				"type":        "string",
+				"description": "Complete, self-contained description of the sub-task and the expected answer",
+			},
+			"tools": map[string]any{
+				"type":        "array",
+				"items":       map[string]any{"type": "string"},
+				"description": "Tool names the sub-agent may use (default: all read-only tools)",
+			},
+			"max_iterations": map[string]any{
+				"type":        "integer",
+				"description": fmt.Sprintf("Maximum LLM calls (default %d, at most %d)", defaultSubAgentIterations, maxSubAgentIterations),
+			},
+			"max_tokens": map[string]any{
+				"type":        "integer",
+				"description": fmt.Sprintf("Token budget across all calls (default %d, at most %d)", defaultSubAgentTokens, maxSubAgentTokens),
+			},
+		},
+		"required": []string{"task"},
+	}
+}
+
+// Tier is that of a call without a tool list (see CallTier).
+func (t *spawnAgentTool) Tier() int { return tools.TierWrite }
+
+// CallTier is the highest tier of the tools the child gets, so a child that
+// may write or run commands is checked like those calls and never runs in a
+// parallel batch. Without a tool list it is tier 1. Every tool call of the
+// child still passes the policy check on its own.
+func (t *spawnAgentTool) CallTier(params map[string]any) int {
+	requested := tools.GetStringSlice(params, "tools")
+	if len(requested) == 0 {
+		return tools.TierWrite
+	}
+	tier := tools.TierReadOnly
+	for _, name := range requested {
+		tool, ok := t.parent.registry.Get(name)
+		if !ok {
+			return tools.TierHighRisk
+		}
+		tier = max(tier, tools.CallTier(tool, nil))
+	}
+	return tier
+}
+
+func (t *spawnAgentTool) Execute(ctx context.Context, params map[string]any) (string, error) {
+	task := strings.TrimSpace(tools.GetString(params, "task", ""))
+	if task == "" {
+		return "Error: task is required", nil
+	}
+	iterations := clampInt(tools.GetInt(params, "max_iterations", 0), defaultSubAgentIterations, maxSubAgentIterations)
+	tokenBudget := clampInt(tools.GetInt(params, "max_tokens", 0), defaultSubAgentTokens, maxSubAgentTokens)
+
+	registry, names, unknown := t.parent.subAgentRegistry(tools.GetStringSlice(params, "tools"))
+	if len(unknown) > 0 {
+		return fmt.Sprintf("Error: unknown or unavailable tools: %s", strings.Join(unknown, ", ")), nil
+	}
+
+	child := t.parent.newSubAgent(registry, iterations, tokenBudget)
+
+	// The child shares the parent's task and trace, so its spans, tokens
+	// and costs are recorded there, but keeps its own tool-step list.
+	prs := requestFrom(ctx)
+	ctx = withRequest(ctx, &requestState{
+		TaskID:      prs.TaskID,
+		Sender:      prs.Sender,
+		Channel:     prs.Channel,
+		ChatID:      prs.ChatID,
+		TraceID:     prs.TraceID,
+		MessageType: prs.MessageType,
+		Profile:     prs.Profile,
+	})
+
+	system := subAgentPrompt
+	if repo := t.parent.currentWorkRepo(); repo != "" {
+		system += "\n\nWork repository: " + repo
+	}
+	messages := []provider.Message{
+		{Role: "system", Content: system},
+		{Role: "user", Content: task},
+	}
+
+	start := time.Now()
+	slog.Info("Sub-agent started", "trace_id", prs.TraceID, "tools", names, "max_iterations", iterations, "max_tokens", tokenBudget)
+	answer, err := child.runAgentLoop(ctx, messages)
+	t.parent.subAgentEvent(prs.TraceID, start, task, names, child, answer, err)
+	if err != nil {
+		return fmt.Sprintf("Error: sub-agent failed: %v", err), nil
+	}
+	return answer, nil
+}
+
+// subAgentRegistry builds the child's tool registry from the parent's.
+// Without a request it holds the read-only tools. spawn_agent itself is
+// never available, so children cannot spawn further agents.
+func (l *Loop) subAgentRegistry(requested []string) (*tools.Registry, []string, []string) {
+	reg := tools.NewRegistry()
+	var names, unknown []string
+	if len(requested) == 0 {
+		for _, tool := range l.registry.List() {
+			if tool.Name() != "spawn_agent" && tools.ToolTier(tool) == tools.TierReadOnly {
+				reg.Register(tool)
+				names = append(names, tool.Name())
+			}
+		}
+		sort.Strings(names)
+		return reg, names, nil
+	}
+	for _, name := range requested {
+		tool, ok := l.registry.Get(name)
+		if !ok || name == "spawn_agent" {
+			unknown = append(unknown, name)
+			continue
+		}
+		reg.Register(tool)
+		names = append(names, name)
+	}
+	return reg, names, unknown
+}
+
+// newSubAgent returns a child loop sharing the parent's provider, policy,
+// timeline, cost accounting and custom hooks. It has no bus: it neither streams to the
+// user nor asks for approvals, so tools that need approval are denied.
+func (l *Loop) newSubAgent(registry *tools.Registry, iterations, tokenBudget int) *Loop {
+	child := &Loop{
+		provider:         l.provider,
+		timeline:         l.timeline,
+		policy:           l.policy,
+		groupPublisher:   l.groupPublisher,
+		approvalMgr:      l.approvalMgr,
+		registry:         registry,
+		workspace:        l.workspace,
+		workRepo:         l.currentWorkRepo(),
+		systemRepo:       l.systemRepo,
+		model:            l.model,
+		maxIterations:    iterations,
+		maxParallelTools: l.maxParallelTools,
+		costs:            l.costs,
+		artifacts:        l.artifacts,
+		journal:          l.journal,
+		toolOutputChars:  l.toolOutputChars,
+		tokenBudget:      tokenBudget,
+		agentName:        "sub-agent",
+	}
+	child.setHooks(l.extraHooks)
+	return child
+}
+
+// currentWorkRepo returns the work repo, preferring the dynamic getter.
+func (l *Loop) currentWorkRepo() string {
+	if l.workRepoGetter != nil {
+		return l.workRepoGetter()
+	}
+	return l.workRepo
+}
+
+// subAgentEvent records a finished sub-agent run in the parent trace.
+func (l *Loop) subAgentEvent(traceID string, start time.Time, task string, toolNames []string, child *Loop, answer string, err error) {
+	if l.timeline == nil || traceID == "" {
+		return
+	}
+	meta := map[string]any{
+		"task":        truncateStr(task, 4096),
+		"tools":       toolNames,
+		"iterations":  child.maxIterations,
+		"token_limit": child.tokenBudget,
+		"tokens_used": child.tokensUsed,
+		"duration_ms": time.Since(start).Milliseconds(),
+		"result":      truncateStr(answer, 10240),
+	}
+	if err != nil {
+		meta["error"] = err.Error()
+	}
+	metaJSON, _ := json.Marshal(meta)
+	_ = l.timeline.AddEvent(&timeline.TimelineEvent{
+		EventID:        fmt.Sprintf("SUBAGENT_%s_%d", traceID, time.Now().UnixNano()),
+		TraceID:        traceID,
+		Timestamp:      start,
+		SenderID:       "AGENT",
+		SenderName:     "Sub-agent",
+		EventType:      "SYSTEM",
+		ContentText:    fmt.Sprintf("sub-agent tools=%s tokens=%d duration=%dms", strings.Join(toolNames, ","), child.tokensUsed, time.Since(start).Milliseconds()),
+		Classification: "SUBAGENT",
+		Authorized:     true,
+		Metadata:       string(metaJSON),
+	})
+}
+
+// clampInt returns def for n <= 0 and caps n at max.
+func clampInt(n, def, max int) int {
+	if n <= 0 {
+		return def
+	}
+	if n > max {
+		return max
+	}
+	return n
+}
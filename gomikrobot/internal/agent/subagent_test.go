@@ -0,0 +1,158 @@
+package agent
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kamir/gomikrobot/internal/bus"
+	"github.com/kamir/gomikrobot/internal/provider"
+	"github.com/kamir/gomikrobot/internal/timeline"
+	"github.com/kamir/gomikrobot/internal/tools"
+)
+
+func TestSpawnAgentRunsChildWithOwnHistory(t *testing.T) {
+	tl := newTestTimeline(t)
+	tmpDir := t.TempDir()
+	prov := &recordingProvider{mockProvider: mockProvider{responses: []provider.ChatResponse{
+		// Parent delegates.
+		{ToolCalls: []provider.ToolCall{{ID: "p1", Name: "spawn_agent", Arguments: map[string]any{
+			"task": "Find the config loader", "tools": []any{"probe_read"},
+		}}}, Usage: provider.Usage{TotalTokens: 10}},
+		// Child uses its tool, then answers.
+		{ToolCalls: []provider.ToolCall{{ID: "c1", Name: "probe_read", Arguments: map[string]any{"id": "x"}}},
+			Usage: provider.Usage{TotalTokens: 10}},
+		{Content: "It is in internal/config/loader.go", Usage: provider.Usage{TotalTokens: 10}},
+		// Parent answers the user.
+		{Content: "The loader lives in internal/config.", Usage: provider.Usage{TotalTokens: 10}},
+	}}}
+	loop := NewLoop(LoopOptions{
+		Bus:       bus.NewMessageBus(),
+		Provider:  prov,
+		Timeline:  tl,
+		Workspace: tmpDir,
+		WorkRepo:  tmpDir,
+		Model:     "mock-model",
+	})
+	var running, peak int32
+	var mu sync.Mutex
+	var order []string
+	loop.registry.Register(&probeTool{name: "probe_read", tier: tools.TierReadOnly,
+		running: &running, peak: &peak, mu: &mu, order: &order})
+
+	chatID := "spawn" + time.Now().Format("150405.000000")
+	t.Cleanup(func() { loop.sessions.Delete("test:" + chatID) })
+	resp, _, err := loop.processMessage(context.Background(), &bus.InboundMessage{
+		Channel: "test", SenderID: "u", ChatID: chatID, TraceID: "trace-spawn-001",
+		Content: "Where is the config loaded?", Timestamp: time.Now(),
+	})
+	if err != nil {
+		t.Fatalf("processMessage: %v", err)
+	}
+	if resp != "The loader lives in internal/config." {
+		t.Fatalf("unexpected response %q", resp)
+	}
+	if len(prov.requests) != 4 {
+		t.Fatalf("expected 4 LLM calls, got %d", len(prov.requests))
+	}
+
+	// The child starts from its own two messages and sees only its tool.
+	child := prov.requests[1]
+	if len(child.Messages) != 2 || child.Messages[1].Content != "Find the config loader" {
+		t.Fatalf("child should start with system prompt and task, got %d messages", len(child.Messages))
+	}
+	if len(child.Tools) != 1 || child.Tools[0].Function.Name != "probe_read" {
+		t.Fatalf("child should only get probe_read, got %v", child.Tools)
+	}
+
+	// The parent only receives the child's final answer.
+	last := prov.requests[3].Messages
+	if got := last[len(last)-1]; got.Role != "tool" || got.Content != "It is in internal/config/loader.go" {
+		t.Fatalf("expected child answer as tool result, got %+v", got)
+	}
+	for _, m := range last {
+		if strings.Contains(m.Content, "result x") {
+			t.Fatal("child tool output leaked into the parent context")
+		}
+	}
+
+	events, err := tl.GetEvents(timeline.FilterArgs{TraceID: "trace-spawn-001", Limit: 100})
+	if err != nil {
+		t.Fatalf("get events: %v", err)
+	}
+	var sub, childLLM, childTool bool
+	for _, ev := range events {
+		switch {
+		case ev.Classification == "SUBAGENT":
+			sub = true
+		case ev.Classification == "LLM" && strings.HasPrefix(ev.ContentText, "sub-agent: "):
+			childLLM = true
+		case ev.Classification == "TOOL" && strings.Contains(ev.ContentText, "sub-agent: tool=probe_read"):
+			childTool = true
+		}
+	}
+	if !sub || !childLLM || !childTool {
+		t.Fatalf("expected sub-agent spans under the parent trace (subagent=%v llm=%v tool=%v)", sub, childLLM, childTool)
+	}
+}
+
+func TestSubAgentRegistryAndBudget(t *testing.T) {
+	tmpDir := t.TempDir()
+	prov := &mockProvider{responses: []provider.ChatResponse{
+		{Content: "looking", ToolCalls: []provider.ToolCall{{ID: "c1", Name: "list_dir", Arguments: map[string]any{"path": tmpDir}}},
+			Usage: provider.Usage{TotalTokens: 600}},
+		{Content: "should not be reached", Usage: provider.Usage{TotalTokens: 10}},
+	}}
+	loop := NewLoop(LoopOptions{Provider: prov, Workspace: tmpDir, WorkRepo: tmpDir, Model: "mock-model"})
+
+	reg, names, unknown := loop.subAgentRegistry(nil)
+	if len(unknown) != 0 {
+		t.Fatalf("unexpected unknown tools %v", unknown)
+	}
+	if _, ok := reg.Get("spawn_agent"); ok {
+		t.Fatal("sub-agents must not be able to spawn agents")
+	}
+	if _, ok := reg.Get("write_file"); ok {
+		t.Fatal("default sub-agent tools must be read-only")
+	}
+	if _, ok := reg.Get("read_file"); !ok {
+		t.Fatalf("expected read_file among default tools, got %v", names)
+	}
+	if _, _, unknown := loop.subAgentRegistry([]string{"read_file", "spawn_agent", "nope"}); len(unknown) != 2 {
+		t.Fatalf("expected spawn_agent and nope to be rejected, got %v", unknown)
+	}
+
+	tool, _ := loop.registry.Get("spawn_agent")
+	out, err := tool.Execute(context.Background(), map[string]any{"task": "look around", "max_tokens": float64(500)})
+	if err != nil {
+		t.Fatalf("execute: %v", err)
+	}
+	if !strings.Contains(out, "Token budget of 500 exhausted") || prov.calls != 1 {
+		t.Fatalf("expected child to stop after its budget, got %q after %d calls", out, prov.calls)
+	}
+}
+
+func TestSpawnAgentTierFollowsChildTools(t *testing.T) {
+	tmpDir := t.TempDir()
+	loop := NewLoop(LoopOptions{Provider: &mockProvider{}, Workspace: tmpDir, WorkRepo: tmpDir})
+	for _, tc := range []struct {
+		tools []any
+		want  int
+	}{
+		{nil, tools.TierWrite},
+		{[]any{"read_file", "list_dir"}, tools.TierReadOnly},
+		{[]any{"read_file", "write_file"}, tools.TierWrite},
+		{[]any{"exec"}, tools.TierHighRisk},
+		{[]any{"nope"}, tools.TierHighRisk},
+	} {
+		call := provider.ToolCall{Name: "spawn_agent", Arguments: map[string]any{"task": "x"}}
+		if tc.tools != nil {
+			call.Arguments["tools"] = tc.tools
+		}
+		if got := loop.toolTier(call); got != tc.want {
+			t.Errorf("tools %v: tier %d, want %d", tc.tools, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package agent
+
+import (
+	"context"
+
+	"github.com/kamir/gomikrobot/internal/bus"
+)
+
+// defaultConcurrentSessions bounds concurrent sessions when not configured.
+const defaultConcurrentSessions = 8
+
+// sessionWorker holds the messages waiting for one session. A worker
+// goroutine drains the queue in order and exits when it is empty.
+type sessionWorker struct {
+	queue []*bus.InboundMessage
+}
+
+// dispatch queues msg for its session and starts a worker if none is
+// running. Messages of the same session are processed one after another,
+// so a slow tool call or a pending approval only blocks its own chat.
+func (l *Loop) dispatch(ctx context.Context, msg *bus.InboundMessage) {
+	key := SessionKey(msg.Channel, msg.ChatID)
+
+	l.workersMu.Lock()
+	defer l.workersMu.Unlock()
+	if w, ok := l.workers[key]; ok {
+		w.queue = append(w.queue, msg)
+		return
+	}
+	w := &sessionWorker{queue: []*bus.InboundMessage{msg}}
+	l.workers[key] = w
+	l.workerWG.Add(1)
+	go l.runSessionWorker(ctx, key, w)
+}
+
+func (l *Loop) runSessionWorker(ctx context.Context, key string, w *sessionWorker) {
+	defer l.workerWG.Done()
+	for {
+		l.workersMu.Lock()
+		if len(w.queue) == 0 {
+			delete(l.workers, key)
+			l.workersMu.Unlock()
+			return
+		}
+		msg := w.queue[0]
+		w.queue = w.queue[1:]
+		l.workersMu.Unlock()
+
+		// Wait for a free slot so at most cap(l.slots) sessions run at once.
+		select {
+		case l.slots <- struct{}{}:
+		case <-ctx.Done():
+			l.workersMu.Lock()
+			delete(l.workers, key)
+			l.workersMu.Unlock()
+			return
+		}
+		l.handleInbound(ctx, msg)
+		<-l.slots
+	}
+}
@@ -0,0 +1,141 @@
+package agent
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kamir/gomikrobot/internal/bus"
+	"github.com/kamir/gomikrobot/internal/provider"
+)
+
+// gatedProvider answers with the last user message, holding back any
+// message that starts with "slow" until release is closed.
+type gatedProvider struct {
+	release chan struct{}
+	mu      sync.Mutex
+	active  map[string]int // in-flight calls per answer prefix
+	overlap bool
+}
+
+func (g *gatedProvider) Chat(ctx context.Context, req *provider.ChatRequest) (*provider.ChatResponse, error) {
+	last := req.Messages[len(req.Messages)-1].Content
+	chat := strings.SplitN(last, " ", 2)[0]
+
+	g.mu.Lock()
+	g.active[chat]++
+	if g.active[chat] > 1 {
+		g.overlap = true
+	}
+	g.mu.Unlock()
+	defer func() {
+		g.mu.Lock()
+		g.active[chat]--
+		g.mu.Unlock()
+	}()
+
+	if chat == "slow" {
+		select {
+		case <-g.release:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	time.Sleep(5 * time.Millisecond)
+	return &provider.ChatResponse{Content: "re: " + last, Usage: provider.Usage{TotalTokens: 1}}, nil
+}
+func (g *gatedProvider) Transcribe(_ context.Context, _ *provider.AudioRequest) (*provider.AudioResponse, error) {
+	return &provider.AudioResponse{}, nil
+}
+func (g *gatedProvider) Speak(_ context.Context, _ *provider.TTSRequest) (*provider.TTSResponse, error) {
+	return &provider.TTSResponse{}, nil
+}
+func (g *gatedProvider) DefaultModel() string { return "gated" }
+
+func TestRunProcessesSessionsConcurrently(t *testing.T) {
+	msgBus := bus.NewMessageBus()
+	tmpDir := t.TempDir()
+	prov := &gatedProvider{release: make(chan struct{}), active: map[string]int{}}
+	loop := NewLoop(LoopOptions{
+		Bus:       msgBus,
+		Provider:  prov,
+		Workspace: tmpDir,
+		WorkRepo:  tmpDir,
+		Model:     "gated",
+	})
+
+	var mu sync.Mutex
+	var replies []string
+	got := make(chan struct{}, 16)
+	msgBus.Subscribe("test", func(msg *bus.OutboundMessage) {
+		mu.Lock()
+		replies = append(replies, msg.ChatID+": "+msg.Content)
+		mu.Unlock()
+		got <- struct{}{}
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	go msgBus.DispatchOutbound(ctx)
+	done := make(chan struct{})
+	go func() {
+		_ = loop.Run(ctx)
+		close(done)
+	}()
+
+	suffix := time.Now().Format("150405.000000")
+	send := func(chatID, content string) {
+		msgBus.PublishInbound(&bus.InboundMessage{
+			Channel: "test", SenderID: "u", ChatID: chatID + suffix, Content: content, Timestamp: time.Now(),
+		})
+	}
+	send("a", "slow first")
+	send("a", "fast second")
+	send("b", "fast other chat")
+
+	// Chat b answers while chat a is still blocked on its first message.
+	select {
+	case <-got:
+	case <-time.After(3 * time.Second):
+		t.Fatal("expected a reply for chat b while chat a is blocked")
+	}
+	mu.Lock()
+	first := replies[0]
+	mu.Unlock()
+	if !strings.HasPrefix(first, "b") {
+		t.Fatalf("expected chat b to answer first, got %q", first)
+	}
+
+	close(prov.release)
+	for i := 0; i < 2; i++ {
+		select {
+		case <-got:
+		case <-time.After(3 * time.Second):
+			t.Fatal("timed out waiting for chat a replies")
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if !strings.Contains(replies[1], "re: slow first") || !strings.Contains(replies[2], "re: fast second") {
+		t.Fatalf("messages of one session must be answered in order, got %v", replies)
+	}
+	prov.mu.Lock()
+	overlap := prov.overlap
+	prov.mu.Unlock()
+	if overlap {
+		t.Fatal("messages of the same session ran concurrently")
+	}
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(3 * time.Second):
+		t.Fatal("Run did not return after cancel")
+	}
+	for _, key := range []string{"test:a" + suffix, "test:b" + suffix} {
+		loop.sessions.Delete(key)
+	}
+}
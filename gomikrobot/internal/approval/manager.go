@@ -41,13 +41,26 @@ func NewManager(tl *timeline.TimelineService) *Manager {
 		pending:  make(map[string]chan bool),
 		timeline: tl,
 	}
-	m.cleanupStale()
+	m.cleanupStale("")
 	return m
 }
 
-// cleanupStale marks any DB-pending approvals as timeout on startup.
-// These are leftovers from a previous process that never resolved them.
-func (m *Manager) cleanupStale() {
+// NewChannelManager is NewManager for a process that shares the timeline
+// with a running gateway (e.g. the MCP server): on creation it only marks
+// stale approvals of its own channel as timeout.
+func NewChannelManager(tl *timeline.TimelineService, channel string) *Manager {
+	m := &Manager{
+		pending:  make(map[string]chan bool),
+		timeline: tl,
+	}
+	m.cleanupStale(channel)
+	return m
+}
+
+// cleanupStale marks any DB-pending approvals (of channel, if set) as
+// timeout on startup. These are leftovers from a previous process that
+// never resolved them.
+func (m *Manager) cleanupStale(channel string) {
 	if m.timeline == nil {
 		return
 	}
@@ -56,6 +69,9 @@ func (m *Manager) cleanupStale() {
 		return
 	}
 	for _, r := range pending {
+		if channel != "" && r.Channel != channel {
+			continue
+		}
 		_ = m.timeline.UpdateApprovalStatus(r.ApprovalID, "timeout")
 	}
 }
@@ -2,8 +2,11 @@ package approval
 
 import (
 	"context"
+	"path/filepath"
 	"testing"
 	"time"
+
+	"github.com/kamir/gomikrobot/internal/timeline"
 )
 
 func TestApproved(t *testing.T) {
@@ -78,3 +81,24 @@ func TestRespondNonexistent(t *testing.T) {
 		t.Fatal("expected error for nonexistent approval")
 	}
 }
+
+func TestChannelManagerKeepsOtherChannels(t *testing.T) {
+	tl, err := timeline.NewTimelineService(filepath.Join(t.TempDir(), "timeline.db"))
+	if err != nil {
+		t.Fatalf("timeline: %v", err)
+	}
+	defer tl.Close()
+
+	gw := NewManager(tl)
+	gw.Create(&ApprovalRequest{Tool: "exec", Tier: 2, Channel: "whatsapp"})
+	gw.Create(&ApprovalRequest{Tool: "exec", Tier: 2, Channel: "mcp"})
+
+	NewChannelManager(tl, "mcp")
+	pending, err := tl.GetPendingApprovals()
+	if err != nil {
+		t.Fatalf("pending: %v", err)
+	}
+	if len(pending) != 1 || pending[0].Channel != "whatsapp" {
+		t.Fatalf("expected only the whatsapp approval to stay pending, got %+v", pending)
+	}
+}
@@ -11,6 +11,7 @@ import (
 const (
 	MetaKeyMessageType  = "message_type"
 	MetaKeyIsFromMe     = "is_from_me"
+	MetaKeyVoiceReply   = "voice_reply" // bool: also speak the reply to this message
 	MessageTypeInternal = "internal"
 	MessageTypeExternal = "external"
 )
@@ -38,6 +39,13 @@ func (m *InboundMessage) MessageType() string {
 	return MessageTypeExternal
 }
 
+// WantsVoiceReply reports whether the channel asked for the reply to this
+// message to be spoken as well.
+func (m *InboundMessage) WantsVoiceReply() bool {
+	voice, _ := m.Metadata[MetaKeyVoiceReply].(bool)
+	return voice
+}
+
 // OutboundMessage represents a message from the agent to a channel.
 type OutboundMessage struct {
 	Channel string `json:"channel"`
@@ -45,6 +53,14 @@ type OutboundMessage struct {
 	TraceID string `json:"trace_id"`
 	TaskID  string `json:"task_id,omitempty"`
 	Content string `json:"content"`
+	// Partial marks an incremental streaming update carrying the text
+	// generated so far. The final message follows with Partial unset;
+	// channels that cannot render progress should treat partials as a
+	// typing signal or ignore them.
+	Partial bool `json:"partial,omitempty"`
+	// Voice marks the final reply to a message that asked for a voice
+	// reply; channels that can should also send it as speech.
+	Voice bool `json:"voice,omitempty"`
 }
 
 // MessageBus decouples channels from the agent core.
@@ -38,6 +38,9 @@ type WhatsAppChannel struct {
 	provider  provider.LLMProvider
 	timeline  *timeline.TimelineService
 	sendFn    func(ctx context.Context, msg *bus.OutboundMessage) error
+	typingFn  func(ctx context.Context, chatID string) error
+	typingAt  map[string]time.Time
+	voiceFn   func(ctx context.Context, chatID string, audio []byte) error
 	allowlist map[string]bool
 	denylist  map[string]bool
 	token     string
@@ -163,6 +166,12 @@ func (c *WhatsAppChannel) Send(ctx context.Context, msg *bus.OutboundMessage) er
 }
 
 func (c *WhatsAppChannel) handleOutbound(msg *bus.OutboundMessage) {
+	// Streaming partials can't be edited into a WhatsApp message, so they
+	// only drive the typing indicator. The final message follows.
+	if msg.Partial {
+		c.handleTyping(msg)
+		return
+	}
 	// Check silent mode — never send if enabled
 	if c.timeline != nil && c.timeline.IsSilentMode() {
 		fmt.Printf("🔇 Silent Mode: suppressed outbound to %s reason=silent_mode channel=%s\n", msg.ChatID, c.Name())
@@ -185,11 +194,115 @@ func (c *WhatsAppChannel) handleOutbound(msg *bus.OutboundMessage) {
 		return
 	}
 	c.logOutbound("sent", msg)
+	c.mu.Lock()
+	delete(c.typingAt, msg.ChatID)
+	c.mu.Unlock()
+	if msg.Voice && c.config.VoiceReplies {
+		c.sendVoiceReply(msg)
+	}
 	if c.timeline != nil && msg.TaskID != "" {
 		_ = c.timeline.UpdateTaskDelivery(msg.TaskID, timeline.DeliverySent, nil)
 	}
 }
 
+// typingRefreshInterval bounds how often the composing state is re-sent
+// while a response streams in; WhatsApp keeps it visible for ~25s.
+const typingRefreshInterval = 10 * time.Second
+
+// handleTyping shows the "typing..." state for a streaming response.
+func (c *WhatsAppChannel) handleTyping(msg *bus.OutboundMessage) {
+	if c.timeline != nil && c.timeline.IsSilentMode() {
+		return
+	}
+
+	c.mu.Lock()
+	if c.typingAt == nil {
+		c.typingAt = make(map[string]time.Time)
+	}
+	if time.Since(c.typingAt[msg.ChatID]) < typingRefreshInterval {
+		c.mu.Unlock()
+		return
+	}
+	c.typingAt[msg.ChatID] = time.Now()
+	c.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := c.sendTyping(ctx, msg.ChatID); err != nil {
+		fmt.Printf("⚠️ WhatsApp typing state error: %v\n", err)
+	}
+}
+
+func (c *WhatsAppChannel) sendTyping(ctx context.Context, chatID string) error {
+	if c.typingFn != nil {
+		return c.typingFn(ctx, chatID)
+	}
+	if c.client == nil {
+		return fmt.Errorf("client not initialized")
+	}
+	jid, err := types.ParseJID(chatID)
+	if err != nil {
+		return fmt.Errorf("invalid JID: %w", err)
+	}
+	return c.client.SendChatPresence(ctx, jid, types.ChatPresenceComposing, types.ChatPresenceMediaText)
+}
+
+// maxVoiceReplyChars bounds replies that are also spoken; longer answers
+// are sent as text only.
+const maxVoiceReplyChars = 1500
+
+// sendVoiceReply speaks msg and sends it as a voice note after the text
+// reply. Failures are logged; the text has already been delivered.
+func (c *WhatsAppChannel) sendVoiceReply(msg *bus.OutboundMessage) {
+	text := strings.TrimSpace(msg.Content)
+	if text == "" || len(text) > maxVoiceReplyChars || c.provider == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+	speech, err := c.provider.Speak(ctx, &provider.TTSRequest{Text: text})
+	if err != nil {
+		fmt.Printf("⚠️ Voice reply synthesis failed: %v\n", err)
+		return
+	}
+	if err := c.sendVoice(ctx, msg.ChatID, speech.AudioData); err != nil {
+		fmt.Printf("⚠️ Voice reply send failed: %v\n", err)
+		return
+	}
+	fmt.Printf("🔊 Voice reply sent to %s (%d bytes)\n", msg.ChatID, len(speech.AudioData))
+}
+
+// sendVoice uploads Ogg/Opus audio and sends it as a push-to-talk note.
+func (c *WhatsAppChannel) sendVoice(ctx context.Context, chatID string, audio []byte) error {
+	if c.voiceFn != nil {
+		return c.voiceFn(ctx, chatID, audio)
+	}
+	if c.client == nil {
+		return fmt.Errorf("client not initialized")
+	}
+	jid, err := types.ParseJID(chatID)
+	if err != nil {
+		return fmt.Errorf("invalid JID: %w", err)
+	}
+	up, err := c.client.Upload(ctx, audio, whatsmeow.MediaAudio)
+	if err != nil {
+		return fmt.Errorf("upload voice note: %w", err)
+	}
+	_, err = c.client.SendMessage(ctx, jid, &waE2E.Message{
+		AudioMessage: &waE2E.AudioMessage{
+			URL:           proto.String(up.URL),
+			DirectPath:    proto.String(up.DirectPath),
+			MediaKey:      up.MediaKey,
+			Mimetype:      proto.String("audio/ogg; codecs=opus"),
+			FileEncSHA256: up.FileEncSHA256,
+			FileSHA256:    up.FileSHA256,
+			FileLength:    proto.Uint64(up.FileLength),
+			PTT:           proto.Bool(true),
+		},
+	})
+	return err
+}
+
 func deliveryBackoff(attempts int) time.Time {
 	delay := 30 * time.Second * time.Duration(1<<uint(attempts))
 	maxDelay := 5 * time.Minute
@@ -242,6 +355,10 @@ func (c *WhatsAppChannel) eventHandler(evt interface{}) {
 		// Improved content extraction
 		content := ""
 		mediaPath := "" // Declare outside scope
+		// Images and documents are handed to the agent as attachments;
+		// audio is transcribed into content instead.
+		var attachments []string
+		voiceNote := false // transcribed audio; reply by voice too if enabled
 
 		if v.Message.GetConversation() != "" {
 			content = v.Message.GetConversation()
@@ -250,6 +367,9 @@ func (c *WhatsAppChannel) eventHandler(evt interface{}) {
 		} else if v.Message.GetImageMessage() != nil {
 			content = "[Image Message]"
 			img := v.Message.GetImageMessage()
+			if caption := strings.TrimSpace(img.GetCaption()); caption != "" {
+				content += " " + caption
+			}
 			data, err := c.client.Download(context.Background(), img)
 			if err == nil {
 				ext := "jpg"
@@ -264,9 +384,8 @@ func (c *WhatsAppChannel) eventHandler(evt interface{}) {
 				os.WriteFile(filePath, data, 0644)
 
 				mediaPath = filePath
+				attachments = append(attachments, filePath)
 				fmt.Printf("📸 Image saved to %s\n", filePath)
-
-				// Optional: Describe image using Vision API? (For later)
 			} else {
 				fmt.Printf("❌ Image download error: %v\n", err)
 			}
@@ -295,6 +414,7 @@ func (c *WhatsAppChannel) eventHandler(evt interface{}) {
 				if err == nil {
 					fmt.Printf("📝 Transcript: %s\n", transcript.Text)
 					content = "[Audio Transcript]: " + transcript.Text
+					voiceNote = true
 					// Note: Transcript echo removed - no automatic response
 				} else {
 					fmt.Printf("❌ Transcription error: %v\n", err)
@@ -309,6 +429,9 @@ func (c *WhatsAppChannel) eventHandler(evt interface{}) {
 				docTitle = doc.GetFileName()
 			}
 			content = fmt.Sprintf("[Document: %s]", docTitle)
+			if caption := strings.TrimSpace(doc.GetCaption()); caption != "" {
+				content += " " + caption
+			}
 
 			data, err := c.client.Download(context.Background(), doc)
 			if err == nil {
@@ -331,6 +454,7 @@ func (c *WhatsAppChannel) eventHandler(evt interface{}) {
 				os.WriteFile(filePath, data, 0644)
 
 				mediaPath = filePath
+				attachments = append(attachments, filePath)
 				fmt.Printf("📄 Document saved to %s (%s, %d bytes)\n", filePath, doc.GetMimetype(), len(data))
 			} else {
 				fmt.Printf("❌ Document download error: %v\n", err)
@@ -409,10 +533,12 @@ func (c *WhatsAppChannel) eventHandler(evt interface{}) {
 				TraceID:        traceID,
 				IdempotencyKey: "wa:" + v.Info.ID,
 				Content:        content,
+				Media:          attachments,
 				Timestamp:      v.Info.Timestamp,
 				Metadata: map[string]any{
 					bus.MetaKeyMessageType: msgType,
 					bus.MetaKeyIsFromMe:    v.Info.IsFromMe,
+					bus.MetaKeyVoiceReply:  voiceNote && c.config.VoiceReplies,
 				},
 			})
 		}
@@ -619,6 +745,22 @@ func containsStr(list []string, v string) bool {
 	return false
 }
 
+// classificationFormat constrains classifyMessage answers to a known category.
+var classificationFormat = &provider.ResponseFormat{
+	Type:   provider.FormatJSONSchema,
+	Name:   "classification",
+	Strict: true,
+	Schema: map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"category": map[string]any{"type": "string", "enum": []string{"EMERGENCY", "APPOINTMENT", "ASSISTANCE"}},
+			"summary":  map[string]any{"type": "string"},
+		},
+		"required":             []string{"category", "summary"},
+		"additionalProperties": false,
+	},
+}
+
 // classifyMessage uses the LLM to classify the intent of the message.
 func (c *WhatsAppChannel) classifyMessage(ctx context.Context, content string) (category string, summary string) {
 	sysPrompt := `You are an intent classifier for a personal agent.
@@ -635,35 +777,23 @@ Output logic:
 - If it's "Can we meet at 5?", it's APPOINTMENT.
 `
 
-	resp, err := c.provider.Chat(ctx, &provider.ChatRequest{
+	var result struct {
+		Category string `json:"category"`
+		Summary  string `json:"summary"`
+	}
+	_, err := provider.ChatJSON(ctx, c.provider, &provider.ChatRequest{
 		Model: "gpt-4o",
 		Messages: []provider.Message{
 			{Role: "system", Content: sysPrompt},
 			{Role: "user", Content: content},
 		},
-		MaxTokens: 100,
-	})
-
+		MaxTokens:      100,
+		ResponseFormat: classificationFormat,
+	}, &result)
 	if err != nil {
 		fmt.Printf("⚠️ Classification failed: %v\n", err)
 		return "ASSISTANCE", shorten(content, 30)
 	}
 
-	// Clean code blocks if present
-	txt := strings.TrimSpace(resp.Content)
-	txt = strings.TrimPrefix(txt, "```json")
-	txt = strings.TrimSuffix(txt, "```")
-
-	var result struct {
-		Category string `json:"category"`
-		Summary  string `json:"summary"`
-	}
-
-	// Fallback to simple unmarshal or just default
-	if err := json.Unmarshal([]byte(txt), &result); err != nil {
-		fmt.Printf("⚠️ JSON parse error: %v (raw: %s)\n", err, txt)
-		return "ASSISTANCE", shorten(content, 30)
-	}
-
 	return strings.ToUpper(result.Category), result.Summary
 }
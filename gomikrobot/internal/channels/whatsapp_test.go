@@ -10,6 +10,7 @@ import (
 
 	"github.com/kamir/gomikrobot/internal/bus"
 	"github.com/kamir/gomikrobot/internal/config"
+	"github.com/kamir/gomikrobot/internal/provider"
 	"github.com/kamir/gomikrobot/internal/timeline"
 )
 
@@ -119,3 +120,78 @@ func TestWhatsAppOutboundLogsTimeline(t *testing.T) {
 		t.Fatalf("expected outbound timeline event to be logged")
 	}
 }
+
+func TestWhatsAppPartialOutboundOnlyShowsTyping(t *testing.T) {
+	timeSvc := newTestTimeline(t)
+	if err := timeSvc.SetSetting("silent_mode", "false"); err != nil {
+		t.Fatalf("failed to set silent mode: %v", err)
+	}
+	wa := NewWhatsAppChannel(config.WhatsAppConfig{Enabled: true}, bus.NewMessageBus(), nil, timeSvc)
+
+	var sent, typing int32
+	wa.sendFn = func(ctx context.Context, msg *bus.OutboundMessage) error {
+		atomic.AddInt32(&sent, 1)
+		return nil
+	}
+	wa.typingFn = func(ctx context.Context, chatID string) error {
+		atomic.AddInt32(&typing, 1)
+		return nil
+	}
+
+	for _, text := range []string{"Hel", "Hello"} {
+		wa.handleOutbound(&bus.OutboundMessage{
+			Channel: wa.Name(),
+			ChatID:  "12345@s.whatsapp.net",
+			Content: text,
+			Partial: true,
+		})
+	}
+
+	if atomic.LoadInt32(&sent) != 0 {
+		t.Fatalf("partials must not be sent as messages")
+	}
+	if atomic.LoadInt32(&typing) != 1 {
+		t.Fatalf("expected one throttled typing update, got %d", typing)
+	}
+}
+
+// speakingProvider returns fixed audio from Speak.
+type speakingProvider struct {
+	provider.LLMProvider
+	texts []string
+}
+
+func (p *speakingProvider) Speak(_ context.Context, req *provider.TTSRequest) (*provider.TTSResponse, error) {
+	p.texts = append(p.texts, req.Text)
+	return &provider.TTSResponse{AudioData: []byte("OggS"), Format: "opus"}, nil
+}
+
+func TestWhatsAppVoiceReplyAfterVoiceNote(t *testing.T) {
+	timeSvc := newTestTimeline(t)
+	if err := timeSvc.SetSetting("silent_mode", "false"); err != nil {
+		t.Fatalf("failed to set silent mode: %v", err)
+	}
+	tts := &speakingProvider{}
+	wa := NewWhatsAppChannel(config.WhatsAppConfig{Enabled: true, VoiceReplies: true}, bus.NewMessageBus(), tts, timeSvc)
+
+	var voiceNotes int
+	wa.sendFn = func(ctx context.Context, msg *bus.OutboundMessage) error { return nil }
+	wa.voiceFn = func(ctx context.Context, chatID string, audio []byte) error {
+		voiceNotes++
+		if string(audio) != "OggS" {
+			t.Errorf("unexpected audio %q", audio)
+		}
+		return nil
+	}
+
+	// Only the reply flagged as the answer to the voice note is spoken, not
+	// an approval prompt or a reply to a later text message in the chat.
+	chatID := "12345@s.whatsapp.net"
+	wa.handleOutbound(&bus.OutboundMessage{Channel: wa.Name(), ChatID: chatID, TraceID: "wa-1", Content: "Tool \"exec\" requires approval."})
+	wa.handleOutbound(&bus.OutboundMessage{Channel: wa.Name(), ChatID: chatID, TraceID: "wa-2", Content: "Text reply"})
+	wa.handleOutbound(&bus.OutboundMessage{Channel: wa.Name(), ChatID: chatID, TraceID: "wa-1", Content: "Alles klar.", Voice: true})
+
+	if voiceNotes != 1 || len(tts.texts) != 1 || tts.texts[0] != "Alles klar." {
+		t.Fatalf("expected exactly one spoken reply, got %d notes for %v", voiceNotes, tts.texts)
+	}
+}
@@ -6,15 +6,18 @@ import "time"
 // Config is the root configuration struct.
 // Top-level groups: Paths, Model, Channels, Providers, Gateway, Tools.
 type Config struct {
-	Paths        PathsConfig        `json:"paths"`
-	Model        ModelConfig        `json:"model"`
-	Channels     ChannelsConfig     `json:"channels"`
-	Providers    ProvidersConfig    `json:"providers"`
-	Gateway      GatewayConfig      `json:"gateway"`
-	Tools        ToolsConfig        `json:"tools"`
-	Group        GroupConfig        `json:"group"`
-	Orchestrator OrchestratorConfig `json:"orchestrator"`
-	Scheduler    SchedulerConfig    `json:"scheduler"`
+	Paths         PathsConfig         `json:"paths"`
+	Model         ModelConfig         `json:"model"`
+	Channels      ChannelsConfig      `json:"channels"`
+	Providers     ProvidersConfig     `json:"providers"`
+	Gateway       GatewayConfig       `json:"gateway"`
+	Tools         ToolsConfig         `json:"tools"`
+	Group         GroupConfig         `json:"group"`
+	Orchestrator  OrchestratorConfig  `json:"orchestrator"`
+	Scheduler     SchedulerConfig     `json:"scheduler"`
+	Costs         CostsConfig         `json:"costs"`
+	AgentProfiles AgentProfilesConfig `json:"agentProfiles"`
+	Intent        IntentConfig        `json:"intent"`
 }
 
 // ---------------------------------------------------------------------------
@@ -38,6 +41,18 @@ type ModelConfig struct {
 	MaxTokens         int     `json:"maxTokens" envconfig:"MAX_TOKENS"`
 	Temperature       float64 `json:"temperature" envconfig:"TEMPERATURE"`
 	MaxToolIterations int     `json:"maxToolIterations" envconfig:"MAX_TOOL_ITERATIONS"`
+	// HistoryTokens is the session history budget; older turns beyond it
+	// are summarized.
+	HistoryTokens int `json:"historyTokens" envconfig:"HISTORY_TOKENS"`
+	// ToolOutputChars is the tool result size above which the output is
+	// saved as an artifact and only a preview goes to the model.
+	ToolOutputChars int `json:"toolOutputChars" envconfig:"TOOL_OUTPUT_CHARS"`
+	// MaxParallelTools bounds concurrent read-only tool calls in one
+	// response; 1 runs them one after another.
+	MaxParallelTools int `json:"maxParallelTools" envconfig:"MAX_PARALLEL_TOOLS"`
+	// MaxConcurrentSessions bounds how many sessions are processed at the
+	// same time; messages of one session always run in order.
+	MaxConcurrentSessions int `json:"maxConcurrentSessions" envconfig:"MAX_CONCURRENT_SESSIONS"`
 }
 
 // ---------------------------------------------------------------------------
@@ -74,6 +89,7 @@ type WhatsAppConfig struct {
 	AllowFrom        []string `json:"allowFrom"`
 	DropUnauthorized bool     `json:"dropUnauthorized" envconfig:"WHATSAPP_DROP_UNAUTHORIZED"`
 	IgnoreReactions  bool     `json:"ignoreReactions" envconfig:"WHATSAPP_IGNORE_REACTIONS"`
+	VoiceReplies     bool     `json:"voiceReplies" envconfig:"WHATSAPP_VOICE_REPLIES"`
 }
 
 // FeishuConfig configures the Feishu channel.
@@ -95,11 +111,13 @@ type ProvidersConfig struct {
 	Anthropic    ProviderConfig     `json:"anthropic"`
 	OpenAI       ProviderConfig     `json:"openai"`
 	LocalWhisper LocalWhisperConfig `json:"localWhisper"`
+	LocalTTS     LocalTTSConfig     `json:"localTTS"`
 	OpenRouter   ProviderConfig     `json:"openrouter"`
 	DeepSeek     ProviderConfig     `json:"deepseek"`
 	Groq         ProviderConfig     `json:"groq"`
 	Gemini       ProviderConfig     `json:"gemini"`
 	VLLM         ProviderConfig     `json:"vllm"`
+	Failover     FailoverConfig     `json:"failover"`
 }
 
 // ProviderConfig contains settings for a single LLM provider.
@@ -108,6 +126,21 @@ type ProviderConfig struct {
 	APIBase string `json:"apiBase,omitempty" envconfig:"API_BASE"`
 }
 
+// FailoverConfig defines an ordered provider chain. When Chain is empty the
+// single provider selected from Model.Name is used.
+type FailoverConfig struct {
+	Chain            []FailoverEntry `json:"chain,omitempty"`
+	FailureThreshold int             `json:"failureThreshold,omitempty"` // consecutive failures before a provider is skipped (default 3)
+	CooldownSeconds  int             `json:"cooldownSeconds,omitempty"`  // how long a failing provider is skipped (default 60)
+}
+
+// FailoverEntry is one provider/model pair in a failover chain.
+// Provider is one of: anthropic, openai, openrouter, deepseek, groq, gemini, vllm.
+type FailoverEntry struct {
+	Provider string `json:"provider"`
+	Model    string `json:"model"`
+}
+
 // LocalWhisperConfig contains settings for local Whisper transcription.
 type LocalWhisperConfig struct {
 	Enabled    bool   `json:"enabled" envconfig:"WHISPER_ENABLED"`
@@ -115,6 +148,18 @@ type LocalWhisperConfig struct {
 	BinaryPath string `json:"binaryPath" envconfig:"WHISPER_BINARY_PATH"`
 }
 
+// LocalTTSConfig contains settings for offline speech synthesis.
+type LocalTTSConfig struct {
+	Enabled bool `json:"enabled" envconfig:"ENABLED"`
+	// Engine is "piper" or "espeak-ng".
+	Engine     string `json:"engine" envconfig:"ENGINE"`
+	BinaryPath string `json:"binaryPath" envconfig:"BINARY_PATH"`
+	// Model is the piper voice model (.onnx); Voice the espeak-ng voice.
+	Model      string `json:"model" envconfig:"MODEL"`
+	Voice      string `json:"voice" envconfig:"VOICE"`
+	FFmpegPath string `json:"ffmpegPath" envconfig:"FFMPEG_PATH"`
+}
+
 // ---------------------------------------------------------------------------
 // Gateway – HTTP server networking
 // ---------------------------------------------------------------------------
@@ -150,6 +195,7 @@ type OrchestratorConfig struct {
 type ToolsConfig struct {
 	Exec ExecToolConfig `json:"exec"`
 	Web  WebToolConfig  `json:"web"`
+	MCP  MCPConfig      `json:"mcp"`
 }
 
 // ---------------------------------------------------------------------------
@@ -183,23 +229,219 @@ type SchedulerConfig struct {
 	MaxConcDefault int           `json:"maxConcDefault" envconfig:"MAX_CONC_DEFAULT"`
 }
 
+// ---------------------------------------------------------------------------
+// Costs – model prices and spend budgets
+// ---------------------------------------------------------------------------
+
+// CostsConfig contains the model price table and spend budgets.
+type CostsConfig struct {
+	// Prices maps a model name (or name prefix) to its price.
+	Prices  map[string]ModelPrice `json:"prices"`
+	Budgets []BudgetConfig        `json:"budgets"`
+}
+
+// ModelPrice is the price of a model in USD per million tokens.
+// A zero Cached price bills cached input tokens at the Input price.
+type ModelPrice struct {
+	Input  float64 `json:"input"`
+	Output float64 `json:"output"`
+	Cached float64 `json:"cached"`
+}
+
+// BudgetConfig limits spend within a period for a scope.
+type BudgetConfig struct {
+	Scope   string  `json:"scope"`   // "global", "channel" or "sender"
+	Match   string  `json:"match"`   // channel or sender; empty applies to each separately
+	Period  string  `json:"period"`  // "day" or "month"
+	SoftUSD float64 `json:"softUsd"` // warn once when reached
+	HardUSD float64 `json:"hardUsd"` // refuse further LLM calls when reached
+}
+
+// ---------------------------------------------------------------------------
+// AgentProfiles – per-chat agent profiles
+// ---------------------------------------------------------------------------
+
+// AgentProfilesConfig contains named agent profiles and the bindings that
+// select them per channel, chat or sender.
+type AgentProfilesConfig struct {
+	// Default is the profile for messages no binding matches (optional).
+	Default  string                  `json:"default"`
+	Profiles map[string]AgentProfile `json:"profiles"`
+	Bindings []ProfileBinding        `json:"bindings"`
+}
+
+// AgentProfile overrides agent-loop settings for the chats bound to it.
+// Unset fields keep the global value.
+type AgentProfile struct {
+	Model         string   `json:"model"`
+	Temperature   *float64 `json:"temperature"`
+	MaxIterations int      `json:"maxIterations"`
+	// Tools is the tool allowlist; empty allows all registered tools.
+	Tools []string `json:"tools"`
+	// BootstrapFiles replaces the workspace files loaded into the system
+	// prompt (AGENTS.md, SOUL.md, ...). Empty keeps the default set.
+	BootstrapFiles []string `json:"bootstrapFiles"`
+	// MaxAutoTier and ExternalMaxTier override the policy engine's limits.
+	MaxAutoTier     *int `json:"maxAutoTier"`
+	ExternalMaxTier *int `json:"externalMaxTier"`
+	// Sandbox overrides tools.exec.sandbox; "none" runs commands
+	// unsandboxed.
+	Sandbox string `json:"sandbox"`
+}
+
+// ProfileBinding selects a profile for matching messages. Empty fields
+// match anything; the most specific match wins (sender, then chat, then
+// channel).
+type ProfileBinding struct {
+	Profile string `json:"profile"`
+	Channel string `json:"channel"`
+	ChatID  string `json:"chatId"`
+	Sender  string `json:"sender"`
+}
+
+// ---------------------------------------------------------------------------
+// Intent – screening of incoming messages
+// ---------------------------------------------------------------------------
+
+// IntentConfig configures the classifier that screens user messages
+// before they reach the LLM.
+type IntentConfig struct {
+	// Classifier is "rules" (default), "llm", "chain" (rules, then llm)
+	// or "off".
+	Classifier string `json:"classifier" envconfig:"CLASSIFIER"`
+	// Rules replace the built-in attack patterns when set.
+	Rules []IntentRule `json:"rules"`
+	// Model is used by the llm classifier (default: the agent model).
+	Model string `json:"model"`
+	// CacheSize and CacheTTL bound the llm classifier's result cache.
+	CacheSize int           `json:"cacheSize"`
+	CacheTTL  time.Duration `json:"cacheTtl"`
+	// Block lists the categories that are refused (default: attack).
+	Block []string `json:"block"`
+	// MinConfidence is the confidence from which a category blocks.
+	MinConfidence float64 `json:"minConfidence"`
+	// Responses are the replies to blocked messages, looked up by
+	// "<channel>:<category>", "<channel>", "<category>", then "default".
+	Responses map[string]string `json:"responses"`
+}
+
+// IntentRule assigns a category to messages matching any of its patterns
+// (Go regular expressions).
+type IntentRule struct {
+	Category   string   `json:"category"`
+	Patterns   []string `json:"patterns"`
+	Confidence float64  `json:"confidence"` // default 1
+	Reason     string   `json:"reason"`
+}
+
 // ExecToolConfig contains shell execution tool settings.
 type ExecToolConfig struct {
 	Timeout             time.Duration `json:"timeout"`
 	RestrictToWorkspace bool          `json:"restrictToWorkspace" envconfig:"EXEC_RESTRICT_WORKSPACE"`
+	// Sandbox names the entry of SandboxProfiles that commands run in
+	// (Linux only). Empty runs them unsandboxed.
+	Sandbox         string                    `json:"sandbox" envconfig:"SANDBOX"`
+	SandboxProfiles map[string]SandboxProfile `json:"sandboxProfiles"`
+}
+
+// SandboxProfile configures the namespace sandbox of the exec tool. The
+// file system is read-only except for the work repo, Writable and a
+// private /tmp. Zero limits take the defaults.
+type SandboxProfile struct {
+	// Network keeps the host network; otherwise commands have none.
+	Network      bool     `json:"network"`
+	MemoryMB     int      `json:"memoryMB"`
+	CPUSeconds   int      `json:"cpuSeconds"`
+	MaxProcesses int      `json:"maxProcesses"`
+	Writable     []string `json:"writable"`
+	// Env names host environment variables passed to commands besides
+	// PATH, HOME, LANG and TERM.
+	Env []string `json:"env"`
+	// HostProc keeps the host /proc where the kernel refuses a private
+	// one, instead of failing.
+	HostProc bool `json:"hostProc"`
 }
 
 // WebToolConfig contains web tool settings.
 type WebToolConfig struct {
 	Search SearchConfig `json:"search"`
+	Fetch  FetchConfig  `json:"fetch"`
 }
 
-// SearchConfig contains web search settings.
+// SearchConfig contains web search settings. The web_search tool is only
+// registered when the backend has an API key.
 type SearchConfig struct {
+	// Backend is the search API; only "brave" (default) is built in.
+	Backend    string `json:"backend" envconfig:"BACKEND"`
 	APIKey     string `json:"apiKey" envconfig:"BRAVE_API_KEY"`
 	MaxResults int    `json:"maxResults"`
 }
 
+// FetchConfig contains settings of the web_fetch tool.
+type FetchConfig struct {
+	// MaxBytes bounds the downloaded body; MaxChars the returned text.
+	MaxBytes int64         `json:"maxBytes" envconfig:"MAX_BYTES"`
+	MaxChars int           `json:"maxChars" envconfig:"MAX_CHARS"`
+	Timeout  time.Duration `json:"timeout"`
+	// AllowDomains, when set, limits fetches to these domains and their
+	// subdomains. DenyDomains are refused even if allowed.
+	AllowDomains []string `json:"allowDomains" envconfig:"ALLOW_DOMAINS"`
+	DenyDomains  []string `json:"denyDomains" envconfig:"DENY_DOMAINS"`
+	// AllowPrivate permits loopback, private and link-local addresses,
+	// which are refused by default.
+	AllowPrivate bool   `json:"allowPrivate" envconfig:"ALLOW_PRIVATE"`
+	UserAgent    string `json:"userAgent"`
+}
+
+// MCPConfig lists external MCP servers whose tools are added to the
+// agent's tool registry, and what `gomikrobot mcp` offers to MCP clients.
+type MCPConfig struct {
+	Servers []MCPServerConfig `json:"servers"`
+	Serve   MCPServeConfig    `json:"serve"`
+}
+
+// MCPServeConfig configures the `gomikrobot mcp` server.
+type MCPServeConfig struct {
+	// Tools are the exposed tool names (default: recall, remember,
+	// day2day, timeline_query, group_submit_task).
+	Tools []string `json:"tools" envconfig:"TOOLS"`
+	// MaxAutoTier is the highest tier run without asking the user
+	// (default 1); higher tiers need approval.
+	MaxAutoTier *int `json:"maxAutoTier" envconfig:"MAX_AUTO_TIER"`
+	// AllowClientApproval lets the MCP client's user approve calls above
+	// MaxAutoTier through elicitation. Off by default: such calls are
+	// denied.
+	AllowClientApproval bool `json:"allowClientApproval" envconfig:"ALLOW_CLIENT_APPROVAL"`
+}
+
+// MCPServerConfig describes one MCP server. Set Command for a stdio
+// server the gateway launches, or URL for a running one.
+type MCPServerConfig struct {
+	// Name prefixes the server's tools: mcp_<name>_<tool>.
+	Name     string `json:"name"`
+	Disabled bool   `json:"disabled"`
+
+	Command string            `json:"command"`
+	Args    []string          `json:"args"`
+	Env     map[string]string `json:"env"`
+	Dir     string            `json:"dir"`
+
+	URL string `json:"url"`
+	// Transport is "stdio", "http" (streamable HTTP) or "sse" (the older
+	// HTTP+SSE transport). Default: stdio with Command, http with URL.
+	Transport string            `json:"transport"`
+	Headers   map[string]string `json:"headers"`
+
+	// Tier is the policy tier of the server's tools (default 2, high
+	// risk); ToolTiers overrides it per tool (by the server's tool name).
+	Tier      *int           `json:"tier"`
+	ToolTiers map[string]int `json:"toolTiers"`
+	// Tools limits the mounted tools to these names (empty = all).
+	Tools []string `json:"tools"`
+	// Timeout bounds each tool call (default 60s).
+	Timeout time.Duration `json:"timeout"`
+}
+
 // DefaultConfig returns a Config with sensible defaults.
 func DefaultConfig() *Config {
 	return &Config{
@@ -209,10 +451,14 @@ func DefaultConfig() *Config {
 			SystemRepoPath: "/Users/kamir/GITHUB.kamir/nanobot/gomikrobot",
 		},
 		Model: ModelConfig{
-			Name:              "anthropic/claude-sonnet-4-5",
-			MaxTokens:         8192,
-			Temperature:       0.7,
-			MaxToolIterations: 20,
+			Name:                  "anthropic/claude-sonnet-4-5",
+			MaxTokens:             8192,
+			Temperature:           0.7,
+			MaxToolIterations:     20,
+			HistoryTokens:         12000,
+			ToolOutputChars:       16000,
+			MaxParallelTools:      4,
+			MaxConcurrentSessions: 8,
 		},
 		Providers: ProvidersConfig{
 			LocalWhisper: LocalWhisperConfig{
@@ -220,6 +466,12 @@ func DefaultConfig() *Config {
 				Model:      "base",
 				BinaryPath: "/opt/homebrew/bin/whisper",
 			},
+			LocalTTS: LocalTTSConfig{
+				Engine:     "piper",
+				BinaryPath: "piper",
+				Voice:      "de",
+				FFmpegPath: "ffmpeg",
+			},
 		},
 		Gateway: GatewayConfig{
 			Host:          "127.0.0.1", // Secure default
@@ -233,8 +485,14 @@ func DefaultConfig() *Config {
 			},
 			Web: WebToolConfig{
 				Search: SearchConfig{
+					Backend:    "brave",
 					MaxResults: 10,
 				},
+				Fetch: FetchConfig{
+					MaxBytes: 2 << 20,
+					MaxChars: 50000,
+					Timeout:  30 * time.Second,
+				},
 			},
 		},
 		Group: GroupConfig{
@@ -254,5 +512,11 @@ func DefaultConfig() *Config {
 			MaxConcShell:   1,
 			MaxConcDefault: 5,
 		},
+		Intent: IntentConfig{
+			Classifier:    "rules",
+			CacheSize:     512,
+			CacheTTL:      time.Hour,
+			MinConfidence: 0.7,
+		},
 	}
 }
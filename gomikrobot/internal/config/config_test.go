@@ -58,7 +58,9 @@ func TestLoadFromFile(t *testing.T) {
 	configJSON := `{
 		"model": {
 			"name": "openai/gpt-4",
-			"maxTokens": 4096
+			"maxTokens": 4096,
+			"maxParallelTools": 1,
+			"maxConcurrentSessions": 2
 		},
 		"gateway": {
 			"port": 9999
@@ -80,6 +82,14 @@ func TestLoadFromFile(t *testing.T) {
 		t.Errorf("expected model openai/gpt-4, got %s", cfg.Model.Name)
 	}
 
+	if cfg.Model.MaxParallelTools != 1 {
+		t.Errorf("expected maxParallelTools 1, got %d", cfg.Model.MaxParallelTools)
+	}
+
+	if cfg.Model.MaxConcurrentSessions != 2 {
+		t.Errorf("expected maxConcurrentSessions 2, got %d", cfg.Model.MaxConcurrentSessions)
+	}
+
 	if cfg.Gateway.Port != 9999 {
 		t.Errorf("expected port 9999, got %d", cfg.Gateway.Port)
 	}
@@ -114,6 +114,13 @@ func Load() (*Config, error) {
 	envconfig.Process("MIKROBOT_PATHS", &cfg.Paths)
 	envconfig.Process("MIKROBOT_MODEL", &cfg.Model)
 	envconfig.Process("MIKROBOT_OPENAI", &cfg.Providers.OpenAI)
+	envconfig.Process("MIKROBOT_ANTHROPIC", &cfg.Providers.Anthropic)
+	envconfig.Process("MIKROBOT_OPENROUTER", &cfg.Providers.OpenRouter)
+	envconfig.Process("MIKROBOT_DEEPSEEK", &cfg.Providers.DeepSeek)
+	envconfig.Process("MIKROBOT_GROQ", &cfg.Providers.Groq)
+	envconfig.Process("MIKROBOT_GEMINI", &cfg.Providers.Gemini)
+	envconfig.Process("MIKROBOT_VLLM", &cfg.Providers.VLLM)
+	envconfig.Process("MIKROBOT_LOCAL_TTS", &cfg.Providers.LocalTTS)
 	envconfig.Process("MIKROBOT_CHANNELS_TELEGRAM", &cfg.Channels.Telegram)
 	envconfig.Process("MIKROBOT_CHANNELS_DISCORD", &cfg.Channels.Discord)
 	envconfig.Process("MIKROBOT_CHANNELS_WHATSAPP", &cfg.Channels.WhatsApp)
@@ -121,9 +128,12 @@ func Load() (*Config, error) {
 	envconfig.Process("MIKROBOT_GATEWAY", &cfg.Gateway)
 	envconfig.Process("MIKROBOT_TOOLS_EXEC", &cfg.Tools.Exec)
 	envconfig.Process("MIKROBOT_TOOLS_WEB_SEARCH", &cfg.Tools.Web.Search)
+	envconfig.Process("MIKROBOT_TOOLS_WEB_FETCH", &cfg.Tools.Web.Fetch)
+	envconfig.Process("MIKROBOT_MCP_SERVE", &cfg.Tools.MCP.Serve)
 	envconfig.Process("MIKROBOT_GROUP", &cfg.Group)
 	envconfig.Process("MIKROBOT_ORCHESTRATOR", &cfg.Orchestrator)
 	envconfig.Process("MIKROBOT_SCHEDULER", &cfg.Scheduler)
+	envconfig.Process("MIKROBOT_INTENT", &cfg.Intent)
 
 	// Legacy env var compatibility
 	envconfig.Process("MIKROBOT_AGENTS", &cfg.Paths)
@@ -138,6 +148,10 @@ func Load() (*Config, error) {
 		}
 	}
 
+	if cfg.Providers.Anthropic.APIKey == "" {
+		cfg.Providers.Anthropic.APIKey = os.Getenv("ANTHROPIC_API_KEY")
+	}
+
 	// Expand ~ in paths
 	expandHome := func(p *string) {
 		if strings.HasPrefix(*p, "~") {
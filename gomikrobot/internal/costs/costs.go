@@ -0,0 +1,219 @@
+// Package costs prices LLM token usage and enforces spend budgets.
+package costs
+
+import (
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kamir/gomikrobot/internal/config"
+)
+
+// Budget scopes and periods.
+const (
+	ScopeGlobal  = "global"
+	ScopeChannel = "channel"
+	ScopeSender  = "sender"
+
+	PeriodDay   = "day"
+	PeriodMonth = "month"
+)
+
+// PriceTable prices token usage per model.
+type PriceTable struct {
+	prices map[string]config.ModelPrice
+	// prefixes holds the keys ordered longest first for prefix matching.
+	prefixes []string
+}
+
+// NewPriceTable builds a table from configured prices.
+func NewPriceTable(prices map[string]config.ModelPrice) *PriceTable {
+	t := &PriceTable{prices: map[string]config.ModelPrice{}}
+	for name, p := range prices {
+		key := strings.ToLower(name)
+		t.prices[key] = p
+		t.prefixes = append(t.prefixes, key)
+	}
+	sort.Slice(t.prefixes, func(i, j int) bool { return len(t.prefixes[i]) > len(t.prefixes[j]) })
+	return t
+}
+
+// Lookup finds the price for a model. It tries the exact name, the name
+// without a provider prefix ("anthropic/claude-x" → "claude-x"), and then
+// the longest configured prefix, so "claude-sonnet-4" prices dated
+// snapshots like "claude-sonnet-4-20250514".
+func (t *PriceTable) Lookup(model string) (config.ModelPrice, bool) {
+	if t == nil || model == "" {
+		return config.ModelPrice{}, false
+	}
+	model = strings.ToLower(model)
+	if p, ok := t.prices[model]; ok {
+		return p, true
+	}
+	base := model[strings.LastIndex(model, "/")+1:]
+	if p, ok := t.prices[base]; ok {
+		return p, true
+	}
+	for _, prefix := range t.prefixes {
+		if strings.HasPrefix(model, prefix) || strings.HasPrefix(base, prefix) {
+			return t.prices[prefix], true
+		}
+	}
+	return config.ModelPrice{}, false
+}
+
+// Cost returns the USD cost of one call. Cached tokens are part of the
+// prompt tokens and billed at the cached price. Unknown models cost 0.
+func (t *PriceTable) Cost(model string, prompt, completion, cached int) float64 {
+	p, ok := t.Lookup(model)
+	if !ok {
+		return 0
+	}
+	if cached > prompt {
+		cached = prompt
+	}
+	cachedPrice := p.Cached
+	if cachedPrice == 0 {
+		cachedPrice = p.Input
+	}
+	return (float64(prompt-cached)*p.Input + float64(cached)*cachedPrice + float64(completion)*p.Output) / 1e6
+}
+
+// SpendStore reports recorded spend. Empty channel or sender match all.
+type SpendStore interface {
+	SpendSince(since time.Time, channel, sender string) (float64, error)
+}
+
+// Level is the outcome of a budget check.
+type Level int
+
+const (
+	LevelOK Level = iota
+	LevelSoft
+	LevelHard
+)
+
+// Status describes the most restrictive budget hit by a check.
+type Status struct {
+	Level  Level
+	Budget config.BudgetConfig
+	Spent  float64
+	// FirstWarning is true the first time a soft limit is reported for a
+	// budget within its period.
+	FirstWarning bool
+
+	warnKey string
+}
+
+// Message describes the status for the user.
+func (s Status) Message() string {
+	switch s.Level {
+	case LevelHard:
+		return fmt.Sprintf("Spend limit reached for this %s (%s: $%.2f of $%.2f). Please try again later or ask an admin to raise the budget.",
+			s.Budget.Period, s.Budget.Scope, s.Spent, s.Budget.HardUSD)
+	case LevelSoft:
+		return fmt.Sprintf("Note: %s spend this %s is $%.2f (warning threshold $%.2f).",
+			s.Budget.Scope, s.Budget.Period, s.Spent, s.Budget.SoftUSD)
+	}
+	return ""
+}
+
+// Accountant prices usage and checks spend against the configured budgets.
+type Accountant struct {
+	Prices  *PriceTable
+	budgets []config.BudgetConfig
+	store   SpendStore
+	now     func() time.Time
+
+	mu     sync.Mutex
+	warned map[string]bool
+}
+
+// NewAccountant creates an accountant. store may be nil, which disables budgets.
+func NewAccountant(cfg config.CostsConfig, store SpendStore) *Accountant {
+	return &Accountant{
+		Prices:  NewPriceTable(cfg.Prices),
+		budgets: cfg.Budgets,
+		store:   store,
+		now:     time.Now,
+		warned:  map[string]bool{},
+	}
+}
+
+// Cost prices one LLM call.
+func (a *Accountant) Cost(model string, prompt, completion, cached int) float64 {
+	if a == nil {
+		return 0
+	}
+	return a.Prices.Cost(model, prompt, completion, cached)
+}
+
+// Check evaluates every budget that applies to channel and sender and
+// returns the most restrictive result. Store errors fail open.
+func (a *Accountant) Check(channel, sender string) Status {
+	if a == nil || a.store == nil {
+		return Status{}
+	}
+	now := a.now()
+	var worst Status
+	for _, b := range a.budgets {
+		var ch, snd string
+		switch b.Scope {
+		case ScopeChannel:
+			if channel == "" || (b.Match != "" && b.Match != channel) {
+				continue
+			}
+			ch = channel
+		case ScopeSender:
+			if sender == "" || (b.Match != "" && b.Match != sender) {
+				continue
+			}
+			snd = sender
+		case ScopeGlobal, "":
+			b.Scope = ScopeGlobal
+		default:
+			continue
+		}
+		start := PeriodStart(b.Period, now)
+		spent, err := a.store.SpendSince(start, ch, snd)
+		if err != nil {
+			slog.Warn("Budget check failed", "scope", b.Scope, "error", err)
+			continue
+		}
+
+		st := Status{Budget: b, Spent: spent}
+		switch {
+		case b.HardUSD > 0 && spent >= b.HardUSD:
+			st.Level = LevelHard
+		case b.SoftUSD > 0 && spent >= b.SoftUSD:
+			st.Level = LevelSoft
+			st.warnKey = fmt.Sprintf("%s|%s|%s|%s|%s", b.Scope, ch, snd, b.Period, start.Format("2006-01-02"))
+			a.mu.Lock()
+			st.FirstWarning = !a.warned[st.warnKey]
+			a.mu.Unlock()
+		}
+		if st.Level > worst.Level || (st.Level == worst.Level && st.FirstWarning && !worst.FirstWarning) {
+			worst = st
+		}
+	}
+	// Only the reported warning counts as given; others surface later.
+	if worst.FirstWarning {
+		a.mu.Lock()
+		a.warned[worst.warnKey] = true
+		a.mu.Unlock()
+	}
+	return worst
+}
+
+// PeriodStart returns the local start of the day or month containing now.
+// Unknown periods are treated as "day".
+func PeriodStart(period string, now time.Time) time.Time {
+	y, m, d := now.Date()
+	if period == PeriodMonth {
+		return time.Date(y, m, 1, 0, 0, 0, 0, now.Location())
+	}
+	return time.Date(y, m, d, 0, 0, 0, 0, now.Location())
+}
@@ -0,0 +1,160 @@
+package costs
+
+import (
+	"errors"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kamir/gomikrobot/internal/config"
+)
+
+type fakeStore struct {
+	spend map[string]float64 // key: channel|sender
+	err   error
+	since []time.Time
+}
+
+func (f *fakeStore) SpendSince(since time.Time, channel, sender string) (float64, error) {
+	f.since = append(f.since, since)
+	if f.err != nil {
+		return 0, f.err
+	}
+	return f.spend[channel+"|"+sender], nil
+}
+
+func almostEqual(a, b float64) bool { return math.Abs(a-b) < 1e-9 }
+
+func TestPriceTableLookup(t *testing.T) {
+	table := NewPriceTable(map[string]config.ModelPrice{
+		"gpt-4o":          {Input: 2.5, Output: 10},
+		"gpt-4o-mini":     {Input: 0.15, Output: 0.6},
+		"claude-sonnet-4": {Input: 3, Output: 15, Cached: 0.3},
+	})
+
+	tests := []struct {
+		model string
+		want  float64 // input price
+		ok    bool
+	}{
+		{"gpt-4o", 2.5, true},
+		{"GPT-4o-mini", 0.15, true},
+		{"openai/gpt-4o-mini", 0.15, true},
+		{"gpt-4o-mini-2024-07-18", 0.15, true},
+		{"anthropic/claude-sonnet-4-20250514", 3, true},
+		{"llama3", 0, false},
+		{"", 0, false},
+	}
+	for _, tt := range tests {
+		p, ok := table.Lookup(tt.model)
+		if ok != tt.ok || p.Input != tt.want {
+			t.Errorf("Lookup(%q) = %v, %v; want input %v, %v", tt.model, p, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestPriceTableCost(t *testing.T) {
+	table := NewPriceTable(map[string]config.ModelPrice{
+		"claude-sonnet-4": {Input: 3, Output: 15, Cached: 0.3},
+		"gpt-4o":          {Input: 2.5, Output: 10},
+	})
+
+	// 1M prompt tokens, 400k of them cached, 100k output.
+	got := table.Cost("claude-sonnet-4", 1_000_000, 100_000, 400_000)
+	want := 0.6*3 + 0.4*0.3 + 0.1*15
+	if !almostEqual(got, want) {
+		t.Fatalf("cost = %v, want %v", got, want)
+	}
+
+	// No cached price: cached tokens bill at the input price.
+	got = table.Cost("gpt-4o", 1_000_000, 0, 500_000)
+	if !almostEqual(got, 2.5) {
+		t.Fatalf("cost without cached price = %v, want 2.5", got)
+	}
+
+	if got := table.Cost("unknown", 1000, 1000, 0); got != 0 {
+		t.Fatalf("unknown model cost = %v, want 0", got)
+	}
+}
+
+func TestAccountantCheckLevels(t *testing.T) {
+	store := &fakeStore{spend: map[string]float64{
+		"|":         12,
+		"whatsapp|": 4,
+		"|alice":    1.5,
+		"telegram|": 0.5,
+		"|bob":      0.1,
+	}}
+	acc := NewAccountant(config.CostsConfig{Budgets: []config.BudgetConfig{
+		{Scope: ScopeGlobal, Period: PeriodMonth, SoftUSD: 10, HardUSD: 50},
+		{Scope: ScopeChannel, Match: "whatsapp", Period: PeriodDay, HardUSD: 3},
+		{Scope: ScopeSender, Period: PeriodDay, SoftUSD: 1, HardUSD: 2},
+	}}, store)
+
+	st := acc.Check("whatsapp", "alice")
+	if st.Level != LevelHard || st.Budget.Scope != ScopeChannel {
+		t.Fatalf("whatsapp: got level %v scope %q, want hard channel", st.Level, st.Budget.Scope)
+	}
+	if !strings.Contains(st.Message(), "Spend limit reached") {
+		t.Fatalf("unexpected hard message: %q", st.Message())
+	}
+
+	// Telegram is under its channel budget; alice and the global budget
+	// are past their soft thresholds.
+	st = acc.Check("telegram", "alice")
+	if st.Level != LevelSoft {
+		t.Fatalf("telegram/alice: got level %v, want soft", st.Level)
+	}
+	if !st.FirstWarning {
+		t.Fatal("expected the first soft warning to be flagged")
+	}
+	// Both soft budgets warn once, then stay quiet for the period.
+	if st2 := acc.Check("telegram", "alice"); !st2.FirstWarning || st2.Budget.Scope == st.Budget.Scope {
+		t.Fatalf("second check: got scope %q first=%v, want the other budget's first warning", st2.Budget.Scope, st2.FirstWarning)
+	}
+	if st = acc.Check("telegram", "alice"); st.Level != LevelSoft || st.FirstWarning {
+		t.Fatalf("repeat check: got level %v first=%v, want soft without first warning", st.Level, st.FirstWarning)
+	}
+}
+
+func TestAccountantSenderMatch(t *testing.T) {
+	store := &fakeStore{spend: map[string]float64{"|bob": 5, "|alice": 5}}
+	acc := NewAccountant(config.CostsConfig{Budgets: []config.BudgetConfig{
+		{Scope: ScopeSender, Match: "bob", Period: PeriodDay, HardUSD: 1},
+	}}, store)
+
+	if st := acc.Check("cli", "alice"); st.Level != LevelOK {
+		t.Fatalf("alice should not be limited by bob's budget, got %v", st.Level)
+	}
+	if st := acc.Check("cli", "bob"); st.Level != LevelHard {
+		t.Fatalf("bob: got %v, want hard", st.Level)
+	}
+}
+
+func TestAccountantFailsOpen(t *testing.T) {
+	acc := NewAccountant(config.CostsConfig{Budgets: []config.BudgetConfig{
+		{Scope: ScopeGlobal, Period: PeriodDay, HardUSD: 0.01},
+	}}, &fakeStore{err: errors.New("db locked")})
+	if st := acc.Check("cli", ""); st.Level != LevelOK {
+		t.Fatalf("store error should fail open, got %v", st.Level)
+	}
+
+	var nilAcc *Accountant
+	if st := nilAcc.Check("cli", ""); st.Level != LevelOK {
+		t.Fatal("nil accountant should allow everything")
+	}
+	if c := nilAcc.Cost("gpt-4o", 10, 10, 0); c != 0 {
+		t.Fatalf("nil accountant cost = %v", c)
+	}
+}
+
+func TestPeriodStart(t *testing.T) {
+	now := time.Date(2026, 3, 17, 15, 4, 5, 0, time.Local)
+	if got := PeriodStart(PeriodDay, now); !got.Equal(time.Date(2026, 3, 17, 0, 0, 0, 0, time.Local)) {
+		t.Fatalf("day start = %v", got)
+	}
+	if got := PeriodStart(PeriodMonth, now); !got.Equal(time.Date(2026, 3, 1, 0, 0, 0, 0, time.Local)) {
+		t.Fatalf("month start = %v", got)
+	}
+}
@@ -0,0 +1,293 @@
+package day2day
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Command is a day2day chat command: the keyword and the text after it.
+//
+//	dtu [text]        add tasks, one per line, and log an update
+//	dtp [text]        log progress
+//	dtc               close a dtu/dtp capture
+//	dts               consolidate today's plan
+//	dtn               suggest the next step
+//	dta               list all open tasks
+//	dtl [done|all]    list tasks with their IDs
+//	dtd <id|text>     mark a task done
+//	dtz <id> <when>   snooze a task (30m, 2h, tomorrow, friday, 2026-03-01)
+//	dtr <id> <day>    reschedule a task to another day
+type Command struct {
+	Kind string
+	Text string
+}
+
+var commandKinds = map[string]bool{
+	"dtu": true, "dtp": true, "dts": true, "dtc": true, "dtn": true, "dta": true,
+	"dtl": true, "dtd": true, "dtz": true, "dtr": true,
+}
+
+// ParseCommand reports whether input is a day2day command.
+func ParseCommand(input string) (Command, bool) {
+	fields := strings.Fields(input)
+	if len(fields) == 0 {
+		return Command{}, false
+	}
+	kind := strings.ToLower(fields[0])
+	if !commandKinds[kind] {
+		return Command{}, false
+	}
+	text := strings.TrimSpace(strings.TrimSpace(input)[len(fields[0]):])
+	return Command{Kind: kind, Text: text}, true
+}
+
+// StartsCapture reports whether the command opens a multi-message capture
+// that is closed with dtc.
+func (c Command) StartsCapture() bool {
+	return (c.Kind == "dtu" || c.Kind == "dtp") && c.Text == ""
+}
+
+// Run executes a command and returns the reply. Captures are handled by
+// the caller, which passes the captured text as an ordinary dtu or dtp.
+func (s *Service) Run(ctx context.Context, cmd Command) string {
+	now := s.opts.Now()
+	switch cmd.Kind {
+	case "dtu":
+		if _, err := s.Add(now, extractTasks(cmd.Text), cmd.Text); err != nil {
+			return "Day2Day Fehler: " + err.Error()
+		}
+		return s.nextReply(now, "Aktualisiert.")
+	case "dtp":
+		if err := s.Progress(now, cmd.Text); err != nil {
+			return "Day2Day Fehler: " + err.Error()
+		}
+		return s.nextReply(now, "Aktualisiert.")
+	case "dts":
+		d, err := s.Consolidate(ctx, now)
+		if err != nil {
+			return "Day2Day Fehler: " + err.Error()
+		}
+		return fmt.Sprintf("Konsolidiert. Open: %d | Done: %d", len(d.Open), len(d.Done))
+	case "dtn":
+		d, err := s.View(now)
+		if err != nil {
+			return "Day2Day Fehler: " + err.Error()
+		}
+		if d.Next == nil {
+			return "Day2Day: keine offenen Tasks."
+		}
+		return fmt.Sprintf("Vorschlag Nächster Schritt: %s", d.Next.Title)
+	case "dta":
+		d, err := s.View(now)
+		if err != nil {
+			return "Day2Day Fehler: " + err.Error()
+		}
+		if len(d.Open) == 0 {
+			return "Day2Day: keine offenen Tasks."
+		}
+		var sb strings.Builder
+		sb.WriteString("Vorschlag Alle offenen Schritte:\n")
+		for _, t := range d.Open {
+			sb.WriteString(fmt.Sprintf("- %s\n", t.Title))
+		}
+		return strings.TrimSpace(sb.String())
+	case "dtl":
+		return s.listReply(now, strings.ToLower(cmd.Text))
+	case "dtd":
+		return s.completeReply(now, cmd.Text)
+	case "dtz":
+		return s.snoozeReply(now, cmd.Text)
+	case "dtr":
+		return s.rescheduleReply(now, cmd.Text)
+	case "dtc":
+		return "Day2Day: no open capture. Send dtu or dtp to start."
+	}
+	return ""
+}
+
+func (s *Service) nextReply(now time.Time, prefix string) string {
+	d, err := s.View(now)
+	if err != nil {
+		return "Day2Day Fehler: " + err.Error()
+	}
+	if d.Next == nil {
+		return prefix + " Keine offenen Tasks gefunden."
+	}
+	return fmt.Sprintf("%s Nächster Schritt: %s", prefix, d.Next.Title)
+}
+
+func (s *Service) listReply(now time.Time, which string) string {
+	d, err := s.View(now)
+	if err != nil {
+		return "Day2Day Fehler: " + err.Error()
+	}
+	var sb strings.Builder
+	if which != "done" {
+		for _, t := range d.Open {
+			sb.WriteString(taskLine(&t, now) + "\n")
+		}
+		for _, t := range d.Snoozed {
+			sb.WriteString(taskLine(&t, now) + "\n")
+		}
+	}
+	if which == "done" || which == "all" {
+		for _, t := range d.Done {
+			sb.WriteString(taskLine(&t, now) + "\n")
+		}
+	}
+	if sb.Len() == 0 {
+		return "Day2Day: keine Tasks."
+	}
+	return strings.TrimSpace(sb.String())
+}
+
+// taskLine formats a task for chat replies.
+func taskLine(t *Task, now time.Time) string {
+	box := "[ ]"
+	if t.Status == StatusDone {
+		box = "[x]"
+	}
+	line := fmt.Sprintf("%d %s %s", t.ID, box, t.Format())
+	if t.CarryOver > 0 {
+		line += fmt.Sprintf(" (carried %d×)", t.CarryOver)
+	}
+	if t.Snoozed(now) {
+		line += " (snoozed until " + t.SnoozedUntil.Format("2006-01-02 15:04") + ")"
+	}
+	return line
+}
+
+func (s *Service) completeReply(now time.Time, ref string) string {
+	if ref == "" {
+		return "Day2Day: dtd <id|text>"
+	}
+	t, err := s.Find(now, ref)
+	if err == nil {
+		var next *Task
+		if t, next, err = s.Complete(t.ID); err == nil {
+			reply := s.nextReply(now, fmt.Sprintf("Erledigt: %s.", t.Title))
+			if next != nil {
+				reply += fmt.Sprintf("\nWiederkehrend, nächster Termin: %s", next.Due)
+			}
+			return reply
+		}
+	}
+	return taskError(ref, err)
+}
+
+func (s *Service) snoozeReply(now time.Time, args string) string {
+	ref, when, _ := strings.Cut(args, " ")
+	until, ok := ParseUntil(when, now)
+	if ref == "" || !ok {
+		return "Day2Day: dtz <id> <30m|2h|tomorrow|friday|YYYY-MM-DD>"
+	}
+	t, err := s.Find(now, ref)
+	if err == nil {
+		if t, err = s.Snooze(t.ID, until); err == nil {
+			return fmt.Sprintf("Zurückgestellt bis %s: %s", until.Format("2006-01-02 15:04"), t.Title)
+		}
+	}
+	return taskError(ref, err)
+}
+
+func (s *Service) rescheduleReply(now time.Time, args string) string {
+	ref, when, _ := strings.Cut(args, " ")
+	due, ok := ParseDay(when, now)
+	if ref == "" || !ok {
+		return "Day2Day: dtr <id> <tomorrow|friday|+3d|YYYY-MM-DD>"
+	}
+	t, err := s.Find(now, ref)
+	if err == nil {
+		if t, err = s.Reschedule(t.ID, due); err == nil {
+			return fmt.Sprintf("Verschoben auf %s (%s): %s", t.Due, due.Weekday(), t.Title)
+		}
+	}
+	return taskError(ref, err)
+}
+
+func taskError(ref string, err error) string {
+	switch {
+	case errors.Is(err, ErrNotFound):
+		return fmt.Sprintf("Day2Day: kein Task %q gefunden.", ref)
+	case errors.Is(err, ErrNotOpen):
+		return fmt.Sprintf("Day2Day: Task %q ist nicht offen.", ref)
+	default:
+		return "Day2Day Fehler: " + err.Error()
+	}
+}
+
+// Status answers a status question such as "status tasks gestern" with a
+// summary of that day. ok is false if input is not a status question.
+func (s *Service) Status(input string) (string, bool) {
+	date, ok := parseStatusDate(input, s.opts.Now())
+	if !ok {
+		return "", false
+	}
+	d, err := s.View(date)
+	if err != nil {
+		return "Day2Day Fehler: " + err.Error(), true
+	}
+	if len(d.Open)+len(d.Snoozed)+len(d.Done) == 0 {
+		return fmt.Sprintf("Day2Day: keine Tasks für %s (%s).", d.Day, date.Weekday()), true
+	}
+
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("Day2Day Status — %s (%s)\n", d.Day, date.Weekday()))
+	sb.WriteString(fmt.Sprintf("Open: %d | Done: %d\n", len(d.Open), len(d.Done)))
+	if d.Next != nil {
+		sb.WriteString(fmt.Sprintf("Next: %s\n", d.Next.Title))
+	}
+	if len(d.Open) > 0 {
+		sb.WriteString("Open Tasks:\n")
+		for i, t := range d.Open {
+			if i >= 5 {
+				sb.WriteString("... (more)\n")
+				break
+			}
+			sb.WriteString(fmt.Sprintf("- %s\n", t.Title))
+		}
+	}
+	return strings.TrimSpace(sb.String()), true
+}
+
+var statusDatePattern = regexp.MustCompile(`\b\d{4}-\d{2}-\d{2}\b`)
+
+func parseStatusDate(input string, now time.Time) (time.Time, bool) {
+	lower := strings.ToLower(input)
+	if !(strings.Contains(lower, "status") && (strings.Contains(lower, "task") || strings.Contains(lower, "aufgabe") || strings.Contains(lower, "day2day"))) {
+		return time.Time{}, false
+	}
+	if m := statusDatePattern.FindString(lower); m != "" {
+		if t, err := time.ParseInLocation(DayLayout, m, now.Location()); err == nil {
+			return t, true
+		}
+	}
+	switch {
+	case strings.Contains(lower, "yesterday") || strings.Contains(lower, "gestern"):
+		return now.AddDate(0, 0, -1), true
+	case strings.Contains(lower, "tomorrow") || strings.Contains(lower, "morgen"):
+		return now.AddDate(0, 0, 1), true
+	default:
+		return now, true
+	}
+}
+
+// extractTasks returns the non-empty lines of text without list bullets.
+func extractTasks(text string) []string {
+	var tasks []string
+	for _, line := range strings.Split(text, "\n") {
+		t := strings.TrimSpace(line)
+		t = strings.TrimPrefix(t, "-")
+		t = strings.TrimPrefix(t, "*")
+		t = strings.TrimPrefix(t, "+")
+		t = strings.TrimSpace(t)
+		if t != "" {
+			tasks = append(tasks, t)
+		}
+	}
+	return tasks
+}
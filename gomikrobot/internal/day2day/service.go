@@ -0,0 +1,681 @@
+package day2day
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kamir/gomikrobot/internal/provider"
+)
+
+// Options configures a Service.
+type Options struct {
+	// Dir returns the directory of the daily markdown files. The view is
+	// not written while it returns an error.
+	Dir func() (string, error)
+	// Provider and Model merge duplicate tasks on consolidation (optional).
+	Provider provider.LLMProvider
+	Model    string
+	// Now overrides the clock (tests).
+	Now func() time.Time
+}
+
+// Service manages the day plan. Tasks live in the Store; every change
+// re-renders the markdown file of the affected day.
+type Service struct {
+	store *Store
+	opts  Options
+	// mu serializes changes from chat and the HTTP API.
+	mu sync.Mutex
+}
+
+// NewService returns a service on store.
+func NewService(store *Store, opts Options) *Service {
+	if opts.Now == nil {
+		opts.Now = time.Now
+	}
+	return &Service{store: store, opts: opts}
+}
+
+// Day is the view of one day of the plan.
+type Day struct {
+	Date           time.Time  `json:"-"`
+	Day            string     `json:"day"`
+	Open           []Task     `json:"open"`
+	Snoozed        []Task     `json:"snoozed"`
+	Done           []Task     `json:"done"`
+	Next           *Task      `json:"next,omitempty"`
+	Log            []LogEntry `json:"log"`
+	ConsolidatedAt *time.Time `json:"consolidated_at,omitempty"`
+}
+
+// View returns the plan of date. Open tasks of earlier days are carried
+// over to today first.
+func (s *Service) View(date time.Time) (*Day, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.prepare(date); err != nil {
+		return nil, err
+	}
+	return s.view(date)
+}
+
+// Add adds one task per line (see ParseTask) to date, skipping titles the
+// day already has. It returns the tasks added.
+func (s *Service) Add(date time.Time, lines []string, logText string) ([]Task, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.prepare(date); err != nil {
+		return nil, err
+	}
+	day := date.Format(DayLayout)
+	existing, err := s.store.ListDay(day)
+	if err != nil {
+		return nil, err
+	}
+	seen := map[string]bool{}
+	for _, t := range existing {
+		seen[strings.ToLower(t.Title)] = true
+	}
+	var added []Task
+	for _, line := range lines {
+		t := ParseTask(line, date)
+		key := strings.ToLower(t.Title)
+		if t.Title == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		if err := s.store.Create(&t); err != nil {
+			return added, err
+		}
+		added = append(added, t)
+	}
+	if logText != "" {
+		if err := s.store.AddLog(day, "UPDATE", logText, s.opts.Now()); err != nil {
+			return added, err
+		}
+	}
+	s.render(date)
+	for _, t := range added {
+		if t.Due != day {
+			s.renderDue(t.Due)
+		}
+	}
+	return added, nil
+}
+
+// Create adds a single task, e.g. from the HTTP API.
+func (s *Service) Create(t Task) (*Task, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t.Title = strings.TrimSpace(t.Title)
+	if t.Title == "" {
+		return nil, fmt.Errorf("title is required")
+	}
+	if t.Due == "" {
+		t.Due = s.opts.Now().Format(DayLayout)
+	}
+	date, err := time.ParseInLocation(DayLayout, t.Due, time.Local)
+	if err != nil {
+		return nil, fmt.Errorf("invalid due day %q", t.Due)
+	}
+	if t.Recurrence != "" && !validRecurrence[t.Recurrence] {
+		return nil, fmt.Errorf("invalid recurrence %q", t.Recurrence)
+	}
+	if t.Priority < PriorityHigh || t.Priority > PriorityLow {
+		t.Priority = PriorityNormal
+	}
+	t.ID, t.Status, t.CarryOver, t.SnoozedUntil, t.CompletedAt = 0, StatusOpen, 0, nil, nil
+	if err := s.prepare(date); err != nil {
+		return nil, err
+	}
+	if err := s.store.Create(&t); err != nil {
+		return nil, err
+	}
+	s.render(date)
+	return &t, nil
+}
+
+// Progress appends a progress note to the log of date.
+func (s *Service) Progress(date time.Time, text string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.prepare(date); err != nil {
+		return err
+	}
+	if err := s.store.AddLog(date.Format(DayLayout), "PROGRESS", text, s.opts.Now()); err != nil {
+		return err
+	}
+	s.render(date)
+	return nil
+}
+
+// Complete marks an open task done. For a recurring task the next
+// occurrence is created and returned as well.
+func (s *Service) Complete(id int64) (*Task, *Task, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, err := s.openTask(id)
+	if err != nil {
+		return nil, nil, err
+	}
+	next, err := s.complete(t)
+	if err != nil {
+		return t, next, err
+	}
+	s.renderDue(t.Due)
+	if next != nil {
+		s.renderDue(next.Due)
+	}
+	return t, next, nil
+}
+
+// complete marks t done and creates the next occurrence of a recurring
+// task.
+func (s *Service) complete(t *Task) (*Task, error) {
+	now := s.opts.Now()
+	t.Status, t.CompletedAt, t.SnoozedUntil = StatusDone, &now, nil
+	if err := s.store.Update(t); err != nil {
+		return nil, err
+	}
+	if t.Recurrence == "" {
+		return nil, nil
+	}
+	from, _ := time.ParseInLocation(DayLayout, t.Due, now.Location())
+	due := nextOccurrence(t.Recurrence, from)
+	for !due.After(startOfDay(now)) {
+		due = nextOccurrence(t.Recurrence, due)
+	}
+	next := &Task{Title: t.Title, Status: StatusOpen, Due: due.Format(DayLayout), Priority: t.Priority,
+		Tags: t.Tags, Recurrence: t.Recurrence}
+	if err := s.store.Create(next); err != nil {
+		return nil, err
+	}
+	return next, nil
+}
+
+// Snooze hides an open task until the given time. Snoozing past the due
+// day moves the task to the day it wakes up on.
+func (s *Service) Snooze(id int64, until time.Time) (*Task, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, err := s.openTask(id)
+	if err != nil {
+		return nil, err
+	}
+	oldDue := t.Due
+	t.SnoozedUntil = &until
+	if wake := until.Format(DayLayout); wake > t.Due {
+		t.Due = wake
+	}
+	if err := s.store.Update(t); err != nil {
+		return nil, err
+	}
+	s.renderDue(oldDue)
+	if t.Due != oldDue {
+		s.renderDue(t.Due)
+	}
+	return t, nil
+}
+
+// Reschedule moves an open task to another day.
+func (s *Service) Reschedule(id int64, due time.Time) (*Task, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, err := s.openTask(id)
+	if err != nil {
+		return nil, err
+	}
+	oldDue := t.Due
+	t.Due, t.SnoozedUntil = due.Format(DayLayout), nil
+	if err := s.store.Update(t); err != nil {
+		return nil, err
+	}
+	s.renderDue(oldDue)
+	s.renderDue(t.Due)
+	return t, nil
+}
+
+// Find returns the open task of date with the given ID ("3" or "#3"), or
+// the first open task whose title contains ref.
+func (s *Service) Find(date time.Time, ref string) (*Task, error) {
+	ref = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(ref), "#"))
+	var id int64
+	if _, err := fmt.Sscanf(ref, "%d", &id); err == nil && fmt.Sprint(id) == ref {
+		return s.store.Get(id)
+	}
+	d, err := s.View(date)
+	if err != nil {
+		return nil, err
+	}
+	lower := strings.ToLower(ref)
+	for _, list := range [][]Task{d.Open, d.Snoozed} {
+		for i := range list {
+			if lower != "" && strings.Contains(strings.ToLower(list[i].Title), lower) {
+				return &list[i], nil
+			}
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// Consolidate cleans up the plan of date: exact duplicates of open tasks
+// are merged, the model (if configured) merges tasks describing the same
+// work and picks the next step, and the consolidation time is recorded.
+// Only tasks merged into another one leave the plan; see merge.
+func (s *Service) Consolidate(ctx context.Context, date time.Time) (*Day, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.prepare(date); err != nil {
+		return nil, err
+	}
+	d, err := s.view(date)
+	if err != nil {
+		return nil, err
+	}
+
+	// Exact duplicates first.
+	byTitle := map[string]int{}
+	var open []Task
+	for _, t := range d.Open {
+		key := strings.ToLower(strings.TrimSpace(t.Title))
+		if i, ok := byTitle[key]; ok {
+			if err := s.merge(&open[i], t); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		byTitle[key] = len(open)
+		open = append(open, t)
+	}
+
+	st, _, err := s.store.getDay(date.Format(DayLayout))
+	if err != nil {
+		return nil, err
+	}
+	if groups, next, ok := s.mergeTasks(ctx, open, d.Done); ok {
+		byID := map[int64]*Task{}
+		for i := range open {
+			byID[open[i].ID] = &open[i]
+		}
+		for i := range d.Done {
+			byID[d.Done[i].ID] = &d.Done[i]
+		}
+		merged := map[int64]bool{}
+		for _, g := range groups {
+			survivor := byID[g.Into]
+			if survivor == nil || merged[g.Into] {
+				continue
+			}
+			if title := strings.TrimSpace(g.Title); title != "" && survivor.Status == StatusOpen {
+				survivor.Title = title
+			}
+			for _, id := range g.IDs {
+				t := byID[id]
+				if t == nil || id == g.Into || merged[id] || t.Status != StatusOpen {
+					continue
+				}
+				if err := s.merge(survivor, *t); err != nil {
+					return nil, err
+				}
+				merged[id] = true
+			}
+			if survivor.Status == StatusOpen {
+				if err := s.store.Update(survivor); err != nil {
+					return nil, err
+				}
+			}
+		}
+		if t := byID[next]; t != nil && t.Status == StatusOpen && !merged[next] {
+			st.NextTaskID = next
+		}
+	}
+	now := s.opts.Now()
+	st.ConsolidatedAt = &now
+	if err := s.store.saveDay(st); err != nil {
+		return nil, err
+	}
+	s.render(date)
+	return s.view(date)
+}
+
+// merge takes the open task t into survivor. Into an open survivor, t is
+// dropped and its attributes carried over: the higher priority, its tags,
+// its recurrence if survivor has none and the larger carry-over count (the
+// caller saves survivor). Into a done survivor, t counts as done as well,
+// so a recurring task still gets its next occurrence.
+func (s *Service) merge(survivor *Task, t Task) error {
+	if survivor.Status == StatusDone {
+		_, err := s.complete(&t)
+		return err
+	}
+	if t.Priority != 0 && (survivor.Priority == 0 || t.Priority < survivor.Priority) {
+		survivor.Priority = t.Priority
+	}
+	for _, tag := range t.Tags {
+		if !containsString(survivor.Tags, tag) {
+			survivor.Tags = append(survivor.Tags, tag)
+		}
+	}
+	if survivor.Recurrence == "" {
+		survivor.Recurrence = t.Recurrence
+	}
+	if t.CarryOver > survivor.CarryOver {
+		survivor.CarryOver = t.CarryOver
+	}
+	if err := s.store.Update(survivor); err != nil {
+		return err
+	}
+	t.Status = StatusDropped
+	return s.store.Update(&t)
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Service) openTask(id int64) (*Task, error) {
+	t, err := s.store.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if t.Status != StatusOpen {
+		return t, ErrNotOpen
+	}
+	return t, nil
+}
+
+// prepare carries unfinished tasks over to today and imports a markdown
+// file written before the task store existed, the first time a day is used.
+func (s *Service) prepare(date time.Time) error {
+	today := s.opts.Now().Format(DayLayout)
+	if n, err := s.store.CarryOver(today); err != nil {
+		return err
+	} else if n > 0 {
+		slog.Info("Day2Day tasks carried over", "day", today, "count", n)
+	}
+
+	return s.ensureDay(date)
+}
+
+// ensureDay records date as used, importing its markdown file the first
+// time. Every day gets a row before its file is rendered, so a rendered
+// file is never imported.
+func (s *Service) ensureDay(date time.Time) error {
+	st, ok, err := s.store.getDay(date.Format(DayLayout))
+	if err != nil || ok {
+		return err
+	}
+	if err := s.store.saveDay(st); err != nil {
+		return err
+	}
+	return s.importMarkdown(date)
+}
+
+// view assembles the plan of date from the store.
+func (s *Service) view(date time.Time) (*Day, error) {
+	day := date.Format(DayLayout)
+	tasks, err := s.store.ListDay(day)
+	if err != nil {
+		return nil, err
+	}
+	d := &Day{Date: date, Day: day, Open: []Task{}, Snoozed: []Task{}, Done: []Task{}}
+	now := s.opts.Now()
+	for _, t := range tasks {
+		switch {
+		case t.Status == StatusDone:
+			d.Done = append(d.Done, t)
+		case t.Snoozed(now):
+			d.Snoozed = append(d.Snoozed, t)
+		default:
+			d.Open = append(d.Open, t)
+		}
+	}
+	sortTasks(d.Open)
+	sortTasks(d.Snoozed)
+
+	st, _, err := s.store.getDay(day)
+	if err != nil {
+		return nil, err
+	}
+	d.ConsolidatedAt = st.ConsolidatedAt
+	for i := range d.Open {
+		if d.Open[i].ID == st.NextTaskID {
+			d.Next = &d.Open[i]
+		}
+	}
+	if d.Next == nil && len(d.Open) > 0 {
+		d.Next = &d.Open[0]
+	}
+	if d.Log, err = s.store.Logs(day); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// mergeFormat is the structured answer of mergeTasks.
+var mergeFormat = &provider.ResponseFormat{
+	Type:   provider.FormatJSONSchema,
+	Name:   "day2day_consolidation",
+	Strict: true,
+	Schema: map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"merge": map[string]any{
+				"type": "array",
+				"items": map[string]any{
+					"type": "object",
+					"properties": map[string]any{
+						"into":  map[string]any{"type": "integer"},
+						"ids":   map[string]any{"type": "array", "items": map[string]any{"type": "integer"}},
+						"title": map[string]any{"type": "string"},
+					},
+					"required":             []string{"into", "ids", "title"},
+					"additionalProperties": false,
+				},
+			},
+			"next": map[string]any{"type": "integer"},
+		},
+		"required":             []string{"merge", "next"},
+		"additionalProperties": false,
+	},
+}
+
+// mergeGroup is one merge proposed by the model: the open tasks IDs are
+// merged into the task Into, which an open survivor may be renamed to
+// Title.
+type mergeGroup struct {
+	Into  int64   `json:"into"`
+	IDs   []int64 `json:"ids"`
+	Title string  `json:"title"`
+}
+
+// mergeTasks asks the model which open tasks describe the same work (or
+// are covered by a done task) and what the next step is. Tasks are named
+// by ID, so the answer cannot lose or invent any. ok is false when there
+// is nothing to merge or the model gave no usable answer, in which case
+// the tasks stay as they are.
+func (s *Service) mergeTasks(ctx context.Context, open, done []Task) (groups []mergeGroup, next int64, ok bool) {
+	if s.opts.Provider == nil || len(open) < 2 {
+		return nil, 0, false
+	}
+
+	type entry struct {
+		ID         int64    `json:"id"`
+		Title      string   `json:"title"`
+		Priority   int      `json:"priority,omitempty"`
+		Tags       []string `json:"tags,omitempty"`
+		Recurrence string   `json:"recurrence,omitempty"`
+	}
+	entries := func(tasks []Task) []entry {
+		out := make([]entry, len(tasks))
+		for i, t := range tasks {
+			out[i] = entry{ID: t.ID, Title: t.Title, Priority: t.Priority, Tags: t.Tags, Recurrence: t.Recurrence}
+		}
+		return out
+	}
+	input, _ := json.Marshal(map[string][]entry{"open": entries(open), "done": entries(done)})
+	var result struct {
+		Merge []mergeGroup `json:"merge"`
+		Next  int64        `json:"next"`
+	}
+	_, err := provider.ChatJSON(ctx, s.opts.Provider, &provider.ChatRequest{
+		Model: s.opts.Model,
+		Messages: []provider.Message{
+			{Role: "system", Content: "You consolidate a personal day plan. Tasks are given by id. For each set of open tasks that describe the same work, add a merge entry: into is the id of the task to keep, ids the ids of the open tasks merged into it, and title a better title for the kept task in the user's wording and language, or empty to keep its title. An open task already covered by a done task is merged into the done task. Do not list tasks that stay as they are. Set next to the id of the open task that should be done first, or 0."},
+			{Role: "user", Content: string(input)},
+		},
+		MaxTokens:      1024,
+		ResponseFormat: mergeFormat,
+	}, &result)
+	if err != nil {
+		slog.Warn("Day2Day consolidation via LLM failed, keeping tasks", "error", err)
+		return nil, 0, false
+	}
+	return result.Merge, result.Next, true
+}
+
+// path returns the markdown file of date.
+func (s *Service) path(date time.Time) (string, error) {
+	if s.opts.Dir == nil {
+		return "", fmt.Errorf("no day2day directory configured")
+	}
+	dir, err := s.opts.Dir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, date.Format(DayLayout)+".md"), nil
+}
+
+// renderDue renders the file of a due day.
+func (s *Service) renderDue(day string) {
+	if date, err := time.ParseInLocation(DayLayout, day, s.opts.Now().Location()); err == nil {
+		s.render(date)
+	}
+}
+
+// render writes the markdown view of date. Failures are logged: the store,
+// not the file, is the source of truth.
+func (s *Service) render(date time.Time) {
+	path, err := s.path(date)
+	if err != nil {
+		slog.Debug("Day2Day view not written", "error", err)
+		return
+	}
+	if err := s.ensureDay(date); err != nil {
+		slog.Warn("Day2Day view failed", "error", err)
+		return
+	}
+	d, err := s.view(date)
+	if err != nil {
+		slog.Warn("Day2Day view failed", "error", err)
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		slog.Warn("Day2Day view not written", "path", path, "error", err)
+		return
+	}
+	if err := os.WriteFile(path, []byte(RenderMarkdown(d)), 0644); err != nil {
+		slog.Warn("Day2Day view not written", "path", path, "error", err)
+	}
+}
+
+// RenderMarkdown renders a day as the daily markdown file. Task lines use
+// the syntax of ParseTask, followed by the task ID and carry-over count.
+func RenderMarkdown(d *Day) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "# Day2Day — %s (%s)\n\n", d.Day, d.Date.Weekday())
+
+	sb.WriteString("## Tasks\n")
+	line := func(box string, t *Task, extra string) {
+		fmt.Fprintf(&sb, "- [%s] %s · id %d", box, t.Format(), t.ID)
+		if t.CarryOver > 0 {
+			fmt.Fprintf(&sb, " · carried %d×", t.CarryOver)
+		}
+		sb.WriteString(extra + "\n")
+	}
+	for i := range d.Open {
+		line(" ", &d.Open[i], "")
+	}
+	for i := range d.Snoozed {
+		line(" ", &d.Snoozed[i], " · snoozed until "+d.Snoozed[i].SnoozedUntil.Format("2006-01-02 15:04"))
+	}
+	for i := range d.Done {
+		line("x", &d.Done[i], "")
+	}
+
+	sb.WriteString("\n## Progress Log\n")
+	for _, e := range d.Log {
+		fmt.Fprintf(&sb, "- %s: %s — %s\n", e.At.Local().Format("15:04"), e.Kind, e.Text)
+	}
+
+	if d.ConsolidatedAt != nil {
+		fmt.Fprintf(&sb, "\n## Consolidated State\n- Open: %d\n- Done: %d\n- Last Consolidation: %s\n",
+			len(d.Open), len(d.Done), d.ConsolidatedAt.Local().Format("15:04"))
+	}
+
+	next := "none"
+	if d.Next != nil {
+		next = d.Next.Title
+	}
+	fmt.Fprintf(&sb, "\n## Next Step\n- %s\n", next)
+	return sb.String()
+}
+
+// importMarkdown adds the tasks of a markdown file that was written before
+// the task store existed.
+func (s *Service) importMarkdown(date time.Time) error {
+	path, err := s.path(date)
+	if err != nil {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	inTasks := false
+	count := 0
+	for _, raw := range strings.Split(string(data), "\n") {
+		if strings.HasPrefix(raw, "## ") {
+			inTasks = strings.TrimSpace(raw) == "## Tasks"
+			continue
+		}
+		if !inTasks {
+			continue
+		}
+		var status string
+		switch {
+		case strings.HasPrefix(raw, "- [ ]"):
+			status = StatusOpen
+		case strings.HasPrefix(strings.ToLower(raw), "- [x]"):
+			status = StatusDone
+		default:
+			continue
+		}
+		title, _, _ := strings.Cut(raw[len("- [ ]"):], " · ")
+		t := ParseTask(title, date)
+		if t.Title == "" {
+			continue
+		}
+		t.Due, t.Status = date.Format(DayLayout), status
+		if err := s.store.Create(&t); err != nil {
+			return err
+		}
+		count++
+	}
+	if count > 0 {
+		slog.Info("Day2Day tasks imported from markdown", "path", path, "count", count)
+	}
+	return nil
+}
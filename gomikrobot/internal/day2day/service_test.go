@@ -0,0 +1,295 @@
+package day2day
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kamir/gomikrobot/internal/provider"
+	"github.com/kamir/gomikrobot/internal/timeline"
+)
+
+type scriptedProvider struct {
+	responses []string
+	calls     int
+}
+
+func (p *scriptedProvider) Chat(ctx context.Context, req *provider.ChatRequest) (*provider.ChatResponse, error) {
+	if p.calls >= len(p.responses) {
+		return nil, errors.New("no more responses")
+	}
+	p.calls++
+	return &provider.ChatResponse{Content: p.responses[p.calls-1]}, nil
+}
+
+func (p *scriptedProvider) Transcribe(ctx context.Context, req *provider.AudioRequest) (*provider.AudioResponse, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (p *scriptedProvider) Speak(ctx context.Context, req *provider.TTSRequest) (*provider.TTSResponse, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (p *scriptedProvider) DefaultModel() string { return "mock" }
+
+// newTestService returns a service whose clock is *now and whose markdown
+// files go to the returned directory.
+func newTestService(t *testing.T, now *time.Time, llm provider.LLMProvider) (*Service, string) {
+	t.Helper()
+	dir := t.TempDir()
+	tl, err := timeline.NewTimelineService(filepath.Join(dir, "timeline.db"))
+	if err != nil {
+		t.Fatalf("failed to create timeline service: %v", err)
+	}
+	t.Cleanup(func() { _ = tl.Close() })
+	tasksDir := filepath.Join(dir, "tasks")
+	svc := NewService(NewStore(tl), Options{
+		Dir:      func() (string, error) { return tasksDir, nil },
+		Provider: llm,
+		Now:      func() time.Time { return *now },
+	})
+	return svc, tasksDir
+}
+
+func TestParseTaskAttributes(t *testing.T) {
+	now := time.Date(2026, 3, 4, 9, 0, 0, 0, time.Local) // Wednesday
+	task := ParseTask("Send invoice !1 #billing @friday every:monthly", now)
+	if task.Title != "Send invoice" || task.Priority != PriorityHigh || task.Recurrence != RecurMonthly {
+		t.Fatalf("unexpected task %+v", task)
+	}
+	if task.Due != "2026-03-06" || len(task.Tags) != 1 || task.Tags[0] != "billing" {
+		t.Fatalf("unexpected due or tags %+v", task)
+	}
+	if got := task.Format(); got != "Send invoice !1 #billing every:monthly" {
+		t.Errorf("Format() = %q", got)
+	}
+	if task := ParseTask("Meet @someone", now); task.Title != "Meet @someone" || task.Due != "2026-03-04" {
+		t.Errorf("unknown @word should stay in the title, got %+v", task)
+	}
+}
+
+func TestCompleteRecurringTaskCreatesNextOccurrence(t *testing.T) {
+	now := time.Date(2026, 3, 6, 9, 0, 0, 0, time.Local) // Friday
+	svc, _ := newTestService(t, &now, nil)
+
+	added, err := svc.Add(now, []string{"Standup every:weekdays", "Write notes"}, "")
+	if err != nil || len(added) != 2 {
+		t.Fatalf("add: %v %+v", err, added)
+	}
+	done, next, err := svc.Complete(added[0].ID)
+	if err != nil {
+		t.Fatalf("complete: %v", err)
+	}
+	if done.Status != StatusDone || next == nil || next.Due != "2026-03-09" {
+		t.Fatalf("expected next occurrence on Monday, got done=%+v next=%+v", done, next)
+	}
+	if _, _, err := svc.Complete(added[0].ID); !errors.Is(err, ErrNotOpen) {
+		t.Errorf("completing twice: expected ErrNotOpen, got %v", err)
+	}
+	if _, _, err := svc.Complete(999); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestSnoozeAndReschedule(t *testing.T) {
+	now := time.Date(2026, 3, 4, 9, 0, 0, 0, time.Local)
+	svc, _ := newTestService(t, &now, nil)
+	added, _ := svc.Add(now, []string{"Review PR", "Book flight"}, "")
+
+	if _, err := svc.Snooze(added[0].ID, now.Add(2*time.Hour)); err != nil {
+		t.Fatalf("snooze: %v", err)
+	}
+	d, _ := svc.View(now)
+	if len(d.Open) != 1 || len(d.Snoozed) != 1 || d.Next.Title != "Book flight" {
+		t.Fatalf("expected snoozed task hidden from open, got %+v", d)
+	}
+	now = now.Add(3 * time.Hour)
+	if d, _ = svc.View(now); len(d.Open) != 2 {
+		t.Errorf("expected task back after snooze, got %d open", len(d.Open))
+	}
+
+	moved, err := svc.Reschedule(added[1].ID, now.AddDate(0, 0, 2))
+	if err != nil || moved.Due != "2026-03-06" {
+		t.Fatalf("reschedule: %v %+v", err, moved)
+	}
+	if d, _ = svc.View(now); len(d.Open) != 1 {
+		t.Errorf("expected rescheduled task gone from today, got %d open", len(d.Open))
+	}
+	// The target day's file was rendered already; reading the day must not
+	// import it as legacy tasks.
+	if d, _ = svc.View(now.AddDate(0, 0, 2)); len(d.Open) != 1 || d.Open[0].ID != added[1].ID {
+		t.Errorf("expected only the rescheduled task on its new day, got %+v", d.Open)
+	}
+}
+
+func TestOpenTasksCarryOverToToday(t *testing.T) {
+	now := time.Date(2026, 3, 4, 9, 0, 0, 0, time.Local)
+	svc, _ := newTestService(t, &now, nil)
+	added, _ := svc.Add(now, []string{"Fix the build", "Answer mail"}, "")
+	if _, _, err := svc.Complete(added[1].ID); err != nil {
+		t.Fatal(err)
+	}
+
+	now = now.AddDate(0, 0, 2)
+	d, err := svc.View(now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(d.Open) != 1 || d.Open[0].Title != "Fix the build" || d.Open[0].CarryOver != 1 {
+		t.Fatalf("expected carried-over task, got %+v", d.Open)
+	}
+	if len(d.Done) != 0 {
+		t.Errorf("done tasks must stay on their day, got %+v", d.Done)
+	}
+}
+
+func TestConsolidateMergesAndPicksNextStep(t *testing.T) {
+	now := time.Date(2026, 3, 4, 9, 0, 0, 0, time.Local)
+	llm := &scriptedProvider{responses: []string{`{"merge": [{"into": 2, "ids": [1], "title": ""}], "next": 3}`}}
+	svc, dir := newTestService(t, &now, llm)
+	if _, err := svc.Add(now, []string{"Draft the report", "Write the report draft", "Call Bob"}, "plan"); err != nil {
+		t.Fatal(err)
+	}
+
+	d, err := svc.Consolidate(context.Background(), now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(d.Open) != 2 || d.Next == nil || d.Next.Title != "Call Bob" || d.ConsolidatedAt == nil {
+		t.Fatalf("unexpected consolidated day %+v", d)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "2026-03-04.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	md := string(data)
+	for _, want := range []string{"# Day2Day — 2026-03-04 (Wednesday)", "- [ ] Write the report draft · id 2", "UPDATE — plan", "## Consolidated State", "## Next Step\n- Call Bob"} {
+		if !strings.Contains(md, want) {
+			t.Errorf("markdown missing %q:\n%s", want, md)
+		}
+	}
+	if strings.Contains(md, "Draft the report") {
+		t.Errorf("merged task still rendered:\n%s", md)
+	}
+}
+
+func TestConsolidateKeepsAttributesAndUnmentionedTasks(t *testing.T) {
+	now := time.Date(2026, 3, 4, 9, 0, 0, 0, time.Local)
+	// The answer renames the report task, covers the plants by a done task,
+	// leaves out "Call Bob" and names IDs that do not exist.
+	llm := &scriptedProvider{responses: []string{`{"merge": [
+		{"into": 2, "ids": [1, 99], "title": "Report draft"},
+		{"into": 5, "ids": [4], "title": "ignored"},
+		{"into": 98, "ids": [3], "title": ""}
+	], "next": 1}`}}
+	svc, _ := newTestService(t, &now, llm)
+	if _, err := svc.Add(now, []string{"Draft the report !1 #work every:weekly", "Write the report draft #q1", "Call Bob", "Water plants every:daily", "Watered the plants"}, ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := svc.Complete(5); err != nil {
+		t.Fatal(err)
+	}
+
+	d, err := svc.Consolidate(context.Background(), now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var titles []string
+	for _, task := range d.Open {
+		titles = append(titles, task.Title)
+	}
+	if strings.Join(titles, "|") != "Report draft|Call Bob" {
+		t.Fatalf("unexpected open tasks %q", titles)
+	}
+	report := d.Open[0]
+	if report.ID != 2 || report.Priority != PriorityHigh || report.Recurrence != RecurWeekly || strings.Join(report.Tags, ",") != "q1,work" {
+		t.Errorf("merged attributes lost: %+v", report)
+	}
+	// The merged task is not the next step; the plan falls back to the first.
+	if d.Next == nil || d.Next.ID != 2 {
+		t.Errorf("unexpected next step %+v", d.Next)
+	}
+
+	dropped, err := svc.store.Get(1)
+	if err != nil || dropped.Status != StatusDropped {
+		t.Errorf("task 1 should be dropped, got %+v, %v", dropped, err)
+	}
+	plants, err := svc.store.Get(4)
+	if err != nil || plants.Status != StatusDone {
+		t.Errorf("task covered by a done task should be done, got %+v, %v", plants, err)
+	}
+	tomorrow, err := svc.View(now.AddDate(0, 0, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for _, task := range tomorrow.Open {
+		found = found || (task.Title == "Water plants" && task.Recurrence == RecurDaily)
+	}
+	if !found {
+		t.Errorf("recurring task lost its next occurrence: %+v", tomorrow.Open)
+	}
+}
+
+func TestLegacyMarkdownIsImported(t *testing.T) {
+	now := time.Date(2026, 3, 4, 9, 0, 0, 0, time.Local)
+	svc, dir := newTestService(t, &now, nil)
+	legacy := "# Day2Day — 2026-03-04\n\n## Tasks\n- [ ] Old open task\n- [x] Old done task\n\n## Next Step\n- Old open task\n"
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "2026-03-04.md"), []byte(legacy), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	d, err := svc.View(now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(d.Open) != 1 || d.Open[0].Title != "Old open task" || len(d.Done) != 1 {
+		t.Fatalf("unexpected imported day %+v", d)
+	}
+	if d, _ = svc.View(now); len(d.Open)+len(d.Done) != 2 {
+		t.Errorf("file imported twice: %+v", d)
+	}
+}
+
+func TestRunCommands(t *testing.T) {
+	now := time.Date(2026, 3, 4, 9, 0, 0, 0, time.Local)
+	svc, _ := newTestService(t, &now, nil)
+	ctx := context.Background()
+
+	run := func(input string) string {
+		cmd, ok := ParseCommand(input)
+		if !ok {
+			t.Fatalf("%q is not a command", input)
+		}
+		return svc.Run(ctx, cmd)
+	}
+	if got := run("dtu - Pay rent !1\n- Water plants"); got != "Aktualisiert. Nächster Schritt: Pay rent" {
+		t.Errorf("dtu: %q", got)
+	}
+	if got := run("dtl"); got != "1 [ ] Pay rent !1\n2 [ ] Water plants" {
+		t.Errorf("dtl: %q", got)
+	}
+	if got := run("dtd rent"); got != "Erledigt: Pay rent. Nächster Schritt: Water plants" {
+		t.Errorf("dtd: %q", got)
+	}
+	if got := run("dtr 2 2026-03-05"); got != "Verschoben auf 2026-03-05 (Thursday): Water plants" {
+		t.Errorf("dtr: %q", got)
+	}
+	if got := run("dtz 7 1h"); got != `Day2Day: kein Task "7" gefunden.` {
+		t.Errorf("dtz unknown: %q", got)
+	}
+	if got := run("dtn"); got != "Day2Day: keine offenen Tasks." {
+		t.Errorf("dtn: %q", got)
+	}
+	if _, ok := ParseCommand("dtx"); ok {
+		t.Error("dtx must not be a command")
+	}
+}
@@ -0,0 +1,195 @@
+package day2day
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/kamir/gomikrobot/internal/timeline"
+)
+
+// Store persists tasks, progress log entries and per-day state in the
+// timeline DB (tables day2day_tasks, day2day_log and day2day_days).
+type Store struct {
+	db *sql.DB
+}
+
+// NewStore returns a store on the timeline DB.
+func NewStore(tl *timeline.TimelineService) *Store {
+	return &Store{db: tl.DB()}
+}
+
+// LogEntry is one line of a day's progress log.
+type LogEntry struct {
+	Kind string    `json:"kind"` // UPDATE or PROGRESS
+	Text string    `json:"text"`
+	At   time.Time `json:"at"`
+}
+
+// dayState is the per-day state kept besides the tasks.
+type dayState struct {
+	Day            string
+	NextTaskID     int64
+	ConsolidatedAt *time.Time
+}
+
+const taskColumns = `id, title, status, due, priority, COALESCE(tags,''), COALESCE(recurrence,''),
+	carry_over, snoozed_until, created_at, updated_at, completed_at`
+
+// Create inserts t and sets its ID and timestamps.
+func (s *Store) Create(t *Task) error {
+	now := time.Now()
+	res, err := s.db.Exec(`INSERT INTO day2day_tasks
+		(title, status, due, priority, tags, recurrence, carry_over, snoozed_until, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		t.Title, t.Status, t.Due, t.Priority, strings.Join(t.Tags, ","), t.Recurrence, t.CarryOver,
+		nullTime(t.SnoozedUntil), now, now)
+	if err != nil {
+		return fmt.Errorf("create day2day task: %w", err)
+	}
+	t.ID, _ = res.LastInsertId()
+	t.CreatedAt, t.UpdatedAt = now, now
+	return nil
+}
+
+// Get returns a task by ID, or ErrNotFound.
+func (s *Store) Get(id int64) (*Task, error) {
+	tasks, err := s.query(`SELECT `+taskColumns+` FROM day2day_tasks WHERE id = ?`, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(tasks) == 0 {
+		return nil, ErrNotFound
+	}
+	return &tasks[0], nil
+}
+
+// Update writes the mutable fields of t.
+func (s *Store) Update(t *Task) error {
+	t.UpdatedAt = time.Now()
+	_, err := s.db.Exec(`UPDATE day2day_tasks SET
+		title = ?, status = ?, due = ?, priority = ?, tags = ?, recurrence = ?, carry_over = ?,
+		snoozed_until = ?, updated_at = ?, completed_at = ?
+		WHERE id = ?`,
+		t.Title, t.Status, t.Due, t.Priority, strings.Join(t.Tags, ","), t.Recurrence, t.CarryOver,
+		nullTime(t.SnoozedUntil), t.UpdatedAt, nullTime(t.CompletedAt), t.ID)
+	if err != nil {
+		return fmt.Errorf("update day2day task: %w", err)
+	}
+	return nil
+}
+
+// ListDay returns the open and done tasks due on day.
+func (s *Store) ListDay(day string) ([]Task, error) {
+	return s.query(`SELECT `+taskColumns+` FROM day2day_tasks
+		WHERE due = ? AND status != ? ORDER BY id`, day, StatusDropped)
+}
+
+// ListOpen returns the open tasks due on or before day.
+func (s *Store) ListOpen(day string) ([]Task, error) {
+	return s.query(`SELECT `+taskColumns+` FROM day2day_tasks
+		WHERE status = ? AND due <= ? ORDER BY id`, StatusOpen, day)
+}
+
+// CarryOver moves open tasks due before day to day and counts the move.
+func (s *Store) CarryOver(day string) (int64, error) {
+	res, err := s.db.Exec(`UPDATE day2day_tasks SET due = ?, carry_over = carry_over + 1, updated_at = ?
+		WHERE status = ? AND due < ?`, day, time.Now(), StatusOpen, day)
+	if err != nil {
+		return 0, fmt.Errorf("carry over day2day tasks: %w", err)
+	}
+	return res.RowsAffected()
+}
+
+// AddLog appends a progress log entry to day.
+func (s *Store) AddLog(day, kind, text string, at time.Time) error {
+	_, err := s.db.Exec(`INSERT INTO day2day_log (day, kind, text, created_at) VALUES (?, ?, ?, ?)`, day, kind, text, at)
+	if err != nil {
+		return fmt.Errorf("add day2day log: %w", err)
+	}
+	return nil
+}
+
+// Logs returns the progress log of day, newest first.
+func (s *Store) Logs(day string) ([]LogEntry, error) {
+	rows, err := s.db.Query(`SELECT kind, text, created_at FROM day2day_log WHERE day = ? ORDER BY id DESC`, day)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []LogEntry
+	for rows.Next() {
+		var e LogEntry
+		if err := rows.Scan(&e.Kind, &e.Text, &e.At); err != nil {
+			return nil, err
+		}
+		out = append(out, e)
+	}
+	return out, rows.Err()
+}
+
+// getDay returns the state of day; ok is false if the day was never used.
+func (s *Store) getDay(day string) (st dayState, ok bool, err error) {
+	var consolidated sql.NullTime
+	err = s.db.QueryRow(`SELECT day, next_task_id, consolidated_at FROM day2day_days WHERE day = ?`, day).
+		Scan(&st.Day, &st.NextTaskID, &consolidated)
+	if errors.Is(err, sql.ErrNoRows) {
+		return dayState{Day: day}, false, nil
+	}
+	if err != nil {
+		return st, false, err
+	}
+	if consolidated.Valid {
+		st.ConsolidatedAt = &consolidated.Time
+	}
+	return st, true, nil
+}
+
+// saveDay inserts or replaces the state of a day.
+func (s *Store) saveDay(st dayState) error {
+	_, err := s.db.Exec(`INSERT INTO day2day_days (day, next_task_id, consolidated_at) VALUES (?, ?, ?)
+		ON CONFLICT(day) DO UPDATE SET next_task_id = excluded.next_task_id, consolidated_at = excluded.consolidated_at`,
+		st.Day, st.NextTaskID, nullTime(st.ConsolidatedAt))
+	if err != nil {
+		return fmt.Errorf("save day2day day: %w", err)
+	}
+	return nil
+}
+
+func (s *Store) query(query string, args ...any) ([]Task, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var tasks []Task
+	for rows.Next() {
+		var t Task
+		var tags string
+		var snoozed, completed sql.NullTime
+		if err := rows.Scan(&t.ID, &t.Title, &t.Status, &t.Due, &t.Priority, &tags, &t.Recurrence,
+			&t.CarryOver, &snoozed, &t.CreatedAt, &t.UpdatedAt, &completed); err != nil {
+			return nil, err
+		}
+		if tags != "" {
+			t.Tags = strings.Split(tags, ",")
+		}
+		if snoozed.Valid {
+			t.SnoozedUntil = &snoozed.Time
+		}
+		if completed.Valid {
+			t.CompletedAt = &completed.Time
+		}
+		tasks = append(tasks, t)
+	}
+	return tasks, rows.Err()
+}
+
+func nullTime(t *time.Time) any {
+	if t == nil {
+		return nil
+	}
+	return *t
+}
@@ -0,0 +1,196 @@
+// Package day2day keeps the personal day plan: typed tasks persisted in the
+// timeline DB, with the daily markdown file rendered as a view of them.
+package day2day
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Task statuses.
+const (
+	StatusOpen    = "open"
+	StatusDone    = "done"
+	StatusDropped = "dropped" // merged into another task by consolidation
+)
+
+// Priorities; lower is more urgent.
+const (
+	PriorityHigh   = 1
+	PriorityNormal = 2
+	PriorityLow    = 3
+)
+
+// Recurrences.
+const (
+	RecurDaily    = "daily"
+	RecurWeekdays = "weekdays"
+	RecurWeekly   = "weekly"
+	RecurMonthly  = "monthly"
+)
+
+// DayLayout is the format of Task.Due and of the daily file names.
+const DayLayout = "2006-01-02"
+
+var (
+	ErrNotFound = errors.New("day2day task not found")
+	ErrNotOpen  = errors.New("day2day task is not open")
+)
+
+// Task is one entry of the day plan.
+type Task struct {
+	ID           int64      `json:"id"`
+	Title        string     `json:"title"`
+	Status       string     `json:"status"`
+	Due          string     `json:"due"` // day the task is planned for (YYYY-MM-DD)
+	Priority     int        `json:"priority"`
+	Tags         []string   `json:"tags,omitempty"`
+	Recurrence   string     `json:"recurrence,omitempty"`
+	CarryOver    int        `json:"carry_over"` // times moved to a new day unfinished
+	SnoozedUntil *time.Time `json:"snoozed_until,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+	CompletedAt  *time.Time `json:"completed_at,omitempty"`
+}
+
+// Snoozed reports whether the task is hidden from the plan at now.
+func (t *Task) Snoozed(now time.Time) bool {
+	return t.SnoozedUntil != nil && t.SnoozedUntil.After(now)
+}
+
+var validRecurrence = map[string]bool{RecurDaily: true, RecurWeekdays: true, RecurWeekly: true, RecurMonthly: true}
+
+// ParseTask reads a task line with inline attributes: "!1" to "!3" set the
+// priority, "#tag" adds a tag, "@day" sets the due day (see ParseDay) and
+// "every:daily|weekdays|weekly|monthly" the recurrence. The remaining words
+// are the title. The due day defaults to the day of now.
+func ParseTask(line string, now time.Time) Task {
+	t := Task{Status: StatusOpen, Priority: PriorityNormal, Due: now.Format(DayLayout)}
+	var words []string
+	for _, w := range strings.Fields(line) {
+		lower := strings.ToLower(w)
+		switch {
+		case len(w) == 2 && w[0] == '!' && w[1] >= '1' && w[1] <= '3':
+			t.Priority = int(w[1] - '0')
+		case len(w) > 1 && w[0] == '#':
+			t.Tags = append(t.Tags, strings.ToLower(w[1:]))
+		case len(w) > 1 && w[0] == '@':
+			if d, ok := ParseDay(w[1:], now); ok {
+				t.Due = d.Format(DayLayout)
+			} else {
+				words = append(words, w)
+			}
+		case strings.HasPrefix(lower, "every:") && validRecurrence[lower[len("every:"):]]:
+			t.Recurrence = lower[len("every:"):]
+		default:
+			words = append(words, w)
+		}
+	}
+	t.Title = strings.Join(words, " ")
+	return t
+}
+
+// Format renders the task in the syntax ParseTask reads, without the due
+// day and with attributes left out where they have their default.
+func (t *Task) Format() string {
+	parts := []string{t.Title}
+	if t.Priority != PriorityNormal && t.Priority != 0 {
+		parts = append(parts, fmt.Sprintf("!%d", t.Priority))
+	}
+	for _, tag := range t.Tags {
+		parts = append(parts, "#"+tag)
+	}
+	if t.Recurrence != "" {
+		parts = append(parts, "every:"+t.Recurrence)
+	}
+	return strings.Join(parts, " ")
+}
+
+// sortTasks orders tasks by priority, then due day, then creation.
+func sortTasks(tasks []Task) {
+	sort.SliceStable(tasks, func(i, j int) bool {
+		a, b := tasks[i], tasks[j]
+		if a.Priority != b.Priority {
+			return a.Priority < b.Priority
+		}
+		if a.Due != b.Due {
+			return a.Due < b.Due
+		}
+		return a.ID < b.ID
+	})
+}
+
+// nextOccurrence returns the first day after from on which a task with the
+// given recurrence is due again.
+func nextOccurrence(recurrence string, from time.Time) time.Time {
+	switch recurrence {
+	case RecurWeekdays:
+		next := from.AddDate(0, 0, 1)
+		for next.Weekday() == time.Saturday || next.Weekday() == time.Sunday {
+			next = next.AddDate(0, 0, 1)
+		}
+		return next
+	case RecurWeekly:
+		return from.AddDate(0, 0, 7)
+	case RecurMonthly:
+		return from.AddDate(0, 1, 0)
+	default:
+		return from.AddDate(0, 0, 1)
+	}
+}
+
+var weekdays = map[string]time.Weekday{
+	"sunday": time.Sunday, "monday": time.Monday, "tuesday": time.Tuesday, "wednesday": time.Wednesday,
+	"thursday": time.Thursday, "friday": time.Friday, "saturday": time.Saturday,
+	"sonntag": time.Sunday, "montag": time.Monday, "dienstag": time.Tuesday, "mittwoch": time.Wednesday,
+	"donnerstag": time.Thursday, "freitag": time.Friday, "samstag": time.Saturday,
+}
+
+var relativeDays = regexp.MustCompile(`^\+(\d+)d$`)
+
+// ParseDay parses a day: "YYYY-MM-DD", today/heute, tomorrow/morgen, a
+// weekday name (its next occurrence after today) or "+Nd".
+func ParseDay(s string, now time.Time) (time.Time, bool) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	today := startOfDay(now)
+	if d, err := time.ParseInLocation(DayLayout, s, now.Location()); err == nil {
+		return d, true
+	}
+	switch s {
+	case "today", "heute":
+		return today, true
+	case "tomorrow", "morgen":
+		return today.AddDate(0, 0, 1), true
+	}
+	if wd, ok := weekdays[s]; ok {
+		days := (int(wd) - int(today.Weekday()) + 7) % 7
+		if days == 0 {
+			days = 7
+		}
+		return today.AddDate(0, 0, days), true
+	}
+	if m := relativeDays.FindStringSubmatch(s); m != nil {
+		n, _ := strconv.Atoi(m[1])
+		return today.AddDate(0, 0, n), true
+	}
+	return time.Time{}, false
+}
+
+// ParseUntil parses a snooze target: a duration such as "30m" or "2h", or
+// a day (see ParseDay), meaning the start of that day.
+func ParseUntil(s string, now time.Time) (time.Time, bool) {
+	if d, err := time.ParseDuration(strings.TrimSpace(s)); err == nil && d > 0 {
+		return now.Add(d), true
+	}
+	return ParseDay(s, now)
+}
+
+func startOfDay(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+}
@@ -0,0 +1,134 @@
+package eval
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGoldenSuites(t *testing.T) {
+	scenarios, err := Load([]string{"../../eval/golden"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(scenarios) == 0 {
+		t.Fatal("no golden scenarios found")
+	}
+	report := RunAll(context.Background(), scenarios, Options{})
+	if report.Failed > 0 {
+		var buf bytes.Buffer
+		report.WriteText(&buf)
+		t.Fatalf("golden scenarios failed:\n%s", buf.String())
+	}
+}
+
+func TestFailingScenarioReportsDiffs(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "fail.json")
+	suite := `{"name": "eval-test-fail",
+	  "provider": {"script": [
+	    {"tool_calls": [{"name": "write_file", "arguments": {"path": "{{work_repo}}/a.txt", "content": "one\ntwo\n"}}]},
+	    {"content": "done"}
+	  ]},
+	  "turns": [{
+	    "user": "write it",
+	    "tool_calls": [{"name": "write_file", "args": {"content": {"contains": "three"}}}, {"name": "read_file"}],
+	    "forbidden_tools": ["write_file"],
+	    "response": "finished"
+	  }],
+	  "files_written": {"a.txt": "one\nthree\n", "b.txt": {"exists": false}}
+	}`
+	if err := os.WriteFile(path, []byte(suite), 0644); err != nil {
+		t.Fatal(err)
+	}
+	scenarios, err := Load([]string{path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	report := RunAll(context.Background(), scenarios, Options{})
+	if report.Passed != 0 || report.Failed != 1 {
+		t.Fatalf("expected one failure, got %+v", report)
+	}
+
+	checks := map[string]bool{}
+	for _, f := range report.Scenarios[0].AllFailures() {
+		checks[f.Check+": "+f.Message] = true
+	}
+	for _, want := range []string{
+		`turn 1 tool write_file arg content: does not contain "three"`,
+		"turn 1 tool read_file: expected tool call not made",
+		"turn 1 tool write_file: forbidden tool was called",
+		"turn 1 response: not equal",
+		"file a.txt: not equal",
+	} {
+		if !checks[want] {
+			t.Errorf("missing failure %q in %v", want, checks)
+		}
+	}
+	if len(checks) != 5 {
+		t.Errorf("unexpected failures %v", checks)
+	}
+
+	var text bytes.Buffer
+	report.WriteText(&text)
+	for _, want := range []string{"FAIL eval-test-fail", "- three", "+ two", "0 passed, 1 failed"} {
+		if !strings.Contains(text.String(), want) {
+			t.Errorf("text report lacks %q:\n%s", want, text.String())
+		}
+	}
+	var js bytes.Buffer
+	if err := report.WriteJSON(&js); err != nil || !strings.Contains(js.String(), `"failed": 1`) {
+		t.Errorf("unexpected JSON report %v:\n%s", err, js.String())
+	}
+}
+
+func TestLoadYAMLShorthandAndErrors(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("single.yml", `
+provider:
+  script:
+    - content: hi
+turns:
+  - user: hello
+    response: hi
+    tool_calls:
+      - name: exec
+        args:
+          command: {matches: "^ls"}
+          dry_run: "true"
+`)
+	write("cassette.json", `{"version": 1, "interactions": []}`)
+
+	scenarios, err := Load([]string{dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(scenarios) != 1 || scenarios[0].Name != "single" {
+		t.Fatalf("expected the single scenario only, got %+v", scenarios)
+	}
+	turn := scenarios[0].Turns[0]
+	if turn.Response == nil || turn.Response.Equals == nil || *turn.Response.Equals != "hi" {
+		t.Errorf("expected equals shorthand, got %+v", turn.Response)
+	}
+	args := turn.ToolCalls[0].Args
+	if args["command"].Matches != "^ls" || *args["dry_run"].Equals != "true" {
+		t.Errorf("unexpected args %+v", args)
+	}
+	dryRun := args["dry_run"]
+	if fails := dryRun.check("x", argString(true), true); len(fails) != 0 {
+		t.Errorf("booleans must match their JSON form, got %+v", fails)
+	}
+
+	write("broken.yaml", "turns:\n  - user: hi\n    respons: typo\n")
+	if _, err := Load([]string{dir}); err == nil || !strings.Contains(err.Error(), "respons") {
+		t.Errorf("expected unknown field error, got %v", err)
+	}
+}
@@ -0,0 +1,173 @@
+package eval
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Matcher checks a text: a reply, a tool argument or a file. A plain
+// string in a scenario is shorthand for equals.
+type Matcher struct {
+	Equals      *string `json:"equals,omitempty" yaml:"equals"`
+	Contains    Strings `json:"contains,omitempty" yaml:"contains"`
+	NotContains Strings `json:"not_contains,omitempty" yaml:"not_contains"`
+	Matches     string  `json:"matches,omitempty" yaml:"matches"` // regular expression
+	// Exists false requires the value to be absent (file not written,
+	// argument not passed).
+	Exists *bool `json:"exists,omitempty" yaml:"exists"`
+}
+
+type matcherFields Matcher
+
+func (m *Matcher) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		m.Equals = &s
+		return nil
+	}
+	return json.Unmarshal(data, (*matcherFields)(m))
+}
+
+func (m *Matcher) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		s := node.Value
+		m.Equals = &s
+		return nil
+	}
+	return node.Decode((*matcherFields)(m))
+}
+
+// Strings is a list of strings that may be written as a single string.
+type Strings []string
+
+func (s *Strings) UnmarshalJSON(data []byte) error {
+	var one string
+	if err := json.Unmarshal(data, &one); err == nil {
+		*s = Strings{one}
+		return nil
+	}
+	return json.Unmarshal(data, (*[]string)(s))
+}
+
+func (s *Strings) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		*s = Strings{node.Value}
+		return nil
+	}
+	return node.Decode((*[]string)(s))
+}
+
+// Failure is one unmet expectation.
+type Failure struct {
+	Check    string `json:"check"` // e.g. "turn 2 response", "file notes.md"
+	Message  string `json:"message"`
+	Expected string `json:"expected,omitempty"`
+	Actual   string `json:"actual,omitempty"`
+	Diff     string `json:"diff,omitempty"`
+}
+
+// check matches value (present reports whether it exists at all) and
+// returns the failures, labelled with check.
+func (m *Matcher) check(check, value string, present bool) []Failure {
+	if m == nil {
+		return nil
+	}
+	var fails []Failure
+	fail := func(msg string) {
+		fails = append(fails, Failure{Check: check, Message: msg, Actual: shorten(value, 500)})
+	}
+	if m.Exists != nil && !*m.Exists {
+		if present {
+			fail("should not exist")
+		}
+		return fails
+	}
+	if !present {
+		return []Failure{{Check: check, Message: "missing"}}
+	}
+	if m.Equals != nil && value != *m.Equals {
+		fails = append(fails, Failure{
+			Check: check, Message: "not equal",
+			Expected: shorten(*m.Equals, 500), Actual: shorten(value, 500),
+			Diff: diffLines(*m.Equals, value),
+		})
+	}
+	for _, s := range m.Contains {
+		if !strings.Contains(value, s) {
+			fail(fmt.Sprintf("does not contain %q", s))
+		}
+	}
+	for _, s := range m.NotContains {
+		if strings.Contains(value, s) {
+			fail(fmt.Sprintf("contains %q", s))
+		}
+	}
+	if m.Matches != "" {
+		re, err := regexp.Compile(m.Matches)
+		if err != nil {
+			fail(fmt.Sprintf("invalid pattern %q: %v", m.Matches, err))
+		} else if !re.MatchString(value) {
+			fail(fmt.Sprintf("does not match /%s/", m.Matches))
+		}
+	}
+	return fails
+}
+
+// argString renders a tool argument for matching: strings as they are,
+// other values as JSON.
+func argString(v any) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+	data, _ := json.Marshal(v)
+	return string(data)
+}
+
+// diffLines returns a line diff from want to got: unchanged lines are
+// indented by two spaces, removed lines start with "-", added with "+".
+func diffLines(want, got string) string {
+	a, b := strings.Split(want, "\n"), strings.Split(got, "\n")
+	// lcs[i][j] is the length of the longest common subsequence of a[i:]
+	// and b[j:].
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+	var sb strings.Builder
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			sb.WriteString("  " + a[i] + "\n")
+			i++
+			j++
+		case j < len(b) && (i == len(a) || lcs[i][j+1] >= lcs[i+1][j]):
+			sb.WriteString("+ " + b[j] + "\n")
+			j++
+		default:
+			sb.WriteString("- " + a[i] + "\n")
+			i++
+		}
+	}
+	return strings.TrimSuffix(sb.String(), "\n")
+}
+
+func shorten(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n] + "..."
+}
@@ -0,0 +1,119 @@
+package eval
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Report is the outcome of a run over several scenarios.
+type Report struct {
+	Passed    int           `json:"passed"`
+	Failed    int           `json:"failed"`
+	Duration  time.Duration `json:"duration_ns"`
+	Scenarios []*Result     `json:"scenarios"`
+}
+
+// Result is the outcome of one scenario. Error is set when the scenario
+// could not be run at all.
+type Result struct {
+	Name     string        `json:"name"`
+	File     string        `json:"file,omitempty"`
+	Passed   bool          `json:"passed"`
+	Error    string        `json:"error,omitempty"`
+	Duration time.Duration `json:"duration_ns"`
+	Turns    []TurnResult  `json:"turns"`
+	// Failures are checks made after the last turn, such as written files.
+	Failures []Failure `json:"failures,omitempty"`
+}
+
+// TurnResult is what happened in one turn.
+type TurnResult struct {
+	Index     int        `json:"index"`
+	User      string     `json:"user"`
+	Response  string     `json:"response"`
+	ToolCalls []ToolCall `json:"tool_calls,omitempty"`
+	Failures  []Failure  `json:"failures,omitempty"`
+}
+
+// ToolCall is a tool call the model made.
+type ToolCall struct {
+	Name      string         `json:"name"`
+	Arguments map[string]any `json:"arguments,omitempty"`
+}
+
+func (tr *TurnResult) label(what string) string {
+	return fmt.Sprintf("turn %d %s", tr.Index, what)
+}
+
+func (tr *TurnResult) toolNames() []string {
+	names := make([]string, 0, len(tr.ToolCalls))
+	for _, c := range tr.ToolCalls {
+		names = append(names, c.Name)
+	}
+	return names
+}
+
+// AllFailures returns the failures of all turns and the final checks.
+func (r *Result) AllFailures() []Failure {
+	var out []Failure
+	for _, tr := range r.Turns {
+		out = append(out, tr.Failures...)
+	}
+	return append(out, r.Failures...)
+}
+
+// WriteJSON writes the report as indented JSON.
+func (r *Report) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// WriteText writes a human-readable report: one line per scenario, the
+// failures with their diffs below failed ones, and a summary line.
+func (r *Report) WriteText(w io.Writer) {
+	for _, res := range r.Scenarios {
+		status := "PASS"
+		if !res.Passed {
+			status = "FAIL"
+		}
+		fmt.Fprintf(w, "%s %s (%s)\n", status, res.Name, res.Duration.Round(time.Millisecond))
+		if res.Error != "" {
+			fmt.Fprintf(w, "    error: %s\n", res.Error)
+		}
+		for _, f := range res.AllFailures() {
+			fmt.Fprintf(w, "    %s: %s\n", f.Check, f.Message)
+			switch {
+			case f.Diff != "":
+				writeIndented(w, f.Diff, "        ")
+			case f.Expected != "" || f.Actual != "":
+				if f.Expected != "" {
+					fmt.Fprintf(w, "        expected: %s\n", f.Expected)
+				}
+				if f.Actual != "" {
+					fmt.Fprintf(w, "        actual:   %s\n", f.Actual)
+				}
+			}
+		}
+	}
+	fmt.Fprintf(w, "\n%d passed, %d failed (%s)\n", r.Passed, r.Failed, r.Duration.Round(time.Millisecond))
+}
+
+func writeIndented(w io.Writer, text, indent string) {
+	for _, line := range strings.Split(text, "\n") {
+		fmt.Fprintf(w, "%s%s\n", indent, line)
+	}
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,366 @@
+package eval
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kamir/gomikrobot/internal/agent"
+	"github.com/kamir/gomikrobot/internal/provider"
+	"github.com/kamir/gomikrobot/internal/timeline"
+)
+
+// Placeholders usable in scripted tool arguments and in expectations.
+// Paths under the scenario's directories are reported with them, so that
+// expectations do not depend on where the run happens.
+const (
+	WorkRepoPlaceholder  = "{{work_repo}}"
+	WorkspacePlaceholder = "{{workspace}}"
+)
+
+// Options configure a run.
+type Options struct {
+	// Provider, if set, answers instead of the scenario's script or
+	// cassette (live evaluation).
+	Provider provider.LLMProvider
+	// Record wraps Provider in a recorder that writes the scenario's
+	// cassette, replacing an existing one.
+	Record bool
+	// PromptDir holds the bootstrap files (AGENTS.md, SOUL.md, ...) copied
+	// into the scenario's workspace.
+	PromptDir string
+	Model     string
+	// Timeout bounds each scenario (0 = 2 minutes).
+	Timeout time.Duration
+	// Filter selects scenarios by name (nil = all).
+	Filter *regexp.Regexp
+}
+
+// RunAll runs the scenarios one after another.
+func RunAll(ctx context.Context, scenarios []*Scenario, opts Options) *Report {
+	start := time.Now()
+	report := &Report{}
+	for _, sc := range scenarios {
+		if opts.Filter != nil && !opts.Filter.MatchString(sc.Name) {
+			continue
+		}
+		res := Run(ctx, sc, opts)
+		report.Scenarios = append(report.Scenarios, res)
+		if res.Passed {
+			report.Passed++
+		} else {
+			report.Failed++
+		}
+	}
+	report.Duration = time.Since(start)
+	return report
+}
+
+// Run plays one scenario in fresh directories and checks its expectations.
+func Run(ctx context.Context, sc *Scenario, opts Options) *Result {
+	start := time.Now()
+	res := &Result{Name: sc.Name, File: sc.File}
+	defer func() {
+		res.Duration = time.Since(start)
+		res.Passed = res.Error == "" && len(res.Failures) == 0
+		for _, tr := range res.Turns {
+			if len(tr.Failures) > 0 {
+				res.Passed = false
+			}
+		}
+	}()
+
+	timeout := opts.Timeout
+	if timeout <= 0 {
+		timeout = 2 * time.Minute
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	env, err := newEnv(sc, opts)
+	if err != nil {
+		res.Error = err.Error()
+		return res
+	}
+	defer env.close()
+
+	prov, script, err := env.provider(sc, opts)
+	if err != nil {
+		res.Error = err.Error()
+		return res
+	}
+
+	rec := &callRecorder{}
+	loop := agent.NewLoop(agent.LoopOptions{
+		Provider:      prov,
+		Timeline:      env.timeline,
+		Workspace:     env.workspace,
+		WorkRepo:      env.workRepo,
+		SystemRepo:    env.systemRepo,
+		Model:         opts.Model,
+		MaxIterations: 10,
+		Hooks:         []agent.Hook{rec},
+	})
+	sessionKey := "eval:" + sc.Name
+	loop.DeleteSession(sessionKey)
+	defer loop.DeleteSession(sessionKey)
+
+	for i, turn := range sc.Turns {
+		rec.reset()
+		traceID := fmt.Sprintf("eval-%s-%d", sc.Name, i+1)
+		reply, err := loop.ProcessDirectWithTrace(ctx, turn.User, sessionKey, traceID)
+		tr := TurnResult{Index: i + 1, User: turn.User, Response: env.normalize(reply)}
+		for _, call := range rec.calls() {
+			tr.ToolCalls = append(tr.ToolCalls, ToolCall{Name: call.Name, Arguments: env.normalizeArgs(call.Arguments)})
+		}
+		if err != nil {
+			tr.Failures = append(tr.Failures, Failure{Check: tr.label("run"), Message: err.Error()})
+		}
+		tr.Failures = append(tr.Failures, checkTurn(&tr, turn)...)
+		res.Turns = append(res.Turns, tr)
+	}
+
+	for _, path := range sortedKeys(sc.FilesWritten) {
+		m := sc.FilesWritten[path]
+		data, err := os.ReadFile(filepath.Join(env.workRepo, filepath.FromSlash(path)))
+		res.Failures = append(res.Failures, m.check("file "+path, env.normalize(string(data)), err == nil)...)
+	}
+	if script != nil && script.Remaining() > 0 {
+		res.Failures = append(res.Failures, Failure{
+			Check:   "script",
+			Message: fmt.Sprintf("%d scripted responses were not used", script.Remaining()),
+		})
+	}
+	return res
+}
+
+// checkTurn compares what happened in a turn with its expectations.
+func checkTurn(tr *TurnResult, turn Turn) []Failure {
+	var fails []Failure
+
+	// Expected calls must appear in order; each is matched against the
+	// first suitable call after the previous match.
+	next := 0
+	for _, want := range turn.ToolCalls {
+		found := false
+		var nearest []Failure
+		for j := next; j < len(tr.ToolCalls); j++ {
+			got := tr.ToolCalls[j]
+			if got.Name != want.Name {
+				continue
+			}
+			argFails := checkArgs(tr.label("tool "+want.Name), want.Args, got.Arguments)
+			if len(argFails) == 0 {
+				found = true
+				next = j + 1
+				break
+			}
+			if nearest == nil {
+				nearest = argFails
+			}
+		}
+		if found {
+			continue
+		}
+		if nearest != nil {
+			fails = append(fails, nearest...)
+			continue
+		}
+		fails = append(fails, Failure{
+			Check:    tr.label("tool " + want.Name),
+			Message:  "expected tool call not made",
+			Expected: want.Name,
+			Actual:   strings.Join(tr.toolNames(), ", "),
+		})
+	}
+
+	for _, name := range turn.ForbiddenTools {
+		for _, got := range tr.ToolCalls {
+			if got.Name == name {
+				fails = append(fails, Failure{Check: tr.label("tool " + name), Message: "forbidden tool was called"})
+				break
+			}
+		}
+	}
+
+	return append(fails, turn.Response.check(tr.label("response"), tr.Response, true)...)
+}
+
+func checkArgs(check string, want map[string]Matcher, got map[string]any) []Failure {
+	var fails []Failure
+	for _, name := range sortedKeys(want) {
+		m := want[name]
+		v, ok := got[name]
+		fails = append(fails, m.check(check+" arg "+name, argString(v), ok)...)
+	}
+	return fails
+}
+
+// env holds the temporary directories of one scenario run.
+type env struct {
+	root       string
+	workspace  string
+	workRepo   string
+	systemRepo string
+	timeline   *timeline.TimelineService
+}
+
+// newEnv prepares the directories. They sit at a fixed place per scenario
+// so that recorded cassettes, whose requests contain these paths, replay.
+func newEnv(sc *Scenario, opts Options) (*env, error) {
+	root := filepath.Join(os.TempDir(), "gomikrobot-eval", safeName(sc.Name))
+	if err := os.RemoveAll(root); err != nil {
+		return nil, fmt.Errorf("clean %s: %w", root, err)
+	}
+	e := &env{
+		root:       root,
+		workspace:  filepath.Join(root, "workspace"),
+		workRepo:   filepath.Join(root, "work"),
+		systemRepo: filepath.Join(root, "system"),
+	}
+	for _, dir := range []string{e.workspace, e.workRepo, e.systemRepo} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, err
+		}
+	}
+	if dir := opts.PromptDir; dir != "" {
+		if strings.HasPrefix(dir, "~") {
+			home, _ := os.UserHomeDir()
+			dir = filepath.Join(home, dir[1:])
+		}
+		matches, _ := filepath.Glob(filepath.Join(dir, "*.md"))
+		for _, src := range matches {
+			data, err := os.ReadFile(src)
+			if err != nil {
+				return nil, fmt.Errorf("copy prompt file: %w", err)
+			}
+			if err := os.WriteFile(filepath.Join(e.workspace, filepath.Base(src)), data, 0644); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for _, name := range sortedKeys(sc.Files) {
+		rel := filepath.Clean(filepath.FromSlash(name))
+		if filepath.IsAbs(rel) || strings.HasPrefix(rel, "..") {
+			return nil, fmt.Errorf("file %q is outside the work repo", name)
+		}
+		path := filepath.Join(e.workRepo, rel)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(path, []byte(sc.Files[name]), 0644); err != nil {
+			return nil, err
+		}
+	}
+	tl, err := timeline.NewTimelineService(filepath.Join(root, "timeline.db"))
+	if err != nil {
+		return nil, fmt.Errorf("open timeline: %w", err)
+	}
+	e.timeline = tl
+	return e, nil
+}
+
+func (e *env) close() {
+	if e.timeline != nil {
+		_ = e.timeline.Close()
+	}
+	_ = os.RemoveAll(e.root)
+}
+
+// provider picks the LLM for the scenario: the live one from opts
+// (optionally recording), else the cassette, else the script.
+func (e *env) provider(sc *Scenario, opts Options) (provider.LLMProvider, *Script, error) {
+	cassette := ""
+	if sc.Provider.Cassette != "" {
+		cassette = sc.Provider.Cassette
+		if !filepath.IsAbs(cassette) {
+			cassette = filepath.Join(filepath.Dir(sc.File), cassette)
+		}
+	}
+	switch {
+	case opts.Provider != nil && opts.Record:
+		if cassette == "" {
+			return nil, nil, fmt.Errorf("record: scenario has no cassette path")
+		}
+		if err := os.Remove(cassette); err != nil && !os.IsNotExist(err) {
+			return nil, nil, err
+		}
+		rec, err := provider.NewRecorder(opts.Provider, cassette)
+		if err != nil {
+			return nil, nil, err
+		}
+		return rec, nil, nil
+	case opts.Provider != nil:
+		return opts.Provider, nil, nil
+	case cassette != "":
+		rp, err := provider.NewReplayer(cassette)
+		if err != nil {
+			return nil, nil, err
+		}
+		return rp, nil, nil
+	case len(sc.Provider.Script) > 0:
+		s := NewScript(sc.Provider.Script, e.expand)
+		return s, s, nil
+	default:
+		return nil, nil, fmt.Errorf("scenario has neither a script nor a cassette")
+	}
+}
+
+func (e *env) expand(s string) string {
+	s = strings.ReplaceAll(s, WorkRepoPlaceholder, e.workRepo)
+	return strings.ReplaceAll(s, WorkspacePlaceholder, e.workspace)
+}
+
+func (e *env) normalize(s string) string {
+	s = strings.ReplaceAll(s, e.workRepo, WorkRepoPlaceholder)
+	return strings.ReplaceAll(s, e.workspace, WorkspacePlaceholder)
+}
+
+func (e *env) normalizeArgs(args map[string]any) map[string]any {
+	out, _ := expandArgs(args, e.normalize).(map[string]any)
+	return out
+}
+
+// callRecorder is a loop hook that collects the tool calls the model asks
+// for in the current turn.
+type callRecorder struct {
+	agent.NopHook
+	mu   sync.Mutex
+	list []provider.ToolCall
+}
+
+func (r *callRecorder) AfterLLM(_ context.Context, call *agent.LLMCall) {
+	if call.Response == nil {
+		return
+	}
+	r.mu.Lock()
+	r.list = append(r.list, call.Response.ToolCalls...)
+	r.mu.Unlock()
+}
+
+func (r *callRecorder) reset() {
+	r.mu.Lock()
+	r.list = nil
+	r.mu.Unlock()
+}
+
+func (r *callRecorder) calls() []provider.ToolCall {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]provider.ToolCall(nil), r.list...)
+}
+
+var unsafeChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+func safeName(name string) string {
+	s := strings.Trim(unsafeChars.ReplaceAllString(name, "_"), "_.")
+	if s == "" {
+		s = "scenario"
+	}
+	return s
+}
@@ -0,0 +1,186 @@
+// Package eval runs scripted conversations through the agent loop and
+// checks the tool calls, replies and written files against expectations,
+// so prompt and tool changes can be tested for regressions.
+package eval
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Scenario is one conversation and what it must produce.
+type Scenario struct {
+	Name        string `json:"name" yaml:"name"`
+	Description string `json:"description,omitempty" yaml:"description"`
+	// Files are written into the work repo before the first turn.
+	Files    map[string]string `json:"files,omitempty" yaml:"files"`
+	Provider ProviderSpec      `json:"provider" yaml:"provider"`
+	Turns    []Turn            `json:"turns" yaml:"turns"`
+	// FilesWritten are checked in the work repo after the last turn.
+	FilesWritten map[string]Matcher `json:"files_written,omitempty" yaml:"files_written"`
+
+	// File is the path the scenario was loaded from.
+	File string `json:"-" yaml:"-"`
+}
+
+// ProviderSpec selects the LLM the scenario runs against: a script of
+// responses or a recorded cassette. A live provider given to the runner
+// takes precedence over both.
+type ProviderSpec struct {
+	Script []ScriptedResponse `json:"script,omitempty" yaml:"script"`
+	// Cassette is relative to the scenario file.
+	Cassette string `json:"cassette,omitempty" yaml:"cassette"`
+}
+
+// ScriptedResponse is one model answer of a script.
+type ScriptedResponse struct {
+	Content   string             `json:"content,omitempty" yaml:"content"`
+	ToolCalls []ScriptedToolCall `json:"tool_calls,omitempty" yaml:"tool_calls"`
+}
+
+// ScriptedToolCall is a tool call in a scripted answer.
+type ScriptedToolCall struct {
+	Name      string         `json:"name" yaml:"name"`
+	Arguments map[string]any `json:"arguments,omitempty" yaml:"arguments"`
+}
+
+// Turn is one user message and the expectations on how it is handled.
+type Turn struct {
+	User string `json:"user" yaml:"user"`
+	// ToolCalls must be made in this order; other calls may come between.
+	ToolCalls      []ToolCallExpectation `json:"tool_calls,omitempty" yaml:"tool_calls"`
+	ForbiddenTools []string              `json:"forbidden_tools,omitempty" yaml:"forbidden_tools"`
+	Response       *Matcher              `json:"response,omitempty" yaml:"response"`
+}
+
+// ToolCallExpectation matches a tool call by name and arguments. Arguments
+// not listed are not checked.
+type ToolCallExpectation struct {
+	Name string             `json:"name" yaml:"name"`
+	Args map[string]Matcher `json:"args,omitempty" yaml:"args"`
+}
+
+// suiteFile is a file holding several scenarios.
+type suiteFile struct {
+	Scenarios []Scenario `json:"scenarios" yaml:"scenarios"`
+}
+
+// LoadFile reads the scenarios of a YAML or JSON file: either a single
+// scenario or a suite with a "scenarios" list.
+func LoadFile(path string) ([]*Scenario, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read scenario file: %w", err)
+	}
+	unmarshal := func(out any) error {
+		if strings.EqualFold(filepath.Ext(path), ".json") {
+			dec := json.NewDecoder(bytes.NewReader(data))
+			dec.DisallowUnknownFields()
+			return dec.Decode(out)
+		}
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		return dec.Decode(out)
+	}
+
+	var list []Scenario
+	var suite suiteFile
+	if err := unmarshal(&suite); err == nil && len(suite.Scenarios) > 0 {
+		list = suite.Scenarios
+	} else {
+		var sc Scenario
+		if err := unmarshal(&sc); err != nil {
+			return nil, fmt.Errorf("parse %s: %w", path, err)
+		}
+		list = []Scenario{sc}
+	}
+
+	out := make([]*Scenario, 0, len(list))
+	for i := range list {
+		sc := &list[i]
+		sc.File = path
+		if sc.Name == "" {
+			sc.Name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+			if len(list) > 1 {
+				sc.Name += fmt.Sprintf("#%d", i+1)
+			}
+		}
+		if len(sc.Turns) == 0 {
+			return nil, fmt.Errorf("%s: scenario %q has no turns", path, sc.Name)
+		}
+		out = append(out, sc)
+	}
+	return out, nil
+}
+
+// Load reads scenario files and directories. Directories are searched
+// recursively for .yaml, .yml and .json files; files in them that are not
+// scenarios (such as cassettes) are skipped.
+func Load(paths []string) ([]*Scenario, error) {
+	var out []*Scenario
+	for _, p := range paths {
+		info, err := os.Stat(p)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			scs, err := LoadFile(p)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, scs...)
+			continue
+		}
+		var files []string
+		err = filepath.WalkDir(p, func(path string, d os.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			switch strings.ToLower(filepath.Ext(path)) {
+			case ".yaml", ".yml", ".json":
+				if !d.IsDir() {
+					files = append(files, path)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		sort.Strings(files)
+		for _, f := range files {
+			scs, err := LoadFile(f)
+			if err != nil {
+				if isScenarioFile(f) {
+					return nil, err
+				}
+				continue
+			}
+			out = append(out, scs...)
+		}
+	}
+	return out, nil
+}
+
+// isScenarioFile reports whether a file looks like a scenario or suite,
+// so that errors in it are reported instead of skipped.
+func isScenarioFile(path string) bool {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return false
+	}
+	var probe map[string]any
+	if yaml.Unmarshal(data, &probe) != nil {
+		return false
+	}
+	_, turns := probe["turns"]
+	_, scenarios := probe["scenarios"]
+	return turns || scenarios
+}
@@ -0,0 +1,90 @@
+package eval
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/kamir/gomikrobot/internal/provider"
+)
+
+// Script is a provider that answers with a fixed list of responses, one
+// per chat call, and fails once they run out.
+type Script struct {
+	mu        sync.Mutex
+	responses []ScriptedResponse
+	expand    func(string) string
+	next      int
+}
+
+// NewScript serves responses in order. String tool arguments are passed
+// through expand, which fills in placeholders such as {{work_repo}}.
+func NewScript(responses []ScriptedResponse, expand func(string) string) *Script {
+	if expand == nil {
+		expand = func(s string) string { return s }
+	}
+	return &Script{responses: responses, expand: expand}
+}
+
+func (s *Script) Chat(_ context.Context, _ *provider.ChatRequest) (*provider.ChatResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.next >= len(s.responses) {
+		return nil, fmt.Errorf("script exhausted after %d responses", len(s.responses))
+	}
+	r := s.responses[s.next]
+	s.next++
+
+	resp := &provider.ChatResponse{Content: r.Content, FinishReason: "stop"}
+	for i, tc := range r.ToolCalls {
+		resp.ToolCalls = append(resp.ToolCalls, provider.ToolCall{
+			ID:        fmt.Sprintf("call_%d_%d", s.next, i+1),
+			Name:      tc.Name,
+			Arguments: expandArgs(tc.Arguments, s.expand).(map[string]any),
+		})
+	}
+	if len(resp.ToolCalls) > 0 {
+		resp.FinishReason = "tool_calls"
+	}
+	return resp, nil
+}
+
+// Remaining returns how many scripted responses were not used.
+func (s *Script) Remaining() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.responses) - s.next
+}
+
+func (s *Script) Transcribe(context.Context, *provider.AudioRequest) (*provider.AudioResponse, error) {
+	return nil, errors.New("script: transcription not supported")
+}
+
+func (s *Script) Speak(context.Context, *provider.TTSRequest) (*provider.TTSResponse, error) {
+	return nil, errors.New("script: speech not supported")
+}
+
+func (s *Script) DefaultModel() string { return "script" }
+
+// expandArgs copies v, passing every string through expand.
+func expandArgs(v any, expand func(string) string) any {
+	switch x := v.(type) {
+	case string:
+		return expand(x)
+	case map[string]any:
+		out := make(map[string]any, len(x))
+		for k, e := range x {
+			out[k] = expandArgs(e, expand)
+		}
+		return out
+	case []any:
+		out := make([]any, len(x))
+		for i, e := range x {
+			out[i] = expandArgs(e, expand)
+		}
+		return out
+	default:
+		return v
+	}
+}
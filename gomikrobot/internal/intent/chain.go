@@ -0,0 +1,39 @@
+package intent
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+)
+
+// Chain asks its classifiers in order and returns the first result that is
+// not safe. A failing classifier is skipped; the chain fails only if all
+// of them do.
+type Chain []Classifier
+
+func (c Chain) Name() string { return "chain" }
+
+func (c Chain) Classify(ctx context.Context, in Input) (Result, error) {
+	var last Result
+	var lastErr error
+	ok := false
+	for _, cl := range c {
+		res, err := cl.Classify(ctx, in)
+		if err != nil {
+			slog.Warn("Intent classifier failed", "classifier", cl.Name(), "error", err)
+			lastErr = err
+			continue
+		}
+		if res.Category != CategorySafe {
+			return res, nil
+		}
+		last, ok = res, true
+	}
+	if !ok {
+		if lastErr == nil {
+			lastErr = fmt.Errorf("no classifiers configured")
+		}
+		return Result{}, lastErr
+	}
+	return last, nil
+}
@@ -0,0 +1,140 @@
+// Package intent screens user messages before they reach the LLM. A
+// Classifier assigns each message a category; the Guard decides from the
+// configuration whether that category is refused and with which reply.
+package intent
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/kamir/gomikrobot/internal/config"
+	"github.com/kamir/gomikrobot/internal/provider"
+)
+
+// Categories assigned by the built-in classifiers.
+const (
+	CategorySafe      = "safe"
+	CategoryAttack    = "attack"           // destructive requests (wipe the repo, rm -rf)
+	CategoryInjection = "prompt_injection" // attempts to override the agent's instructions
+	CategoryAbuse     = "abuse"            // harassment, spam
+)
+
+// DefaultResponse is the reply to a blocked message when no response is
+// configured.
+const DefaultResponse = "Ey, du spinnst wohl? Hä? 💣 👮‍♂️ 🔒"
+
+// Input is a message to classify.
+type Input struct {
+	Text    string
+	Channel string
+	Sender  string
+}
+
+// Result is a classifier's verdict.
+type Result struct {
+	Category   string  `json:"category"`
+	Confidence float64 `json:"confidence"` // 0..1
+	Reason     string  `json:"reason"`
+	// Classifier names the classifier that produced the result.
+	Classifier string `json:"classifier"`
+}
+
+// Classifier assigns a category to a message.
+type Classifier interface {
+	Name() string
+	Classify(ctx context.Context, in Input) (Result, error)
+}
+
+// Guard applies the configured classifier and block policy.
+type Guard struct {
+	classifier    Classifier // nil: screening is off
+	block         map[string]bool
+	minConfidence float64
+	responses     map[string]string
+}
+
+// NewGuard builds the guard described by cfg. The llm classifier uses
+// prov with cfg.Model, or model when that is empty.
+func NewGuard(cfg config.IntentConfig, prov provider.LLMProvider, model string) (*Guard, error) {
+	g := &Guard{block: map[string]bool{}, minConfidence: cfg.MinConfidence, responses: cfg.Responses}
+	if g.minConfidence <= 0 {
+		g.minConfidence = 0.7
+	}
+	for _, c := range cfg.Block {
+		g.block[strings.ToLower(c)] = true
+	}
+	if len(g.block) == 0 {
+		g.block[CategoryAttack] = true
+	}
+
+	newLLM := func() (Classifier, error) {
+		if prov == nil {
+			return nil, fmt.Errorf("intent classifier %q needs a provider", cfg.Classifier)
+		}
+		if cfg.Model != "" {
+			model = cfg.Model
+		}
+		return NewLLM(prov, model, cfg.CacheSize, cfg.CacheTTL), nil
+	}
+	var err error
+	switch strings.ToLower(cfg.Classifier) {
+	case "", "rules":
+		g.classifier, err = NewRules(cfg.Rules)
+	case "llm":
+		g.classifier, err = newLLM()
+	case "chain":
+		var rules, llm Classifier
+		if rules, err = NewRules(cfg.Rules); err == nil {
+			if llm, err = newLLM(); err == nil {
+				g.classifier = Chain{rules, llm}
+			}
+		}
+	case "off":
+	default:
+		err = fmt.Errorf("unknown intent classifier %q", cfg.Classifier)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+// DefaultGuard returns a guard with the built-in rules.
+func DefaultGuard() *Guard {
+	g, _ := NewGuard(config.IntentConfig{}, nil, "")
+	return g
+}
+
+// Check classifies a message and reports whether it is blocked. A failing
+// classifier lets the message through. The result is zero when screening
+// is off.
+func (g *Guard) Check(ctx context.Context, in Input) (Result, bool) {
+	if g == nil || g.classifier == nil {
+		return Result{}, false
+	}
+	start := time.Now()
+	res, err := g.classifier.Classify(ctx, in)
+	if err != nil {
+		slog.Warn("Intent classification failed, allowing message", "classifier", g.classifier.Name(), "error", err)
+		return Result{Category: CategorySafe, Reason: "classifier error: " + err.Error(), Classifier: g.classifier.Name()}, false
+	}
+	slog.Debug("Intent classified", "category", res.Category, "confidence", res.Confidence,
+		"classifier", res.Classifier, "duration", time.Since(start))
+	return res, g.block[res.Category] && res.Confidence >= g.minConfidence
+}
+
+// Response returns the reply to a blocked message of the given category
+// on channel.
+func (g *Guard) Response(channel, category string) string {
+	if g != nil {
+		for _, key := range []string{channel + ":" + category, channel, category, "default"} {
+			if r, ok := g.responses[key]; ok && r != "" {
+				return r
+			}
+		}
+	}
+	return DefaultResponse
+}
@@ -0,0 +1,93 @@
+package intent
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/kamir/gomikrobot/internal/config"
+)
+
+// defaultRules catch requests to destroy the repository or its files, in
+// English and German.
+var defaultRules = []config.IntentRule{{
+	Category: CategoryAttack,
+	Reason:   "destructive request",
+	Patterns: []string{
+		`(?i)\bdelete\b.*\brepo\b`,
+		`(?i)\brepo\b.*\bdelete\b`,
+		`(?i)\bremove\b.*\brepo\b`,
+		`(?i)\brepo\b.*\bremove\b`,
+		`(?i)\bwipe\b.*\brepo\b`,
+		`(?i)\bdelete\b.*\bcontent\b`,
+		`(?i)\bdelete\b.*\ball\b.*\bfiles\b`,
+		`(?i)\bremove\b.*\ball\b.*\bfiles\b`,
+		`(?i)\brm\s+-rf\b`,
+		`(?i)\blösch\S*\s.*\brepo`,
+		`(?i)\brepo\b.*\blösch`,
+		`(?i)\blösch\S*\s+(alle?s?|sämtliche)\b`,
+		`(?i)\bdatei(en)?\b.*\blösch`,
+	},
+}}
+
+type rule struct {
+	category   string
+	confidence float64
+	reason     string
+	patterns   []*regexp.Regexp
+}
+
+// Rules classifies messages by regular expressions. The first matching
+// rule wins; messages matching none are safe.
+type Rules struct {
+	rules []rule
+}
+
+// NewRules compiles the configured rules, or the built-in attack rules if
+// none are configured.
+func NewRules(cfg []config.IntentRule) (*Rules, error) {
+	if len(cfg) == 0 {
+		cfg = defaultRules
+	}
+	r := &Rules{}
+	for i, rc := range cfg {
+		if rc.Category == "" {
+			return nil, fmt.Errorf("intent rule %d: category is required", i)
+		}
+		compiled := rule{category: strings.ToLower(rc.Category), confidence: rc.Confidence, reason: rc.Reason}
+		if compiled.confidence <= 0 {
+			compiled.confidence = 1
+		}
+		for _, p := range rc.Patterns {
+			re, err := regexp.Compile(p)
+			if err != nil {
+				return nil, fmt.Errorf("intent rule %d: %w", i, err)
+			}
+			compiled.patterns = append(compiled.patterns, re)
+		}
+		r.rules = append(r.rules, compiled)
+	}
+	return r, nil
+}
+
+func (r *Rules) Name() string { return "rules" }
+
+func (r *Rules) Classify(_ context.Context, in Input) (Result, error) {
+	text := strings.ToLower(in.Text)
+	for _, rl := range r.rules {
+		for _, re := range rl.patterns {
+			if !re.MatchString(text) {
+				continue
+			}
+			reason := rl.reason
+			if reason == "" {
+				reason = "matched " + re.String()
+			} else {
+				reason += " (matched " + re.String() + ")"
+			}
+			return Result{Category: rl.category, Confidence: rl.confidence, Reason: reason, Classifier: r.Name()}, nil
+		}
+	}
+	return Result{Category: CategorySafe, Reason: "no rule matched", Classifier: r.Name()}, nil
+}
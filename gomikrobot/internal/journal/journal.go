@@ -0,0 +1,365 @@
+// Package journal records the files the agent writes and edits, with their
+// content before and after each tool call, so that the changes of a task
+// can be reviewed and reverted.
+package journal
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/kamir/gomikrobot/internal/timeline"
+)
+
+// MaxFileSize is the largest file the journal keeps. Changes to larger
+// files are not journaled and cannot be reverted.
+const MaxFileSize = 1 << 20
+
+// ErrNothingToRevert is returned when a task has no unreverted changes.
+var ErrNothingToRevert = errors.New("no file changes to revert")
+
+// ConflictError is returned by a revert when files were changed after the
+// task wrote them. Nothing is restored in that case.
+type ConflictError struct {
+	Paths []string
+}
+
+func (e *ConflictError) Error() string {
+	return "files changed since the task wrote them: " + strings.Join(e.Paths, ", ")
+}
+
+// Change is one file modified by one tool call.
+type Change struct {
+	ID           int64       `json:"id"`
+	TraceID      string      `json:"trace_id,omitempty"`
+	TaskID       string      `json:"task_id,omitempty"`
+	Channel      string      `json:"channel,omitempty"`
+	ChatID       string      `json:"chat_id,omitempty"`
+	Tool         string      `json:"tool"`
+	Path         string      `json:"path"`
+	BeforeExists bool        `json:"before_exists"`
+	BeforeMode   os.FileMode `json:"-"` // permission bits; 0 for older records
+	Before       string      `json:"-"`
+	AfterExists  bool        `json:"after_exists"`
+	After        string      `json:"-"`
+	CreatedAt    time.Time   `json:"created_at"`
+	RevertedAt   *time.Time  `json:"reverted_at,omitempty"`
+}
+
+// Diff returns the change as a line diff.
+func (c *Change) Diff() string {
+	return Diff(c.Before, c.After)
+}
+
+// Snapshot is the state of a file at one point in time.
+type Snapshot struct {
+	Path    string
+	Exists  bool
+	Mode    os.FileMode // permission bits
+	Content string
+	// Err is set when the file could not be read or is larger than
+	// MaxFileSize; such a snapshot is not journaled.
+	Err error
+}
+
+// Take reads the current state of path.
+func Take(path string) Snapshot {
+	s := Snapshot{Path: path}
+	info, err := os.Stat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s
+	}
+	if err != nil {
+		s.Err = err
+		return s
+	}
+	if info.IsDir() {
+		s.Err = fmt.Errorf("%s is a directory", path)
+		return s
+	}
+	if info.Size() > MaxFileSize {
+		s.Err = fmt.Errorf("%s is larger than %d bytes", path, MaxFileSize)
+		return s
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		s.Err = err
+		return s
+	}
+	s.Exists, s.Mode, s.Content = true, info.Mode().Perm(), string(data)
+	return s
+}
+
+// Equal reports whether both snapshots hold the same state.
+func (s Snapshot) Equal(o Snapshot) bool {
+	return s.Exists == o.Exists && s.Content == o.Content
+}
+
+// Journal stores changes in the timeline DB (table file_changes).
+type Journal struct {
+	db *sql.DB
+}
+
+// New returns a journal on the timeline DB.
+func New(tl *timeline.TimelineService) *Journal {
+	return &Journal{db: tl.DB()}
+}
+
+// Record stores c and sets its ID and creation time.
+func (j *Journal) Record(c *Change) error {
+	if c.CreatedAt.IsZero() {
+		c.CreatedAt = time.Now()
+	}
+	res, err := j.db.Exec(`INSERT INTO file_changes
+		(trace_id, task_id, channel, chat_id, tool, path, before_exists, before_mode, before_content, after_exists, after_content, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		c.TraceID, c.TaskID, c.Channel, c.ChatID, c.Tool, c.Path,
+		c.BeforeExists, uint32(c.BeforeMode), c.Before, c.AfterExists, c.After, c.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("record file change: %w", err)
+	}
+	c.ID, _ = res.LastInsertId()
+	return nil
+}
+
+const changeColumns = `id, COALESCE(trace_id,''), COALESCE(task_id,''), COALESCE(channel,''), COALESCE(chat_id,''),
+	tool, path, before_exists, COALESCE(before_mode,0), COALESCE(before_content,''), after_exists, COALESCE(after_content,''),
+	created_at, reverted_at`
+
+// TaskChanges returns the changes made by a task, oldest first, including
+// reverted ones.
+func (j *Journal) TaskChanges(taskID string) ([]Change, error) {
+	return j.query(`SELECT `+changeColumns+` FROM file_changes WHERE task_id = ? ORDER BY id`, taskID)
+}
+
+// RevertResult lists what a revert did.
+type RevertResult struct {
+	TaskID   string   `json:"task_id,omitempty"`
+	TraceID  string   `json:"trace_id,omitempty"`
+	Restored []string `json:"restored"` // files written back to their earlier content
+	Removed  []string `json:"removed"`  // files the task had created
+}
+
+// Files returns the number of files the revert touched.
+func (r *RevertResult) Files() int {
+	return len(r.Restored) + len(r.Removed)
+}
+
+// RevertTask restores the files changed by a task to their state before
+// the task. Unless force is set, it fails with a *ConflictError if a file
+// no longer has the content the task left.
+func (j *Journal) RevertTask(taskID string, force bool) (*RevertResult, error) {
+	changes, err := j.query(`SELECT `+changeColumns+` FROM file_changes
+		WHERE task_id = ? AND reverted_at IS NULL ORDER BY id`, taskID)
+	if err != nil {
+		return nil, err
+	}
+	return j.revert(changes, force)
+}
+
+// UndoLast reverts the most recent turn in a chat that has unreverted
+// changes. Turns are identified by task ID, or by trace ID for direct
+// calls that have no task.
+func (j *Journal) UndoLast(channel, chatID string) (*RevertResult, error) {
+	var taskID, traceID string
+	err := j.db.QueryRow(`SELECT COALESCE(task_id,''), COALESCE(trace_id,'') FROM file_changes
+		WHERE channel = ? AND chat_id = ? AND reverted_at IS NULL ORDER BY id DESC LIMIT 1`,
+		channel, chatID).Scan(&taskID, &traceID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNothingToRevert
+	}
+	if err != nil {
+		return nil, fmt.Errorf("find last change: %w", err)
+	}
+	if taskID != "" {
+		return j.RevertTask(taskID, false)
+	}
+	changes, err := j.query(`SELECT `+changeColumns+` FROM file_changes
+		WHERE task_id = '' AND trace_id = ? AND channel = ? AND chat_id = ? AND reverted_at IS NULL ORDER BY id`,
+		traceID, channel, chatID)
+	if err != nil {
+		return nil, err
+	}
+	return j.revert(changes, false)
+}
+
+// revert restores the state before the first change of each file, after
+// checking that each file still has the state after its last change.
+func (j *Journal) revert(changes []Change, force bool) (*RevertResult, error) {
+	if len(changes) == 0 {
+		return nil, ErrNothingToRevert
+	}
+	type span struct{ first, last *Change }
+	var order []string
+	spans := map[string]*span{}
+	for i := range changes {
+		c := &changes[i]
+		if s, ok := spans[c.Path]; ok {
+			s.last = c
+			continue
+		}
+		spans[c.Path] = &span{first: c, last: c}
+		order = append(order, c.Path)
+	}
+
+	var conflicts []string
+	for _, path := range order {
+		last := spans[path].last
+		cur := Take(path)
+		if cur.Err != nil || !cur.Equal(Snapshot{Exists: last.AfterExists, Content: last.After}) {
+			conflicts = append(conflicts, path)
+		}
+	}
+	if len(conflicts) > 0 && !force {
+		return nil, &ConflictError{Paths: conflicts}
+	}
+
+	res := &RevertResult{TaskID: changes[0].TaskID, TraceID: changes[0].TraceID, Restored: []string{}, Removed: []string{}}
+	for _, path := range order {
+		first := spans[path].first
+		if !first.BeforeExists {
+			if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+				return res, fmt.Errorf("remove %s: %w", path, err)
+			}
+			res.Removed = append(res.Removed, path)
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return res, fmt.Errorf("restore %s: %w", path, err)
+		}
+		mode := first.BeforeMode
+		if mode == 0 {
+			mode = 0644
+		}
+		// WriteFile keeps the mode of an existing file, so set it as well.
+		if err := os.WriteFile(path, []byte(first.Before), mode); err != nil {
+			return res, fmt.Errorf("restore %s: %w", path, err)
+		}
+		if err := os.Chmod(path, mode); err != nil {
+			return res, fmt.Errorf("restore %s: %w", path, err)
+		}
+		res.Restored = append(res.Restored, path)
+	}
+
+	now := time.Now()
+	for _, c := range changes {
+		if _, err := j.db.Exec(`UPDATE file_changes SET reverted_at = ? WHERE id = ?`, now, c.ID); err != nil {
+			return res, fmt.Errorf("mark change reverted: %w", err)
+		}
+	}
+	return res, nil
+}
+
+func (j *Journal) query(query string, args ...any) ([]Change, error) {
+	rows, err := j.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("list file changes: %w", err)
+	}
+	defer rows.Close()
+	var out []Change
+	for rows.Next() {
+		var c Change
+		var reverted sql.NullTime
+		var mode uint32
+		if err := rows.Scan(&c.ID, &c.TraceID, &c.TaskID, &c.Channel, &c.ChatID, &c.Tool, &c.Path,
+			&c.BeforeExists, &mode, &c.Before, &c.AfterExists, &c.After, &c.CreatedAt, &reverted); err != nil {
+			return nil, err
+		}
+		c.BeforeMode = os.FileMode(mode)
+		if reverted.Valid {
+			c.RevertedAt = &reverted.Time
+		}
+		out = append(out, c)
+	}
+	return out, rows.Err()
+}
+
+// Diff returns a line diff from before to after. Unchanged lines are
+// indented by two spaces, removed lines start with "-", added with "+".
+// Long unchanged runs at the start and end are left out.
+func Diff(before, after string) string {
+	if before == after {
+		return ""
+	}
+	a, b := splitLines(before), splitLines(after)
+	// Trim the common prefix and suffix, keeping one line of context.
+	pre := 0
+	for pre < len(a) && pre < len(b) && a[pre] == b[pre] {
+		pre++
+	}
+	suf := 0
+	for suf < len(a)-pre && suf < len(b)-pre && a[len(a)-1-suf] == b[len(b)-1-suf] {
+		suf++
+	}
+	var buf bytes.Buffer
+	if pre > 1 {
+		fmt.Fprintf(&buf, "@@ %d unchanged lines @@\n", pre-1)
+	}
+	if pre > 0 {
+		buf.WriteString("  " + a[pre-1] + "\n")
+	}
+	writeLCSDiff(&buf, a[pre:len(a)-suf], b[pre:len(b)-suf])
+	if suf > 0 {
+		buf.WriteString("  " + a[len(a)-suf] + "\n")
+	}
+	if suf > 1 {
+		fmt.Fprintf(&buf, "@@ %d unchanged lines @@\n", suf-1)
+	}
+	return strings.TrimSuffix(buf.String(), "\n")
+}
+
+// maxDiffCells bounds the LCS table; larger differences are shown as all
+// lines removed and then all added.
+const maxDiffCells = 4 << 20
+
+func writeLCSDiff(buf *bytes.Buffer, a, b []string) {
+	if (len(a)+1)*(len(b)+1) > maxDiffCells {
+		for _, l := range a {
+			buf.WriteString("- " + l + "\n")
+		}
+		for _, l := range b {
+			buf.WriteString("+ " + l + "\n")
+		}
+		return
+	}
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			buf.WriteString("  " + a[i] + "\n")
+			i++
+			j++
+		case i < len(a) && (j == len(b) || lcs[i+1][j] >= lcs[i][j+1]):
+			buf.WriteString("- " + a[i] + "\n")
+			i++
+		default:
+			buf.WriteString("+ " + b[j] + "\n")
+			j++
+		}
+	}
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
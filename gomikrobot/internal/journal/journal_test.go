@@ -0,0 +1,155 @@
+package journal
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kamir/gomikrobot/internal/timeline"
+)
+
+func newTestJournal(t *testing.T) *Journal {
+	t.Helper()
+	tl, err := timeline.NewTimelineService(filepath.Join(t.TempDir(), "timeline.db"))
+	if err != nil {
+		t.Fatalf("failed to create timeline service: %v", err)
+	}
+	t.Cleanup(func() { _ = tl.Close() })
+	return New(tl)
+}
+
+// change applies content to path and journals it like the agent does.
+func change(t *testing.T, j *Journal, taskID, path, content string) {
+	t.Helper()
+	before := Take(path)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	after := Take(path)
+	err := j.Record(&Change{TaskID: taskID, TraceID: "trace-" + taskID, Channel: "web", ChatID: "u1", Tool: "write_file", Path: path,
+		BeforeExists: before.Exists, BeforeMode: before.Mode, Before: before.Content, AfterExists: after.Exists, After: after.Content})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func read(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestRevertTaskRestoresFirstState(t *testing.T) {
+	j := newTestJournal(t)
+	dir := t.TempDir()
+	a, b := filepath.Join(dir, "a.txt"), filepath.Join(dir, "b.txt")
+	if err := os.WriteFile(a, []byte("v0\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	change(t, j, "task-1", a, "v1\n")
+	change(t, j, "task-1", a, "v2\n")
+	change(t, j, "task-1", b, "created\n")
+
+	changes, err := j.TaskChanges("task-1")
+	if err != nil || len(changes) != 3 {
+		t.Fatalf("expected 3 changes, got %v %d", err, len(changes))
+	}
+	if diff := changes[1].Diff(); diff != "- v1\n+ v2" {
+		t.Errorf("unexpected diff %q", diff)
+	}
+
+	res, err := j.RevertTask("task-1", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := read(t, a); got != "v0\n" {
+		t.Errorf("a.txt = %q, want the state before the task", got)
+	}
+	if _, err := os.Stat(b); !os.IsNotExist(err) {
+		t.Errorf("b.txt should be removed, got %v", err)
+	}
+	if len(res.Restored) != 1 || len(res.Removed) != 1 || res.TraceID != "trace-task-1" {
+		t.Errorf("unexpected result %+v", res)
+	}
+	if _, err := j.RevertTask("task-1", false); !errors.Is(err, ErrNothingToRevert) {
+		t.Errorf("second revert: expected ErrNothingToRevert, got %v", err)
+	}
+}
+
+func TestRevertDetectsConflicts(t *testing.T) {
+	j := newTestJournal(t)
+	path := filepath.Join(t.TempDir(), "notes.md")
+	change(t, j, "task-1", path, "from task 1\n")
+	change(t, j, "task-2", path, "from task 2\n")
+
+	_, err := j.RevertTask("task-1", false)
+	var conflict *ConflictError
+	if !errors.As(err, &conflict) || len(conflict.Paths) != 1 || conflict.Paths[0] != path {
+		t.Fatalf("expected conflict on %s, got %v", path, err)
+	}
+	if got := read(t, path); got != "from task 2\n" {
+		t.Errorf("a conflicting revert must not touch files, got %q", got)
+	}
+
+	// Undo takes the most recent turn of the chat, which reverts cleanly.
+	if _, err := j.UndoLast("web", "u1"); err != nil {
+		t.Fatal(err)
+	}
+	if got := read(t, path); got != "from task 1\n" {
+		t.Errorf("after undo got %q", got)
+	}
+
+	if err := os.WriteFile(path, []byte("edited by hand\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := j.UndoLast("web", "u1"); !errors.As(err, &conflict) {
+		t.Fatalf("expected conflict after manual edit, got %v", err)
+	}
+	if _, err := j.RevertTask("task-1", true); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("forced revert should remove the file task 1 created, got %v", err)
+	}
+}
+
+func TestDiffTrimsUnchangedLines(t *testing.T) {
+	before := "a\nb\nc\nd\ne\n"
+	after := "a\nb\nc\nX\ne\n"
+	want := strings.Join([]string{"@@ 2 unchanged lines @@", "  c", "- d", "+ X", "  e"}, "\n")
+	if got := Diff(before, after); got != want {
+		t.Errorf("Diff =\n%s\nwant\n%s", got, want)
+	}
+	if Diff("same", "same") != "" {
+		t.Error("identical contents must give an empty diff")
+	}
+}
+
+func TestRevertKeepsFileMode(t *testing.T) {
+	j := newTestJournal(t)
+	path := filepath.Join(t.TempDir(), "run.sh")
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"), 0750); err != nil {
+		t.Fatal(err)
+	}
+	change(t, j, "task-1", path, "rm -rf build\n")
+	// The tool replaced the file, losing its mode.
+	if err := os.Chmod(path, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := j.RevertTask("task-1", false); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0750 {
+		t.Errorf("mode = %v, want 0750", info.Mode().Perm())
+	}
+}
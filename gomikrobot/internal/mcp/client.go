@@ -0,0 +1,205 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+)
+
+// peer is one end of a JSON-RPC connection. It matches responses to the
+// requests it sent and hands incoming requests and notifications to its
+// handlers. Client and Server are built on it.
+type peer struct {
+	t transport
+	// onRequest answers incoming requests; it runs on its own goroutine.
+	// Nil answers every request except ping with "method not found".
+	onRequest func(ctx context.Context, m *Message) *Message
+	// onNotify receives notifications on the read loop and must not block.
+	onNotify func(method string, params json.RawMessage)
+
+	nextID  atomic.Int64
+	mu      sync.Mutex
+	pending map[string]chan *Message
+}
+
+func newPeer(t transport) *peer {
+	return &peer{t: t, pending: map[string]chan *Message{}}
+}
+
+// handle dispatches an incoming message.
+func (p *peer) handle(m *Message) {
+	switch {
+	case m.IsResponse():
+		p.mu.Lock()
+		ch, ok := p.pending[string(m.ID)]
+		delete(p.pending, string(m.ID))
+		p.mu.Unlock()
+		if ok {
+			ch <- m
+		}
+	case m.IsRequest():
+		go func() {
+			var resp *Message
+			switch {
+			case m.Method == "ping":
+				resp = newResponse(m.ID, struct{}{}, nil)
+			case p.onRequest != nil:
+				resp = p.onRequest(context.Background(), m)
+			default:
+				resp = newResponse(m.ID, nil, &RPCError{Code: CodeMethodNotFound, Message: "method not found: " + m.Method})
+			}
+			if resp != nil {
+				_ = p.t.send(context.Background(), resp)
+			}
+		}()
+	case m.IsNotification():
+		if p.onNotify != nil {
+			p.onNotify(m.Method, m.Params)
+		}
+	}
+}
+
+// call sends a request and decodes its result into result (if non-nil).
+func (p *peer) call(ctx context.Context, method string, params, result any) error {
+	id := p.nextID.Add(1)
+	req, err := newRequest(id, method, params)
+	if err != nil {
+		return err
+	}
+	key := string(req.ID)
+	ch := make(chan *Message, 1)
+	p.mu.Lock()
+	p.pending[key] = ch
+	p.mu.Unlock()
+	defer func() {
+		p.mu.Lock()
+		delete(p.pending, key)
+		p.mu.Unlock()
+	}()
+
+	if err := p.t.send(ctx, req); err != nil {
+		return fmt.Errorf("%s: %w", method, err)
+	}
+	select {
+	case resp := <-ch:
+		if resp.Error != nil {
+			return fmt.Errorf("%s: %w", method, resp.Error)
+		}
+		if result != nil && len(resp.Result) > 0 {
+			if err := json.Unmarshal(resp.Result, result); err != nil {
+				return fmt.Errorf("%s: decode result: %w", method, err)
+			}
+		}
+		return nil
+	case <-ctx.Done():
+		// Tell the other side to stop working on it.
+		_ = p.notify(context.Background(), "notifications/cancelled", map[string]any{
+			"requestId": id,
+			"reason":    ctx.Err().Error(),
+		})
+		return fmt.Errorf("%s: %w", method, ctx.Err())
+	case <-p.t.done():
+		if err := p.t.err(); err != nil {
+			return fmt.Errorf("%s: %w", method, err)
+		}
+		return fmt.Errorf("%s: %w", method, ErrClosed)
+	}
+}
+
+// notify sends a notification.
+func (p *peer) notify(ctx context.Context, method string, params any) error {
+	msg, err := newRequest(nil, method, params)
+	if err != nil {
+		return err
+	}
+	return p.t.send(ctx, msg)
+}
+
+// Client is a connection to one MCP server.
+type Client struct {
+	*peer
+
+	// Server is set by Initialize.
+	Server InitializeResult
+}
+
+// newClient wraps a transport. onNotify receives server notifications and
+// may be nil.
+func newClient(t transport, onNotify func(method string, params json.RawMessage)) *Client {
+	p := newPeer(t)
+	p.onNotify = onNotify
+	return &Client{peer: p}
+}
+
+// start opens the transport.
+func (c *Client) start(ctx context.Context) error {
+	return c.t.start(ctx, c.handle)
+}
+
+// Call sends a request and decodes its result into result (if non-nil).
+func (c *Client) Call(ctx context.Context, method string, params, result any) error {
+	return c.call(ctx, method, params, result)
+}
+
+// Notify sends a notification.
+func (c *Client) Notify(ctx context.Context, method string, params any) error {
+	return c.notify(ctx, method, params)
+}
+
+// Initialize performs the MCP handshake.
+func (c *Client) Initialize(ctx context.Context, info Implementation) error {
+	params := InitializeParams{
+		ProtocolVersion: ProtocolVersion,
+		Capabilities:    map[string]any{},
+		ClientInfo:      info,
+	}
+	if err := c.Call(ctx, "initialize", params, &c.Server); err != nil {
+		return err
+	}
+	if c.Server.ProtocolVersion != ProtocolVersion {
+		slog.Debug("MCP server uses another protocol version", "server", c.Server.ServerInfo.Name, "version", c.Server.ProtocolVersion)
+	}
+	return c.Notify(ctx, "notifications/initialized", nil)
+}
+
+// ListTools returns all tools of the server, following pagination.
+func (c *Client) ListTools(ctx context.Context) ([]ToolDef, error) {
+	var all []ToolDef
+	cursor := ""
+	for {
+		var params any
+		if cursor != "" {
+			params = map[string]string{"cursor": cursor}
+		}
+		var page ListToolsResult
+		if err := c.Call(ctx, "tools/list", params, &page); err != nil {
+			return nil, err
+		}
+		all = append(all, page.Tools...)
+		if page.NextCursor == "" || page.NextCursor == cursor {
+			return all, nil
+		}
+		cursor = page.NextCursor
+	}
+}
+
+// CallTool invokes a tool on the server.
+func (c *Client) CallTool(ctx context.Context, name string, args map[string]any) (*CallToolResult, error) {
+	var res CallToolResult
+	if err := c.Call(ctx, "tools/call", CallToolParams{Name: name, Arguments: args}, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// Done is closed when the connection ends.
+func (c *Client) Done() <-chan struct{} { return c.t.done() }
+
+// Err tells why the connection ended.
+func (c *Client) Err() error { return c.t.err() }
+
+// Close ends the connection; a stdio server process is stopped.
+func (c *Client) Close() error { return c.t.close() }
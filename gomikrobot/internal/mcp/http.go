@@ -0,0 +1,373 @@
+package mcp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// errSessionExpired is returned when the server no longer knows the
+// session; the connection must be initialized again.
+var errSessionExpired = errors.New("mcp session expired")
+
+// httpTransport implements the streamable HTTP transport: every message
+// is POSTed to one endpoint and answered with JSON or an SSE stream. A GET
+// stream carries notifications the server sends on its own.
+type httpTransport struct {
+	lifeline
+	url     string
+	headers map[string]string
+	client  *http.Client
+	recv    func(*Message)
+
+	ctx    context.Context // ends on close
+	cancel context.CancelFunc
+
+	mu        sync.Mutex
+	sessionID string
+}
+
+func newHTTPTransport(endpoint string, headers map[string]string) *httpTransport {
+	return &httpTransport{
+		lifeline: newLifeline(),
+		url:      endpoint,
+		headers:  headers,
+		client:   &http.Client{},
+	}
+}
+
+func (t *httpTransport) start(ctx context.Context, recv func(*Message)) error {
+	t.recv = recv
+	t.ctx, t.cancel = context.WithCancel(context.Background())
+	return nil
+}
+
+func (t *httpTransport) session() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.sessionID
+}
+
+func (t *httpTransport) newRequest(ctx context.Context, method string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, t.url, body)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range t.headers {
+		req.Header.Set(k, v)
+	}
+	if id := t.session(); id != "" {
+		req.Header.Set("Mcp-Session-Id", id)
+	}
+	return req, nil
+}
+
+func (t *httpTransport) send(ctx context.Context, msg *Message) error {
+	select {
+	case <-t.done():
+		return ErrClosed
+	default:
+	}
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	req, err := t.newRequest(ctx, http.MethodPost, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json, text/event-stream")
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		// The server is unreachable: end the connection so it is set up
+		// again.
+		t.fail(err)
+		return err
+	}
+	if id := resp.Header.Get("Mcp-Session-Id"); id != "" {
+		t.mu.Lock()
+		t.sessionID = id
+		t.mu.Unlock()
+	}
+	if resp.StatusCode == http.StatusNotFound && t.session() != "" {
+		resp.Body.Close()
+		t.fail(errSessionExpired)
+		return errSessionExpired
+	}
+	if resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		resp.Body.Close()
+		return fmt.Errorf("http %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	if msg.Method == "notifications/initialized" {
+		// The session is set up: listen for server notifications.
+		go t.listen()
+	}
+	if resp.StatusCode == http.StatusAccepted {
+		resp.Body.Close()
+		return nil
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if mediaType == "text/event-stream" {
+		// The response arrives on the stream, possibly after requests
+		// and notifications from the server.
+		go func() {
+			defer resp.Body.Close()
+			_ = readSSE(resp.Body, func(event, data string) {
+				t.deliver(event, data)
+			})
+		}()
+		return nil
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxLineSize))
+	if err != nil {
+		return err
+	}
+	if len(bytes.TrimSpace(body)) == 0 {
+		return nil
+	}
+	msgs, err := decodeMessages(body)
+	if err != nil {
+		return fmt.Errorf("decode response: %w", err)
+	}
+	for _, m := range msgs {
+		t.recv(m)
+	}
+	return nil
+}
+
+func (t *httpTransport) deliver(event, data string) {
+	if event != "" && event != "message" {
+		return
+	}
+	msgs, err := decodeMessages([]byte(data))
+	if err != nil {
+		slog.Debug("MCP: invalid SSE message", "error", err)
+		return
+	}
+	for _, m := range msgs {
+		t.recv(m)
+	}
+}
+
+// listen keeps a GET stream open for server notifications. Servers that
+// do not offer one answer 405, which ends it.
+func (t *httpTransport) listen() {
+	for t.ctx.Err() == nil {
+		req, err := t.newRequest(t.ctx, http.MethodGet, nil)
+		if err != nil {
+			return
+		}
+		req.Header.Set("Accept", "text/event-stream")
+		resp, err := t.client.Do(req)
+		if err == nil {
+			switch {
+			case resp.StatusCode == http.StatusNotFound && t.session() != "":
+				resp.Body.Close()
+				t.fail(errSessionExpired)
+				return
+			case resp.StatusCode != http.StatusOK:
+				resp.Body.Close()
+				return
+			}
+			_ = readSSE(resp.Body, t.deliver)
+			resp.Body.Close()
+		}
+		select {
+		case <-t.ctx.Done():
+		case <-time.After(5 * time.Second):
+		}
+	}
+}
+
+func (t *httpTransport) close() error {
+	if t.cancel != nil {
+		t.cancel()
+	}
+	if t.session() != "" {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if req, err := t.newRequest(ctx, http.MethodDelete, nil); err == nil {
+			if resp, err := t.client.Do(req); err == nil {
+				resp.Body.Close()
+			}
+		}
+	}
+	t.fail(ErrClosed)
+	return nil
+}
+
+// sseTransport implements the older HTTP+SSE transport: the client opens
+// an SSE stream, which first names the endpoint for POSTs; responses and
+// notifications all arrive on the stream.
+type sseTransport struct {
+	lifeline
+	url      string
+	headers  map[string]string
+	client   *http.Client
+	endpoint string
+	cancel   context.CancelFunc
+}
+
+func newSSETransport(endpoint string, headers map[string]string) *sseTransport {
+	return &sseTransport{lifeline: newLifeline(), url: endpoint, headers: headers, client: &http.Client{}}
+}
+
+func (t *sseTransport) start(ctx context.Context, recv func(*Message)) error {
+	streamCtx, cancel := context.WithCancel(context.Background())
+	t.cancel = cancel
+	req, err := http.NewRequestWithContext(streamCtx, http.MethodGet, t.url, nil)
+	if err != nil {
+		cancel()
+		return err
+	}
+	for k, v := range t.headers {
+		req.Header.Set(k, v)
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	resp, err := t.client.Do(req)
+	if err != nil {
+		cancel()
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		cancel()
+		return fmt.Errorf("sse stream: http %d", resp.StatusCode)
+	}
+
+	endpoint := make(chan string, 1)
+	go func() {
+		defer resp.Body.Close()
+		err := readSSE(resp.Body, func(event, data string) {
+			switch event {
+			case "endpoint":
+				select {
+				case endpoint <- data:
+				default:
+				}
+			case "", "message":
+				msgs, err := decodeMessages([]byte(data))
+				if err != nil {
+					slog.Debug("MCP: invalid SSE message", "error", err)
+					return
+				}
+				for _, m := range msgs {
+					recv(m)
+				}
+			}
+		})
+		if err == nil {
+			err = ErrClosed
+		}
+		t.fail(err)
+	}()
+
+	select {
+	case data := <-endpoint:
+		base, _ := url.Parse(t.url)
+		ref, err := url.Parse(strings.TrimSpace(data))
+		if err != nil {
+			t.close()
+			return fmt.Errorf("sse endpoint %q: %w", data, err)
+		}
+		t.endpoint = base.ResolveReference(ref).String()
+		return nil
+	case <-t.done():
+		return fmt.Errorf("sse stream ended before the endpoint event: %w", t.err())
+	case <-ctx.Done():
+		t.close()
+		return ctx.Err()
+	}
+}
+
+func (t *sseTransport) send(ctx context.Context, msg *Message) error {
+	select {
+	case <-t.done():
+		return ErrClosed
+	default:
+	}
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.endpoint, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	for k, v := range t.headers {
+		req.Header.Set(k, v)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("http %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+func (t *sseTransport) close() error {
+	if t.cancel != nil {
+		t.cancel()
+	}
+	t.fail(ErrClosed)
+	return nil
+}
+
+// readSSE parses a server-sent event stream and calls fn for each event.
+func readSSE(r io.Reader, fn func(event, data string)) error {
+	br := bufio.NewReaderSize(r, 64<<10)
+	var event string
+	var data []string
+	for {
+		line, err := readLine(br)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+		s := string(line)
+		switch {
+		case s == "":
+			if len(data) > 0 {
+				fn(event, strings.Join(data, "\n"))
+			}
+			event, data = "", nil
+		case strings.HasPrefix(s, ":"):
+			// comment / keep-alive
+		default:
+			field, value, _ := strings.Cut(s, ":")
+			value = strings.TrimPrefix(value, " ")
+			switch field {
+			case "event":
+				event = value
+			case "data":
+				data = append(data, value)
+			}
+		}
+	}
+}
@@ -0,0 +1,464 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kamir/gomikrobot/internal/config"
+	"github.com/kamir/gomikrobot/internal/tools"
+)
+
+// Restart backoff of a failed server, doubled after each failure. A
+// connection that stayed up longer than maxBackoff resets it.
+var (
+	minBackoff = time.Second
+	maxBackoff = time.Minute
+)
+
+const (
+	defaultCallTimeout = 60 * time.Second
+	// startTimeout bounds the first connection attempt Start waits for.
+	startTimeout = 30 * time.Second
+)
+
+// clientInfo is sent to servers in the handshake.
+var clientInfo = Implementation{Name: "gomikrobot", Version: "1.0"}
+
+// Manager runs the configured MCP servers and keeps their tools in a tool
+// registry. Crashed servers are restarted with backoff; tool lists are
+// refreshed when a server announces a change.
+type Manager struct {
+	registry *tools.Registry
+	servers  []*server
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
+}
+
+// NewManager validates the server configs. Disabled servers are skipped.
+func NewManager(cfg config.MCPConfig, registry *tools.Registry) (*Manager, error) {
+	m := &Manager{registry: registry}
+	seen := map[string]bool{}
+	for _, sc := range cfg.Servers {
+		if sc.Disabled {
+			continue
+		}
+		if !validName.MatchString(sc.Name) {
+			return nil, fmt.Errorf("mcp server %q: name must be letters, digits, - or _", sc.Name)
+		}
+		if seen[sc.Name] {
+			return nil, fmt.Errorf("mcp server %q: duplicate name", sc.Name)
+		}
+		seen[sc.Name] = true
+		if _, err := transportKind(sc); err != nil {
+			return nil, fmt.Errorf("mcp server %q: %w", sc.Name, err)
+		}
+		m.servers = append(m.servers, newServer(sc, registry))
+	}
+	return m, nil
+}
+
+var validName = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// transportKind resolves the configured transport.
+func transportKind(sc config.MCPServerConfig) (string, error) {
+	kind := strings.ToLower(sc.Transport)
+	if kind == "" {
+		switch {
+		case sc.Command != "":
+			kind = "stdio"
+		case sc.URL != "":
+			kind = "http"
+		}
+	}
+	switch kind {
+	case "stdio":
+		if sc.Command == "" {
+			return "", errors.New("stdio transport needs a command")
+		}
+	case "http", "sse":
+		if sc.URL == "" {
+			return "", fmt.Errorf("%s transport needs a url", kind)
+		}
+	case "":
+		return "", errors.New("set command or url")
+	default:
+		return "", fmt.Errorf("unknown transport %q", sc.Transport)
+	}
+	return kind, nil
+}
+
+// Start launches the servers and waits until each has finished its first
+// connection attempt, so their tools are available to the first message.
+// Servers keep running and reconnecting until ctx ends or Close.
+func (m *Manager) Start(ctx context.Context) {
+	if len(m.servers) == 0 {
+		return
+	}
+	ctx, m.cancel = context.WithCancel(ctx)
+	for _, s := range m.servers {
+		m.wg.Add(1)
+		go func(s *server) {
+			defer m.wg.Done()
+			s.run(ctx)
+		}(s)
+	}
+	timeout := time.After(startTimeout)
+	for _, s := range m.servers {
+		select {
+		case <-s.started:
+		case <-timeout:
+			return
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Close stops the servers and removes their tools from the registry.
+func (m *Manager) Close() {
+	if m.cancel != nil {
+		m.cancel()
+	}
+	m.wg.Wait()
+	for _, s := range m.servers {
+		s.unregisterAll()
+	}
+}
+
+// ServerStatus describes the state of one server.
+type ServerStatus struct {
+	Name      string   `json:"name"`
+	Connected bool     `json:"connected"`
+	Tools     []string `json:"tools"`
+	Restarts  int      `json:"restarts"`
+	LastError string   `json:"last_error,omitempty"`
+}
+
+// Status returns the state of each server.
+func (m *Manager) Status() []ServerStatus {
+	out := make([]ServerStatus, 0, len(m.servers))
+	for _, s := range m.servers {
+		out = append(out, s.status())
+	}
+	return out
+}
+
+// server supervises one configured MCP server.
+type server struct {
+	cfg      config.MCPServerConfig
+	registry *tools.Registry
+	timeout  time.Duration
+	refresh  chan struct{}
+	started  chan struct{}
+	once     sync.Once
+
+	mu       sync.Mutex
+	client   *Client         // nil while disconnected
+	names    map[string]bool // registered tool names
+	restarts int
+	lastErr  error
+}
+
+func newServer(cfg config.MCPServerConfig, registry *tools.Registry) *server {
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = defaultCallTimeout
+	}
+	return &server{
+		cfg:      cfg,
+		registry: registry,
+		timeout:  timeout,
+		refresh:  make(chan struct{}, 1),
+		started:  make(chan struct{}),
+		names:    map[string]bool{},
+	}
+}
+
+// run connects, serves until the connection ends and reconnects with
+// backoff, until ctx ends.
+func (s *server) run(ctx context.Context) {
+	backoff := minBackoff
+	for {
+		connected := time.Now()
+		err := s.session(ctx)
+		s.once.Do(func() { close(s.started) })
+		if ctx.Err() != nil {
+			return
+		}
+		s.mu.Lock()
+		s.lastErr = err
+		s.restarts++
+		s.mu.Unlock()
+		if time.Since(connected) > maxBackoff {
+			backoff = minBackoff
+		}
+		slog.Warn("MCP server disconnected", "server", s.cfg.Name, "error", err, "retry_in", backoff)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, maxBackoff)
+	}
+}
+
+// session runs one connection: handshake, tool registration, then tool
+// refreshes until the connection ends.
+func (s *server) session(ctx context.Context) error {
+	c, err := s.connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		s.mu.Lock()
+		s.client = nil
+		s.mu.Unlock()
+		c.Close()
+	}()
+	s.mu.Lock()
+	s.client = c
+	s.lastErr = nil
+	s.mu.Unlock()
+	s.once.Do(func() { close(s.started) })
+	slog.Info("MCP server connected", "server", s.cfg.Name,
+		"info", c.Server.ServerInfo.Name, "tools", len(s.toolNames()))
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-c.Done():
+			if err := c.Err(); err != nil {
+				return err
+			}
+			return ErrClosed
+		case <-s.refresh:
+			if err := s.syncTools(ctx, c); err != nil {
+				slog.Warn("MCP tool refresh failed", "server", s.cfg.Name, "error", err)
+			}
+		}
+	}
+}
+
+func (s *server) connect(ctx context.Context) (*Client, error) {
+	kind, _ := transportKind(s.cfg)
+	var t transport
+	switch kind {
+	case "stdio":
+		t = newStdioTransport(s.cfg.Name, s.cfg.Command, s.cfg.Args, s.cfg.Env, s.cfg.Dir)
+	case "http":
+		t = newHTTPTransport(s.cfg.URL, s.cfg.Headers)
+	case "sse":
+		t = newSSETransport(s.cfg.URL, s.cfg.Headers)
+	}
+	c := newClient(t, s.notify)
+
+	ctx, cancel := context.WithTimeout(ctx, startTimeout)
+	defer cancel()
+	if err := c.start(ctx); err != nil {
+		return nil, err
+	}
+	if err := c.Initialize(ctx, clientInfo); err != nil {
+		c.Close()
+		return nil, err
+	}
+	if err := s.syncTools(ctx, c); err != nil {
+		c.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// notify handles server notifications; it runs on the read loop and must
+// not block.
+func (s *server) notify(method string, params json.RawMessage) {
+	switch method {
+	case "notifications/tools/list_changed":
+		select {
+		case s.refresh <- struct{}{}:
+		default:
+		}
+	case "notifications/message":
+		slog.Debug("MCP server log", "server", s.cfg.Name, "params", string(params))
+	}
+}
+
+// syncTools lists the server's tools and brings the registry in line:
+// new and changed tools are registered, vanished ones removed.
+func (s *server) syncTools(ctx context.Context, c *Client) error {
+	defs, err := c.ListTools(ctx)
+	if err != nil {
+		return err
+	}
+	allowed := map[string]bool{}
+	for _, name := range s.cfg.Tools {
+		allowed[name] = true
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	wanted := map[string]bool{}
+	for _, def := range defs {
+		if len(allowed) > 0 && !allowed[def.Name] {
+			continue
+		}
+		name := toolName(s.cfg.Name, def.Name)
+		if existing, ok := s.registry.Get(name); ok {
+			if p, ours := existing.(*proxyTool); !ours || p.srv != s {
+				slog.Warn("MCP tool skipped: name already registered", "server", s.cfg.Name, "tool", def.Name, "name", name)
+				continue
+			}
+		}
+		wanted[name] = true
+		s.registry.Register(&proxyTool{srv: s, name: name, def: def, tier: s.tierOf(def.Name)})
+	}
+	for name := range s.names {
+		if !wanted[name] {
+			s.registry.Unregister(name)
+		}
+	}
+	s.names = wanted
+	return nil
+}
+
+func (s *server) tierOf(tool string) int {
+	if t, ok := s.cfg.ToolTiers[tool]; ok {
+		return t
+	}
+	if s.cfg.Tier != nil {
+		return *s.cfg.Tier
+	}
+	return tools.TierHighRisk
+}
+
+func (s *server) current() *Client {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.client
+}
+
+func (s *server) toolNames() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	names := make([]string, 0, len(s.names))
+	for name := range s.names {
+		names = append(names, name)
+	}
+	return names
+}
+
+func (s *server) unregisterAll() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for name := range s.names {
+		s.registry.Unregister(name)
+	}
+	s.names = map[string]bool{}
+}
+
+func (s *server) status() ServerStatus {
+	names := s.toolNames()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st := ServerStatus{Name: s.cfg.Name, Connected: s.client != nil, Tools: names, Restarts: s.restarts}
+	if s.lastErr != nil {
+		st.LastError = s.lastErr.Error()
+	}
+	return st
+}
+
+var invalidToolChars = regexp.MustCompile(`[^A-Za-z0-9_-]`)
+
+// toolName is the registry name of a server tool. LLM APIs accept at
+// most 64 characters of [A-Za-z0-9_-].
+func toolName(server, tool string) string {
+	name := "mcp_" + server + "_" + invalidToolChars.ReplaceAllString(tool, "_")
+	if len(name) > 64 {
+		name = name[:64]
+	}
+	return name
+}
+
+// proxyTool forwards calls to a tool of an MCP server.
+type proxyTool struct {
+	srv  *server
+	name string
+	def  ToolDef
+	tier int
+}
+
+func (t *proxyTool) Name() string { return t.name }
+
+func (t *proxyTool) Tier() int { return t.tier }
+
+func (t *proxyTool) Description() string {
+	desc := strings.TrimSpace(t.def.Description)
+	if desc == "" {
+		desc = t.def.Name
+	}
+	return fmt.Sprintf("[MCP %s] %s", t.srv.cfg.Name, desc)
+}
+
+func (t *proxyTool) Parameters() map[string]any {
+	if len(t.def.InputSchema) == 0 {
+		return map[string]any{"type": "object", "properties": map[string]any{}}
+	}
+	return t.def.InputSchema
+}
+
+func (t *proxyTool) Execute(ctx context.Context, params map[string]any) (string, error) {
+	c := t.srv.current()
+	if c == nil {
+		return fmt.Sprintf("Error: MCP server %s is not connected (restarting)", t.srv.cfg.Name), nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, t.srv.timeout)
+	defer cancel()
+	res, err := c.CallTool(ctx, t.def.Name, params)
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			return fmt.Sprintf("Error: MCP tool %s timed out after %s", t.def.Name, t.srv.timeout), nil
+		}
+		return fmt.Sprintf("Error: MCP tool %s failed: %v", t.def.Name, err), nil
+	}
+	out := FormatResult(res)
+	if res.IsError {
+		return "Error: " + out, nil
+	}
+	return out, nil
+}
+
+// FormatResult renders a tool result as text for the model. Binary parts
+// are described, not included.
+func FormatResult(res *CallToolResult) string {
+	var parts []string
+	for _, c := range res.Content {
+		switch c.Type {
+		case "text":
+			parts = append(parts, c.Text)
+		case "image", "audio":
+			parts = append(parts, fmt.Sprintf("[%s: %s, %d bytes base64]", c.Type, c.MimeType, len(c.Data)))
+		case "resource":
+			if c.Resource == nil {
+				continue
+			}
+			if c.Resource.Text != "" {
+				parts = append(parts, fmt.Sprintf("[resource %s]\n%s", c.Resource.URI, c.Resource.Text))
+			} else {
+				parts = append(parts, fmt.Sprintf("[resource %s: %s]", c.Resource.URI, c.Resource.MimeType))
+			}
+		case "resource_link":
+			parts = append(parts, fmt.Sprintf("[link %s: %s]", c.Name, c.URI))
+		}
+	}
+	if len(parts) == 0 && len(res.StructuredContent) > 0 {
+		parts = append(parts, string(res.StructuredContent))
+	}
+	return strings.Join(parts, "\n")
+}
@@ -0,0 +1,299 @@
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kamir/gomikrobot/internal/config"
+	"github.com/kamir/gomikrobot/internal/tools"
+)
+
+// The test binary doubles as a stdio MCP server.
+func TestMain(m *testing.M) {
+	if os.Getenv("MCP_FAKE_SERVER") == "1" {
+		runFakeStdioServer()
+		os.Exit(0)
+	}
+	minBackoff = 20 * time.Millisecond
+	os.Exit(m.Run())
+}
+
+// fakeServer offers the tools echo, slow, crash and grow; grow adds the
+// tool reverse and announces the change.
+type fakeServer struct {
+	mu     sync.Mutex
+	extra  bool
+	notify func(*Message)
+}
+
+func (f *fakeServer) handle(m *Message) *Message {
+	switch m.Method {
+	case "initialize":
+		return newResponse(m.ID, InitializeResult{
+			ProtocolVersion: ProtocolVersion,
+			Capabilities:    ServerCapabilities{Tools: &Capability{ListChanged: true}},
+			ServerInfo:      Implementation{Name: "fake", Version: "0"},
+		}, nil)
+	case "tools/list":
+		defs := []ToolDef{
+			{Name: "echo", Description: "Echo text", InputSchema: map[string]any{"type": "object", "properties": map[string]any{"text": map[string]any{"type": "string"}}}},
+			{Name: "slow", Description: "Sleep"},
+			{Name: "crash", Description: "Exit"},
+			{Name: "grow", Description: "Add a tool"},
+		}
+		f.mu.Lock()
+		if f.extra {
+			defs = append(defs, ToolDef{Name: "reverse", Description: "Reverse text"})
+		}
+		f.mu.Unlock()
+		return newResponse(m.ID, ListToolsResult{Tools: defs}, nil)
+	case "tools/call":
+		var p CallToolParams
+		_ = json.Unmarshal(m.Params, &p)
+		switch p.Name {
+		case "echo":
+			return newResponse(m.ID, CallToolResult{Content: []Content{TextContent(fmt.Sprint(p.Arguments["text"]))}}, nil)
+		case "slow":
+			time.Sleep(2 * time.Second)
+			return newResponse(m.ID, CallToolResult{Content: []Content{TextContent("done")}}, nil)
+		case "crash":
+			os.Exit(3)
+		case "grow":
+			f.mu.Lock()
+			f.extra = true
+			f.mu.Unlock()
+			if f.notify != nil {
+				defer f.notify(&Message{JSONRPC: "2.0", Method: "notifications/tools/list_changed"})
+			}
+			return newResponse(m.ID, CallToolResult{Content: []Content{TextContent("grown")}}, nil)
+		}
+		return newResponse(m.ID, CallToolResult{Content: []Content{TextContent("unknown tool " + p.Name)}, IsError: true}, nil)
+	}
+	if m.IsRequest() {
+		return newResponse(m.ID, nil, &RPCError{Code: CodeMethodNotFound, Message: m.Method})
+	}
+	return nil
+}
+
+func runFakeStdioServer() {
+	var wm sync.Mutex
+	write := func(m *Message) {
+		data, _ := json.Marshal(m)
+		wm.Lock()
+		os.Stdout.Write(append(data, '\n'))
+		wm.Unlock()
+	}
+	f := &fakeServer{notify: write}
+	sc := bufio.NewScanner(os.Stdin)
+	for sc.Scan() {
+		var m Message
+		if json.Unmarshal(sc.Bytes(), &m) != nil {
+			continue
+		}
+		go func() {
+			if resp := f.handle(&m); resp != nil {
+				write(resp)
+			}
+		}()
+	}
+}
+
+// waitFor polls cond for up to five seconds.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestStdioServerToolsRefreshAndRestart(t *testing.T) {
+	tier := tools.TierWrite
+	reg := tools.NewRegistry()
+	mgr, err := NewManager(config.MCPConfig{Servers: []config.MCPServerConfig{{
+		Name:      "fake",
+		Command:   os.Args[0],
+		Args:      []string{"-test.run=^$"},
+		Env:       map[string]string{"MCP_FAKE_SERVER": "1"},
+		Tier:      &tier,
+		ToolTiers: map[string]int{"crash": tools.TierHighRisk},
+		Timeout:   200 * time.Millisecond,
+	}}}, reg)
+	if err != nil {
+		t.Fatalf("new manager: %v", err)
+	}
+	ctx := context.Background()
+	mgr.Start(ctx)
+	defer mgr.Close()
+
+	echo, ok := reg.Get("mcp_fake_echo")
+	if !ok {
+		t.Fatalf("echo not registered; status %+v", mgr.Status())
+	}
+	if tools.ToolTier(echo) != tools.TierWrite {
+		t.Errorf("echo tier = %d, want %d", tools.ToolTier(echo), tools.TierWrite)
+	}
+	if crash, _ := reg.Get("mcp_fake_crash"); tools.ToolTier(crash) != tools.TierHighRisk {
+		t.Errorf("crash tier override not applied")
+	}
+	if out, _ := reg.Execute(ctx, "mcp_fake_echo", map[string]any{"text": "hi"}); out != "hi" {
+		t.Fatalf("echo = %q", out)
+	}
+	if out, _ := reg.Execute(ctx, "mcp_fake_slow", nil); !strings.Contains(out, "timed out after 200ms") {
+		t.Fatalf("expected timeout, got %q", out)
+	}
+
+	// A change notification refreshes the tool list.
+	if out, _ := reg.Execute(ctx, "mcp_fake_grow", nil); out != "grown" {
+		t.Fatalf("grow = %q", out)
+	}
+	waitFor(t, "reverse to be registered", func() bool { _, ok := reg.Get("mcp_fake_reverse"); return ok })
+
+	// A crash restarts the server; the fresh process has no reverse tool.
+	out, _ := reg.Execute(ctx, "mcp_fake_crash", nil)
+	if !strings.Contains(out, "Error:") {
+		t.Fatalf("expected crash error, got %q", out)
+	}
+	waitFor(t, "restart", func() bool {
+		out, _ := reg.Execute(ctx, "mcp_fake_echo", map[string]any{"text": "again"})
+		return out == "again"
+	})
+	if _, ok := reg.Get("mcp_fake_reverse"); ok {
+		t.Error("reverse should be gone after the restart")
+	}
+	if st := mgr.Status()[0]; st.Restarts < 1 || !st.Connected {
+		t.Errorf("unexpected status %+v", st)
+	}
+
+	mgr.Close()
+	if _, ok := reg.Get("mcp_fake_echo"); ok {
+		t.Error("tools should be removed on close")
+	}
+}
+
+func TestHTTPTransports(t *testing.T) {
+	f := &fakeServer{}
+	// Streamable HTTP: JSON responses, tool calls answered as SSE.
+	streamable := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		var m Message
+		if err := json.NewDecoder(r.Body).Decode(&m); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if m.Method == "initialize" {
+			w.Header().Set("Mcp-Session-Id", "s1")
+		} else if r.Header.Get("Mcp-Session-Id") != "s1" {
+			http.Error(w, "missing session", http.StatusBadRequest)
+			return
+		}
+		resp := f.handle(&m)
+		if resp == nil {
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+		data, _ := json.Marshal(resp)
+		if m.Method == "tools/call" {
+			w.Header().Set("Content-Type", "text/event-stream")
+			fmt.Fprintf(w, ": keep-alive\n\nevent: message\ndata: %s\n\n", data)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(data)
+	}))
+	defer streamable.Close()
+
+	// HTTP+SSE: responses arrive on the event stream.
+	out := make(chan []byte, 16)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/sse", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "event: endpoint\ndata: /messages?session=1\n\n")
+		w.(http.Flusher).Flush()
+		for {
+			select {
+			case data := <-out:
+				fmt.Fprintf(w, "event: message\ndata: %s\n\n", data)
+				w.(http.Flusher).Flush()
+			case <-r.Context().Done():
+				return
+			}
+		}
+	})
+	mux.HandleFunc("/messages", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		var m Message
+		if err := json.Unmarshal(body, &m); err != nil || r.URL.Query().Get("session") != "1" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		if resp := f.handle(&m); resp != nil {
+			data, _ := json.Marshal(resp)
+			out <- data
+		}
+		w.WriteHeader(http.StatusAccepted)
+	})
+	legacy := httptest.NewServer(mux)
+	defer legacy.Close()
+
+	reg := tools.NewRegistry()
+	mgr, err := NewManager(config.MCPConfig{Servers: []config.MCPServerConfig{
+		{Name: "web", URL: streamable.URL, Tools: []string{"echo"}},
+		{Name: "old", URL: legacy.URL + "/sse", Transport: "sse"},
+	}}, reg)
+	if err != nil {
+		t.Fatalf("new manager: %v", err)
+	}
+	ctx := context.Background()
+	mgr.Start(ctx)
+	defer mgr.Close()
+
+	for _, name := range []string{"mcp_web_echo", "mcp_old_echo"} {
+		res, err := reg.Execute(ctx, name, map[string]any{"text": name})
+		if err != nil || res != name {
+			t.Errorf("%s = %q, %v (status %+v)", name, res, err, mgr.Status())
+		}
+	}
+	if _, ok := reg.Get("mcp_web_grow"); ok {
+		t.Error("tools outside the allow list should not be registered")
+	}
+	if echo, _ := reg.Get("mcp_old_echo"); tools.ToolTier(echo) != tools.TierHighRisk {
+		t.Error("MCP tools should default to the high-risk tier")
+	}
+}
+
+func TestNewManagerValidatesConfig(t *testing.T) {
+	for _, sc := range []config.MCPServerConfig{
+		{Name: "a b", Command: "x"},
+		{Name: "nothing"},
+		{Name: "bad", URL: "http://x", Transport: "carrier-pigeon"},
+		{Name: "stdio", URL: "http://x", Transport: "stdio"},
+	} {
+		if _, err := NewManager(config.MCPConfig{Servers: []config.MCPServerConfig{sc}}, tools.NewRegistry()); err == nil {
+			t.Errorf("expected %+v to be rejected", sc)
+		}
+	}
+	dup := []config.MCPServerConfig{{Name: "a", Command: "x"}, {Name: "a", Command: "y"}}
+	if _, err := NewManager(config.MCPConfig{Servers: dup}, tools.NewRegistry()); err == nil {
+		t.Error("expected duplicate names to be rejected")
+	}
+	if got := toolName("srv", "files.read/all"); got != "mcp_srv_files_read_all" {
+		t.Errorf("toolName = %q", got)
+	}
+}
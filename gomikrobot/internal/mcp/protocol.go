@@ -0,0 +1,233 @@
+// Package mcp speaks the Model Context Protocol (JSON-RPC 2.0 over stdio
+// or HTTP). The Manager launches or connects to external MCP servers and
+// mounts their tools into the agent's tool registry; the Server offers the
+// agent's own tools and resources to MCP clients.
+package mcp
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// ProtocolVersion is the MCP revision this package implements.
+const ProtocolVersion = "2025-03-26"
+
+// JSON-RPC error codes.
+const (
+	CodeParseError     = -32700
+	CodeInvalidRequest = -32600
+	CodeMethodNotFound = -32601
+	CodeInvalidParams  = -32602
+	CodeInternalError  = -32603
+)
+
+// Message is a JSON-RPC request, notification or response.
+type Message struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *RPCError       `json:"error,omitempty"`
+}
+
+// IsRequest reports whether m expects a response.
+func (m *Message) IsRequest() bool { return m.Method != "" && len(m.ID) > 0 }
+
+// IsNotification reports whether m is a request without ID.
+func (m *Message) IsNotification() bool { return m.Method != "" && len(m.ID) == 0 }
+
+// IsResponse reports whether m answers a request.
+func (m *Message) IsResponse() bool { return m.Method == "" && len(m.ID) > 0 }
+
+// RPCError is the error object of a JSON-RPC response.
+type RPCError struct {
+	Code    int             `json:"code"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data,omitempty"`
+}
+
+func (e *RPCError) Error() string {
+	return fmt.Sprintf("rpc error %d: %s", e.Code, e.Message)
+}
+
+// newRequest builds a request (id != nil) or notification (id == nil).
+func newRequest(id any, method string, params any) (*Message, error) {
+	m := &Message{JSONRPC: "2.0", Method: method}
+	if id != nil {
+		raw, err := json.Marshal(id)
+		if err != nil {
+			return nil, err
+		}
+		m.ID = raw
+	}
+	if params != nil {
+		raw, err := json.Marshal(params)
+		if err != nil {
+			return nil, fmt.Errorf("encode %s params: %w", method, err)
+		}
+		m.Params = raw
+	}
+	return m, nil
+}
+
+// newResponse answers the request with the given ID; a non-nil rpcErr
+// makes it an error response.
+func newResponse(id json.RawMessage, result any, rpcErr *RPCError) *Message {
+	m := &Message{JSONRPC: "2.0", ID: id}
+	if rpcErr != nil {
+		m.Error = rpcErr
+		return m
+	}
+	raw, err := json.Marshal(result)
+	if err != nil {
+		m.Error = &RPCError{Code: CodeInternalError, Message: err.Error()}
+		return m
+	}
+	m.Result = raw
+	return m
+}
+
+// decodeMessages parses a single message or a batch.
+func decodeMessages(data []byte) ([]*Message, error) {
+	data = bytes.TrimSpace(data)
+	if len(data) > 0 && data[0] == '[' {
+		var batch []*Message
+		if err := json.Unmarshal(data, &batch); err != nil {
+			return nil, err
+		}
+		return batch, nil
+	}
+	var m Message
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, err
+	}
+	return []*Message{&m}, nil
+}
+
+// Implementation names a client or server.
+type Implementation struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+// InitializeParams is sent by the client to open a session.
+type InitializeParams struct {
+	ProtocolVersion string         `json:"protocolVersion"`
+	Capabilities    map[string]any `json:"capabilities"`
+	ClientInfo      Implementation `json:"clientInfo"`
+}
+
+// Capability describes optional features of a server capability.
+type Capability struct {
+	ListChanged bool `json:"listChanged,omitempty"`
+	Subscribe   bool `json:"subscribe,omitempty"`
+}
+
+// ServerCapabilities lists what a server offers.
+type ServerCapabilities struct {
+	Tools     *Capability    `json:"tools,omitempty"`
+	Resources *Capability    `json:"resources,omitempty"`
+	Prompts   *Capability    `json:"prompts,omitempty"`
+	Logging   map[string]any `json:"logging,omitempty"`
+}
+
+// InitializeResult is the server's answer to initialize.
+type InitializeResult struct {
+	ProtocolVersion string             `json:"protocolVersion"`
+	Capabilities    ServerCapabilities `json:"capabilities"`
+	ServerInfo      Implementation     `json:"serverInfo"`
+	Instructions    string             `json:"instructions,omitempty"`
+}
+
+// ToolDef describes a tool offered by a server.
+type ToolDef struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description,omitempty"`
+	InputSchema map[string]any `json:"inputSchema"`
+}
+
+// ListToolsResult is one page of tools/list.
+type ListToolsResult struct {
+	Tools      []ToolDef `json:"tools"`
+	NextCursor string    `json:"nextCursor,omitempty"`
+}
+
+// CallToolParams invokes a tool.
+type CallToolParams struct {
+	Name      string         `json:"name"`
+	Arguments map[string]any `json:"arguments,omitempty"`
+}
+
+// CallToolResult is the outcome of a tool call. IsError marks failures
+// reported by the tool itself, as opposed to protocol errors.
+type CallToolResult struct {
+	Content           []Content       `json:"content"`
+	StructuredContent json.RawMessage `json:"structuredContent,omitempty"`
+	IsError           bool            `json:"isError,omitempty"`
+}
+
+// Content is one part of a tool result: text, image, audio, an embedded
+// resource or a resource link.
+type Content struct {
+	Type     string            `json:"type"`
+	Text     string            `json:"text,omitempty"`
+	Data     string            `json:"data,omitempty"`
+	MimeType string            `json:"mimeType,omitempty"`
+	Resource *ResourceContents `json:"resource,omitempty"`
+	URI      string            `json:"uri,omitempty"`
+	Name     string            `json:"name,omitempty"`
+}
+
+// ResourceContents is the content of a resource, as text or base64 blob.
+type ResourceContents struct {
+	URI      string `json:"uri"`
+	MimeType string `json:"mimeType,omitempty"`
+	Text     string `json:"text,omitempty"`
+	Blob     string `json:"blob,omitempty"`
+}
+
+// TextContent returns a text content part.
+func TextContent(text string) Content {
+	return Content{Type: "text", Text: text}
+}
+
+// Resource is a document a server offers.
+type Resource struct {
+	URI         string `json:"uri"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	MimeType    string `json:"mimeType,omitempty"`
+}
+
+// ResourceTemplate describes a family of resources by URI template.
+type ResourceTemplate struct {
+	URITemplate string `json:"uriTemplate"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	MimeType    string `json:"mimeType,omitempty"`
+}
+
+// ReadResourceParams asks for the content of a resource.
+type ReadResourceParams struct {
+	URI string `json:"uri"`
+}
+
+// ReadResourceResult carries the content of a resource.
+type ReadResourceResult struct {
+	Contents []ResourceContents `json:"contents"`
+}
+
+// ElicitParams asks the user of the client for input.
+type ElicitParams struct {
+	Message         string         `json:"message"`
+	RequestedSchema map[string]any `json:"requestedSchema"`
+}
+
+// ElicitResult is the user's answer: action is "accept", "decline" or
+// "cancel".
+type ElicitResult struct {
+	Action  string         `json:"action"`
+	Content map[string]any `json:"content,omitempty"`
+}
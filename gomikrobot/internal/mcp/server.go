@@ -0,0 +1,404 @@
+package mcp
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kamir/gomikrobot/internal/approval"
+	"github.com/kamir/gomikrobot/internal/policy"
+	"github.com/kamir/gomikrobot/internal/timeline"
+	"github.com/kamir/gomikrobot/internal/tools"
+)
+
+// supportedVersions are the protocol revisions the server speaks, newest
+// first. A client asking for one of them gets it; any other gets the newest.
+var supportedVersions = []string{"2025-06-18", ProtocolVersion, "2024-11-05"}
+
+// CodeResourceNotFound is returned by resources/read for unknown URIs.
+const CodeResourceNotFound = -32002
+
+// ServedResource is a resource with the function that reads it.
+type ServedResource struct {
+	Resource
+	Read func(ctx context.Context) (string, error)
+}
+
+// ServedTemplate offers every URI starting with Prefix; Read gets the
+// full URI.
+type ServedTemplate struct {
+	ResourceTemplate
+	Prefix string
+	Read   func(ctx context.Context, uri string) (string, error)
+}
+
+// Server offers a tool registry and a set of resources to MCP clients.
+// Every tool call passes the Gate first.
+type Server struct {
+	Info         Implementation
+	Instructions string
+	Tools        *tools.Registry
+	Resources    []ServedResource
+	Templates    []ServedTemplate
+	Gate         *Gate
+}
+
+// Serve talks to one client over newline-delimited JSON (the stdio
+// transport) until r ends or ctx is cancelled.
+func (s *Server) Serve(ctx context.Context, r io.Reader, w io.Writer) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	t := newStreamTransport(r, w)
+	c := &serverConn{srv: s, ctx: ctx, peer: newPeer(t), inflight: map[string]context.CancelFunc{}}
+	c.onRequest = c.handle
+	c.onNotify = c.notified
+	if err := t.start(ctx, c.peer.handle); err != nil {
+		return err
+	}
+	select {
+	case <-t.done():
+		if err := t.err(); err != nil && !errors.Is(err, ErrClosed) {
+			return err
+		}
+		return nil
+	case <-ctx.Done():
+		t.close()
+		return ctx.Err()
+	}
+}
+
+// serverConn is the state of one client connection.
+type serverConn struct {
+	*peer
+	srv *Server
+	ctx context.Context
+
+	mu        sync.Mutex
+	canElicit bool
+	inflight  map[string]context.CancelFunc
+}
+
+func (c *serverConn) handle(_ context.Context, m *Message) *Message {
+	ctx, cancel := context.WithCancel(c.ctx)
+	key := string(m.ID)
+	c.mu.Lock()
+	c.inflight[key] = cancel
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		delete(c.inflight, key)
+		c.mu.Unlock()
+		cancel()
+	}()
+
+	result, rpcErr := c.dispatch(ctx, m)
+	if ctx.Err() != nil && c.ctx.Err() == nil {
+		// Cancelled by the client, which expects no response.
+		return nil
+	}
+	return newResponse(m.ID, result, rpcErr)
+}
+
+func (c *serverConn) notified(method string, params json.RawMessage) {
+	if method != "notifications/cancelled" {
+		return
+	}
+	var p struct {
+		RequestID json.RawMessage `json:"requestId"`
+	}
+	if json.Unmarshal(params, &p) != nil {
+		return
+	}
+	c.mu.Lock()
+	cancel := c.inflight[string(p.RequestID)]
+	c.mu.Unlock()
+	if cancel != nil {
+		cancel()
+	}
+}
+
+func invalidParams(err error) *RPCError {
+	return &RPCError{Code: CodeInvalidParams, Message: err.Error()}
+}
+
+func (c *serverConn) dispatch(ctx context.Context, m *Message) (any, *RPCError) {
+	switch m.Method {
+	case "initialize":
+		var p InitializeParams
+		if err := json.Unmarshal(m.Params, &p); err != nil {
+			return nil, invalidParams(err)
+		}
+		_, elicit := p.Capabilities["elicitation"]
+		c.mu.Lock()
+		c.canElicit = elicit
+		c.mu.Unlock()
+		return c.srv.initialize(p.ProtocolVersion), nil
+	case "tools/list":
+		return ListToolsResult{Tools: c.srv.toolDefs()}, nil
+	case "tools/call":
+		var p CallToolParams
+		if err := json.Unmarshal(m.Params, &p); err != nil {
+			return nil, invalidParams(err)
+		}
+		return c.callTool(ctx, p)
+	case "resources/list":
+		list := make([]Resource, 0, len(c.srv.Resources))
+		for _, r := range c.srv.Resources {
+			list = append(list, r.Resource)
+		}
+		return map[string]any{"resources": list}, nil
+	case "resources/templates/list":
+		list := make([]ResourceTemplate, 0, len(c.srv.Templates))
+		for _, t := range c.srv.Templates {
+			list = append(list, t.ResourceTemplate)
+		}
+		return map[string]any{"resourceTemplates": list}, nil
+	case "resources/read":
+		var p ReadResourceParams
+		if err := json.Unmarshal(m.Params, &p); err != nil {
+			return nil, invalidParams(err)
+		}
+		return c.srv.readResource(ctx, p.URI)
+	}
+	return nil, &RPCError{Code: CodeMethodNotFound, Message: "method not found: " + m.Method}
+}
+
+func (s *Server) initialize(requested string) InitializeResult {
+	version := supportedVersions[0]
+	for _, v := range supportedVersions {
+		if v == requested {
+			version = v
+		}
+	}
+	caps := ServerCapabilities{}
+	if s.Tools != nil {
+		caps.Tools = &Capability{}
+	}
+	if len(s.Resources) > 0 || len(s.Templates) > 0 {
+		caps.Resources = &Capability{}
+	}
+	return InitializeResult{
+		ProtocolVersion: version,
+		Capabilities:    caps,
+		ServerInfo:      s.Info,
+		Instructions:    s.Instructions,
+	}
+}
+
+func (s *Server) toolDefs() []ToolDef {
+	defs := []ToolDef{}
+	if s.Tools == nil {
+		return defs
+	}
+	for _, t := range s.Tools.List() {
+		schema := t.Parameters()
+		if schema == nil {
+			schema = map[string]any{"type": "object"}
+		}
+		defs = append(defs, ToolDef{Name: t.Name(), Description: t.Description(), InputSchema: schema})
+	}
+	sort.Slice(defs, func(i, j int) bool { return defs[i].Name < defs[j].Name })
+	return defs
+}
+
+func (c *serverConn) callTool(ctx context.Context, p CallToolParams) (any, *RPCError) {
+	if c.srv.Tools == nil {
+		return nil, &RPCError{Code: CodeInvalidParams, Message: "unknown tool: " + p.Name}
+	}
+	tool, ok := c.srv.Tools.Get(p.Name)
+	if !ok {
+		return nil, &RPCError{Code: CodeInvalidParams, Message: "unknown tool: " + p.Name}
+	}
+	if c.srv.Gate != nil {
+		var ask AskFunc
+		c.mu.Lock()
+		if c.canElicit {
+			ask = c.elicit
+		}
+		c.mu.Unlock()
+		if ok, reason := c.srv.Gate.Check(ctx, p.Name, tools.CallTier(tool, p.Arguments), p.Arguments, ask); !ok {
+			return CallToolResult{Content: []Content{TextContent("Denied by policy: " + reason)}, IsError: true}, nil
+		}
+	}
+	out, err := tool.Execute(ctx, p.Arguments)
+	if err != nil {
+		return CallToolResult{Content: []Content{TextContent("Error: " + err.Error())}, IsError: true}, nil
+	}
+	return CallToolResult{
+		Content: []Content{TextContent(out)},
+		IsError: strings.HasPrefix(out, "Error"),
+	}, nil
+}
+
+// elicit asks the user of the client to confirm.
+func (c *serverConn) elicit(ctx context.Context, prompt string) (bool, error) {
+	var res ElicitResult
+	err := c.call(ctx, "elicitation/create", ElicitParams{
+		Message: prompt,
+		RequestedSchema: map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"approve": map[string]any{"type": "boolean", "title": "Approve"},
+			},
+			"required": []string{"approve"},
+		},
+	}, &res)
+	if err != nil {
+		return false, err
+	}
+	if res.Action != "accept" {
+		return false, nil
+	}
+	approved, _ := res.Content["approve"].(bool)
+	return approved, nil
+}
+
+func (s *Server) readResource(ctx context.Context, uri string) (any, *RPCError) {
+	var (
+		mimeType string
+		text     string
+		found    bool
+		err      error
+	)
+	for _, r := range s.Resources {
+		if r.URI == uri {
+			mimeType, found = r.MimeType, true
+			text, err = r.Read(ctx)
+			break
+		}
+	}
+	if !found {
+		for _, t := range s.Templates {
+			if t.Prefix != "" && strings.HasPrefix(uri, t.Prefix) && len(uri) > len(t.Prefix) {
+				mimeType, found = t.MimeType, true
+				text, err = t.Read(ctx, uri)
+				break
+			}
+		}
+	}
+	if !found || errors.Is(err, ErrResourceNotFound) {
+		return nil, &RPCError{Code: CodeResourceNotFound, Message: "resource not found: " + uri}
+	}
+	if err != nil {
+		return nil, &RPCError{Code: CodeInternalError, Message: err.Error()}
+	}
+	return ReadResourceResult{Contents: []ResourceContents{{URI: uri, MimeType: mimeType, Text: text}}}, nil
+}
+
+// ErrResourceNotFound may be returned by resource readers for URIs that
+// name nothing.
+var ErrResourceNotFound = errors.New("resource not found")
+
+// AskFunc asks the user to confirm a tool call.
+type AskFunc func(ctx context.Context, prompt string) (bool, error)
+
+// Gate applies the policy engine and the approval manager to tool calls
+// from MCP clients. Calls are evaluated as internal messages on the "mcp"
+// channel. A call that requires approval is denied unless
+// AllowClientApproval is set; then it is put to the user of the client, or
+// denied if the client cannot ask.
+type Gate struct {
+	Policy    policy.Engine
+	Approvals *approval.Manager
+	Timeline  *timeline.TimelineService
+	Sender    string
+	// Timeout bounds the wait for an approval (default 60s).
+	Timeout time.Duration
+	// AllowClientApproval lets the MCP client approve calls itself. A
+	// client that accepts every elicitation then approves its own calls,
+	// so this is off by default.
+	AllowClientApproval bool
+}
+
+// Channel is the channel name MCP calls are evaluated and recorded under.
+const Channel = "mcp"
+
+// Check reports whether the call may run and, if not, why. ask is nil when
+// the client cannot ask its user.
+func (g *Gate) Check(ctx context.Context, tool string, tier int, args map[string]any, ask AskFunc) (bool, string) {
+	traceID := newServerTraceID()
+	decision := g.Policy.Evaluate(policy.Context{
+		Sender:      g.Sender,
+		Channel:     Channel,
+		Tool:        tool,
+		Tier:        tier,
+		Arguments:   args,
+		TraceID:     traceID,
+		MessageType: "internal",
+	})
+	if g.Timeline != nil {
+		_ = g.Timeline.LogPolicyDecision(&timeline.PolicyDecisionRecord{
+			TraceID: traceID,
+			Tool:    tool,
+			Tier:    tier,
+			Sender:  g.Sender,
+			Channel: Channel,
+			Allowed: decision.Allow,
+			Reason:  decision.Reason,
+		})
+	}
+	if decision.Allow {
+		return true, ""
+	}
+	if !decision.RequiresApproval || g.Approvals == nil {
+		return false, decision.Reason
+	}
+	if !g.AllowClientApproval {
+		return false, decision.Reason + " (approval by the MCP client is disabled)"
+	}
+	if ask == nil {
+		return false, decision.Reason + " (client cannot ask the user)"
+	}
+
+	id := g.Approvals.Create(&approval.ApprovalRequest{
+		Tool:      tool,
+		Tier:      tier,
+		Arguments: args,
+		Sender:    g.Sender,
+		Channel:   Channel,
+		TraceID:   traceID,
+	})
+	timeout := g.Timeout
+	if timeout <= 0 {
+		timeout = 60 * time.Second
+	}
+	waitCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	go func() {
+		args, _ := json.Marshal(args)
+		prompt := fmt.Sprintf("GoMikroBot wants to run %q (tier %d) with %s. Approve?", tool, tier, args)
+		approved, err := ask(waitCtx, prompt)
+		if err != nil {
+			slog.Warn("MCP approval request failed", "id", id, "error", err)
+		}
+		_ = g.Approvals.Respond(id, approved)
+	}()
+
+	approved, err := g.Approvals.Wait(waitCtx, id)
+	if err != nil {
+		return false, "approval_timeout"
+	}
+	if !approved {
+		return false, "approval_denied"
+	}
+	return true, ""
+}
+
+func newServerTraceID() string {
+	var b [8]byte
+	if _, err := rand.Read(b[:]); err == nil {
+		return "mcp-" + hex.EncodeToString(b[:])
+	}
+	return fmt.Sprintf("mcp-%d", time.Now().UnixNano())
+}
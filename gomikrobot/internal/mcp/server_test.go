@@ -0,0 +1,198 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kamir/gomikrobot/internal/approval"
+	"github.com/kamir/gomikrobot/internal/policy"
+	"github.com/kamir/gomikrobot/internal/tools"
+)
+
+type stubTool struct {
+	name string
+	tier int
+	runs int
+}
+
+func (s *stubTool) Name() string               { return s.name }
+func (s *stubTool) Description() string        { return "stub " + s.name }
+func (s *stubTool) Parameters() map[string]any { return map[string]any{"type": "object"} }
+func (s *stubTool) Tier() int                  { return s.tier }
+func (s *stubTool) Execute(ctx context.Context, params map[string]any) (string, error) {
+	s.runs++
+	return s.name + " ran", nil
+}
+
+// serveTest connects a client to a server on pipes. answer, if set, makes
+// the client declare elicitation and answer every elicitation request.
+func serveTest(t *testing.T, srv *Server, answer *ElicitResult) *Client {
+	t.Helper()
+	cr, sw := io.Pipe()
+	sr, cw := io.Pipe()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		srv.Serve(ctx, sr, sw)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		cw.Close()
+		sw.Close()
+		<-done
+	})
+
+	c := newClient(newStreamTransport(cr, cw), nil)
+	caps := map[string]any{}
+	if answer != nil {
+		caps["elicitation"] = map[string]any{}
+		c.onRequest = func(_ context.Context, m *Message) *Message {
+			if m.Method != "elicitation/create" {
+				return newResponse(m.ID, nil, &RPCError{Code: CodeMethodNotFound, Message: m.Method})
+			}
+			return newResponse(m.ID, answer, nil)
+		}
+	}
+	if err := c.start(ctx); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	params := InitializeParams{ProtocolVersion: "2024-11-05", Capabilities: caps, ClientInfo: Implementation{Name: "test"}}
+	callCtx, callCancel := context.WithTimeout(ctx, 5*time.Second)
+	defer callCancel()
+	if err := c.Call(callCtx, "initialize", params, &c.Server); err != nil {
+		t.Fatalf("initialize: %v", err)
+	}
+	if c.Server.ProtocolVersion != "2024-11-05" {
+		t.Errorf("negotiated version = %q", c.Server.ProtocolVersion)
+	}
+	return c
+}
+
+func newTestServer() (*Server, *stubTool, *stubTool) {
+	peek := &stubTool{name: "peek", tier: tools.TierReadOnly}
+	launch := &stubTool{name: "launch", tier: tools.TierHighRisk}
+	reg := tools.NewRegistry()
+	reg.Register(peek)
+	reg.Register(launch)
+	srv := &Server{
+		Info:  Implementation{Name: "gomikrobot", Version: "test"},
+		Tools: reg,
+		Gate: &Gate{
+			Policy:    policy.NewDefaultEngine(),
+			Approvals: approval.NewManager(nil),
+			Sender:    "test",
+			Timeout:   2 * time.Second,
+
+			AllowClientApproval: true,
+		},
+		Resources: []ServedResource{{
+			Resource: Resource{URI: "gomikrobot://memory/MEMORY.md", Name: "MEMORY.md"},
+			Read:     func(context.Context) (string, error) { return "# Memory", nil },
+		}},
+		Templates: []ServedTemplate{{
+			ResourceTemplate: ResourceTemplate{URITemplate: "gomikrobot://sessions/{key}", Name: "session"},
+			Prefix:           "gomikrobot://sessions/",
+			Read: func(_ context.Context, uri string) (string, error) {
+				if strings.HasSuffix(uri, "/cli:default") {
+					return "[]", nil
+				}
+				return "", ErrResourceNotFound
+			},
+		}},
+	}
+	return srv, peek, launch
+}
+
+func TestServerToolsAndPolicy(t *testing.T) {
+	srv, peek, launch := newTestServer()
+	ctx := context.Background()
+
+	// Without elicitation, calls that need approval are denied.
+	c := serveTest(t, srv, nil)
+	defs, err := c.ListTools(ctx)
+	if err != nil || len(defs) != 2 || defs[0].Name != "launch" || defs[1].Name != "peek" {
+		t.Fatalf("tools/list = %+v, %v", defs, err)
+	}
+	res, err := c.CallTool(ctx, "peek", nil)
+	if err != nil || res.IsError || res.Content[0].Text != "peek ran" {
+		t.Fatalf("peek = %+v, %v", res, err)
+	}
+	res, err = c.CallTool(ctx, "launch", nil)
+	if err != nil || !res.IsError || !strings.Contains(res.Content[0].Text, "client cannot ask the user") {
+		t.Fatalf("launch without elicitation = %+v, %v", res, err)
+	}
+	if _, err := c.CallTool(ctx, "missing", nil); err == nil {
+		t.Error("expected an error for an unknown tool")
+	}
+
+	// Without opt-in, a client that accepts everything cannot approve
+	// its own calls.
+	srv.Gate.AllowClientApproval = false
+	c = serveTest(t, srv, &ElicitResult{Action: "accept", Content: map[string]any{"approve": true}})
+	res, err = c.CallTool(ctx, "launch", nil)
+	if err != nil || !res.IsError || !strings.Contains(res.Content[0].Text, "approval by the MCP client is disabled") {
+		t.Fatalf("self-approved launch = %+v, %v", res, err)
+	}
+	srv.Gate.AllowClientApproval = true
+
+	// The user declines.
+	c = serveTest(t, srv, &ElicitResult{Action: "decline"})
+	res, err = c.CallTool(ctx, "launch", nil)
+	if err != nil || !res.IsError || !strings.Contains(res.Content[0].Text, "approval_denied") {
+		t.Fatalf("declined launch = %+v, %v", res, err)
+	}
+
+	// The user approves.
+	c = serveTest(t, srv, &ElicitResult{Action: "accept", Content: map[string]any{"approve": true}})
+	res, err = c.CallTool(ctx, "launch", nil)
+	if err != nil || res.IsError || res.Content[0].Text != "launch ran" {
+		t.Fatalf("approved launch = %+v, %v", res, err)
+	}
+	if launch.runs != 1 || peek.runs != 1 {
+		t.Errorf("runs: launch=%d peek=%d", launch.runs, peek.runs)
+	}
+}
+
+func TestServerResources(t *testing.T) {
+	srv, _, _ := newTestServer()
+	c := serveTest(t, srv, nil)
+	ctx := context.Background()
+
+	var list struct {
+		Resources []Resource `json:"resources"`
+	}
+	if err := c.Call(ctx, "resources/list", nil, &list); err != nil || len(list.Resources) != 1 {
+		t.Fatalf("resources/list = %+v, %v", list, err)
+	}
+	var templates struct {
+		ResourceTemplates []ResourceTemplate `json:"resourceTemplates"`
+	}
+	if err := c.Call(ctx, "resources/templates/list", nil, &templates); err != nil || len(templates.ResourceTemplates) != 1 {
+		t.Fatalf("resources/templates/list = %+v, %v", templates, err)
+	}
+
+	for uri, want := range map[string]string{
+		"gomikrobot://memory/MEMORY.md":     "# Memory",
+		"gomikrobot://sessions/cli:default": "[]",
+	} {
+		var res ReadResourceResult
+		if err := c.Call(ctx, "resources/read", ReadResourceParams{URI: uri}, &res); err != nil {
+			t.Fatalf("read %s: %v", uri, err)
+		}
+		if len(res.Contents) != 1 || res.Contents[0].Text != want {
+			t.Errorf("read %s = %+v", uri, res)
+		}
+	}
+
+	err := c.Call(ctx, "resources/read", ReadResourceParams{URI: "gomikrobot://sessions/nope"}, &json.RawMessage{})
+	var rpcErr *RPCError
+	if !errors.As(err, &rpcErr) || rpcErr.Code != CodeResourceNotFound {
+		t.Errorf("expected resource not found, got %v", err)
+	}
+}
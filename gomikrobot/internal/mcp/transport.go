@@ -0,0 +1,214 @@
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+// ErrClosed is returned for calls on a connection that has ended.
+var ErrClosed = errors.New("mcp connection closed")
+
+// transport carries JSON-RPC messages between client and server.
+type transport interface {
+	// start connects and passes every incoming message to recv until the
+	// connection ends.
+	start(ctx context.Context, recv func(*Message)) error
+	send(ctx context.Context, msg *Message) error
+	// done is closed when the connection is lost or closed; err then
+	// tells why.
+	done() <-chan struct{}
+	err() error
+	close() error
+}
+
+// lifeline tracks the end of a connection for transports.
+type lifeline struct {
+	once   sync.Once
+	ch     chan struct{}
+	mu     sync.Mutex
+	reason error
+}
+
+func newLifeline() lifeline { return lifeline{ch: make(chan struct{})} }
+
+func (l *lifeline) fail(err error) {
+	l.once.Do(func() {
+		l.mu.Lock()
+		l.reason = err
+		l.mu.Unlock()
+		close(l.ch)
+	})
+}
+
+func (l *lifeline) done() <-chan struct{} { return l.ch }
+
+func (l *lifeline) err() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.reason
+}
+
+// maxLineSize bounds one newline-delimited message on a stream.
+const maxLineSize = 16 << 20
+
+// streamTransport exchanges newline-delimited JSON messages over a reader
+// and a writer, as MCP does on stdio.
+type streamTransport struct {
+	lifeline
+	r  io.Reader
+	w  io.Writer
+	wm sync.Mutex
+}
+
+func newStreamTransport(r io.Reader, w io.Writer) *streamTransport {
+	return &streamTransport{lifeline: newLifeline(), r: r, w: w}
+}
+
+func (t *streamTransport) start(_ context.Context, recv func(*Message)) error {
+	go func() {
+		t.fail(readLines(t.r, recv))
+	}()
+	return nil
+}
+
+// readLines passes the messages of r to recv until r ends.
+func readLines(r io.Reader, recv func(*Message)) error {
+	br := bufio.NewReaderSize(r, 64<<10)
+	for {
+		line, err := readLine(br)
+		if len(line) > 0 {
+			msgs, derr := decodeMessages(line)
+			if derr != nil {
+				slog.Debug("MCP: invalid message", "error", derr)
+			}
+			for _, m := range msgs {
+				recv(m)
+			}
+		}
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return ErrClosed
+			}
+			return err
+		}
+	}
+}
+
+func readLine(br *bufio.Reader) ([]byte, error) {
+	var line []byte
+	for {
+		chunk, isPrefix, err := br.ReadLine()
+		line = append(line, chunk...)
+		if len(line) > maxLineSize {
+			return nil, fmt.Errorf("message larger than %d bytes", maxLineSize)
+		}
+		if err != nil || !isPrefix {
+			return line, err
+		}
+	}
+}
+
+func (t *streamTransport) send(_ context.Context, msg *Message) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	select {
+	case <-t.done():
+		return ErrClosed
+	default:
+	}
+	t.wm.Lock()
+	defer t.wm.Unlock()
+	if _, err := t.w.Write(append(data, '\n')); err != nil {
+		t.fail(err)
+		return err
+	}
+	return nil
+}
+
+func (t *streamTransport) close() error {
+	t.fail(ErrClosed)
+	return nil
+}
+
+// stdioTransport runs a server as a child process and talks to it over
+// its stdin and stdout. Stderr is logged.
+type stdioTransport struct {
+	*streamTransport
+	name  string
+	cmd   *exec.Cmd
+	stdin io.Closer
+}
+
+func newStdioTransport(name, command string, args []string, env map[string]string, dir string) *stdioTransport {
+	cmd := exec.Command(command, args...)
+	cmd.Dir = dir
+	cmd.Env = os.Environ()
+	for k, v := range env {
+		cmd.Env = append(cmd.Env, k+"="+v)
+	}
+	return &stdioTransport{streamTransport: newStreamTransport(nil, nil), name: name, cmd: cmd}
+}
+
+func (t *stdioTransport) start(_ context.Context, recv func(*Message)) error {
+	stdin, err := t.cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	stdout, err := t.cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	stderr, err := t.cmd.StderrPipe()
+	if err != nil {
+		return err
+	}
+	if err := t.cmd.Start(); err != nil {
+		return fmt.Errorf("start %s: %w", t.cmd.Path, err)
+	}
+	t.r, t.w, t.stdin = stdout, stdin, stdin
+
+	go func() {
+		sc := bufio.NewScanner(stderr)
+		for sc.Scan() {
+			slog.Debug("MCP server stderr", "server", t.name, "line", sc.Text())
+		}
+	}()
+	go func() {
+		err := readLines(stdout, recv)
+		if werr := t.cmd.Wait(); werr != nil {
+			err = fmt.Errorf("process exited: %w", werr)
+		} else if errors.Is(err, ErrClosed) {
+			err = errors.New("process exited")
+		}
+		t.fail(err)
+	}()
+	return nil
+}
+
+// close closes stdin, which asks the server to exit, and kills the
+// process if it is still running after a grace period.
+func (t *stdioTransport) close() error {
+	if t.stdin == nil {
+		t.fail(ErrClosed)
+		return nil
+	}
+	_ = t.stdin.Close()
+	select {
+	case <-t.done():
+	case <-time.After(2 * time.Second):
+		_ = t.cmd.Process.Kill()
+		<-t.done()
+	}
+	return nil
+}
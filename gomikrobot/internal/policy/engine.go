@@ -17,6 +17,10 @@ type Context struct {
 	Arguments   map[string]any
 	TraceID     string
 	MessageType string // "internal" or "external"
+	// MaxAutoTier and ExternalMaxTier, when set, override the engine's
+	// limits for this evaluation (per-chat agent profiles).
+	MaxAutoTier     *int
+	ExternalMaxTier *int
 }
 
 // Decision is the result of a policy evaluation.
@@ -81,8 +85,14 @@ func (e *DefaultEngine) Evaluate(ctx Context) Decision {
 
 	// Determine effective max tier based on message type
 	effectiveMaxTier := e.MaxAutoTier
+	if ctx.MaxAutoTier != nil {
+		effectiveMaxTier = *ctx.MaxAutoTier
+	}
 	if ctx.MessageType == "external" {
 		effectiveMaxTier = e.ExternalMaxTier
+		if ctx.ExternalMaxTier != nil {
+			effectiveMaxTier = *ctx.ExternalMaxTier
+		}
 	}
 
 	// Check tier against max auto-approved tier
@@ -145,3 +145,41 @@ func TestInternalMessageAllowsFullAccess(t *testing.T) {
 		t.Fatalf("empty message type should use MaxAutoTier, got: %s", d.Reason)
 	}
 }
+
+func TestContextTierOverrides(t *testing.T) {
+	eng := NewDefaultEngine()
+	eng.MaxAutoTier = 2
+	eng.ExternalMaxTier = 1
+
+	readOnly := 0
+	// Restricted profile: writes need approval even for internal messages.
+	d := eng.Evaluate(Context{
+		Tool:        "write_file",
+		Tier:        tools.TierWrite,
+		MessageType: "internal",
+		MaxAutoTier: &readOnly,
+	})
+	if d.Allow || !d.RequiresApproval {
+		t.Fatalf("profile MaxAutoTier=0 should require approval for tier 1, got allow=%v reason=%s", d.Allow, d.Reason)
+	}
+
+	// External override applies to external messages only.
+	d = eng.Evaluate(Context{
+		Tool:            "write_file",
+		Tier:            tools.TierWrite,
+		MessageType:     "external",
+		ExternalMaxTier: &readOnly,
+	})
+	if d.Allow {
+		t.Fatal("profile ExternalMaxTier=0 should deny tier 1 for external messages")
+	}
+	d = eng.Evaluate(Context{
+		Tool:        "write_file",
+		Tier:        tools.TierWrite,
+		MessageType: "external",
+		MaxAutoTier: &readOnly,
+	})
+	if !d.Allow {
+		t.Fatalf("MaxAutoTier override must not affect external messages, got: %s", d.Reason)
+	}
+}
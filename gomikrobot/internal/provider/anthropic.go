@@ -0,0 +1,403 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// anthropicVersion is the Messages API version sent with every request.
+const anthropicVersion = "2023-06-01"
+
+// AnthropicProvider implements LLMProvider using the native Anthropic
+// Messages API. Compared to routing Claude through an OpenAI-compatible
+// proxy it keeps tool_use/tool_result blocks intact, reports stop reasons
+// faithfully and enables prompt caching for the system prompt and tools.
+type AnthropicProvider struct {
+	apiKey       string
+	apiBase      string
+	defaultModel string
+	httpClient   *http.Client
+}
+
+// NewAnthropicProvider creates a new Anthropic Messages API provider.
+func NewAnthropicProvider(apiKey, apiBase, defaultModel string) *AnthropicProvider {
+	if apiBase == "" {
+		apiBase = "https://api.anthropic.com/v1"
+	}
+	if defaultModel == "" {
+		defaultModel = "claude-sonnet-4-5"
+	}
+	return &AnthropicProvider{
+		apiKey:       apiKey,
+		apiBase:      strings.TrimSuffix(apiBase, "/"),
+		defaultModel: defaultModel,
+		httpClient: &http.Client{
+			Timeout: 120 * time.Second,
+		},
+	}
+}
+
+// DefaultModel returns the configured default model.
+func (p *AnthropicProvider) DefaultModel() string {
+	return p.defaultModel
+}
+
+// Chat sends a request to the Messages API.
+func (p *AnthropicProvider) Chat(ctx context.Context, req *ChatRequest) (*ChatResponse, error) {
+	model := req.Model
+	if model == "" {
+		model = p.defaultModel
+	}
+
+	maxTokens := req.MaxTokens
+	if maxTokens <= 0 {
+		maxTokens = 4096
+	}
+
+	system, messages := p.convertMessages(req.Messages)
+
+	// JSON schema output is enforced by forcing a single tool whose input is
+	// the answer. Without a schema, or alongside real tools, it becomes an
+	// instruction in the system prompt.
+	structuredTool := ""
+	if f := req.ResponseFormat; f != nil {
+		if f.Type == FormatJSONSchema && f.Schema != nil && len(req.Tools) == 0 {
+			structuredTool = f.Name
+			if structuredTool == "" {
+				structuredTool = "response"
+			}
+		} else {
+			system = strings.TrimSpace(system + "\n\n" + f.instruction())
+		}
+	}
+
+	body := map[string]any{
+		"model":      anthropicModelName(model),
+		"max_tokens": maxTokens,
+		"messages":   messages,
+	}
+	if req.Temperature > 0 {
+		// The Messages API only accepts temperatures in [0, 1].
+		body["temperature"] = min(req.Temperature, 1.0)
+	}
+	if system != "" {
+		body["system"] = []map[string]any{{
+			"type":          "text",
+			"text":          system,
+			"cache_control": map[string]any{"type": "ephemeral"},
+		}}
+	}
+	if len(req.Tools) > 0 {
+		body["tools"] = p.convertTools(req.Tools)
+	}
+	if structuredTool != "" {
+		body["tools"] = []map[string]any{{
+			"name":         structuredTool,
+			"description":  "Return the answer in this structure.",
+			"input_schema": req.ResponseFormat.Schema,
+		}}
+		body["tool_choice"] = map[string]any{"type": "tool", "name": structuredTool}
+	}
+
+	jsonBody, err := json.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("marshal request: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", p.apiBase+"/messages", bytes.NewReader(jsonBody))
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("x-api-key", p.apiKey)
+	httpReq.Header.Set("anthropic-version", anthropicVersion)
+
+	resp, err := p.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("execute request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, &APIError{StatusCode: resp.StatusCode, Body: string(respBody)}
+	}
+
+	var apiResp anthropicResponse
+	if err := json.Unmarshal(respBody, &apiResp); err != nil {
+		return nil, fmt.Errorf("parse response: %w", err)
+	}
+
+	result := p.parseResponse(&apiResp)
+	if structuredTool != "" {
+		structuredAnswer(result, structuredTool)
+	}
+	return result, nil
+}
+
+// structuredAnswer moves the input of the forced structured-output tool
+// call into Content, so callers see a plain JSON answer.
+func structuredAnswer(resp *ChatResponse, toolName string) {
+	for _, tc := range resp.ToolCalls {
+		if tc.Name != toolName {
+			continue
+		}
+		data, err := json.Marshal(tc.Arguments)
+		if err != nil {
+			return
+		}
+		resp.Content = string(data)
+		resp.ToolCalls = nil
+		resp.FinishReason = "stop"
+		return
+	}
+}
+
+// convertMessages splits out the system prompt and converts the remaining
+// messages to Messages API content blocks. Tool results are sent as
+// tool_result blocks in a user turn, and consecutive turns with the same
+// role are merged because the API requires strict user/assistant alternation.
+func (p *AnthropicProvider) convertMessages(messages []Message) (string, []map[string]any) {
+	var systemParts []string
+	var result []map[string]any
+
+	appendBlocks := func(role string, blocks []map[string]any) {
+		if len(blocks) == 0 {
+			return
+		}
+		if n := len(result); n > 0 && result[n-1]["role"] == role {
+			result[n-1]["content"] = append(result[n-1]["content"].([]map[string]any), blocks...)
+			return
+		}
+		result = append(result, map[string]any{"role": role, "content": blocks})
+	}
+
+	for _, msg := range messages {
+		switch msg.Role {
+		case "system":
+			if msg.Content != "" {
+				systemParts = append(systemParts, msg.Content)
+			}
+		case "tool":
+			appendBlocks("user", []map[string]any{{
+				"type":        "tool_result",
+				"tool_use_id": msg.ToolCallID,
+				"content":     nonEmpty(msg.Content),
+			}})
+		case "assistant":
+			var blocks []map[string]any
+			if msg.Content != "" {
+				blocks = append(blocks, map[string]any{"type": "text", "text": msg.Content})
+			}
+			for _, tc := range msg.ToolCalls {
+				input := tc.Arguments
+				if input == nil {
+					input = map[string]any{}
+				}
+				blocks = append(blocks, map[string]any{
+					"type":  "tool_use",
+					"id":    tc.ID,
+					"name":  tc.Name,
+					"input": input,
+				})
+			}
+			appendBlocks("assistant", blocks)
+		default:
+			if len(msg.Parts) > 0 {
+				appendBlocks("user", p.convertParts(msg.Content, msg.Parts))
+				continue
+			}
+			appendBlocks("user", []map[string]any{{"type": "text", "text": nonEmpty(msg.Content)}})
+		}
+	}
+
+	return strings.Join(systemParts, "\n\n"), result
+}
+
+// anthropicImageTypes are the image formats the Messages API accepts.
+var anthropicImageTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/gif":  true,
+	"image/webp": true,
+}
+
+// convertParts builds user content blocks for a multimodal message. Images
+// and PDFs are sent as base64 image/document blocks, text files are inlined.
+func (p *AnthropicProvider) convertParts(content string, parts []ContentPart) []map[string]any {
+	var blocks []map[string]any
+	addText := func(text string) {
+		blocks = append(blocks, map[string]any{"type": "text", "text": text})
+	}
+	base64Source := func(part ContentPart, data []byte) map[string]any {
+		return map[string]any{
+			"type":       "base64",
+			"media_type": part.MimeType,
+			"data":       base64.StdEncoding.EncodeToString(data),
+		}
+	}
+
+	if strings.TrimSpace(content) != "" {
+		addText(content)
+	}
+	for _, part := range parts {
+		if part.Type == PartText {
+			addText(nonEmpty(part.Text))
+			continue
+		}
+		data, err := part.Bytes()
+		if err != nil {
+			addText(attachmentNote(part, err.Error()))
+			continue
+		}
+		switch {
+		case part.Type == PartImage && anthropicImageTypes[part.MimeType]:
+			blocks = append(blocks, map[string]any{"type": "image", "source": base64Source(part, data)})
+		case part.MimeType == "application/pdf":
+			blocks = append(blocks, map[string]any{"type": "document", "source": base64Source(part, data)})
+		case part.IsTextLike():
+			addText(inlineText(part, data))
+		default:
+			addText(attachmentNote(part, "unsupported type"))
+		}
+	}
+	if len(blocks) == 0 {
+		addText(nonEmpty(content))
+	}
+	return blocks
+}
+
+// convertTools converts OpenAI-style function definitions to Anthropic tools.
+// The last tool carries a cache breakpoint so the tool list is cached
+// together with the system prompt.
+func (p *AnthropicProvider) convertTools(defs []ToolDefinition) []map[string]any {
+	tools := make([]map[string]any, len(defs))
+	for i, def := range defs {
+		schema := def.Function.Parameters
+		if schema == nil {
+			schema = map[string]any{"type": "object", "properties": map[string]any{}}
+		}
+		tools[i] = map[string]any{
+			"name":         def.Function.Name,
+			"description":  def.Function.Description,
+			"input_schema": schema,
+		}
+	}
+	if len(tools) > 0 {
+		tools[len(tools)-1]["cache_control"] = map[string]any{"type": "ephemeral"}
+	}
+	return tools
+}
+
+// parseResponse converts the API response to our ChatResponse type.
+func (p *AnthropicProvider) parseResponse(resp *anthropicResponse) *ChatResponse {
+	var text strings.Builder
+	result := &ChatResponse{
+		FinishReason: anthropicStopReason(resp.StopReason),
+	}
+
+	for _, block := range resp.Content {
+		switch block.Type {
+		case "text":
+			text.WriteString(block.Text)
+		case "tool_use":
+			var args map[string]any
+			if len(block.Input) > 0 {
+				if err := json.Unmarshal(block.Input, &args); err != nil {
+					args = map[string]any{"raw": string(block.Input)}
+				}
+			}
+			result.ToolCalls = append(result.ToolCalls, ToolCall{
+				ID:        block.ID,
+				Name:      block.Name,
+				Arguments: args,
+			})
+		}
+	}
+	result.Content = text.String()
+
+	u := resp.Usage
+	prompt := u.InputTokens + u.CacheCreationInputTokens + u.CacheReadInputTokens
+	result.Usage = Usage{
+		PromptTokens:     prompt,
+		CompletionTokens: u.OutputTokens,
+		TotalTokens:      prompt + u.OutputTokens,
+		CachedTokens:     u.CacheReadInputTokens,
+	}
+
+	return result
+}
+
+// Transcribe is not supported by the Messages API.
+func (p *AnthropicProvider) Transcribe(ctx context.Context, req *AudioRequest) (*AudioResponse, error) {
+	return nil, fmt.Errorf("anthropic: transcription %w", ErrUnsupported)
+}
+
+// Speak is not supported by the Messages API.
+func (p *AnthropicProvider) Speak(ctx context.Context, req *TTSRequest) (*TTSResponse, error) {
+	return nil, fmt.Errorf("anthropic: speech synthesis %w", ErrUnsupported)
+}
+
+// anthropicModelName strips the OpenRouter-style "anthropic/" prefix so the
+// same model setting works for both routes.
+func anthropicModelName(model string) string {
+	return strings.TrimPrefix(model, "anthropic/")
+}
+
+// anthropicStopReason maps Messages API stop reasons to the OpenAI-style
+// finish reasons used throughout the agent.
+func anthropicStopReason(reason string) string {
+	switch reason {
+	case "end_turn", "stop_sequence":
+		return "stop"
+	case "tool_use":
+		return "tool_calls"
+	case "max_tokens":
+		return "length"
+	default:
+		return reason
+	}
+}
+
+// nonEmpty guards against empty text blocks, which the API rejects.
+func nonEmpty(s string) string {
+	if strings.TrimSpace(s) == "" {
+		return "(empty)"
+	}
+	return s
+}
+
+// Anthropic API response types
+type anthropicResponse struct {
+	ID         string                  `json:"id"`
+	Content    []anthropicContentBlock `json:"content"`
+	StopReason string                  `json:"stop_reason"`
+	Usage      anthropicUsage          `json:"usage"`
+}
+
+type anthropicContentBlock struct {
+	Type  string          `json:"type"`
+	Text  string          `json:"text,omitempty"`
+	ID    string          `json:"id,omitempty"`
+	Name  string          `json:"name,omitempty"`
+	Input json.RawMessage `json:"input,omitempty"`
+}
+
+type anthropicUsage struct {
+	InputTokens              int `json:"input_tokens"`
+	OutputTokens             int `json:"output_tokens"`
+	CacheCreationInputTokens int `json:"cache_creation_input_tokens"`
+	CacheReadInputTokens     int `json:"cache_read_input_tokens"`
+}
@@ -0,0 +1,164 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAnthropicProvider_ChatRequestAndResponse(t *testing.T) {
+	var got map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/messages" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		if r.Header.Get("x-api-key") != "test-key" {
+			t.Errorf("missing x-api-key header")
+		}
+		if r.Header.Get("anthropic-version") == "" {
+			t.Errorf("missing anthropic-version header")
+		}
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Fatalf("decode request: %v", err)
+		}
+		w.Write([]byte(`{
+			"id": "msg_1",
+			"content": [
+				{"type": "text", "text": "Let me check."},
+				{"type": "tool_use", "id": "toolu_2", "name": "list_dir", "input": {"path": "/tmp"}}
+			],
+			"stop_reason": "tool_use",
+			"usage": {"input_tokens": 20, "output_tokens": 7, "cache_creation_input_tokens": 5, "cache_read_input_tokens": 100}
+		}`))
+	}))
+	defer server.Close()
+
+	p := NewAnthropicProvider("test-key", server.URL, "anthropic/claude-sonnet-4-5")
+	resp, err := p.Chat(context.Background(), &ChatRequest{
+		Messages: []Message{
+			{Role: "system", Content: "You are a bot."},
+			{Role: "user", Content: "Read two files"},
+			{Role: "assistant", ToolCalls: []ToolCall{
+				{ID: "toolu_a", Name: "read_file", Arguments: map[string]any{"path": "a.txt"}},
+				{ID: "toolu_b", Name: "read_file", Arguments: map[string]any{"path": "b.txt"}},
+			}},
+			{Role: "tool", ToolCallID: "toolu_a", Content: "A"},
+			{Role: "tool", ToolCallID: "toolu_b", Content: "B"},
+		},
+		Tools: []ToolDefinition{{Type: "function", Function: FunctionDef{
+			Name:       "read_file",
+			Parameters: map[string]any{"type": "object"},
+		}}},
+		MaxTokens:   256,
+		Temperature: 0.7,
+	})
+	if err != nil {
+		t.Fatalf("Chat() error: %v", err)
+	}
+
+	// Request shape
+	if got["model"] != "claude-sonnet-4-5" {
+		t.Errorf("expected prefix-stripped model, got %v", got["model"])
+	}
+	system, _ := got["system"].([]any)
+	if len(system) != 1 || !strings.Contains(system[0].(map[string]any)["text"].(string), "You are a bot.") {
+		t.Errorf("expected top-level system prompt, got %v", got["system"])
+	}
+	msgs := got["messages"].([]any)
+	if len(msgs) != 3 {
+		t.Fatalf("expected 3 messages (user, assistant, merged tool results), got %d", len(msgs))
+	}
+	assistant := msgs[1].(map[string]any)["content"].([]any)
+	if len(assistant) != 2 || assistant[0].(map[string]any)["type"] != "tool_use" {
+		t.Errorf("expected two tool_use blocks, got %v", assistant)
+	}
+	results := msgs[2].(map[string]any)
+	if results["role"] != "user" {
+		t.Errorf("expected tool results in a user turn, got %v", results["role"])
+	}
+	blocks := results["content"].([]any)
+	if len(blocks) != 2 || blocks[1].(map[string]any)["tool_use_id"] != "toolu_b" {
+		t.Errorf("expected merged tool_result blocks, got %v", blocks)
+	}
+	tools := got["tools"].([]any)
+	if tools[0].(map[string]any)["input_schema"] == nil {
+		t.Errorf("expected input_schema on tool")
+	}
+
+	// Response mapping
+	if resp.Content != "Let me check." {
+		t.Errorf("unexpected content %q", resp.Content)
+	}
+	if resp.FinishReason != "tool_calls" {
+		t.Errorf("expected finish reason tool_calls, got %s", resp.FinishReason)
+	}
+	if len(resp.ToolCalls) != 1 || resp.ToolCalls[0].Arguments["path"] != "/tmp" {
+		t.Errorf("unexpected tool calls %+v", resp.ToolCalls)
+	}
+	if resp.Usage.PromptTokens != 125 || resp.Usage.CompletionTokens != 7 || resp.Usage.TotalTokens != 132 {
+		t.Errorf("unexpected usage %+v", resp.Usage)
+	}
+	if resp.Usage.CachedTokens != 100 {
+		t.Errorf("expected 100 cached tokens, got %d", resp.Usage.CachedTokens)
+	}
+}
+
+func TestAnthropicProvider_APIError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"type":"error","error":{"type":"invalid_request_error"}}`))
+	}))
+	defer server.Close()
+
+	p := NewAnthropicProvider("test-key", server.URL, "")
+	_, err := p.Chat(context.Background(), &ChatRequest{
+		Messages: []Message{{Role: "user", Content: "Hello"}},
+	})
+	if err == nil || !strings.Contains(err.Error(), "status 400") {
+		t.Fatalf("expected status 400 error, got %v", err)
+	}
+}
+
+func TestAnthropicStopReason(t *testing.T) {
+	cases := map[string]string{
+		"end_turn":      "stop",
+		"stop_sequence": "stop",
+		"tool_use":      "tool_calls",
+		"max_tokens":    "length",
+	}
+	for in, want := range cases {
+		if got := anthropicStopReason(in); got != want {
+			t.Errorf("anthropicStopReason(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestAnthropicProvider_MultimodalParts(t *testing.T) {
+	p := NewAnthropicProvider("k", "", "")
+	_, msgs := p.convertMessages([]Message{{
+		Role:    "user",
+		Content: "Summarize",
+		Parts: []ContentPart{
+			{Type: PartImage, MimeType: "image/jpeg", Name: "a.jpg", Data: []byte("jpg")},
+			{Type: PartFile, MimeType: "application/pdf", Name: "b.pdf", Data: []byte("%PDF")},
+			{Type: PartFile, MimeType: "application/zip", Name: "c.zip", Data: []byte("PK")},
+		},
+	}})
+
+	blocks := msgs[0]["content"].([]map[string]any)
+	if len(blocks) != 4 {
+		t.Fatalf("expected 4 blocks, got %d: %v", len(blocks), blocks)
+	}
+	if blocks[1]["type"] != "image" || blocks[2]["type"] != "document" {
+		t.Errorf("expected image and document blocks, got %v / %v", blocks[1]["type"], blocks[2]["type"])
+	}
+	if src := blocks[1]["source"].(map[string]any); src["media_type"] != "image/jpeg" || src["data"] != "anBn" {
+		t.Errorf("unexpected image source %v", src)
+	}
+	if !strings.Contains(blocks[3]["text"].(string), "c.zip") {
+		t.Errorf("expected text note for unsupported file, got %v", blocks[3])
+	}
+}
@@ -0,0 +1,134 @@
+package provider
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Cassette is a file of recorded provider interactions, written by a
+// Recorder and served back by a Replayer.
+type Cassette struct {
+	Version      int           `json:"version"`
+	Interactions []Interaction `json:"interactions"`
+}
+
+// Interaction is one recorded provider call. Request holds the normalized
+// request the Key was derived from, kept for reading and diffing cassettes.
+type Interaction struct {
+	Key        string          `json:"key"`
+	Op         string          `json:"op"` // "chat", "embed", "transcribe" or "speak"
+	RecordedAt time.Time       `json:"recorded_at"`
+	Request    json.RawMessage `json:"request"`
+	Response   json.RawMessage `json:"response,omitempty"`
+	Error      string          `json:"error,omitempty"`
+}
+
+const cassetteVersion = 1
+
+// LoadCassette reads a cassette file.
+func LoadCassette(path string) (*Cassette, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read cassette: %w", err)
+	}
+	var c Cassette
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("parse cassette %s: %w", path, err)
+	}
+	if c.Version != cassetteVersion {
+		return nil, fmt.Errorf("cassette %s has unsupported version %d", path, c.Version)
+	}
+	return &c, nil
+}
+
+// Save writes the cassette atomically.
+func (c *Cassette) Save(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("create cassette dir: %w", err)
+	}
+	c.Version = cassetteVersion
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal cassette: %w", err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("write cassette: %w", err)
+	}
+	return os.Rename(tmp, path)
+}
+
+// normalizedChat is the part of a ChatRequest that identifies it across
+// runs. System messages are left out because the system prompt embeds the
+// current time and RAG context; the model, sampling settings and tool call
+// IDs are left out so a cassette recorded against one backend replays
+// regardless of configuration.
+type normalizedChat struct {
+	Messages       []normalizedMessage `json:"messages"`
+	Tools          []string            `json:"tools,omitempty"`
+	ResponseFormat *ResponseFormat     `json:"response_format,omitempty"`
+}
+
+type normalizedMessage struct {
+	Role      string               `json:"role"`
+	Content   string               `json:"content,omitempty"`
+	ToolCalls []normalizedToolCall `json:"tool_calls,omitempty"`
+	Parts     []string             `json:"parts,omitempty"`
+}
+
+type normalizedToolCall struct {
+	Name      string         `json:"name"`
+	Arguments map[string]any `json:"arguments,omitempty"`
+}
+
+func normalizeChat(req *ChatRequest) normalizedChat {
+	var n normalizedChat
+	for _, m := range req.Messages {
+		if m.Role == "system" {
+			continue
+		}
+		nm := normalizedMessage{Role: m.Role, Content: strings.TrimSpace(m.Content)}
+		for _, tc := range m.ToolCalls {
+			nm.ToolCalls = append(nm.ToolCalls, normalizedToolCall{Name: tc.Name, Arguments: tc.Arguments})
+		}
+		for _, p := range m.Parts {
+			nm.Parts = append(nm.Parts, p.Type+":"+p.MimeType+":"+p.Name)
+		}
+		n.Messages = append(n.Messages, nm)
+	}
+	for _, t := range req.Tools {
+		n.Tools = append(n.Tools, t.Function.Name)
+	}
+	sort.Strings(n.Tools)
+	n.ResponseFormat = req.ResponseFormat
+	return n
+}
+
+// requestKey hashes an operation and its normalized request. It returns the
+// key and the normalized JSON.
+func requestKey(op string, normalized any) (string, json.RawMessage, error) {
+	data, err := json.Marshal(normalized)
+	if err != nil {
+		return "", nil, fmt.Errorf("normalize %s request: %w", op, err)
+	}
+	sum := sha256.Sum256(append([]byte(op+"\n"), data...))
+	return hex.EncodeToString(sum[:]), data, nil
+}
+
+// audioKeyRequest identifies a transcription by the audio content, not
+// the path, since media files get fresh names per download.
+func audioKeyRequest(req *AudioRequest) (map[string]string, error) {
+	data, err := os.ReadFile(req.FilePath)
+	if err != nil {
+		return nil, fmt.Errorf("read audio file: %w", err)
+	}
+	sum := sha256.Sum256(data)
+	return map[string]string{"audio_sha256": hex.EncodeToString(sum[:]), "model": req.Model}, nil
+}
@@ -0,0 +1,133 @@
+package provider
+
+import (
+	"encoding/base64"
+	"fmt"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Content part types for multimodal messages.
+const (
+	PartText  = "text"
+	PartImage = "image"
+	PartFile  = "file"
+)
+
+// MaxMediaBytes caps the size of a single attachment sent to a provider.
+const MaxMediaBytes = 20 << 20
+
+// MaxInlineTextChars caps a text-like attachment inlined into a message
+// (about 8000 tokens), so one log file cannot fill the context window.
+const MaxInlineTextChars = 32000
+
+// ContentPart is one typed piece of a multimodal message. Binary parts carry
+// their bytes in Data or reference a local file via Path; Path is resolved
+// lazily when the request is encoded.
+type ContentPart struct {
+	Type     string `json:"type"`
+	Text     string `json:"text,omitempty"`
+	Path     string `json:"path,omitempty"`
+	Data     []byte `json:"-"`
+	MimeType string `json:"mime_type,omitempty"`
+	Name     string `json:"name,omitempty"`
+}
+
+// TextPart returns a text content part.
+func TextPart(text string) ContentPart {
+	return ContentPart{Type: PartText, Text: text}
+}
+
+// MediaPart returns an image or file part for a local media file, based on
+// its MIME type. The file is checked but not read until encoding.
+func MediaPart(path string) (ContentPart, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return ContentPart{}, fmt.Errorf("stat media: %w", err)
+	}
+	if info.Size() > MaxMediaBytes {
+		return ContentPart{}, fmt.Errorf("media %s too large (%d bytes, max %d)", filepath.Base(path), info.Size(), MaxMediaBytes)
+	}
+
+	mimeType := mime.TypeByExtension(strings.ToLower(filepath.Ext(path)))
+	if mimeType == "" {
+		head := make([]byte, 512)
+		f, err := os.Open(path)
+		if err != nil {
+			return ContentPart{}, fmt.Errorf("open media: %w", err)
+		}
+		n, _ := f.Read(head)
+		f.Close()
+		mimeType = http.DetectContentType(head[:n])
+	}
+	mimeType, _, _ = strings.Cut(mimeType, ";")
+
+	partType := PartFile
+	if strings.HasPrefix(mimeType, "image/") {
+		partType = PartImage
+	}
+	return ContentPart{
+		Type:     partType,
+		Path:     path,
+		MimeType: mimeType,
+		Name:     filepath.Base(path),
+	}, nil
+}
+
+// Bytes returns the part's binary content, reading Path if needed.
+func (p ContentPart) Bytes() ([]byte, error) {
+	if p.Data != nil {
+		return p.Data, nil
+	}
+	if p.Path == "" {
+		return nil, fmt.Errorf("content part has no data")
+	}
+	data, err := os.ReadFile(p.Path)
+	if err != nil {
+		return nil, fmt.Errorf("read media: %w", err)
+	}
+	if len(data) > MaxMediaBytes {
+		return nil, fmt.Errorf("media %s too large (%d bytes, max %d)", p.Name, len(data), MaxMediaBytes)
+	}
+	return data, nil
+}
+
+// IsTextLike reports whether a file part can be inlined as plain text.
+func (p ContentPart) IsTextLike() bool {
+	m := p.MimeType
+	return strings.HasPrefix(m, "text/") ||
+		m == "application/json" ||
+		m == "application/xml" ||
+		m == "application/yaml" ||
+		m == "application/x-yaml"
+}
+
+// dataURL encodes data as a base64 data: URL.
+func dataURL(mimeType string, data []byte) string {
+	return "data:" + mimeType + ";base64," + base64.StdEncoding.EncodeToString(data)
+}
+
+// attachmentNote is the text stand-in for a part a provider cannot accept.
+func attachmentNote(p ContentPart, reason string) string {
+	name := p.Name
+	if name == "" {
+		name = p.Type
+	}
+	if reason != "" {
+		return fmt.Sprintf("[Attachment %s (%s) not included: %s]", name, p.MimeType, reason)
+	}
+	return fmt.Sprintf("[Attachment %s (%s)]", name, p.MimeType)
+}
+
+// inlineText renders a text-like file part as a labelled text block, cut
+// at MaxInlineTextChars.
+func inlineText(p ContentPart, data []byte) string {
+	if len(data) <= MaxInlineTextChars {
+		return fmt.Sprintf("File %s:\n%s", p.Name, string(data))
+	}
+	return fmt.Sprintf("File %s:\n%s\n[file cut at %d of %d characters]",
+		p.Name, strings.ToValidUTF8(string(data[:MaxInlineTextChars]), ""), MaxInlineTextChars, len(data))
+}
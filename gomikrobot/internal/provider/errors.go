@@ -0,0 +1,48 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+)
+
+// APIError is returned when a provider API answers with a non-200 status.
+type APIError struct {
+	// API names the endpoint family in the message, e.g. "Whisper" or "TTS".
+	API        string
+	StatusCode int
+	Body       string
+	// RetryAfter is the wait requested by the server on 429/503, if any.
+	RetryAfter time.Duration
+}
+
+func (e *APIError) Error() string {
+	prefix := "API error"
+	if e.API != "" {
+		prefix = e.API + " API error"
+	}
+	return fmt.Sprintf("%s (status %d): %s", prefix, e.StatusCode, e.Body)
+}
+
+// IsTransient reports whether err is worth trying again or elsewhere:
+// rate limits (429), server errors (5xx), timeouts and connection failures.
+// Client errors such as 400 or 401 and cancellations by the caller are not.
+func IsTransient(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode == http.StatusTooManyRequests ||
+			apiErr.StatusCode == http.StatusRequestTimeout ||
+			apiErr.StatusCode >= 500
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
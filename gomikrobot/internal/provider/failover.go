@@ -0,0 +1,330 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// FailoverTarget is one backend in a FailoverProvider chain.
+type FailoverTarget struct {
+	// Name labels the backend in traces and logs, e.g. "openrouter".
+	Name     string
+	Provider LLMProvider
+	// Model overrides the requested model for this backend when set.
+	Model string
+}
+
+// TargetHealth is a snapshot of a backend's circuit breaker.
+type TargetHealth struct {
+	Name      string    `json:"name"`
+	Model     string    `json:"model"`
+	State     string    `json:"state"` // "closed", "open" or "half-open"
+	Failures  int       `json:"failures"`
+	LastError string    `json:"last_error,omitempty"`
+	OpenUntil time.Time `json:"open_until,omitempty"`
+}
+
+// failoverBackend pairs a target with its circuit breaker state.
+type failoverBackend struct {
+	FailoverTarget
+	failures  int
+	openUntil time.Time
+	lastError string
+}
+
+// FailoverProvider tries an ordered list of backends and moves on to the
+// next one when a call fails with a transient error (5xx, 429, timeout).
+// Each backend has a circuit breaker: after FailureThreshold consecutive
+// transient failures it is skipped for Cooldown, then given one trial call.
+type FailoverProvider struct {
+	FailureThreshold int
+	Cooldown         time.Duration
+
+	backends []*failoverBackend
+	mu       sync.Mutex
+	now      func() time.Time
+}
+
+// retryPolicySetter is implemented by providers with their own retries.
+type retryPolicySetter interface {
+	SetRetryPolicy(RetryPolicy)
+}
+
+// NewFailoverProvider creates a failover chain over the given targets.
+// Backends that retry on their own are set to a single attempt, except the
+// last one: a rate-limited backend would otherwise wait out Retry-After
+// before the chain moves on.
+func NewFailoverProvider(targets []FailoverTarget) *FailoverProvider {
+	backends := make([]*failoverBackend, len(targets))
+	for i, t := range targets {
+		backends[i] = &failoverBackend{FailoverTarget: t}
+		if rp, ok := t.Provider.(retryPolicySetter); ok && i < len(targets)-1 {
+			rp.SetRetryPolicy(RetryPolicy{MaxAttempts: 1})
+		}
+	}
+	return &FailoverProvider{
+		FailureThreshold: 3,
+		Cooldown:         60 * time.Second,
+		backends:         backends,
+		now:              time.Now,
+	}
+}
+
+// DefaultModel returns the model of the first backend.
+func (p *FailoverProvider) DefaultModel() string {
+	if len(p.backends) == 0 {
+		return ""
+	}
+	if p.backends[0].Model != "" {
+		return p.backends[0].Model
+	}
+	return p.backends[0].Provider.DefaultModel()
+}
+
+// Chat sends the request to the first healthy backend, failing over on
+// transient errors. The response records which backend served it.
+func (p *FailoverProvider) Chat(ctx context.Context, req *ChatRequest) (*ChatResponse, error) {
+	var resp *ChatResponse
+	err := p.each(ctx, func(b *failoverBackend) error {
+		r, err := b.Provider.Chat(ctx, p.requestFor(b, req))
+		if err != nil {
+			return err
+		}
+		resp = p.stamp(b, r, req)
+		return nil
+	})
+	return resp, err
+}
+
+// ChatStream streams from the first healthy backend. Once a backend has
+// emitted output the call is committed to it, since partial text has
+// already reached the caller.
+func (p *FailoverProvider) ChatStream(ctx context.Context, req *ChatRequest, onDelta func(StreamDelta)) (*ChatResponse, error) {
+	var resp *ChatResponse
+	started := false
+	err := p.each(ctx, func(b *failoverBackend) error {
+		r, err := StreamChat(ctx, b.Provider, p.requestFor(b, req), func(d StreamDelta) {
+			started = true
+			if onDelta != nil {
+				onDelta(d)
+			}
+		})
+		if err != nil {
+			if started {
+				return &committedError{err}
+			}
+			return err
+		}
+		resp = p.stamp(b, r, req)
+		return nil
+	})
+	var committed *committedError
+	if errors.As(err, &committed) {
+		err = committed.err
+	}
+	return resp, err
+}
+
+// Transcribe fails over across backends like Chat. Backends without
+// transcription are passed over.
+func (p *FailoverProvider) Transcribe(ctx context.Context, req *AudioRequest) (*AudioResponse, error) {
+	var resp *AudioResponse
+	err := p.each(ctx, func(b *failoverBackend) error {
+		r, err := b.Provider.Transcribe(ctx, req)
+		resp = r
+		return skipUnsupported(err)
+	})
+	if errors.Is(err, errSkipBackend) {
+		return nil, fmt.Errorf("failover: transcription %w by any provider", ErrUnsupported)
+	}
+	return resp, err
+}
+
+// Speak fails over across backends like Chat. Backends without speech
+// synthesis are passed over.
+func (p *FailoverProvider) Speak(ctx context.Context, req *TTSRequest) (*TTSResponse, error) {
+	var resp *TTSResponse
+	err := p.each(ctx, func(b *failoverBackend) error {
+		r, err := b.Provider.Speak(ctx, req)
+		resp = r
+		return skipUnsupported(err)
+	})
+	if errors.Is(err, errSkipBackend) {
+		return nil, fmt.Errorf("failover: speech synthesis %w by any provider", ErrUnsupported)
+	}
+	return resp, err
+}
+
+// skipUnsupported turns the error of a backend lacking the capability into
+// errSkipBackend.
+func skipUnsupported(err error) error {
+	if errors.Is(err, ErrUnsupported) {
+		return errSkipBackend
+	}
+	return err
+}
+
+// Embed uses the first backend that supports embeddings, failing over
+// among embedding-capable backends.
+func (p *FailoverProvider) Embed(ctx context.Context, req *EmbeddingRequest) (*EmbeddingResponse, error) {
+	var resp *EmbeddingResponse
+	tried := false
+	err := p.each(ctx, func(b *failoverBackend) error {
+		emb, ok := AsEmbedder(b.Provider)
+		if !ok {
+			return errSkipBackend
+		}
+		tried = true
+		r, err := emb.Embed(ctx, req)
+		resp = r
+		return err
+	})
+	if !tried {
+		return nil, fmt.Errorf("no embedding-capable provider in failover chain")
+	}
+	return resp, err
+}
+
+// CanEmbed reports whether any backend supports embeddings, so the chain
+// only counts as an Embedder (see AsEmbedder) when one does.
+func (p *FailoverProvider) CanEmbed() bool {
+	for _, b := range p.backends {
+		if _, ok := AsEmbedder(b.Provider); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Health returns a snapshot of every backend's breaker state.
+func (p *FailoverProvider) Health() []TargetHealth {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := p.now()
+	out := make([]TargetHealth, len(p.backends))
+	for i, b := range p.backends {
+		state := "closed"
+		if !b.openUntil.IsZero() {
+			state = "open"
+			if !now.Before(b.openUntil) {
+				state = "half-open"
+			}
+		}
+		out[i] = TargetHealth{
+			Name:      b.Name,
+			Model:     b.Model,
+			State:     state,
+			Failures:  b.failures,
+			LastError: b.lastError,
+			OpenUntil: b.openUntil,
+		}
+	}
+	return out
+}
+
+// errSkipBackend lets a call function pass over a backend that cannot
+// serve the request without counting it as a failure.
+var errSkipBackend = errors.New("backend skipped")
+
+// committedError marks a failure after which no other backend may be tried.
+type committedError struct{ err error }
+
+func (e *committedError) Error() string { return e.err.Error() }
+func (e *committedError) Unwrap() error { return e.err }
+
+// each runs call against the backends in order until one succeeds or fails
+// with a non-transient error. Backends with an open breaker are skipped,
+// unless every breaker is open, in which case all are tried as last resort.
+func (p *FailoverProvider) each(ctx context.Context, call func(b *failoverBackend) error) error {
+	if len(p.backends) == 0 {
+		return fmt.Errorf("failover: no providers configured")
+	}
+
+	candidates := p.available()
+	if len(candidates) == 0 {
+		candidates = p.backends
+	}
+
+	var lastErr error
+	for _, b := range candidates {
+		err := call(b)
+		if err == nil {
+			p.recordSuccess(b)
+			return nil
+		}
+		if errors.Is(err, errSkipBackend) {
+			continue
+		}
+		var committed *committedError
+		if errors.As(err, &committed) || !IsTransient(err) || ctx.Err() != nil {
+			return err
+		}
+		p.recordFailure(b, err)
+		slog.Warn("Provider failed, trying next", "provider", b.Name, "error", err)
+		lastErr = err
+	}
+	if lastErr == nil {
+		return errSkipBackend
+	}
+	return fmt.Errorf("all providers failed: %w", lastErr)
+}
+
+// available returns the backends whose breaker is closed or half-open.
+func (p *FailoverProvider) available() []*failoverBackend {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := p.now()
+	var out []*failoverBackend
+	for _, b := range p.backends {
+		if b.openUntil.IsZero() || !now.Before(b.openUntil) {
+			out = append(out, b)
+		}
+	}
+	return out
+}
+
+func (p *FailoverProvider) recordSuccess(b *failoverBackend) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !b.openUntil.IsZero() {
+		slog.Info("Provider circuit closed", "provider", b.Name)
+	}
+	b.failures = 0
+	b.openUntil = time.Time{}
+}
+
+func (p *FailoverProvider) recordFailure(b *failoverBackend, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	b.failures++
+	b.lastError = err.Error()
+	halfOpen := !b.openUntil.IsZero()
+	if halfOpen || b.failures >= p.FailureThreshold {
+		b.openUntil = p.now().Add(p.Cooldown)
+		slog.Warn("Provider circuit opened", "provider", b.Name, "failures", b.failures, "cooldown", p.Cooldown)
+	}
+}
+
+// requestFor applies the backend's model override to a copy of req.
+func (p *FailoverProvider) requestFor(b *failoverBackend, req *ChatRequest) *ChatRequest {
+	if b.Model == "" {
+		return req
+	}
+	r := *req
+	r.Model = b.Model
+	return &r
+}
+
+// stamp records the serving backend on the response.
+func (p *FailoverProvider) stamp(b *failoverBackend, resp *ChatResponse, req *ChatRequest) *ChatResponse {
+	resp.Provider = b.Name
+	resp.Model = p.requestFor(b, req).Model
+	if resp.Model == "" {
+		resp.Model = b.Provider.DefaultModel()
+	}
+	return resp
+}
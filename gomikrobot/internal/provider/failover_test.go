@@ -0,0 +1,188 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// stubProvider returns a fixed error or content and counts calls.
+type stubProvider struct {
+	err     error
+	content string
+	calls   int
+	model   string
+}
+
+func (s *stubProvider) Chat(_ context.Context, req *ChatRequest) (*ChatResponse, error) {
+	s.calls++
+	s.model = req.Model
+	if s.err != nil {
+		return nil, s.err
+	}
+	return &ChatResponse{Content: s.content}, nil
+}
+func (s *stubProvider) Transcribe(context.Context, *AudioRequest) (*AudioResponse, error) {
+	return nil, s.err
+}
+func (s *stubProvider) Speak(context.Context, *TTSRequest) (*TTSResponse, error) { return nil, s.err }
+func (s *stubProvider) DefaultModel() string                                     { return "stub" }
+
+func TestFailoverProvider_FailsOverOnTransientErrors(t *testing.T) {
+	for _, failure := range []error{
+		&APIError{StatusCode: 503, Body: "overloaded"},
+		&APIError{StatusCode: 429, Body: "slow down"},
+		context.DeadlineExceeded,
+	} {
+		primary := &stubProvider{err: failure}
+		secondary := &stubProvider{content: "from backup"}
+		p := NewFailoverProvider([]FailoverTarget{
+			{Name: "openrouter", Provider: primary, Model: "m1"},
+			{Name: "groq", Provider: secondary, Model: "m2"},
+		})
+
+		resp, err := p.Chat(context.Background(), &ChatRequest{Model: "requested"})
+		if err != nil {
+			t.Fatalf("%v: Chat() error: %v", failure, err)
+		}
+		if resp.Content != "from backup" || resp.Provider != "groq" || resp.Model != "m2" {
+			t.Errorf("%v: unexpected response %+v", failure, resp)
+		}
+		if primary.model != "m1" || secondary.model != "m2" {
+			t.Errorf("expected per-target model overrides, got %q/%q", primary.model, secondary.model)
+		}
+	}
+}
+
+func TestFailoverProvider_DoesNotFailOverOnClientErrors(t *testing.T) {
+	primary := &stubProvider{err: &APIError{StatusCode: 400, Body: "bad request"}}
+	secondary := &stubProvider{content: "unused"}
+	p := NewFailoverProvider([]FailoverTarget{
+		{Name: "a", Provider: primary},
+		{Name: "b", Provider: secondary},
+	})
+
+	_, err := p.Chat(context.Background(), &ChatRequest{})
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != 400 {
+		t.Fatalf("expected the 400 error to be returned, got %v", err)
+	}
+	if secondary.calls != 0 {
+		t.Errorf("secondary must not be called for a fatal error")
+	}
+}
+
+func TestFailoverProvider_CircuitBreaker(t *testing.T) {
+	primary := &stubProvider{err: &APIError{StatusCode: 500}}
+	secondary := &stubProvider{content: "ok"}
+	p := NewFailoverProvider([]FailoverTarget{
+		{Name: "a", Provider: primary},
+		{Name: "b", Provider: secondary},
+	})
+	p.FailureThreshold = 2
+	p.Cooldown = time.Minute
+	now := time.Now()
+	p.now = func() time.Time { return now }
+
+	for i := 0; i < 4; i++ {
+		if _, err := p.Chat(context.Background(), &ChatRequest{}); err != nil {
+			t.Fatalf("Chat() error: %v", err)
+		}
+	}
+	if primary.calls != 2 {
+		t.Errorf("expected breaker to stop calls after 2 failures, got %d calls", primary.calls)
+	}
+	if h := p.Health(); h[0].State != "open" || h[1].State != "closed" {
+		t.Errorf("unexpected health %+v", h)
+	}
+
+	// After the cooldown the backend gets one trial call and recovers.
+	now = now.Add(2 * time.Minute)
+	primary.err = nil
+	primary.content = "recovered"
+	resp, err := p.Chat(context.Background(), &ChatRequest{})
+	if err != nil || resp.Provider != "a" {
+		t.Fatalf("expected half-open trial to succeed on a, got %+v %v", resp, err)
+	}
+	if h := p.Health(); h[0].State != "closed" || h[0].Failures != 0 {
+		t.Errorf("expected breaker to close, got %+v", h[0])
+	}
+}
+
+func TestFailoverProvider_AllFail(t *testing.T) {
+	p := NewFailoverProvider([]FailoverTarget{
+		{Name: "a", Provider: &stubProvider{err: &APIError{StatusCode: 502}}},
+		{Name: "b", Provider: &stubProvider{err: &APIError{StatusCode: 503}}},
+	})
+	_, err := p.Chat(context.Background(), &ChatRequest{})
+	if err == nil || !strings.Contains(err.Error(), "all providers failed") || !strings.Contains(err.Error(), "503") {
+		t.Fatalf("expected aggregated failure, got %v", err)
+	}
+}
+
+func TestFailoverProvider_SkipsBackendsWithoutCapability(t *testing.T) {
+	claude := NewAnthropicProvider("key", "", "claude-sonnet-4-5")
+	p := NewFailoverProvider([]FailoverTarget{
+		{Name: "anthropic", Provider: claude},
+		{Name: "openai", Provider: &embedStub{}},
+	})
+	audio, err := p.Transcribe(context.Background(), &AudioRequest{})
+	if err != nil || audio.Text != "transcribed" {
+		t.Fatalf("expected transcription by the second backend, got %+v, %v", audio, err)
+	}
+	if _, ok := AsEmbedder(p); !ok {
+		t.Error("chain with an embedding backend should embed")
+	}
+	if h := p.Health(); h[0].Failures != 0 {
+		t.Errorf("an unsupported call must not count as a failure: %+v", h[0])
+	}
+
+	only := NewFailoverProvider([]FailoverTarget{{Name: "anthropic", Provider: claude}})
+	if _, err := only.Speak(context.Background(), &TTSRequest{}); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("expected ErrUnsupported, got %v", err)
+	}
+	if _, ok := AsEmbedder(only); ok {
+		t.Error("chain without an embedding backend must not embed")
+	}
+}
+
+func TestFailoverProvider_DoesNotWaitOutRateLimits(t *testing.T) {
+	primaryCalls := 0
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		primaryCalls++
+		w.Header().Set("Retry-After", "20")
+		w.WriteHeader(http.StatusTooManyRequests)
+		w.Write([]byte("rate limited"))
+	}))
+	defer primary.Close()
+	secondary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"choices":[{"message":{"content":"from backup"},"finish_reason":"stop"}]}`))
+	}))
+	defer secondary.Close()
+
+	first := NewOpenAIProvider("k", primary.URL, "m1")
+	last := NewOpenAIProvider("k", secondary.URL, "m2")
+	p := NewFailoverProvider([]FailoverTarget{
+		{Name: "openai", Provider: first},
+		{Name: "openrouter", Provider: last},
+	})
+
+	start := time.Now()
+	resp, err := p.Chat(context.Background(), &ChatRequest{})
+	if err != nil {
+		t.Fatalf("Chat() error: %v", err)
+	}
+	if resp.Content != "from backup" || resp.Provider != "openrouter" {
+		t.Errorf("unexpected response %+v", resp)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second || primaryCalls != 1 {
+		t.Errorf("expected one attempt on the primary and no wait, got %d calls in %v", primaryCalls, elapsed)
+	}
+	if last.retry != DefaultRetryPolicy {
+		t.Errorf("the last backend should keep its retries, got %+v", last.retry)
+	}
+}
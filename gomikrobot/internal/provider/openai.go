@@ -1,6 +1,7 @@
 package provider
 
 import (
+	"bufio"
 	"bytes"
 	"context"
 	"encoding/json"
@@ -21,6 +22,7 @@ type OpenAIProvider struct {
 	apiBase      string
 	defaultModel string
 	httpClient   *http.Client
+	retry        RetryPolicy
 }
 
 // NewOpenAIProvider creates a new OpenAI-compatible provider.
@@ -38,9 +40,15 @@ func NewOpenAIProvider(apiKey, apiBase, defaultModel string) *OpenAIProvider {
 		httpClient: &http.Client{
 			Timeout: 120 * time.Second,
 		},
+		retry: DefaultRetryPolicy,
 	}
 }
 
+// SetRetryPolicy replaces the retry policy for transient API failures.
+func (p *OpenAIProvider) SetRetryPolicy(policy RetryPolicy) {
+	p.retry = policy
+}
+
 // DefaultModel returns the configured default model.
 func (p *OpenAIProvider) DefaultModel() string {
 	return p.defaultModel
@@ -48,15 +56,48 @@ func (p *OpenAIProvider) DefaultModel() string {
 
 // Chat sends a completion request to the OpenAI-compatible API.
 func (p *OpenAIProvider) Chat(ctx context.Context, req *ChatRequest) (*ChatResponse, error) {
+	jsonBody, err := json.Marshal(p.buildChatBody(req))
+	if err != nil {
+		return nil, fmt.Errorf("marshal request: %w", err)
+	}
+
+	// Execute request, retrying transient failures
+	resp, err := p.do(ctx, "chat", "", p.newRequest(ctx, "/chat/completions", "application/json", jsonBody))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read response: %w", err)
+	}
+
+	// Parse response
+	var apiResp openAIResponse
+	if err := json.Unmarshal(respBody, &apiResp); err != nil {
+		return nil, fmt.Errorf("parse response: %w", err)
+	}
+
+	return p.parseResponse(&apiResp)
+}
+
+// buildChatBody builds the /chat/completions request body.
+func (p *OpenAIProvider) buildChatBody(req *ChatRequest) map[string]any {
 	model := req.Model
 	if model == "" {
 		model = p.defaultModel
 	}
 
-	// Build request body
+	messages := req.Messages
+	if f := req.ResponseFormat; f != nil && f.Type == FormatJSON {
+		// json_object mode is rejected unless the messages mention JSON.
+		messages = withSystemInstruction(messages, f.instruction())
+	}
+
 	body := map[string]any{
 		"model":       model,
-		"messages":    p.convertMessages(req.Messages),
+		"messages":    p.convertMessages(messages),
 		"max_tokens":  req.MaxTokens,
 		"temperature": req.Temperature,
 	}
@@ -65,44 +106,130 @@ func (p *OpenAIProvider) Chat(ctx context.Context, req *ChatRequest) (*ChatRespo
 		body["tools"] = req.Tools
 		body["tool_choice"] = "auto"
 	}
+	if f := req.ResponseFormat; f != nil {
+		switch f.Type {
+		case FormatJSONSchema:
+			name := f.Name
+			if name == "" {
+				name = "response"
+			}
+			body["response_format"] = map[string]any{
+				"type": FormatJSONSchema,
+				"json_schema": map[string]any{
+					"name":   name,
+					"schema": f.Schema,
+					"strict": f.Strict,
+				},
+			}
+		case FormatJSON:
+			body["response_format"] = map[string]any{"type": FormatJSON}
+		}
+	}
+	return body
+}
+
+// ChatStream sends a streaming completion request and reports content and
+// tool-call fragments through onDelta as server-sent events arrive.
+func (p *OpenAIProvider) ChatStream(ctx context.Context, req *ChatRequest, onDelta func(StreamDelta)) (*ChatResponse, error) {
+	body := p.buildChatBody(req)
+	body["stream"] = true
+	body["stream_options"] = map[string]any{"include_usage": true}
 
 	jsonBody, err := json.Marshal(body)
 	if err != nil {
 		return nil, fmt.Errorf("marshal request: %w", err)
 	}
 
-	// Create HTTP request
-	httpReq, err := http.NewRequestWithContext(ctx, "POST", p.apiBase+"/chat/completions", bytes.NewReader(jsonBody))
+	// Only establishing the stream is retried; once events flow, a broken
+	// stream is returned to the caller.
+	newReq := p.newRequest(ctx, "/chat/completions", "application/json", jsonBody)
+	resp, err := p.do(ctx, "chat_stream", "", func() (*http.Request, error) {
+		httpReq, err := newReq()
+		if err == nil {
+			httpReq.Header.Set("Accept", "text/event-stream")
+		}
+		return httpReq, err
+	})
 	if err != nil {
-		return nil, fmt.Errorf("create request: %w", err)
+		return nil, err
 	}
+	defer resp.Body.Close()
 
-	httpReq.Header.Set("Content-Type", "application/json")
-	httpReq.Header.Set("Authorization", "Bearer "+p.apiKey)
+	var (
+		content      strings.Builder
+		finishReason string
+		usage        Usage
+		calls        []*openAIToolCall
+	)
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if !strings.HasPrefix(line, "data:") {
+			continue // comments, event names and keep-alives
+		}
+		data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		if data == "[DONE]" {
+			break
+		}
 
-	// Execute request
-	resp, err := p.httpClient.Do(httpReq)
-	if err != nil {
-		return nil, fmt.Errorf("execute request: %w", err)
+		var chunk openAIStreamChunk
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return nil, fmt.Errorf("parse stream chunk: %w", err)
+		}
+		if chunk.Usage != nil {
+			usage = chunk.Usage.toUsage()
+		}
+		for _, choice := range chunk.Choices {
+			if choice.FinishReason != "" {
+				finishReason = choice.FinishReason
+			}
+			if choice.Delta.Content != "" {
+				content.WriteString(choice.Delta.Content)
+				if onDelta != nil {
+					onDelta(StreamDelta{Content: choice.Delta.Content})
+				}
+			}
+			for _, tc := range choice.Delta.ToolCalls {
+				for len(calls) <= tc.Index {
+					calls = append(calls, &openAIToolCall{Type: "function"})
+				}
+				call := calls[tc.Index]
+				if tc.ID != "" {
+					call.ID = tc.ID
+				}
+				if tc.Function.Name != "" {
+					call.Function.Name = tc.Function.Name
+				}
+				call.Function.Arguments += tc.Function.Arguments
+				if onDelta != nil {
+					onDelta(StreamDelta{ToolCall: &ToolCallDelta{
+						Index:     tc.Index,
+						ID:        tc.ID,
+						Name:      tc.Function.Name,
+						Arguments: tc.Function.Arguments,
+					}})
+				}
+			}
+		}
 	}
-	defer resp.Body.Close()
-
-	respBody, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("read response: %w", err)
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read stream: %w", err)
 	}
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("API error (status %d): %s", resp.StatusCode, string(respBody))
+	msg := openAIMessage{Role: "assistant", Content: content.String()}
+	for _, call := range calls {
+		msg.ToolCalls = append(msg.ToolCalls, *call)
 	}
-
-	// Parse response
-	var apiResp openAIResponse
-	if err := json.Unmarshal(respBody, &apiResp); err != nil {
-		return nil, fmt.Errorf("parse response: %w", err)
+	result, err := p.parseResponse(&openAIResponse{
+		Choices: []openAIChoice{{Message: msg, FinishReason: finishReason}},
+	})
+	if err != nil {
+		return nil, err
 	}
-
-	return p.parseResponse(&apiResp)
+	result.Usage = usage
+	return result, nil
 }
 
 // convertMessages converts our Message type to OpenAI API format.
@@ -113,6 +240,9 @@ func (p *OpenAIProvider) convertMessages(messages []Message) []map[string]any {
 			"role":    msg.Role,
 			"content": msg.Content,
 		}
+		if len(msg.Parts) > 0 {
+			m["content"] = p.convertParts(msg.Content, msg.Parts)
+		}
 		if msg.ToolCallID != "" {
 			m["tool_call_id"] = msg.ToolCallID
 		}
@@ -136,6 +266,49 @@ func (p *OpenAIProvider) convertMessages(messages []Message) []map[string]any {
 	return result
 }
 
+// convertParts builds an OpenAI content array. Images become image_url
+// parts, PDFs become file parts, and text files are inlined.
+func (p *OpenAIProvider) convertParts(content string, parts []ContentPart) []map[string]any {
+	var out []map[string]any
+	addText := func(text string) {
+		out = append(out, map[string]any{"type": "text", "text": text})
+	}
+	if content != "" {
+		addText(content)
+	}
+	for _, part := range parts {
+		if part.Type == PartText {
+			addText(part.Text)
+			continue
+		}
+		data, err := part.Bytes()
+		if err != nil {
+			addText(attachmentNote(part, err.Error()))
+			continue
+		}
+		switch {
+		case part.Type == PartImage:
+			out = append(out, map[string]any{
+				"type":      "image_url",
+				"image_url": map[string]any{"url": dataURL(part.MimeType, data)},
+			})
+		case part.IsTextLike():
+			addText(inlineText(part, data))
+		case part.MimeType == "application/pdf":
+			out = append(out, map[string]any{
+				"type": "file",
+				"file": map[string]any{
+					"filename":  part.Name,
+					"file_data": dataURL(part.MimeType, data),
+				},
+			})
+		default:
+			addText(attachmentNote(part, "unsupported type"))
+		}
+	}
+	return out
+}
+
 // parseResponse converts the API response to our ChatResponse type.
 func (p *OpenAIProvider) parseResponse(resp *openAIResponse) (*ChatResponse, error) {
 	if len(resp.Choices) == 0 {
@@ -146,11 +319,7 @@ func (p *OpenAIProvider) parseResponse(resp *openAIResponse) (*ChatResponse, err
 	result := &ChatResponse{
 		Content:      choice.Message.Content,
 		FinishReason: choice.FinishReason,
-		Usage: Usage{
-			PromptTokens:     resp.Usage.PromptTokens,
-			CompletionTokens: resp.Usage.CompletionTokens,
-			TotalTokens:      resp.Usage.TotalTokens,
-		},
+		Usage:        resp.Usage.toUsage(),
 	}
 
 	// Parse tool calls
@@ -174,11 +343,27 @@ func (p *OpenAIProvider) parseResponse(resp *openAIResponse) (*ChatResponse, err
 // OpenAI API response types
 type openAIResponse struct {
 	Choices []openAIChoice `json:"choices"`
-	Usage   struct {
-		PromptTokens     int `json:"prompt_tokens"`
-		CompletionTokens int `json:"completion_tokens"`
-		TotalTokens      int `json:"total_tokens"`
-	} `json:"usage"`
+	Usage   openAIUsage    `json:"usage"`
+}
+
+// openAIUsage is the token usage of a completion. Prompt caching is
+// reported in prompt_tokens_details.
+type openAIUsage struct {
+	PromptTokens        int `json:"prompt_tokens"`
+	CompletionTokens    int `json:"completion_tokens"`
+	TotalTokens         int `json:"total_tokens"`
+	PromptTokensDetails struct {
+		CachedTokens int `json:"cached_tokens"`
+	} `json:"prompt_tokens_details"`
+}
+
+func (u *openAIUsage) toUsage() Usage {
+	return Usage{
+		PromptTokens:     u.PromptTokens,
+		CompletionTokens: u.CompletionTokens,
+		TotalTokens:      u.TotalTokens,
+		CachedTokens:     u.PromptTokensDetails.CachedTokens,
+	}
 }
 
 type openAIChoice struct {
@@ -201,6 +386,25 @@ type openAIToolCall struct {
 	} `json:"function"`
 }
 
+// openAIStreamChunk is one server-sent event of a streamed completion.
+type openAIStreamChunk struct {
+	Choices []struct {
+		Delta struct {
+			Content   string `json:"content"`
+			ToolCalls []struct {
+				Index    int    `json:"index"`
+				ID       string `json:"id"`
+				Function struct {
+					Name      string `json:"name"`
+					Arguments string `json:"arguments"`
+				} `json:"function"`
+			} `json:"tool_calls"`
+		} `json:"delta"`
+		FinishReason string `json:"finish_reason"`
+	} `json:"choices"`
+	Usage *openAIUsage `json:"usage"`
+}
+
 // Transcribe converts audio to text using OpenAI Whisper API.
 func (p *OpenAIProvider) Transcribe(ctx context.Context, req *AudioRequest) (*AudioResponse, error) {
 	model := req.Model
@@ -231,17 +435,9 @@ func (p *OpenAIProvider) Transcribe(ctx context.Context, req *AudioRequest) (*Au
 		return nil, fmt.Errorf("close form writer: %w", err)
 	}
 
-	httpReq, err := http.NewRequestWithContext(ctx, "POST", p.apiBase+"/audio/transcriptions", body)
-	if err != nil {
-		return nil, fmt.Errorf("create request: %w", err)
-	}
-
-	httpReq.Header.Set("Content-Type", writer.FormDataContentType())
-	httpReq.Header.Set("Authorization", "Bearer "+p.apiKey)
-
-	resp, err := p.httpClient.Do(httpReq)
+	resp, err := p.do(ctx, "transcribe", "Whisper", p.newRequest(ctx, "/audio/transcriptions", writer.FormDataContentType(), body.Bytes()))
 	if err != nil {
-		return nil, fmt.Errorf("execute request: %w", err)
+		return nil, err
 	}
 	defer resp.Body.Close()
 
@@ -250,10 +446,6 @@ func (p *OpenAIProvider) Transcribe(ctx context.Context, req *AudioRequest) (*Au
 		return nil, fmt.Errorf("read response: %w", err)
 	}
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("Whisper API error (status %d): %s", resp.StatusCode, string(respBody))
-	}
-
 	var audioResp struct {
 		Text string `json:"text"`
 	}
@@ -281,17 +473,9 @@ func (p *OpenAIProvider) Embed(ctx context.Context, req *EmbeddingRequest) (*Emb
 		return nil, fmt.Errorf("marshal embedding request: %w", err)
 	}
 
-	httpReq, err := http.NewRequestWithContext(ctx, "POST", p.apiBase+"/embeddings", bytes.NewReader(jsonBody))
-	if err != nil {
-		return nil, fmt.Errorf("create embedding request: %w", err)
-	}
-
-	httpReq.Header.Set("Content-Type", "application/json")
-	httpReq.Header.Set("Authorization", "Bearer "+p.apiKey)
-
-	resp, err := p.httpClient.Do(httpReq)
+	resp, err := p.do(ctx, "embed", "embedding", p.newRequest(ctx, "/embeddings", "application/json", jsonBody))
 	if err != nil {
-		return nil, fmt.Errorf("execute embedding request: %w", err)
+		return nil, err
 	}
 	defer resp.Body.Close()
 
@@ -300,10 +484,6 @@ func (p *OpenAIProvider) Embed(ctx context.Context, req *EmbeddingRequest) (*Emb
 		return nil, fmt.Errorf("read embedding response: %w", err)
 	}
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("embedding API error (status %d): %s", resp.StatusCode, string(respBody))
-	}
-
 	var embResp struct {
 		Data []struct {
 			Embedding []float32 `json:"embedding"`
@@ -349,25 +529,12 @@ func (p *OpenAIProvider) Speak(ctx context.Context, req *TTSRequest) (*TTSRespon
 		return nil, fmt.Errorf("marshal request: %w", err)
 	}
 
-	httpReq, err := http.NewRequestWithContext(ctx, "POST", p.apiBase+"/audio/speech", bytes.NewBuffer(jsonBody))
+	resp, err := p.do(ctx, "speak", "TTS", p.newRequest(ctx, "/audio/speech", "application/json", jsonBody))
 	if err != nil {
-		return nil, fmt.Errorf("create request: %w", err)
-	}
-
-	httpReq.Header.Set("Content-Type", "application/json")
-	httpReq.Header.Set("Authorization", "Bearer "+p.apiKey)
-
-	resp, err := p.httpClient.Do(httpReq)
-	if err != nil {
-		return nil, fmt.Errorf("execute request: %w", err)
+		return nil, err
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		respBody, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("TTS API error (status %d): %s", resp.StatusCode, string(respBody))
-	}
-
 	audioData, err := io.ReadAll(resp.Body)
 	if err != nil {
 		return nil, fmt.Errorf("read response: %w", err)
@@ -378,3 +545,47 @@ func (p *OpenAIProvider) Speak(ctx context.Context, req *TTSRequest) (*TTSRespon
 		Format:    "opus",
 	}, nil
 }
+
+// newRequest returns a builder for an authenticated POST to path. Each call
+// creates a fresh request so the body can be sent again on retry.
+func (p *OpenAIProvider) newRequest(ctx context.Context, path, contentType string, body []byte) func() (*http.Request, error) {
+	return func() (*http.Request, error) {
+		httpReq, err := http.NewRequestWithContext(ctx, "POST", p.apiBase+path, bytes.NewReader(body))
+		if err != nil {
+			return nil, fmt.Errorf("create request: %w", err)
+		}
+		httpReq.Header.Set("Content-Type", contentType)
+		httpReq.Header.Set("Authorization", "Bearer "+p.apiKey)
+		return httpReq, nil
+	}
+}
+
+// do executes the request built by newReq, retrying transient failures
+// according to the retry policy. Non-200 responses become *APIError labelled
+// with api. On success the caller must close the response body.
+func (p *OpenAIProvider) do(ctx context.Context, op, api string, newReq func() (*http.Request, error)) (*http.Response, error) {
+	var resp *http.Response
+	err := retry(ctx, p.retry, op, func() error {
+		httpReq, err := newReq()
+		if err != nil {
+			return err
+		}
+		r, err := p.httpClient.Do(httpReq)
+		if err != nil {
+			return fmt.Errorf("execute request: %w", err)
+		}
+		if r.StatusCode != http.StatusOK {
+			respBody, _ := io.ReadAll(r.Body)
+			r.Body.Close()
+			return &APIError{
+				API:        api,
+				StatusCode: r.StatusCode,
+				Body:       string(respBody),
+				RetryAfter: parseRetryAfter(r.Header, time.Now()),
+			}
+		}
+		resp = r
+		return nil
+	})
+	return resp, err
+}
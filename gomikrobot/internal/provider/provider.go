@@ -3,8 +3,13 @@ package provider
 
 import (
 	"context"
+	"errors"
 )
 
+// ErrUnsupported is wrapped by errors of providers that do not offer a
+// capability at all, e.g. transcription on the Anthropic Messages API.
+var ErrUnsupported = errors.New("not supported")
+
 // LLMProvider is the interface for LLM API clients.
 type LLMProvider interface {
 	// Chat sends a completion request and returns the response.
@@ -48,6 +53,8 @@ type ChatRequest struct {
 	Model       string
 	MaxTokens   int
 	Temperature float64
+	// ResponseFormat requests JSON output (optional). See ChatJSON.
+	ResponseFormat *ResponseFormat
 }
 
 // ChatResponse contains the response from a chat completion request.
@@ -56,14 +63,21 @@ type ChatResponse struct {
 	ToolCalls    []ToolCall
 	FinishReason string
 	Usage        Usage
+	// Provider and Model identify the backend that served the request when
+	// it was routed through a FailoverProvider (empty otherwise).
+	Provider string
+	Model    string
 }
 
 // Message represents a chat message.
+// Parts adds typed multimodal content (images, files) after Content;
+// providers that cannot render a part fall back to a text note.
 type Message struct {
-	Role       string     `json:"role"`
-	Content    string     `json:"content"`
-	ToolCalls  []ToolCall `json:"tool_calls,omitempty"`
-	ToolCallID string     `json:"tool_call_id,omitempty"`
+	Role       string        `json:"role"`
+	Content    string        `json:"content"`
+	Parts      []ContentPart `json:"parts,omitempty"`
+	ToolCalls  []ToolCall    `json:"tool_calls,omitempty"`
+	ToolCallID string        `json:"tool_call_id,omitempty"`
 }
 
 // ToolCall represents a tool call from the LLM.
@@ -91,15 +105,37 @@ type Usage struct {
 	PromptTokens     int `json:"prompt_tokens"`
 	CompletionTokens int `json:"completion_tokens"`
 	TotalTokens      int `json:"total_tokens"`
+	// CachedTokens is the part of PromptTokens served from the provider's
+	// prompt cache (0 when the provider does not report it).
+	CachedTokens int `json:"cached_tokens,omitempty"`
 }
 
 // Embedder is an optional interface for providers that support embedding.
 // Not all providers implement this (e.g. LocalWhisperProvider does not).
-// Callers should use type assertion: if emb, ok := prov.(Embedder); ok { ... }
+// Callers should use AsEmbedder rather than a type assertion, since
+// wrappers implement Embed whether or not what they wrap can embed.
 type Embedder interface {
 	Embed(ctx context.Context, req *EmbeddingRequest) (*EmbeddingResponse, error)
 }
 
+// embedChecker is implemented by wrappers whose Embed only works when the
+// wrapped provider supports it.
+type embedChecker interface {
+	CanEmbed() bool
+}
+
+// AsEmbedder returns p as an Embedder if it can embed.
+func AsEmbedder(p LLMProvider) (Embedder, bool) {
+	emb, ok := p.(Embedder)
+	if !ok {
+		return nil, false
+	}
+	if c, ok := p.(embedChecker); ok && !c.CanEmbed() {
+		return nil, false
+	}
+	return emb, true
+}
+
 // EmbeddingRequest contains parameters for an embedding request.
 type EmbeddingRequest struct {
 	Input string
@@ -5,6 +5,9 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -30,11 +33,7 @@ func TestOpenAIProvider_ParseSimpleResponse(t *testing.T) {
 					FinishReason: "stop",
 				},
 			},
-			Usage: struct {
-				PromptTokens     int `json:"prompt_tokens"`
-				CompletionTokens int `json:"completion_tokens"`
-				TotalTokens      int `json:"total_tokens"`
-			}{PromptTokens: 10, CompletionTokens: 5, TotalTokens: 15},
+			Usage: openAIUsage{PromptTokens: 10, CompletionTokens: 5, TotalTokens: 15},
 		}
 		json.NewEncoder(w).Encode(resp)
 	}))
@@ -128,6 +127,28 @@ func TestOpenAIProvider_ParseToolCallResponse(t *testing.T) {
 	}
 }
 
+func TestOpenAIProvider_CachedTokens(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{
+			"choices": [{"message": {"content": "hi"}, "finish_reason": "stop"}],
+			"usage": {"prompt_tokens": 2000, "completion_tokens": 10, "total_tokens": 2010,
+				"prompt_tokens_details": {"cached_tokens": 1536}}
+		}`))
+	}))
+	defer server.Close()
+
+	p := NewOpenAIProvider("test-key", server.URL, "test-model")
+	resp, err := p.Chat(context.Background(), &ChatRequest{
+		Messages: []Message{{Role: "user", Content: "Hello"}},
+	})
+	if err != nil {
+		t.Fatalf("Chat() error: %v", err)
+	}
+	if resp.Usage.PromptTokens != 2000 || resp.Usage.CachedTokens != 1536 {
+		t.Errorf("expected 1536 of 2000 prompt tokens cached, got %+v", resp.Usage)
+	}
+}
+
 func TestOpenAIProvider_APIError(t *testing.T) {
 	// Mock server returning error
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -145,3 +166,101 @@ func TestOpenAIProvider_APIError(t *testing.T) {
 		t.Error("expected error for unauthorized request")
 	}
 }
+
+func TestOpenAIProvider_ChatStream(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]any
+		json.NewDecoder(r.Body).Decode(&body)
+		if body["stream"] != true {
+			t.Errorf("expected stream=true in request")
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		events := []string{
+			`{"choices":[{"delta":{"content":"Hel"}}]}`,
+			`{"choices":[{"delta":{"content":"lo"}}]}`,
+			`{"choices":[{"delta":{"tool_calls":[{"index":0,"id":"call_1","function":{"name":"read_file","arguments":"{\"pa"}}]}}]}`,
+			`{"choices":[{"delta":{"tool_calls":[{"index":0,"function":{"arguments":"th\":\"a.txt\"}"}}]},"finish_reason":"tool_calls"}]}`,
+			`{"choices":[],"usage":{"prompt_tokens":10,"completion_tokens":4,"total_tokens":14,"prompt_tokens_details":{"cached_tokens":6}}}`,
+		}
+		for _, e := range events {
+			w.Write([]byte("data: " + e + "\n\n"))
+		}
+		w.Write([]byte("data: [DONE]\n\n"))
+	}))
+	defer server.Close()
+
+	p := NewOpenAIProvider("test-key", server.URL, "test-model")
+	var text string
+	var toolDeltas int
+	resp, err := p.ChatStream(context.Background(), &ChatRequest{
+		Messages: []Message{{Role: "user", Content: "Hello"}},
+	}, func(d StreamDelta) {
+		text += d.Content
+		if d.ToolCall != nil {
+			toolDeltas++
+		}
+	})
+	if err != nil {
+		t.Fatalf("ChatStream() error: %v", err)
+	}
+
+	if text != "Hello" || resp.Content != "Hello" {
+		t.Errorf("expected streamed content 'Hello', got delta=%q resp=%q", text, resp.Content)
+	}
+	if toolDeltas != 2 {
+		t.Errorf("expected 2 tool call deltas, got %d", toolDeltas)
+	}
+	if len(resp.ToolCalls) != 1 || resp.ToolCalls[0].Arguments["path"] != "a.txt" {
+		t.Errorf("expected assembled tool call, got %+v", resp.ToolCalls)
+	}
+	if resp.FinishReason != "tool_calls" || resp.Usage.TotalTokens != 14 || resp.Usage.CachedTokens != 6 {
+		t.Errorf("unexpected finish/usage: %s %+v", resp.FinishReason, resp.Usage)
+	}
+}
+
+func TestOpenAIProvider_MultimodalParts(t *testing.T) {
+	dir := t.TempDir()
+	img := filepath.Join(dir, "photo.png")
+	os.WriteFile(img, []byte("\x89PNG\r\n\x1a\nfake"), 0644)
+	notes := filepath.Join(dir, "notes.txt")
+	os.WriteFile(notes, []byte("buy milk"), 0644)
+
+	imgPart, err := MediaPart(img)
+	if err != nil || imgPart.Type != PartImage || imgPart.MimeType != "image/png" {
+		t.Fatalf("unexpected image part %+v (%v)", imgPart, err)
+	}
+	txtPart, _ := MediaPart(notes)
+
+	p := NewOpenAIProvider("k", "", "m")
+	msgs := p.convertMessages([]Message{{
+		Role:    "user",
+		Content: "What is this?",
+		Parts:   []ContentPart{imgPart, txtPart},
+	}})
+
+	content, ok := msgs[0]["content"].([]map[string]any)
+	if !ok || len(content) != 3 {
+		t.Fatalf("expected 3 content parts, got %#v", msgs[0]["content"])
+	}
+	if content[0]["text"] != "What is this?" {
+		t.Errorf("expected text first, got %v", content[0])
+	}
+	url := content[1]["image_url"].(map[string]any)["url"].(string)
+	if !strings.HasPrefix(url, "data:image/png;base64,") {
+		t.Errorf("expected data URL for image, got %s", url)
+	}
+	if !strings.Contains(content[2]["text"].(string), "buy milk") {
+		t.Errorf("expected inlined text file, got %v", content[2])
+	}
+}
+
+func TestInlineTextIsCut(t *testing.T) {
+	part := ContentPart{Type: PartFile, Name: "big.csv", MimeType: "text/csv"}
+	text := inlineText(part, []byte(strings.Repeat("a,b\n", MaxInlineTextChars)))
+	if len(text) > MaxInlineTextChars+200 || !strings.Contains(text, "[file cut at") {
+		t.Fatalf("expected the file to be cut, got %d chars", len(text))
+	}
+	if text := inlineText(part, []byte("a,b")); text != "File big.csv:\na,b" {
+		t.Errorf("small file changed: %q", text)
+	}
+}
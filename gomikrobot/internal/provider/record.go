@@ -0,0 +1,232 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+// Recorder wraps a provider and appends every call and its result to a
+// cassette file, which a Replayer can serve back later without network
+// access. The cassette is saved after each call, so a crashed session
+// still leaves a usable recording.
+type Recorder struct {
+	base     LLMProvider
+	path     string
+	mu       sync.Mutex
+	cassette *Cassette
+}
+
+// NewRecorder wraps base. An existing cassette at path is extended.
+func NewRecorder(base LLMProvider, path string) (*Recorder, error) {
+	cassette := &Cassette{Version: cassetteVersion}
+	if _, err := os.Stat(path); err == nil {
+		c, err := LoadCassette(path)
+		if err != nil {
+			return nil, err
+		}
+		cassette = c
+	}
+	return &Recorder{base: base, path: path, cassette: cassette}, nil
+}
+
+// DefaultModel returns the wrapped provider's default model.
+func (r *Recorder) DefaultModel() string {
+	return r.base.DefaultModel()
+}
+
+// Chat forwards to the wrapped provider and records the exchange.
+func (r *Recorder) Chat(ctx context.Context, req *ChatRequest) (*ChatResponse, error) {
+	key := normalizeChat(req)
+	resp, err := r.base.Chat(ctx, req)
+	r.record("chat", key, resp, err)
+	return resp, err
+}
+
+// ChatStream streams from the wrapped provider and records the final
+// response.
+func (r *Recorder) ChatStream(ctx context.Context, req *ChatRequest, onDelta func(StreamDelta)) (*ChatResponse, error) {
+	key := normalizeChat(req)
+	resp, err := StreamChat(ctx, r.base, req, onDelta)
+	r.record("chat", key, resp, err)
+	return resp, err
+}
+
+// Transcribe forwards to the wrapped provider and records the exchange.
+func (r *Recorder) Transcribe(ctx context.Context, req *AudioRequest) (*AudioResponse, error) {
+	resp, err := r.base.Transcribe(ctx, req)
+	if keyReq, kerr := audioKeyRequest(req); kerr == nil {
+		r.record("transcribe", keyReq, resp, err)
+	}
+	return resp, err
+}
+
+// Speak forwards to the wrapped provider and records the exchange.
+func (r *Recorder) Speak(ctx context.Context, req *TTSRequest) (*TTSResponse, error) {
+	keyReq := *req // providers may fill in defaults on req
+	resp, err := r.base.Speak(ctx, req)
+	r.record("speak", &keyReq, resp, err)
+	return resp, err
+}
+
+// Embed forwards to the wrapped provider when it supports embeddings.
+func (r *Recorder) Embed(ctx context.Context, req *EmbeddingRequest) (*EmbeddingResponse, error) {
+	emb, ok := AsEmbedder(r.base)
+	if !ok {
+		return nil, fmt.Errorf("recorded provider: embedding %w", ErrUnsupported)
+	}
+	keyReq := *req
+	resp, err := emb.Embed(ctx, req)
+	r.record("embed", &keyReq, resp, err)
+	return resp, err
+}
+
+// CanEmbed reports whether the wrapped provider supports embeddings.
+func (r *Recorder) CanEmbed() bool {
+	_, ok := AsEmbedder(r.base)
+	return ok
+}
+
+// record appends one interaction and saves the cassette. Failures to write
+// the cassette are reported but never fail the call itself. Cancelled calls
+// are not recorded.
+func (r *Recorder) record(op string, normalized, resp any, callErr error) {
+	if errors.Is(callErr, context.Canceled) {
+		return
+	}
+	key, reqJSON, err := requestKey(op, normalized)
+	if err != nil {
+		slog.Warn("Recorder: cannot key request", "op", op, "error", err)
+		return
+	}
+	in := Interaction{Key: key, Op: op, RecordedAt: time.Now(), Request: reqJSON}
+	if callErr != nil {
+		in.Error = callErr.Error()
+	} else if in.Response, err = json.Marshal(resp); err != nil {
+		slog.Warn("Recorder: cannot marshal response", "op", op, "error", err)
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cassette.Interactions = append(r.cassette.Interactions, in)
+	if err := r.cassette.Save(r.path); err != nil {
+		slog.Warn("Recorder: cannot save cassette", "path", r.path, "error", err)
+	}
+}
+
+// Replayer serves responses from a cassette instead of calling an API.
+// Requests are matched by normalized hash; repeated identical requests get
+// the recorded responses in order, and the last one once those run out.
+// A request that was never recorded fails with an error.
+type Replayer struct {
+	mu     sync.Mutex
+	byKey  map[string][]Interaction
+	served map[string]int
+	embeds bool // the cassette has embed interactions
+}
+
+// NewReplayer loads the cassette at path.
+func NewReplayer(path string) (*Replayer, error) {
+	c, err := LoadCassette(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewReplayerFromCassette(c), nil
+}
+
+// NewReplayerFromCassette serves an already loaded cassette.
+func NewReplayerFromCassette(c *Cassette) *Replayer {
+	r := &Replayer{byKey: map[string][]Interaction{}, served: map[string]int{}}
+	for _, in := range c.Interactions {
+		r.byKey[in.Key] = append(r.byKey[in.Key], in)
+		r.embeds = r.embeds || in.Op == "embed"
+	}
+	return r
+}
+
+// DefaultModel identifies the replayer in traces.
+func (r *Replayer) DefaultModel() string {
+	return "replay"
+}
+
+// Chat returns the recorded response for req.
+func (r *Replayer) Chat(_ context.Context, req *ChatRequest) (*ChatResponse, error) {
+	var resp ChatResponse
+	if err := r.replay("chat", normalizeChat(req), &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// Transcribe returns the recorded transcript for the audio file.
+func (r *Replayer) Transcribe(_ context.Context, req *AudioRequest) (*AudioResponse, error) {
+	keyReq, err := audioKeyRequest(req)
+	if err != nil {
+		return nil, err
+	}
+	var resp AudioResponse
+	if err := r.replay("transcribe", keyReq, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// Speak returns the recorded audio for req.
+func (r *Replayer) Speak(_ context.Context, req *TTSRequest) (*TTSResponse, error) {
+	var resp TTSResponse
+	if err := r.replay("speak", req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// Embed returns the recorded embedding for req.
+func (r *Replayer) Embed(_ context.Context, req *EmbeddingRequest) (*EmbeddingResponse, error) {
+	var resp EmbeddingResponse
+	if err := r.replay("embed", req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// CanEmbed reports whether the cassette recorded any embeddings.
+func (r *Replayer) CanEmbed() bool {
+	return r.embeds
+}
+
+// replay looks up the next recorded interaction for the request and
+// decodes its response into out, or returns the recorded error.
+func (r *Replayer) replay(op string, normalized, out any) error {
+	key, _, err := requestKey(op, normalized)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	recorded := r.byKey[key]
+	i := r.served[key]
+	if i < len(recorded) {
+		r.served[key] = i + 1
+	} else {
+		i = len(recorded) - 1
+	}
+	r.mu.Unlock()
+
+	if len(recorded) == 0 {
+		return fmt.Errorf("replay: no recorded %s interaction for request %s", op, key[:12])
+	}
+	in := recorded[i]
+	if in.Error != "" {
+		return fmt.Errorf("replay: %s", in.Error)
+	}
+	if err := json.Unmarshal(in.Response, out); err != nil {
+		return fmt.Errorf("replay: decode %s response: %w", op, err)
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package provider
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRecorderReplayer_RoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cassette.json")
+	stub := &stubProvider{content: "first"}
+	rec, err := NewRecorder(stub, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := func(system, model string) *ChatRequest {
+		return &ChatRequest{
+			Model: model,
+			Messages: []Message{
+				{Role: "system", Content: system},
+				{Role: "user", Content: "hello"},
+			},
+			Tools: []ToolDefinition{
+				{Function: FunctionDef{Name: "write_file"}},
+				{Function: FunctionDef{Name: "read_file"}},
+			},
+		}
+	}
+	rec.Chat(context.Background(), req("now is 10:00", "gpt-4o"))
+	stub.content = "second"
+	rec.Chat(context.Background(), req("now is 10:01", "gpt-4o"))
+
+	rep, err := NewReplayer(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// System prompt, model and tool order do not affect matching.
+	r2 := req("now is 11:30", "other-model")
+	r2.Tools[0], r2.Tools[1] = r2.Tools[1], r2.Tools[0]
+	for _, want := range []string{"first", "second", "second"} {
+		resp, err := rep.Chat(context.Background(), r2)
+		if err != nil {
+			t.Fatalf("Chat() error: %v", err)
+		}
+		if resp.Content != want {
+			t.Errorf("expected %q, got %q", want, resp.Content)
+		}
+	}
+
+	_, err = rep.Chat(context.Background(), &ChatRequest{Messages: []Message{{Role: "user", Content: "unknown"}}})
+	if err == nil || !strings.Contains(err.Error(), "no recorded chat interaction") {
+		t.Errorf("expected a miss for an unrecorded request, got %v", err)
+	}
+}
+
+func TestRecorderReplayer_EmbedOnlyWhenSupported(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cassette.json")
+	if _, ok := AsEmbedder(mustRecorder(t, &stubProvider{}, path)); ok {
+		t.Error("recorder of a provider without embeddings must not embed")
+	}
+	rec := mustRecorder(t, &embedStub{}, path)
+	emb, ok := AsEmbedder(rec)
+	if !ok {
+		t.Fatal("expected the recorder to embed through the wrapped provider")
+	}
+	rec.Chat(context.Background(), &ChatRequest{Messages: []Message{{Role: "user", Content: "hi"}}})
+	if rep, err := NewReplayer(path); err != nil {
+		t.Fatal(err)
+	} else if _, ok := AsEmbedder(rep); ok {
+		t.Error("a cassette without embeddings must not enable them")
+	}
+
+	if _, err := emb.Embed(context.Background(), &EmbeddingRequest{Input: "x"}); err != nil {
+		t.Fatal(err)
+	}
+	rep, err := NewReplayer(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	emb, ok = AsEmbedder(rep)
+	if !ok {
+		t.Fatal("expected the replayer to serve recorded embeddings")
+	}
+	if out, err := emb.Embed(context.Background(), &EmbeddingRequest{Input: "x"}); err != nil || len(out.Vector) != 1 {
+		t.Errorf("Embed() = %+v, %v", out, err)
+	}
+}
+
+func mustRecorder(t *testing.T, base LLMProvider, path string) *Recorder {
+	t.Helper()
+	rec, err := NewRecorder(base, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rec
+}
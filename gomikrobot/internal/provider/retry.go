@@ -0,0 +1,126 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RetryPolicy controls how transient API failures are retried. Delays grow
+// exponentially from BaseDelay up to MaxDelay with random jitter; a
+// Retry-After header from the server takes precedence over the computed delay.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts, including the first.
+	// Values below 2 disable retries.
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+}
+
+// DefaultRetryPolicy is used by providers unless configured otherwise.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 4,
+	BaseDelay:   500 * time.Millisecond,
+	MaxDelay:    30 * time.Second,
+}
+
+// RetryEvent describes one failed attempt that is about to be retried.
+type RetryEvent struct {
+	Op      string        // operation, e.g. "chat" or "transcribe"
+	Attempt int           // the attempt that failed, starting at 1
+	Delay   time.Duration // wait before the next attempt
+	Err     error
+}
+
+type retryObserverKey struct{}
+
+// WithRetryObserver returns a context whose provider calls report every
+// retry to fn, e.g. to record it in a trace.
+func WithRetryObserver(ctx context.Context, fn func(RetryEvent)) context.Context {
+	return context.WithValue(ctx, retryObserverKey{}, fn)
+}
+
+func retryObserver(ctx context.Context) func(RetryEvent) {
+	fn, _ := ctx.Value(retryObserverKey{}).(func(RetryEvent))
+	return fn
+}
+
+// retry runs call until it succeeds, fails with a non-transient error, the
+// attempts are used up, or the next wait would exceed the context deadline.
+// The last error is returned unchanged.
+func retry(ctx context.Context, policy RetryPolicy, op string, call func() error) error {
+	for attempt := 1; ; attempt++ {
+		err := call()
+		if err == nil || attempt >= policy.MaxAttempts || !IsTransient(err) || ctx.Err() != nil {
+			return err
+		}
+
+		delay, ok := policy.delay(attempt, err)
+		if !ok {
+			return err
+		}
+		if deadline, has := ctx.Deadline(); has && time.Until(deadline) < delay {
+			return err
+		}
+
+		slog.Warn("Provider call failed, retrying", "op", op, "attempt", attempt, "delay", delay, "error", err)
+		if fn := retryObserver(ctx); fn != nil {
+			fn(RetryEvent{Op: op, Attempt: attempt, Delay: delay, Err: err})
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
+
+// delay returns the wait after the given failed attempt. A server-provided
+// Retry-After is honoured as is; if it asks for longer than MaxDelay the
+// call is not retried at all.
+func (rp RetryPolicy) delay(attempt int, err error) (time.Duration, bool) {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.RetryAfter > 0 {
+		if rp.MaxDelay > 0 && apiErr.RetryAfter > rp.MaxDelay {
+			return 0, false
+		}
+		return apiErr.RetryAfter, true
+	}
+
+	d := rp.BaseDelay << (attempt - 1)
+	if d <= 0 || (rp.MaxDelay > 0 && d > rp.MaxDelay) {
+		d = rp.MaxDelay
+	}
+	// Jitter: wait between half and the full backoff.
+	if half := d / 2; half > 0 {
+		d = half + rand.N(half+1)
+	}
+	return d, true
+}
+
+// parseRetryAfter reads a Retry-After header given in seconds or as an
+// HTTP date. It returns 0 when the header is absent or invalid.
+func parseRetryAfter(h http.Header, now time.Time) time.Duration {
+	v := strings.TrimSpace(h.Get("Retry-After"))
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(v); err == nil {
+		if secs < 0 {
+			return 0
+		}
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil && t.After(now) {
+		return t.Sub(now)
+	}
+	return 0
+}
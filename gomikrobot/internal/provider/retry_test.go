@@ -0,0 +1,113 @@
+package provider
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func testRetryProvider(url string) *OpenAIProvider {
+	p := NewOpenAIProvider("k", url, "m")
+	p.SetRetryPolicy(RetryPolicy{MaxAttempts: 4, BaseDelay: time.Millisecond, MaxDelay: time.Second})
+	return p
+}
+
+func TestOpenAIProvider_RetriesTransientErrors(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls < 3 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte("overloaded"))
+			return
+		}
+		w.Write([]byte(`{"choices":[{"message":{"content":"ok"},"finish_reason":"stop"}]}`))
+	}))
+	defer server.Close()
+
+	var events []RetryEvent
+	ctx := WithRetryObserver(context.Background(), func(ev RetryEvent) {
+		events = append(events, ev)
+	})
+	resp, err := testRetryProvider(server.URL).Chat(ctx, &ChatRequest{Messages: []Message{{Role: "user", Content: "hi"}}})
+	if err != nil {
+		t.Fatalf("Chat() error: %v", err)
+	}
+	if resp.Content != "ok" || calls != 3 {
+		t.Errorf("expected success on 3rd attempt, got %q after %d calls", resp.Content, calls)
+	}
+	if len(events) != 2 || events[0].Op != "chat" || events[1].Attempt != 2 {
+		t.Errorf("unexpected retry events %+v", events)
+	}
+}
+
+func TestOpenAIProvider_DoesNotRetryFatalErrors(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("invalid request"))
+	}))
+	defer server.Close()
+
+	_, err := testRetryProvider(server.URL).Embed(context.Background(), &EmbeddingRequest{Input: "x"})
+	if err == nil || calls != 1 {
+		t.Fatalf("expected a single failed attempt, got %d calls (%v)", calls, err)
+	}
+}
+
+func TestOpenAIProvider_RetryRespectsDeadline(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Retry-After", "1")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := testRetryProvider(server.URL).Chat(ctx, &ChatRequest{})
+	apiErr, ok := err.(*APIError)
+	if !ok || apiErr.StatusCode != 429 || apiErr.RetryAfter != time.Second {
+		t.Fatalf("expected the 429 error, got %v", err)
+	}
+	if calls != 1 || time.Since(start) > 150*time.Millisecond {
+		t.Errorf("expected to give up without waiting past the deadline, got %d calls in %v", calls, time.Since(start))
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	cases := map[string]time.Duration{
+		"":                              0,
+		"7":                             7 * time.Second,
+		"-1":                            0,
+		"soon":                          0,
+		"Wed, 01 Jan 2025 12:00:30 GMT": 30 * time.Second,
+	}
+	for in, want := range cases {
+		h := http.Header{}
+		h.Set("Retry-After", in)
+		if got := parseRetryAfter(h, now); got != want {
+			t.Errorf("parseRetryAfter(%q) = %v, want %v", in, got, want)
+		}
+	}
+}
+
+func TestRetryPolicyDelay(t *testing.T) {
+	rp := RetryPolicy{MaxAttempts: 5, BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+	for attempt := 1; attempt <= 6; attempt++ {
+		d, ok := rp.delay(attempt, &APIError{StatusCode: 500})
+		if !ok || d <= 0 || d > time.Second {
+			t.Errorf("attempt %d: delay %v out of range", attempt, d)
+		}
+	}
+	if _, ok := rp.delay(1, &APIError{StatusCode: 429, RetryAfter: time.Minute}); ok {
+		t.Errorf("expected Retry-After beyond MaxDelay to stop retrying")
+	}
+}
@@ -0,0 +1,56 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+)
+
+// SplitProvider serves chat from one provider and transcription, speech
+// and embeddings from another, e.g. Claude through the Messages API with
+// OpenAI for voice messages and memory.
+type SplitProvider struct {
+	chat  LLMProvider
+	media LLMProvider
+}
+
+// NewSplitProvider returns a provider that sends Chat and ChatStream to
+// chat and everything else to media.
+func NewSplitProvider(chat, media LLMProvider) *SplitProvider {
+	return &SplitProvider{chat: chat, media: media}
+}
+
+func (p *SplitProvider) Chat(ctx context.Context, req *ChatRequest) (*ChatResponse, error) {
+	return p.chat.Chat(ctx, req)
+}
+
+// ChatStream streams through the chat provider when it supports streaming.
+func (p *SplitProvider) ChatStream(ctx context.Context, req *ChatRequest, onDelta func(StreamDelta)) (*ChatResponse, error) {
+	return StreamChat(ctx, p.chat, req, onDelta)
+}
+
+func (p *SplitProvider) Transcribe(ctx context.Context, req *AudioRequest) (*AudioResponse, error) {
+	return p.media.Transcribe(ctx, req)
+}
+
+func (p *SplitProvider) Speak(ctx context.Context, req *TTSRequest) (*TTSResponse, error) {
+	return p.media.Speak(ctx, req)
+}
+
+func (p *SplitProvider) DefaultModel() string {
+	return p.chat.DefaultModel()
+}
+
+// Embed embeds through the media provider.
+func (p *SplitProvider) Embed(ctx context.Context, req *EmbeddingRequest) (*EmbeddingResponse, error) {
+	emb, ok := AsEmbedder(p.media)
+	if !ok {
+		return nil, fmt.Errorf("embedding not supported by the media provider")
+	}
+	return emb.Embed(ctx, req)
+}
+
+// CanEmbed reports whether the media provider supports embedding.
+func (p *SplitProvider) CanEmbed() bool {
+	_, ok := AsEmbedder(p.media)
+	return ok
+}
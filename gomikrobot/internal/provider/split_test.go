@@ -0,0 +1,47 @@
+package provider
+
+import (
+	"context"
+	"testing"
+
+	"github.com/kamir/gomikrobot/internal/config"
+)
+
+// embedStub is a stubProvider that also embeds.
+type embedStub struct{ stubProvider }
+
+func (s *embedStub) Embed(context.Context, *EmbeddingRequest) (*EmbeddingResponse, error) {
+	return &EmbeddingResponse{Vector: []float32{1}}, nil
+}
+
+func (s *embedStub) Transcribe(context.Context, *AudioRequest) (*AudioResponse, error) {
+	return &AudioResponse{Text: "transcribed"}, nil
+}
+
+func TestSplitProvider(t *testing.T) {
+	chat := &stubProvider{content: "from chat"}
+	p := NewSplitProvider(chat, &embedStub{})
+
+	resp, err := p.Chat(context.Background(), &ChatRequest{})
+	if err != nil || resp.Content != "from chat" {
+		t.Fatalf("Chat() = %+v, %v", resp, err)
+	}
+	audio, err := p.Transcribe(context.Background(), &AudioRequest{})
+	if err != nil || audio.Text != "transcribed" {
+		t.Fatalf("Transcribe() = %+v, %v", audio, err)
+	}
+	emb, ok := AsEmbedder(p)
+	if !ok {
+		t.Fatal("expected embeddings through the media provider")
+	}
+	if out, err := emb.Embed(context.Background(), &EmbeddingRequest{Input: "x"}); err != nil || len(out.Vector) != 1 {
+		t.Errorf("Embed() = %+v, %v", out, err)
+	}
+
+	if _, ok := AsEmbedder(NewLocalTTSProvider(config.LocalTTSConfig{}, NewLocalWhisperProvider(config.LocalWhisperConfig{}, p))); !ok {
+		t.Error("local audio wrappers must keep the wrapped provider's embeddings")
+	}
+	if _, ok := AsEmbedder(NewSplitProvider(chat, &stubProvider{})); ok {
+		t.Error("a media provider without embeddings must not enable them")
+	}
+}
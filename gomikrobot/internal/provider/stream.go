@@ -0,0 +1,49 @@
+package provider
+
+import (
+	"context"
+)
+
+// StreamDelta is an incremental update from a streamed chat completion.
+// Exactly one of Content or ToolCall is set.
+type StreamDelta struct {
+	// Content is the next fragment of assistant text.
+	Content string
+	// ToolCall is a fragment of a tool call being assembled.
+	ToolCall *ToolCallDelta
+}
+
+// ToolCallDelta is a fragment of a streamed tool call. ID and Name arrive
+// with the first fragment for an Index; Arguments are appended piecewise.
+type ToolCallDelta struct {
+	Index     int
+	ID        string
+	Name      string
+	Arguments string
+}
+
+// StreamingProvider is an optional interface for providers that can stream
+// completions. ChatStream invokes onDelta for every fragment as it arrives
+// and returns the fully assembled response (including tool calls and usage)
+// once the stream ends.
+// Callers should use type assertion or StreamChat, which falls back to Chat.
+type StreamingProvider interface {
+	ChatStream(ctx context.Context, req *ChatRequest, onDelta func(StreamDelta)) (*ChatResponse, error)
+}
+
+// StreamChat streams the completion when p supports it. Otherwise it calls
+// Chat and reports the whole content as a single delta, so callers can use
+// one code path for both kinds of providers.
+func StreamChat(ctx context.Context, p LLMProvider, req *ChatRequest, onDelta func(StreamDelta)) (*ChatResponse, error) {
+	if sp, ok := p.(StreamingProvider); ok {
+		return sp.ChatStream(ctx, req, onDelta)
+	}
+	resp, err := p.Chat(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	if onDelta != nil && resp.Content != "" {
+		onDelta(StreamDelta{Content: resp.Content})
+	}
+	return resp, nil
+}
@@ -0,0 +1,249 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// Response format types for ChatRequest.ResponseFormat.
+const (
+	// FormatJSON asks for any syntactically valid JSON object.
+	FormatJSON = "json_object"
+	// FormatJSONSchema asks for a JSON object matching Schema.
+	FormatJSONSchema = "json_schema"
+)
+
+// ResponseFormat constrains the model's answer to JSON. Backends with a
+// native mode enforce it (OpenAI response_format, an Anthropic forced tool);
+// others get it as an instruction, so callers should still validate.
+type ResponseFormat struct {
+	Type string
+	// Name identifies the schema, e.g. "classification".
+	Name string
+	// Schema is a JSON Schema object (type, properties, required, enum,
+	// items) describing the expected answer.
+	Schema map[string]any
+	// Strict requests exact schema adherence where the backend supports it.
+	Strict bool
+}
+
+// instruction is the prompt text used where no native JSON mode exists.
+func (f *ResponseFormat) instruction() string {
+	if f.Type == FormatJSONSchema && f.Schema != nil {
+		schema, _ := json.Marshal(f.Schema)
+		return "Respond with only a JSON object that matches this JSON schema, without any other text:\n" + string(schema)
+	}
+	return "Respond with only a valid JSON object, without any other text."
+}
+
+// withSystemInstruction returns messages with text appended to the system
+// prompt, or preceded by a system message holding text if there is none.
+// messages is not modified.
+func withSystemInstruction(messages []Message, text string) []Message {
+	if len(messages) > 0 && messages[0].Role == "system" {
+		out := append([]Message(nil), messages...)
+		out[0].Content = strings.TrimSpace(out[0].Content + "\n\n" + text)
+		return out
+	}
+	return append([]Message{{Role: "system", Content: text}}, messages...)
+}
+
+type usageObserverKey struct{}
+
+// WithUsageObserver returns a context whose ChatJSON calls report the
+// response of every attempt to fn, so helper calls made on behalf of a
+// request (classification, consolidation) are metered with it.
+func WithUsageObserver(ctx context.Context, fn func(*ChatResponse)) context.Context {
+	return context.WithValue(ctx, usageObserverKey{}, fn)
+}
+
+func usageObserver(ctx context.Context) func(*ChatResponse) {
+	fn, _ := ctx.Value(usageObserverKey{}).(func(*ChatResponse))
+	return fn
+}
+
+// ChatJSON sends req and unmarshals the model's JSON answer into out. If
+// req has no ResponseFormat, JSON mode is requested. When the answer is not
+// valid JSON or does not match the schema, the model is asked once more
+// with the validation error before giving up.
+func ChatJSON(ctx context.Context, p LLMProvider, req *ChatRequest, out any) (*ChatResponse, error) {
+	r := *req
+	if r.ResponseFormat == nil {
+		r.ResponseFormat = &ResponseFormat{Type: FormatJSON}
+	}
+	r.Messages = append([]Message(nil), req.Messages...)
+
+	var lastErr error
+	for attempt := 0; attempt < 2; attempt++ {
+		resp, err := p.Chat(ctx, &r)
+		if err != nil {
+			return nil, err
+		}
+		if observe := usageObserver(ctx); observe != nil {
+			observe(resp)
+		}
+		data := extractJSON(resp.Content)
+		if lastErr = ValidateJSON(r.ResponseFormat.Schema, data); lastErr == nil {
+			if lastErr = json.Unmarshal(data, out); lastErr == nil {
+				return resp, nil
+			}
+		}
+		r.Messages = append(r.Messages,
+			Message{Role: "assistant", Content: resp.Content},
+			Message{Role: "user", Content: fmt.Sprintf("Your answer was not valid: %v. Reply again with only the corrected JSON object.", lastErr)},
+		)
+	}
+	return nil, fmt.Errorf("structured output: %w", lastErr)
+}
+
+// extractJSON strips code fences and surrounding prose from a model answer.
+func extractJSON(s string) []byte {
+	s = strings.TrimSpace(s)
+	s = strings.TrimPrefix(s, "```json")
+	s = strings.TrimPrefix(s, "```")
+	s = strings.TrimSuffix(s, "```")
+	s = strings.TrimSpace(s)
+	if start, end := strings.IndexAny(s, "{["), strings.LastIndexAny(s, "}]"); start >= 0 && end > start {
+		s = s[start : end+1]
+	}
+	return []byte(s)
+}
+
+// ValidateJSON checks data against a JSON Schema subset: type, properties,
+// required, enum, items and additionalProperties=false. A nil schema only
+// requires valid JSON.
+func ValidateJSON(schema map[string]any, data []byte) error {
+	var v any
+	if err := json.Unmarshal(data, &v); err != nil {
+		return fmt.Errorf("invalid JSON: %w", err)
+	}
+	if schema == nil {
+		return nil
+	}
+	return validateValue(schema, v, "$")
+}
+
+func validateValue(schema map[string]any, v any, path string) error {
+	if t, ok := schema["type"]; ok && !matchesType(t, v) {
+		return fmt.Errorf("%s: expected %v, got %s", path, t, jsonType(v))
+	}
+	if enum := anyList(schema["enum"]); enum != nil {
+		found := false
+		for _, e := range enum {
+			if fmt.Sprint(e) == fmt.Sprint(v) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("%s: %v is not one of %v", path, v, enum)
+		}
+	}
+
+	switch val := v.(type) {
+	case map[string]any:
+		for _, name := range stringList(schema["required"]) {
+			if _, ok := val[name]; !ok {
+				return fmt.Errorf("%s: missing required field %q", path, name)
+			}
+		}
+		props, _ := schema["properties"].(map[string]any)
+		keys := make([]string, 0, len(val))
+		for k := range val {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			sub, ok := props[k].(map[string]any)
+			if !ok {
+				if extra, set := schema["additionalProperties"].(bool); set && !extra {
+					return fmt.Errorf("%s: unexpected field %q", path, k)
+				}
+				continue
+			}
+			if err := validateValue(sub, val[k], path+"."+k); err != nil {
+				return err
+			}
+		}
+	case []any:
+		if items, ok := schema["items"].(map[string]any); ok {
+			for i, item := range val {
+				if err := validateValue(items, item, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func matchesType(t any, v any) bool {
+	for _, name := range stringList(t) {
+		got := jsonType(v)
+		if got == name || (name == "number" && got == "integer") {
+			return true
+		}
+	}
+	return false
+}
+
+// jsonType names the JSON type of a decoded value.
+func jsonType(v any) string {
+	switch val := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		if val == math.Trunc(val) {
+			return "integer"
+		}
+		return "number"
+	case string:
+		return "string"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+// anyList accepts a []any or []string schema value.
+func anyList(v any) []any {
+	switch val := v.(type) {
+	case []any:
+		return val
+	case []string:
+		out := make([]any, len(val))
+		for i, s := range val {
+			out[i] = s
+		}
+		return out
+	}
+	return nil
+}
+
+// stringList accepts a string or a list of strings, as schema keywords
+// like "type" and "required" are written in either form.
+func stringList(v any) []string {
+	switch val := v.(type) {
+	case string:
+		return []string{val}
+	case []string:
+		return val
+	case []any:
+		out := make([]string, 0, len(val))
+		for _, s := range val {
+			if str, ok := s.(string); ok {
+				out = append(out, str)
+			}
+		}
+		return out
+	}
+	return nil
+}
@@ -0,0 +1,156 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// scriptedProvider returns the given contents in order and keeps requests.
+type scriptedProvider struct {
+	stubProvider
+	contents []string
+	requests []*ChatRequest
+}
+
+func (s *scriptedProvider) Chat(_ context.Context, req *ChatRequest) (*ChatResponse, error) {
+	s.requests = append(s.requests, req)
+	content := s.contents[len(s.requests)-1]
+	return &ChatResponse{Content: content}, nil
+}
+
+var testFormat = &ResponseFormat{
+	Type: FormatJSONSchema,
+	Name: "classification",
+	Schema: map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"category": map[string]any{"type": "string", "enum": []string{"A", "B"}},
+			"score":    map[string]any{"type": "number"},
+		},
+		"required": []string{"category"},
+	},
+}
+
+func TestChatJSON_ReasksOnceOnInvalidAnswer(t *testing.T) {
+	p := &scriptedProvider{contents: []string{
+		`{"category": "C"}`,
+		"```json\n{\"category\": \"B\", \"score\": 0.5}\n```",
+	}}
+	var out struct {
+		Category string  `json:"category"`
+		Score    float64 `json:"score"`
+	}
+	_, err := ChatJSON(context.Background(), p, &ChatRequest{
+		Messages:       []Message{{Role: "user", Content: "classify"}},
+		ResponseFormat: testFormat,
+	}, &out)
+	if err != nil {
+		t.Fatalf("ChatJSON() error: %v", err)
+	}
+	if out.Category != "B" || out.Score != 0.5 {
+		t.Errorf("unexpected result %+v", out)
+	}
+	reask := p.requests[1].Messages
+	if len(reask) != 3 || !strings.Contains(reask[2].Content, "not one of") {
+		t.Errorf("expected re-ask with validation error, got %+v", reask)
+	}
+}
+
+func TestChatJSON_FailsAfterReask(t *testing.T) {
+	p := &scriptedProvider{contents: []string{"nope", "still nope"}}
+	var out map[string]any
+	_, err := ChatJSON(context.Background(), p, &ChatRequest{}, &out)
+	if err == nil || len(p.requests) != 2 {
+		t.Fatalf("expected failure after 2 attempts, got %v after %d", err, len(p.requests))
+	}
+	if p.requests[0].ResponseFormat == nil || p.requests[0].ResponseFormat.Type != FormatJSON {
+		t.Errorf("expected JSON mode by default")
+	}
+}
+
+func TestChatJSON_ReportsEveryAttempt(t *testing.T) {
+	p := &scriptedProvider{contents: []string{"nope", `{"category": "A"}`}}
+	var reported int
+	ctx := WithUsageObserver(context.Background(), func(*ChatResponse) { reported++ })
+	var out map[string]any
+	if _, err := ChatJSON(ctx, p, &ChatRequest{ResponseFormat: testFormat}, &out); err != nil {
+		t.Fatalf("ChatJSON() error: %v", err)
+	}
+	if reported != 2 {
+		t.Errorf("expected both attempts to be reported, got %d", reported)
+	}
+}
+
+func TestValidateJSON(t *testing.T) {
+	cases := map[string]bool{
+		`{"category": "A"}`:               true,
+		`{"category": "A", "score": 3}`:   true,
+		`{"score": 1}`:                    false,
+		`{"category": "A", "score": "x"}`: false,
+		`["A"]`:                           false,
+		`{"category": `:                   false,
+	}
+	for in, ok := range cases {
+		if err := ValidateJSON(testFormat.Schema, []byte(in)); (err == nil) != ok {
+			t.Errorf("ValidateJSON(%s) = %v, want ok=%v", in, err, ok)
+		}
+	}
+}
+
+func TestOpenAIProvider_ResponseFormat(t *testing.T) {
+	body := NewOpenAIProvider("k", "", "m").buildChatBody(&ChatRequest{ResponseFormat: testFormat})
+	rf := body["response_format"].(map[string]any)
+	if rf["type"] != "json_schema" || rf["json_schema"].(map[string]any)["name"] != "classification" {
+		t.Errorf("unexpected response_format %v", rf)
+	}
+}
+
+func TestOpenAIProvider_JSONModeMentionsJSON(t *testing.T) {
+	system := []Message{{Role: "system", Content: "Classify."}, {Role: "user", Content: "hi"}}
+	body := NewOpenAIProvider("k", "", "m").buildChatBody(&ChatRequest{
+		Messages:       system,
+		ResponseFormat: &ResponseFormat{Type: FormatJSON},
+	})
+	msgs := body["messages"].([]map[string]any)
+	if len(msgs) != 2 || !strings.Contains(msgs[0]["content"].(string), "Classify.\n\nRespond with only a valid JSON object") {
+		t.Errorf("expected JSON instruction in the system prompt, got %+v", msgs)
+	}
+	if system[0].Content != "Classify." {
+		t.Errorf("request messages were modified: %+v", system)
+	}
+
+	body = NewOpenAIProvider("k", "", "m").buildChatBody(&ChatRequest{
+		Messages:       []Message{{Role: "user", Content: "hi"}},
+		ResponseFormat: &ResponseFormat{Type: FormatJSON},
+	})
+	if msgs := body["messages"].([]map[string]any); len(msgs) != 2 || msgs[0]["role"] != "system" {
+		t.Errorf("expected a system message with the JSON instruction, got %+v", msgs)
+	}
+}
+
+func TestAnthropicProvider_ResponseFormatUsesForcedTool(t *testing.T) {
+	var got map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&got)
+		w.Write([]byte(`{"content": [{"type": "tool_use", "id": "t1", "name": "classification", "input": {"category": "A"}}], "stop_reason": "tool_use"}`))
+	}))
+	defer server.Close()
+
+	resp, err := NewAnthropicProvider("k", server.URL, "").Chat(context.Background(), &ChatRequest{
+		Messages:       []Message{{Role: "user", Content: "classify"}},
+		ResponseFormat: testFormat,
+	})
+	if err != nil {
+		t.Fatalf("Chat() error: %v", err)
+	}
+	if choice := got["tool_choice"].(map[string]any); choice["name"] != "classification" {
+		t.Errorf("expected forced tool choice, got %v", choice)
+	}
+	if resp.Content != `{"category":"A"}` || len(resp.ToolCalls) != 0 || resp.FinishReason != "stop" {
+		t.Errorf("expected tool input as content, got %+v", resp)
+	}
+}
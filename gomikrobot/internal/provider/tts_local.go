@@ -0,0 +1,152 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/kamir/gomikrobot/internal/config"
+)
+
+// LocalTTSProvider implements speech synthesis using a local TTS binary
+// (piper or espeak-ng). The WAV output is converted with ffmpeg to Ogg/Opus,
+// which WhatsApp plays as a voice note.
+type LocalTTSProvider struct {
+	config config.LocalTTSConfig
+	base   LLMProvider // For everything except speech synthesis
+}
+
+// NewLocalTTSProvider creates a new local TTS provider.
+func NewLocalTTSProvider(cfg config.LocalTTSConfig, base LLMProvider) *LocalTTSProvider {
+	return &LocalTTSProvider{
+		config: cfg,
+		base:   base,
+	}
+}
+
+func (p *LocalTTSProvider) Chat(ctx context.Context, req *ChatRequest) (*ChatResponse, error) {
+	return p.base.Chat(ctx, req)
+}
+
+// ChatStream streams through the wrapped provider when it supports streaming.
+func (p *LocalTTSProvider) ChatStream(ctx context.Context, req *ChatRequest, onDelta func(StreamDelta)) (*ChatResponse, error) {
+	return StreamChat(ctx, p.base, req, onDelta)
+}
+
+func (p *LocalTTSProvider) Transcribe(ctx context.Context, req *AudioRequest) (*AudioResponse, error) {
+	return p.base.Transcribe(ctx, req)
+}
+
+func (p *LocalTTSProvider) DefaultModel() string {
+	return p.base.DefaultModel()
+}
+
+// Embed forwards to the wrapped provider when it supports embeddings.
+func (p *LocalTTSProvider) Embed(ctx context.Context, req *EmbeddingRequest) (*EmbeddingResponse, error) {
+	emb, ok := AsEmbedder(p.base)
+	if !ok {
+		return nil, fmt.Errorf("embedding %w by the wrapped provider", ErrUnsupported)
+	}
+	return emb.Embed(ctx, req)
+}
+
+// CanEmbed reports whether the wrapped provider supports embeddings.
+func (p *LocalTTSProvider) CanEmbed() bool {
+	_, ok := AsEmbedder(p.base)
+	return ok
+}
+
+// Speak synthesizes req.Text locally. The voice comes from the config;
+// req.Voice names an OpenAI voice and is ignored.
+func (p *LocalTTSProvider) Speak(ctx context.Context, req *TTSRequest) (*TTSResponse, error) {
+	if !p.config.Enabled {
+		return p.base.Speak(ctx, req)
+	}
+	if strings.TrimSpace(req.Text) == "" {
+		return nil, fmt.Errorf("local tts: empty text")
+	}
+
+	tmpDir, err := os.MkdirTemp("", "tts-")
+	if err != nil {
+		return nil, fmt.Errorf("create temp dir: %w", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	wavPath := filepath.Join(tmpDir, "speech.wav")
+	args, err := p.engineArgs(wavPath, req.Speed)
+	if err != nil {
+		return nil, err
+	}
+
+	// Text goes in on stdin so it is never parsed as a flag.
+	cmd := exec.CommandContext(ctx, p.config.BinaryPath, args...)
+	cmd.Stdin = strings.NewReader(req.Text)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("%s command failed: %w (output: %s)", p.engine(), err, string(output))
+	}
+
+	// Mono 48 kHz Opus in an Ogg container is what WhatsApp sends for
+	// push-to-talk voice notes.
+	oggPath := filepath.Join(tmpDir, "speech.ogg")
+	ffmpeg := p.config.FFmpegPath
+	if ffmpeg == "" {
+		ffmpeg = "ffmpeg"
+	}
+	cmd = exec.CommandContext(ctx, ffmpeg, "-y", "-loglevel", "error",
+		"-i", wavPath,
+		"-ac", "1", "-ar", "48000",
+		"-c:a", "libopus", "-b:a", "32k",
+		"-f", "ogg", oggPath)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("ffmpeg opus conversion failed: %w (output: %s)", err, string(output))
+	}
+
+	audioData, err := os.ReadFile(oggPath)
+	if err != nil {
+		return nil, fmt.Errorf("read tts output: %w", err)
+	}
+
+	return &TTSResponse{
+		AudioData: audioData,
+		Format:    "opus",
+	}, nil
+}
+
+func (p *LocalTTSProvider) engine() string {
+	if p.config.Engine == "" {
+		return "piper"
+	}
+	return strings.ToLower(p.config.Engine)
+}
+
+// engineArgs builds the command line that writes WAV audio to wavPath.
+func (p *LocalTTSProvider) engineArgs(wavPath string, speed float64) ([]string, error) {
+	switch p.engine() {
+	case "piper":
+		if p.config.Model == "" {
+			return nil, fmt.Errorf("local tts: piper needs a voice model (localTTS.model)")
+		}
+		args := []string{"--model", p.config.Model, "--output_file", wavPath}
+		if speed > 0 {
+			// piper's length scale is the inverse of speed.
+			args = append(args, "--length_scale", strconv.FormatFloat(1/speed, 'f', 2, 64))
+		}
+		return args, nil
+	case "espeak-ng", "espeak":
+		args := []string{"-w", wavPath}
+		if p.config.Voice != "" {
+			args = append(args, "-v", p.config.Voice)
+		}
+		if speed > 0 {
+			// espeak-ng defaults to 175 words per minute.
+			args = append(args, "-s", strconv.Itoa(int(175*speed)))
+		}
+		return append(args, "--stdin"), nil
+	default:
+		return nil, fmt.Errorf("local tts: unknown engine %q", p.config.Engine)
+	}
+}
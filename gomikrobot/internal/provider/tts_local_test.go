@@ -0,0 +1,74 @@
+package provider
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kamir/gomikrobot/internal/config"
+)
+
+// writeScript creates an executable shell script in dir.
+func writeScript(t *testing.T, dir, name, body string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+body), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLocalTTSProvider_Speak(t *testing.T) {
+	dir := t.TempDir()
+	// Fake piper: writes stdin to the --output_file argument.
+	piper := writeScript(t, dir, "piper", `
+while [ $# -gt 0 ]; do
+  if [ "$1" = "--output_file" ]; then out="$2"; fi
+  shift
+done
+cat > "$out"
+`)
+	// Fake ffmpeg: copies the -i input to the last argument, tagged.
+	ffmpeg := writeScript(t, dir, "ffmpeg", `
+while [ $# -gt 0 ]; do
+  if [ "$1" = "-i" ]; then in="$2"; fi
+  last="$1"
+  shift
+done
+{ printf 'OggS:'; cat "$in"; } > "$last"
+`)
+
+	p := NewLocalTTSProvider(config.LocalTTSConfig{
+		Enabled:    true,
+		Engine:     "piper",
+		BinaryPath: piper,
+		Model:      "de_DE-thorsten-medium.onnx",
+		FFmpegPath: ffmpeg,
+	}, &stubProvider{})
+
+	resp, err := p.Speak(context.Background(), &TTSRequest{Text: "--help Hallo Welt", Voice: "nova"})
+	if err != nil {
+		t.Fatalf("Speak() error: %v", err)
+	}
+	if string(resp.AudioData) != "OggS:--help Hallo Welt" || resp.Format != "opus" {
+		t.Errorf("unexpected audio %q (%s)", resp.AudioData, resp.Format)
+	}
+}
+
+func TestLocalTTSProvider_EngineArgs(t *testing.T) {
+	p := NewLocalTTSProvider(config.LocalTTSConfig{Engine: "espeak-ng", Voice: "de"}, nil)
+	args, err := p.engineArgs("out.wav", 1.2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(args, " "); got != "-w out.wav -v de -s 210 --stdin" {
+		t.Errorf("unexpected espeak-ng args %q", got)
+	}
+
+	p = NewLocalTTSProvider(config.LocalTTSConfig{Engine: "piper"}, nil)
+	if _, err := p.engineArgs("out.wav", 0); err == nil {
+		t.Errorf("expected an error for piper without a model")
+	}
+}
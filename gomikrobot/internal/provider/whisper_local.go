@@ -14,33 +14,53 @@ import (
 // LocalWhisperProvider implements transcription using a local Whisper binary.
 type LocalWhisperProvider struct {
 	config config.LocalWhisperConfig
-	openai *OpenAIProvider // Fallback or for non-transcription tasks
+	base   LLMProvider // Fallback or for non-transcription tasks
 }
 
 // NewLocalWhisperProvider creates a new local Whisper provider.
-func NewLocalWhisperProvider(cfg config.LocalWhisperConfig, openai *OpenAIProvider) *LocalWhisperProvider {
+func NewLocalWhisperProvider(cfg config.LocalWhisperConfig, base LLMProvider) *LocalWhisperProvider {
 	return &LocalWhisperProvider{
 		config: cfg,
-		openai: openai,
+		base:   base,
 	}
 }
 
 func (p *LocalWhisperProvider) Chat(ctx context.Context, req *ChatRequest) (*ChatResponse, error) {
-	return p.openai.Chat(ctx, req)
+	return p.base.Chat(ctx, req)
+}
+
+// ChatStream streams through the wrapped provider when it supports streaming.
+func (p *LocalWhisperProvider) ChatStream(ctx context.Context, req *ChatRequest, onDelta func(StreamDelta)) (*ChatResponse, error) {
+	return StreamChat(ctx, p.base, req, onDelta)
 }
 
 func (p *LocalWhisperProvider) Speak(ctx context.Context, req *TTSRequest) (*TTSResponse, error) {
-	return p.openai.Speak(ctx, req)
+	return p.base.Speak(ctx, req)
 }
 
 func (p *LocalWhisperProvider) DefaultModel() string {
-	return p.openai.DefaultModel()
+	return p.base.DefaultModel()
+}
+
+// Embed forwards to the wrapped provider when it supports embeddings.
+func (p *LocalWhisperProvider) Embed(ctx context.Context, req *EmbeddingRequest) (*EmbeddingResponse, error) {
+	emb, ok := AsEmbedder(p.base)
+	if !ok {
+		return nil, fmt.Errorf("embedding %w by the wrapped provider", ErrUnsupported)
+	}
+	return emb.Embed(ctx, req)
+}
+
+// CanEmbed reports whether the wrapped provider supports embeddings.
+func (p *LocalWhisperProvider) CanEmbed() bool {
+	_, ok := AsEmbedder(p.base)
+	return ok
 }
 
 // Transcribe converts audio to text using a local Command Line Whisper.
 func (p *LocalWhisperProvider) Transcribe(ctx context.Context, req *AudioRequest) (*AudioResponse, error) {
 	if !p.config.Enabled {
-		return p.openai.Transcribe(ctx, req)
+		return p.base.Transcribe(ctx, req)
 	}
 
 	model := req.Model
@@ -0,0 +1,207 @@
+//go:build linux
+
+package sandbox
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// cgroupRoot is where the unified (v2) cgroup hierarchy is mounted.
+const cgroupRoot = "/sys/fs/cgroup"
+
+// cgroupControllers are enabled for the sandbox cgroups.
+var cgroupControllers = []string{"memory", "pids"}
+
+var (
+	cgroupOnce sync.Once
+	cgroupBase string
+	cgroupErr  error
+)
+
+// sandboxCgroups returns the cgroup below which each sandboxed command
+// gets its own, or why there is none. It is the process's own cgroup when
+// the host delegated it (systemd: Delegate=yes), so that memory.max and
+// pids.max can be set for the children. Only a cgroup without processes
+// may enable controllers for its children, so the process first moves
+// into a leaf named "gomikrobot".
+func sandboxCgroups() (string, error) {
+	cgroupOnce.Do(func() {
+		cgroupBase, cgroupErr = setupCgroups()
+	})
+	return cgroupBase, cgroupErr
+}
+
+func setupCgroups() (string, error) {
+	// CLONE_INTO_CGROUP needs Linux 5.7.
+	var uts unix.Utsname
+	if err := unix.Uname(&uts); err != nil {
+		return "", err
+	}
+	if !kernelAtLeast(unix.ByteSliceToString(uts.Release[:]), 5, 7) {
+		return "", errors.New("kernel older than 5.7")
+	}
+	// Hybrid hosts mount cgroup v1 at the root.
+	if _, err := os.Stat(filepath.Join(cgroupRoot, "cgroup.controllers")); err != nil {
+		return "", errors.New("no cgroup v2 hierarchy at " + cgroupRoot)
+	}
+	own, err := ownCgroup("/proc/self/cgroup")
+	if err != nil {
+		return "", err
+	}
+	dir := filepath.Join(cgroupRoot, own)
+	if err := checkControllers(filepath.Join(dir, "cgroup.controllers")); err != nil {
+		return "", err
+	}
+	if enableControllers(dir) == nil {
+		return dir, nil
+	}
+	leaf := filepath.Join(dir, "gomikrobot")
+	if err := os.Mkdir(leaf, 0o755); err != nil && !errors.Is(err, os.ErrExist) {
+		return "", fmt.Errorf("cgroup not delegated: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(leaf, "cgroup.procs"), []byte("0"), 0); err != nil {
+		return "", fmt.Errorf("move into %s: %w", leaf, err)
+	}
+	if err := enableControllers(dir); err != nil {
+		return "", err
+	}
+	return dir, nil
+}
+
+// ownCgroup returns the cgroup v2 path of the process from
+// /proc/self/cgroup.
+func ownCgroup(procFile string) (string, error) {
+	f, err := os.Open(procFile)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		if path, ok := strings.CutPrefix(sc.Text(), "0::"); ok {
+			return path, nil
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return "", err
+	}
+	return "", errors.New("no cgroup v2 entry in " + procFile)
+}
+
+// checkControllers fails unless the memory and pids controllers are
+// available in the cgroup whose cgroup.controllers file is given.
+func checkControllers(file string) error {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	have := strings.Fields(string(data))
+	for _, c := range cgroupControllers {
+		if !containsField(have, c) {
+			return fmt.Errorf("cgroup controller %s not delegated", c)
+		}
+	}
+	return nil
+}
+
+// enableControllers enables the memory and pids controllers for the
+// children of dir.
+func enableControllers(dir string) error {
+	file := filepath.Join(dir, "cgroup.subtree_control")
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	have := strings.Fields(string(data))
+	var add []string
+	for _, c := range cgroupControllers {
+		if !containsField(have, c) {
+			add = append(add, "+"+c)
+		}
+	}
+	if len(add) == 0 {
+		return nil
+	}
+	if err := os.WriteFile(file, []byte(strings.Join(add, " ")), 0); err != nil {
+		return fmt.Errorf("enable %s: %w", strings.Join(add, " "), err)
+	}
+	return nil
+}
+
+// cgroup is the cgroup of one sandboxed command.
+type cgroup struct {
+	dir string
+	fd  *os.File
+}
+
+// newCgroup creates a cgroup below base with the memory and process
+// limits of spec.
+func newCgroup(base string, spec Spec) (*cgroup, error) {
+	dir, err := os.MkdirTemp(base, "sandbox-")
+	if err != nil {
+		return nil, err
+	}
+	cg := &cgroup{dir: dir}
+	for file, v := range map[string]int64{"memory.max": spec.MemoryBytes, "pids.max": int64(spec.MaxProcesses)} {
+		if v <= 0 {
+			continue
+		}
+		if err := os.WriteFile(filepath.Join(dir, file), []byte(strconv.FormatInt(v, 10)), 0); err != nil {
+			cg.remove()
+			return nil, fmt.Errorf("set %s: %w", file, err)
+		}
+	}
+	if spec.MemoryBytes > 0 {
+		// Without swap accounting the file is missing; memory.max holds.
+		_ = os.WriteFile(filepath.Join(dir, "memory.swap.max"), []byte("0"), 0)
+	}
+	if cg.fd, err = os.Open(dir); err != nil {
+		cg.remove()
+		return nil, err
+	}
+	return cg, nil
+}
+
+// remove kills what is left in the cgroup and deletes it.
+func (c *cgroup) remove() {
+	if c.fd != nil {
+		c.fd.Close()
+	}
+	_ = os.WriteFile(filepath.Join(c.dir, "cgroup.kill"), []byte("1"), 0)
+	// Killed processes leave the cgroup asynchronously.
+	for i := 0; i < 50; i++ {
+		if err := os.Remove(c.dir); err == nil || errors.Is(err, os.ErrNotExist) {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// kernelAtLeast reports whether a kernel release such as "6.1.0-13-amd64"
+// is at least major.minor.
+func kernelAtLeast(release string, major, minor int) bool {
+	var gotMajor, gotMinor int
+	if _, err := fmt.Sscanf(release, "%d.%d", &gotMajor, &gotMinor); err != nil {
+		return false
+	}
+	return gotMajor > major || (gotMajor == major && gotMinor >= minor)
+}
+
+func containsField(fields []string, s string) bool {
+	for _, f := range fields {
+		if f == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,57 @@
+// Package sandbox runs commands isolated by Linux namespaces: a private
+// user, mount and PID namespace, a read-only view of the host file system
+// with selected paths writable, no network unless allowed, and resource
+// limits. The command is started through the gomikrobot binary itself,
+// which sets up the sandbox in the new namespaces (see Init) and then
+// executes the command.
+package sandbox
+
+import "errors"
+
+// ErrUnsupported is returned by Command on platforms without namespaces.
+var ErrUnsupported = errors.New("sandbox not supported on this platform")
+
+// initEnv carries the spec from Command to Init in the sandboxed process.
+const initEnv = "GOMIKROBOT_SANDBOX_INIT"
+
+// baseEnv are the host variables every sandboxed command gets.
+var baseEnv = []string{"PATH", "HOME", "LANG", "TERM"}
+
+// Spec describes the sandbox of one command.
+type Spec struct {
+	// Writable paths are bind-mounted read-write; the rest of the file
+	// system is read-only. /tmp is an empty private tmpfs.
+	Writable []string `json:"writable,omitempty"`
+	// Network keeps the host network. Otherwise the command runs in an
+	// empty network namespace, without even loopback.
+	Network bool `json:"network,omitempty"`
+	// HostProc keeps the read-only host /proc where the kernel refuses a
+	// proc for the new PID namespace (nested containers). Host processes,
+	// and the environment of processes of the same user, are then
+	// visible. Otherwise the sandbox fails to start.
+	HostProc bool `json:"hostProc,omitempty"`
+	// Dir is the working directory in the sandbox.
+	Dir string `json:"dir,omitempty"`
+	// Env names the variables of the host environment the command gets
+	// besides PATH, HOME, LANG and TERM. Nothing else is passed on, so
+	// API keys of the host process stay out of the sandbox.
+	Env []string `json:"env,omitempty"`
+	// MemoryBytes limits the memory and MaxProcesses the processes of
+	// the sandbox, through a cgroup (memory.max, pids.max) where the host
+	// delegates cgroup v2 controllers. Otherwise they fall back to
+	// RLIMIT_AS, the address space of each process, and RLIMIT_NPROC,
+	// which counts every process of the host user. CPUSeconds limits the
+	// CPU time of each process. 0 = no limit.
+	MemoryBytes  int64 `json:"memoryBytes,omitempty"`
+	CPUSeconds   int   `json:"cpuSeconds,omitempty"`
+	MaxProcesses int   `json:"maxProcesses,omitempty"`
+}
+
+// initSpec is what Init receives: the sandbox and the command to run.
+type initSpec struct {
+	Spec
+	Path string   `json:"path"`
+	Args []string `json:"args"`
+	// Cgroup is set when a cgroup enforces MemoryBytes and MaxProcesses.
+	Cgroup bool `json:"cgroup,omitempty"`
+}
@@ -0,0 +1,425 @@
+//go:build linux
+
+package sandbox
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// Command prepares name with args to run in a sandbox. The returned command
+// starts the current executable, whose Init sets up the sandbox before it
+// executes name. Starting it fails if the kernel does not allow
+// unprivileged user namespaces. Call release once the command has exited;
+// it removes the command's cgroup.
+func Command(ctx context.Context, spec Spec, name string, args ...string) (cmd *exec.Cmd, release func(), err error) {
+	release = func() {}
+	writable := make([]string, 0, len(spec.Writable))
+	for _, p := range spec.Writable {
+		abs, err := filepath.Abs(p)
+		if err != nil {
+			return nil, release, fmt.Errorf("writable path %q: %w", p, err)
+		}
+		writable = append(writable, abs)
+	}
+	spec.Writable = writable
+
+	is := initSpec{Spec: spec, Path: name, Args: args}
+	var cg *cgroup
+	if spec.MemoryBytes > 0 || spec.MaxProcesses > 0 {
+		if base, err := sandboxCgroups(); err == nil {
+			if cg, err = newCgroup(base, spec); err != nil {
+				return nil, release, fmt.Errorf("cgroup: %w", err)
+			}
+			is.Cgroup = true
+			release = cg.remove
+		}
+	}
+	payload, err := json.Marshal(is)
+	if err != nil {
+		release()
+		return nil, func() {}, err
+	}
+
+	cmd = exec.CommandContext(ctx, "/proc/self/exe")
+	cmd.Args = []string{"gomikrobot-sandbox"}
+	cmd.Env = append(environ(spec.Env), initEnv+"="+string(payload))
+
+	flags := uintptr(syscall.CLONE_NEWUSER | syscall.CLONE_NEWNS | syscall.CLONE_NEWPID)
+	if !spec.Network {
+		flags |= syscall.CLONE_NEWNET
+	}
+	// The caller's IDs become root in the sandbox; Init drops all
+	// capabilities before the command runs.
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Cloneflags:  flags,
+		UidMappings: []syscall.SysProcIDMap{{ContainerID: 0, HostID: os.Getuid(), Size: 1}},
+		GidMappings: []syscall.SysProcIDMap{{ContainerID: 0, HostID: os.Getgid(), Size: 1}},
+	}
+	if cg != nil {
+		cmd.SysProcAttr.UseCgroupFD = true
+		cmd.SysProcAttr.CgroupFD = int(cg.fd.Fd())
+	}
+	return cmd, release, nil
+}
+
+// environ returns the host variables in baseEnv and names that are set.
+func environ(names []string) []string {
+	var env []string
+	seen := map[string]bool{}
+	for _, name := range append(baseEnv, names...) {
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		if v, ok := os.LookupEnv(name); ok {
+			env = append(env, name+"="+v)
+		}
+	}
+	return env
+}
+
+// Init sets up the sandbox and executes the command when the process was
+// started by Command; otherwise it returns at once. Call it first thing in
+// main.
+func Init() {
+	payload, ok := os.LookupEnv(initEnv)
+	if !ok {
+		return
+	}
+	os.Unsetenv(initEnv)
+	// Capabilities and no_new_privs belong to a thread: the one that
+	// drops them must be the one that executes the command.
+	runtime.LockOSThread()
+
+	var spec initSpec
+	if err := json.Unmarshal([]byte(payload), &spec); err != nil {
+		fail(fmt.Errorf("decode spec: %w", err))
+	}
+	if err := setup(spec); err != nil {
+		fail(err)
+	}
+	path, err := exec.LookPath(spec.Path)
+	if err != nil {
+		fail(err)
+	}
+	args, err := newExecArgs(path, append([]string{spec.Path}, spec.Args...), os.Environ())
+	if err != nil {
+		fail(err)
+	}
+	if err := dropPrivileges(); err != nil {
+		fail(err)
+	}
+	// Under RLIMIT_AS the Go runtime may fail to grow its heap, so nothing
+	// from the limits to exec allocates.
+	if err := setLimits(rlimits(spec)); err != nil {
+		fail(err)
+	}
+	fail(args.exec())
+}
+
+// execArgs are the arguments of execve(2), converted in advance.
+type execArgs struct {
+	path       *byte
+	argv, envv []*byte
+}
+
+func newExecArgs(path string, argv, envv []string) (*execArgs, error) {
+	var a execArgs
+	var err error
+	if a.path, err = syscall.BytePtrFromString(path); err != nil {
+		return nil, err
+	}
+	if a.argv, err = syscall.SlicePtrFromStrings(argv); err != nil {
+		return nil, err
+	}
+	if a.envv, err = syscall.SlicePtrFromStrings(envv); err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+// exec replaces the process with the command; it only returns on error.
+func (a *execArgs) exec() error {
+	_, _, errno := syscall.RawSyscall(syscall.SYS_EXECVE, uintptr(unsafe.Pointer(a.path)),
+		uintptr(unsafe.Pointer(&a.argv[0])), uintptr(unsafe.Pointer(&a.envv[0])))
+	return errno
+}
+
+func fail(err error) {
+	fmt.Fprintf(os.Stderr, "sandbox: %v\n", err)
+	os.Exit(126)
+}
+
+// setup builds the new root in the mount namespace and switches to it. It
+// runs as root of the new user namespace.
+func setup(spec initSpec) error {
+	// Nothing mounted here may propagate back to the host.
+	if err := unix.Mount("", "/", "", unix.MS_REC|unix.MS_PRIVATE, ""); err != nil {
+		return fmt.Errorf("make mounts private: %w", err)
+	}
+
+	// A tmpfs becomes the temporary root; the host root is reached under
+	// /old and bind-mounted to /root, the future root.
+	const base = "/tmp"
+	if err := unix.Mount("tmpfs", base, "tmpfs", 0, "mode=0700"); err != nil {
+		return fmt.Errorf("mount tmpfs: %w", err)
+	}
+	for _, dir := range []string{"old", "root"} {
+		if err := os.Mkdir(filepath.Join(base, dir), 0o700); err != nil {
+			return err
+		}
+	}
+	if err := unix.PivotRoot(base, filepath.Join(base, "old")); err != nil {
+		return fmt.Errorf("pivot_root: %w", err)
+	}
+	if err := unix.Chdir("/"); err != nil {
+		return err
+	}
+	if err := unix.Mount("/old", "/root", "", unix.MS_BIND|unix.MS_REC, ""); err != nil {
+		return fmt.Errorf("bind host root: %w", err)
+	}
+	if err := remountReadOnly("/root", "/old/proc/self/mountinfo"); err != nil {
+		return err
+	}
+	// A proc for the new PID namespace hides host processes. Where the
+	// kernel refuses it (nested containers), the read-only host proc only
+	// stays when the spec allows it.
+	if err := unix.Mount("proc", "/root/proc", "proc", unix.MS_NOSUID|unix.MS_NODEV|unix.MS_NOEXEC, ""); err != nil {
+		if !spec.HostProc {
+			return fmt.Errorf("mount /proc: %w (hostProc keeps the host /proc instead)", err)
+		}
+		fmt.Fprintf(os.Stderr, "sandbox: warning: mount /proc: %v; host processes are visible\n", err)
+	}
+	if err := unix.Mount("tmpfs", "/root/tmp", "tmpfs", unix.MS_NOSUID|unix.MS_NODEV, "mode=1777"); err != nil {
+		return fmt.Errorf("mount /tmp: %w", err)
+	}
+	for _, p := range spec.Writable {
+		if err := bindWritable("/old"+p, "/root"+p); err != nil {
+			return fmt.Errorf("bind %s writable: %w", p, err)
+		}
+	}
+	if err := unix.Unmount("/old", unix.MNT_DETACH); err != nil {
+		return fmt.Errorf("detach host root: %w", err)
+	}
+
+	// Switch to the new root; the tmpfs below it is detached.
+	if err := unix.Chdir("/root"); err != nil {
+		return err
+	}
+	if err := unix.PivotRoot(".", "."); err != nil {
+		return fmt.Errorf("pivot_root: %w", err)
+	}
+	if err := unix.Unmount(".", unix.MNT_DETACH); err != nil {
+		return fmt.Errorf("detach tmpfs: %w", err)
+	}
+	dir := spec.Dir
+	if dir == "" {
+		dir = "/"
+	}
+	if err := unix.Chdir(dir); err != nil {
+		return fmt.Errorf("chdir %s: %w", dir, err)
+	}
+
+	return nil
+}
+
+// bindWritable bind-mounts src onto dst. A missing mount point is created,
+// which only succeeds on the private /tmp.
+func bindWritable(src, dst string) error {
+	st, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Lstat(dst); os.IsNotExist(err) {
+		if st.IsDir() {
+			err = os.MkdirAll(dst, 0o755)
+		} else if err = os.MkdirAll(filepath.Dir(dst), 0o755); err == nil {
+			err = os.WriteFile(dst, nil, 0o644)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return unix.Mount(src, dst, "", unix.MS_BIND|unix.MS_REC, "")
+}
+
+// remountReadOnly makes root and every mount below it read-only. A mount
+// that cannot be remounted is detached, so nothing writable is left.
+func remountReadOnly(root, mountinfo string) error {
+	points, err := mountPoints(mountinfo, root)
+	if err != nil {
+		return err
+	}
+	var detached []string
+	for _, p := range points {
+		if under(p, detached) {
+			continue
+		}
+		flags := uintptr(unix.MS_REMOUNT | unix.MS_BIND | unix.MS_RDONLY)
+		var st unix.Statfs_t
+		if err := unix.Statfs(p, &st); err == nil {
+			flags |= lockedFlags(st.Flags)
+		}
+		if err := unix.Mount("", p, "", flags, ""); err != nil {
+			if p == root || unix.Unmount(p, unix.MNT_DETACH) != nil {
+				return fmt.Errorf("remount %s read-only: %w", p, err)
+			}
+			detached = append(detached, p)
+		}
+	}
+	return nil
+}
+
+// lockedFlags returns the mount flags of a statfs result that a remount
+// in a user namespace must keep.
+func lockedFlags(f int64) uintptr {
+	var flags uintptr
+	for st, ms := range map[int64]uintptr{
+		unix.ST_NOSUID:     unix.MS_NOSUID,
+		unix.ST_NODEV:      unix.MS_NODEV,
+		unix.ST_NOEXEC:     unix.MS_NOEXEC,
+		unix.ST_NOATIME:    unix.MS_NOATIME,
+		unix.ST_NODIRATIME: unix.MS_NODIRATIME,
+		unix.ST_RELATIME:   unix.MS_RELATIME,
+	} {
+		if f&st != 0 {
+			flags |= ms
+		}
+	}
+	return flags
+}
+
+// mountPoints lists the mount points at or below root, parents first.
+func mountPoints(mountinfo, root string) ([]string, error) {
+	f, err := os.Open(mountinfo)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	seen := map[string]bool{}
+	var points []string
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) < 5 {
+			continue
+		}
+		p := unescapeMountPath(fields[4])
+		if (p == root || strings.HasPrefix(p, root+"/")) && !seen[p] {
+			seen[p] = true
+			points = append(points, p)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	sort.Slice(points, func(i, j int) bool {
+		return strings.Count(points[i], "/") < strings.Count(points[j], "/")
+	})
+	return points, nil
+}
+
+// unescapeMountPath decodes the octal escapes (\040 for space) of
+// /proc/self/mountinfo.
+func unescapeMountPath(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+4 <= len(s) {
+			if n, err := strconv.ParseUint(s[i+1:i+4], 8, 8); err == nil {
+				sb.WriteByte(byte(n))
+				i += 3
+				continue
+			}
+		}
+		sb.WriteByte(s[i])
+	}
+	return sb.String()
+}
+
+func under(p string, dirs []string) bool {
+	for _, d := range dirs {
+		if strings.HasPrefix(p, d+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// rlimit is one resource limit of the sandbox.
+type rlimit struct {
+	resource int
+	value    int64
+}
+
+// rlimits returns the rlimits of the sandbox; memory and processes only
+// when no cgroup limits them.
+func rlimits(spec initSpec) []rlimit {
+	limits := []rlimit{{unix.RLIMIT_CPU, int64(spec.CPUSeconds)}}
+	if !spec.Cgroup {
+		limits = append(limits, rlimit{unix.RLIMIT_AS, spec.MemoryBytes}, rlimit{unix.RLIMIT_NPROC, int64(spec.MaxProcesses)})
+	}
+	return limits
+}
+
+// setLimits sets the given rlimits; 0 means no limit.
+func setLimits(limits []rlimit) error {
+	for _, l := range limits {
+		if l.value <= 0 {
+			continue
+		}
+		lim := unix.Rlimit{Cur: uint64(l.value), Max: uint64(l.value)}
+		if err := unix.Setrlimit(l.resource, &lim); err != nil {
+			return fmt.Errorf("setrlimit %d: %w", l.resource, err)
+		}
+	}
+	return nil
+}
+
+// dropPrivileges empties the capability bounding and inheritable sets, so
+// the command keeps no capabilities although it runs as root of the user
+// namespace, and forbids gaining privileges through setuid binaries.
+func dropPrivileges() error {
+	last := 63
+	if data, err := os.ReadFile("/proc/sys/kernel/cap_last_cap"); err == nil {
+		if n, err := strconv.Atoi(strings.TrimSpace(string(data))); err == nil {
+			last = n
+		}
+	}
+	for c := 0; c <= last; c++ {
+		if err := unix.Prctl(unix.PR_CAPBSET_DROP, uintptr(c), 0, 0, 0); err != nil && err != unix.EINVAL {
+			return fmt.Errorf("drop capability %d: %w", c, err)
+		}
+	}
+	hdr := unix.CapUserHeader{Version: unix.LINUX_CAPABILITY_VERSION_3}
+	var data [2]unix.CapUserData
+	if err := unix.Capget(&hdr, &data[0]); err != nil {
+		return fmt.Errorf("capget: %w", err)
+	}
+	for i := range data {
+		data[i].Inheritable = 0
+	}
+	if err := unix.Capset(&hdr, &data[0]); err != nil {
+		return fmt.Errorf("capset: %w", err)
+	}
+	if err := unix.Prctl(unix.PR_SET_NO_NEW_PRIVS, 1, 0, 0, 0); err != nil {
+		return fmt.Errorf("no_new_privs: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,181 @@
+//go:build linux
+
+package sandbox
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// The test binary doubles as the sandbox init.
+func TestMain(m *testing.M) {
+	Init()
+	os.Exit(m.Run())
+}
+
+func run(t *testing.T, spec Spec, script string) (string, error) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	cmd, release, err := Command(ctx, spec, "sh", "-c", script)
+	if err != nil {
+		t.Fatalf("command: %v", err)
+	}
+	defer release()
+	var out bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &out, &out
+	err = cmd.Run()
+	return strings.TrimSpace(out.String()), err
+}
+
+func TestSandbox(t *testing.T) {
+	if out, err := run(t, Spec{}, "true"); err != nil {
+		t.Skipf("user namespaces not available: %v %s", err, out)
+	}
+	repo := t.TempDir()
+	// Outside /tmp, which the sandbox replaces.
+	outside, err := os.MkdirTemp(".", "outside")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(outside)
+	outside, _ = filepath.Abs(outside)
+
+	spec := Spec{
+		Writable:     []string{repo},
+		Dir:          repo,
+		MemoryBytes:  256 << 20,
+		CPUSeconds:   5,
+		MaxProcesses: 64,
+	}
+	out, err := run(t, spec, "pwd && echo hi > note.txt && echo $$ && grep CapEff /proc/self/status && cat /proc/self/limits /proc/net/dev")
+	if err != nil {
+		t.Fatalf("sandboxed script failed: %v\n%s", err, out)
+	}
+	for _, want := range []string{repo + "\n", "\n1\n", "CapEff:\t0000000000000000", " lo:"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output lacks %q:\n%s", want, out)
+		}
+	}
+	limits := map[string]string{}
+	devices := 0
+	for _, line := range strings.Split(out, "\n") {
+		if name, rest, ok := strings.Cut(line, "  "); ok && strings.HasPrefix(name, "Max ") {
+			limits[name] = strings.Fields(rest)[0]
+		}
+		if strings.Contains(line, "|") || !strings.Contains(line, ":") {
+			continue
+		}
+		if strings.HasPrefix(strings.TrimSpace(line), "lo:") || strings.Contains(line, "eth") {
+			devices++
+		}
+	}
+	wantLimits := map[string]string{"Max address space": "268435456", "Max cpu time": "5", "Max processes": "64"}
+	if _, err := sandboxCgroups(); err == nil {
+		// The cgroup limits memory and processes instead.
+		delete(wantLimits, "Max address space")
+		delete(wantLimits, "Max processes")
+		out, err := run(t, spec, `cg=/sys/fs/cgroup$(cut -d: -f3 /proc/self/cgroup); cat $cg/memory.max $cg/pids.max`)
+		if err != nil || out != "268435456\n64" {
+			t.Errorf("cgroup limits: %q, %v", out, err)
+		}
+	}
+	for name, want := range wantLimits {
+		if limits[name] != want {
+			t.Errorf("%s = %q, want %s", name, limits[name], want)
+		}
+	}
+	if devices != 1 {
+		t.Errorf("expected only loopback in the network namespace:\n%s", out)
+	}
+	if data, err := os.ReadFile(filepath.Join(repo, "note.txt")); err != nil || string(data) != "hi\n" {
+		t.Errorf("write to the work repo: %q, %v", data, err)
+	}
+
+	// /tmp is a private tmpfs; everything else outside the work repo is
+	// read-only.
+	if out, err := run(t, spec, "echo x > /tmp/scratch"); err != nil {
+		t.Errorf("write to private /tmp failed: %v %s", err, out)
+	}
+	for _, target := range []string{filepath.Join(outside, "x"), "/etc/gomikrobot-sandbox-test"} {
+		if _, err := run(t, spec, "echo x > "+target); err == nil {
+			t.Errorf("write to %s succeeded", target)
+		}
+		if _, err := os.Stat(target); err == nil {
+			t.Errorf("%s appeared on the host", target)
+		}
+	}
+	// The private proc hides the host processes, this one included.
+	if out, err := run(t, spec, fmt.Sprintf("test ! -e /proc/%d/environ", os.Getpid())); err != nil {
+		t.Errorf("host process visible in the sandbox: %v %s", err, out)
+	}
+	if out, err := run(t, spec, "mount -o remount,rw / 2>&1 || exit 3"); err == nil {
+		t.Errorf("remount succeeded: %s", out)
+	}
+
+	// With Network the host interfaces stay visible.
+	host, _ := os.ReadFile("/proc/net/dev")
+	out, err = run(t, Spec{Network: true}, "cat /proc/net/dev")
+	if err != nil || strings.Count(out, "\n") != strings.Count(strings.TrimSpace(string(host)), "\n") {
+		t.Errorf("network namespace with Network set:\n%s\nhost:\n%s", out, host)
+	}
+}
+
+func TestSandboxEnv(t *testing.T) {
+	if out, err := run(t, Spec{}, "true"); err != nil {
+		t.Skipf("user namespaces not available: %v %s", err, out)
+	}
+	t.Setenv("GOMIKROBOT_TEST_API_KEY", "s3cret")
+	t.Setenv("GOMIKROBOT_TEST_ALLOWED", "yes")
+	out, err := run(t, Spec{Env: []string{"GOMIKROBOT_TEST_ALLOWED", "GOMIKROBOT_TEST_UNSET"}}, "env")
+	if err != nil {
+		t.Fatalf("env: %v %s", err, out)
+	}
+	if strings.Contains(out, "s3cret") || strings.Contains(out, initEnv) {
+		t.Errorf("host variables leaked into the sandbox:\n%s", out)
+	}
+	for _, want := range []string{"PATH=" + os.Getenv("PATH"), "GOMIKROBOT_TEST_ALLOWED=yes"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("environment lacks %q:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "GOMIKROBOT_TEST_UNSET") {
+		t.Errorf("unset variable passed on:\n%s", out)
+	}
+}
+
+func TestOwnCgroup(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cgroup")
+	if err := os.WriteFile(path, []byte("4:memory:/user.slice\n0::/system.slice/gomikrobot.service\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := ownCgroup(path); err != nil || got != "/system.slice/gomikrobot.service" {
+		t.Errorf("ownCgroup = %q, %v", got, err)
+	}
+	if err := os.WriteFile(path, []byte("4:memory:/user.slice\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ownCgroup(path); err == nil {
+		t.Error("expected an error without a cgroup v2 entry")
+	}
+}
+
+func TestKernelAtLeast(t *testing.T) {
+	for release, want := range map[string]bool{"5.7.0": true, "6.1.0-13-amd64": true, "5.4.0-150-generic": false, "4.19.0": false, "": false} {
+		if got := kernelAtLeast(release, 5, 7); got != want {
+			t.Errorf("kernelAtLeast(%q) = %v, want %v", release, got, want)
+		}
+	}
+}
+
+func TestUnescapeMountPath(t *testing.T) {
+	if got := unescapeMountPath(`/mnt/my\040disk`); got != "/mnt/my disk" {
+		t.Errorf("got %q", got)
+	}
+}
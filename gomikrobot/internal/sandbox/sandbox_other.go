@@ -0,0 +1,16 @@
+//go:build !linux
+
+package sandbox
+
+import (
+	"context"
+	"os/exec"
+)
+
+// Command returns ErrUnsupported; namespaces are Linux-only.
+func Command(ctx context.Context, spec Spec, name string, args ...string) (*exec.Cmd, func(), error) {
+	return nil, func() {}, ErrUnsupported
+}
+
+// Init is a no-op outside Linux.
+func Init() {}
@@ -68,12 +68,70 @@ func (s *Session) GetHistory(maxMessages int) []Message {
 	return result
 }
 
+// Metadata keys for the rolling conversation summary.
+const (
+	// MetaSummary holds the summary of the compacted older turns.
+	MetaSummary = "summary"
+	// MetaSummaryUpTo holds the number of leading messages the summary covers.
+	MetaSummaryUpTo = "summary_upto"
+)
+
+// MessagesFrom returns a copy of the messages starting at index start.
+func (s *Session) MessagesFrom(start int) []Message {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if start < 0 {
+		start = 0
+	}
+	if start >= len(s.Messages) {
+		return []Message{}
+	}
+	result := make([]Message, len(s.Messages)-start)
+	copy(result, s.Messages[start:])
+	return result
+}
+
+// Summary returns the rolling summary and the number of leading messages
+// it replaces. The raw messages stay in the session.
+func (s *Session) Summary() (string, int) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	text, _ := s.Metadata[MetaSummary].(string)
+	var upTo int
+	switch v := s.Metadata[MetaSummaryUpTo].(type) {
+	case int:
+		upTo = v
+	case float64: // after a JSON round trip
+		upTo = int(v)
+	}
+	if upTo < 0 || upTo > len(s.Messages) {
+		upTo = 0
+	}
+	return text, upTo
+}
+
+// SetSummary stores a rolling summary covering the first upTo messages.
+func (s *Session) SetSummary(text string, upTo int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.Metadata == nil {
+		s.Metadata = map[string]any{}
+	}
+	s.Metadata[MetaSummary] = text
+	s.Metadata[MetaSummaryUpTo] = upTo
+	s.UpdatedAt = time.Now()
+}
+
 // Clear removes all messages from the session.
 func (s *Session) Clear() {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
 	s.Messages = []Message{}
+	delete(s.Metadata, MetaSummary)
+	delete(s.Metadata, MetaSummaryUpTo)
 	s.UpdatedAt = time.Now()
 }
 
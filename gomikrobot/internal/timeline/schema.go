@@ -57,6 +57,8 @@ type AgentTask struct {
 	PromptTokens     int        `json:"prompt_tokens"`
 	CompletionTokens int        `json:"completion_tokens"`
 	TotalTokens      int        `json:"total_tokens"`
+	CostUSD          float64    `json:"cost_usd"`
+	Profile          string     `json:"profile,omitempty"`
 	DeliveryAttempts int        `json:"delivery_attempts"`
 	DeliveryNextAt   *time.Time `json:"delivery_next_at,omitempty"`
 	CreatedAt        time.Time  `json:"created_at"`
@@ -69,6 +71,7 @@ const (
 	TaskStatusProcessing = "processing"
 	TaskStatusCompleted  = "completed"
 	TaskStatusFailed     = "failed"
+	TaskStatusCancelled  = "cancelled"
 
 	DeliveryPending = "pending"
 	DeliverySent    = "sent"
@@ -334,16 +337,19 @@ type TopicDensityBucket struct {
 
 // PolicyDecisionRecord represents a logged policy evaluation.
 type PolicyDecisionRecord struct {
-	ID        int64     `json:"id"`
-	TraceID   string    `json:"trace_id,omitempty"`
-	TaskID    string    `json:"task_id,omitempty"`
-	Tool      string    `json:"tool"`
-	Tier      int       `json:"tier"`
-	Sender    string    `json:"sender,omitempty"`
-	Channel   string    `json:"channel,omitempty"`
-	Allowed   bool      `json:"allowed"`
-	Reason    string    `json:"reason,omitempty"`
-	CreatedAt time.Time `json:"created_at"`
+	ID      int64  `json:"id"`
+	TraceID string `json:"trace_id,omitempty"`
+	TaskID  string `json:"task_id,omitempty"`
+	Tool    string `json:"tool"`
+	Tier    int    `json:"tier"`
+	Sender  string `json:"sender,omitempty"`
+	Channel string `json:"channel,omitempty"`
+	Allowed bool   `json:"allowed"`
+	Reason  string `json:"reason,omitempty"`
+	// Category and Confidence are set for intent classifications.
+	Category   string    `json:"category,omitempty"`
+	Confidence float64   `json:"confidence,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
 }
 
 // ApprovalRecord represents a tool approval request stored in the database.
@@ -362,6 +368,43 @@ type ApprovalRecord struct {
 	RespondedAt *time.Time `json:"responded_at,omitempty"`
 }
 
+// LLMUsageRecord is the token usage and cost of a single LLM call.
+type LLMUsageRecord struct {
+	ID               int64     `json:"id"`
+	TraceID          string    `json:"trace_id,omitempty"`
+	TaskID           string    `json:"task_id,omitempty"`
+	Channel          string    `json:"channel,omitempty"`
+	Sender           string    `json:"sender,omitempty"`
+	Model            string    `json:"model"`
+	Provider         string    `json:"provider,omitempty"`
+	PromptTokens     int       `json:"prompt_tokens"`
+	CompletionTokens int       `json:"completion_tokens"`
+	CachedTokens     int       `json:"cached_tokens"`
+	CostUSD          float64   `json:"cost_usd"`
+	CreatedAt        time.Time `json:"created_at"`
+}
+
+// CostBucket aggregates usage for one value of a report dimension.
+type CostBucket struct {
+	Key              string  `json:"key"`
+	Calls            int     `json:"calls"`
+	PromptTokens     int     `json:"prompt_tokens"`
+	CompletionTokens int     `json:"completion_tokens"`
+	CachedTokens     int     `json:"cached_tokens"`
+	CostUSD          float64 `json:"cost_usd"`
+}
+
+// CostReport breaks down LLM spend in a time range by model, channel and sender.
+type CostReport struct {
+	Since     time.Time    `json:"since"`
+	Until     time.Time    `json:"until"`
+	TotalUSD  float64      `json:"total_usd"`
+	Calls     int          `json:"calls"`
+	ByModel   []CostBucket `json:"by_model"`
+	ByChannel []CostBucket `json:"by_channel"`
+	BySender  []CostBucket `json:"by_sender"`
+}
+
 const Schema = `
 CREATE TABLE IF NOT EXISTS timeline (
 	id INTEGER PRIMARY KEY AUTOINCREMENT,
@@ -421,6 +464,8 @@ CREATE TABLE IF NOT EXISTS tasks (
 	prompt_tokens INTEGER NOT NULL DEFAULT 0,
 	completion_tokens INTEGER NOT NULL DEFAULT 0,
 	total_tokens INTEGER NOT NULL DEFAULT 0,
+	cost_usd REAL NOT NULL DEFAULT 0,
+	profile TEXT DEFAULT '',
 	delivery_status TEXT NOT NULL DEFAULT 'pending',
 	delivery_attempts INTEGER NOT NULL DEFAULT 0,
 	delivery_next_at DATETIME,
@@ -443,6 +488,8 @@ CREATE TABLE IF NOT EXISTS policy_decisions (
 	channel TEXT,
 	allowed BOOLEAN NOT NULL,
 	reason TEXT,
+	category TEXT DEFAULT '',
+	confidence REAL NOT NULL DEFAULT 0,
 	created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
 );
 CREATE INDEX IF NOT EXISTS idx_policy_trace ON policy_decisions(trace_id);
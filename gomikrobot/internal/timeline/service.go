@@ -75,6 +75,9 @@ func NewTimelineService(dbPath string) (*TimelineService, error) {
 	_, _ = db.Exec(`ALTER TABLE tasks ADD COLUMN prompt_tokens INTEGER NOT NULL DEFAULT 0`)
 	_, _ = db.Exec(`ALTER TABLE tasks ADD COLUMN completion_tokens INTEGER NOT NULL DEFAULT 0`)
 	_, _ = db.Exec(`ALTER TABLE tasks ADD COLUMN total_tokens INTEGER NOT NULL DEFAULT 0`)
+	_, _ = db.Exec(`ALTER TABLE tasks ADD COLUMN cost_usd REAL NOT NULL DEFAULT 0`)
+	// Best-effort migration: agent profile in effect for the task.
+	_, _ = db.Exec(`ALTER TABLE tasks ADD COLUMN profile TEXT DEFAULT ''`)
 	// Best-effort migration: policy_decisions table.
 	_, _ = db.Exec(`CREATE TABLE IF NOT EXISTS policy_decisions (
 		id INTEGER PRIMARY KEY AUTOINCREMENT,
@@ -90,6 +93,9 @@ func NewTimelineService(dbPath string) (*TimelineService, error) {
 	)`)
 	_, _ = db.Exec(`CREATE INDEX IF NOT EXISTS idx_policy_trace ON policy_decisions(trace_id)`)
 	_, _ = db.Exec(`CREATE INDEX IF NOT EXISTS idx_policy_task ON policy_decisions(task_id)`)
+	// Best-effort migration: intent classification verdicts.
+	_, _ = db.Exec(`ALTER TABLE policy_decisions ADD COLUMN category TEXT DEFAULT ''`)
+	_, _ = db.Exec(`ALTER TABLE policy_decisions ADD COLUMN confidence REAL NOT NULL DEFAULT 0`)
 	// Best-effort migration: memory_chunks table.
 	_, _ = db.Exec(`CREATE TABLE IF NOT EXISTS memory_chunks (
 		id TEXT PRIMARY KEY,
@@ -279,6 +285,72 @@ func NewTimelineService(dbPath string) (*TimelineService, error) {
 	_, _ = db.Exec(`ALTER TABLE group_tasks ADD COLUMN original_requester_id TEXT DEFAULT ''`)
 	_, _ = db.Exec(`ALTER TABLE group_tasks ADD COLUMN deadline_at DATETIME`)
 	_, _ = db.Exec(`ALTER TABLE group_tasks ADD COLUMN accepted_at DATETIME`)
+	// Best-effort migration: llm_usage table (per-call cost accounting).
+	_, _ = db.Exec(`CREATE TABLE IF NOT EXISTS llm_usage (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		trace_id TEXT DEFAULT '',
+		task_id TEXT DEFAULT '',
+		channel TEXT DEFAULT '',
+		sender TEXT DEFAULT '',
+		model TEXT NOT NULL,
+		provider TEXT DEFAULT '',
+		prompt_tokens INTEGER NOT NULL DEFAULT 0,
+		completion_tokens INTEGER NOT NULL DEFAULT 0,
+		cached_tokens INTEGER NOT NULL DEFAULT 0,
+		cost_usd REAL NOT NULL DEFAULT 0,
+		created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+	)`)
+	_, _ = db.Exec(`CREATE INDEX IF NOT EXISTS idx_llm_usage_created ON llm_usage(created_at)`)
+	_, _ = db.Exec(`CREATE INDEX IF NOT EXISTS idx_llm_usage_task ON llm_usage(task_id)`)
+	// Best-effort migration: day2day task store (see internal/day2day).
+	_, _ = db.Exec(`CREATE TABLE IF NOT EXISTS day2day_tasks (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		title TEXT NOT NULL,
+		status TEXT NOT NULL DEFAULT 'open',
+		due TEXT NOT NULL,
+		priority INTEGER NOT NULL DEFAULT 2,
+		tags TEXT DEFAULT '',
+		recurrence TEXT DEFAULT '',
+		carry_over INTEGER NOT NULL DEFAULT 0,
+		snoozed_until DATETIME,
+		created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		completed_at DATETIME
+	)`)
+	_, _ = db.Exec(`CREATE INDEX IF NOT EXISTS idx_day2day_tasks_due ON day2day_tasks(status, due)`)
+	_, _ = db.Exec(`CREATE TABLE IF NOT EXISTS day2day_days (
+		day TEXT PRIMARY KEY,
+		next_task_id INTEGER NOT NULL DEFAULT 0,
+		consolidated_at DATETIME
+	)`)
+	_, _ = db.Exec(`CREATE TABLE IF NOT EXISTS day2day_log (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		day TEXT NOT NULL,
+		kind TEXT NOT NULL,
+		text TEXT NOT NULL,
+		created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+	)`)
+	_, _ = db.Exec(`CREATE INDEX IF NOT EXISTS idx_day2day_log_day ON day2day_log(day)`)
+	// Best-effort migration: file change journal (see internal/journal).
+	_, _ = db.Exec(`CREATE TABLE IF NOT EXISTS file_changes (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		trace_id TEXT DEFAULT '',
+		task_id TEXT DEFAULT '',
+		channel TEXT DEFAULT '',
+		chat_id TEXT DEFAULT '',
+		tool TEXT NOT NULL,
+		path TEXT NOT NULL,
+		before_exists INTEGER NOT NULL DEFAULT 0,
+		before_mode INTEGER DEFAULT 0,
+		before_content TEXT DEFAULT '',
+		after_exists INTEGER NOT NULL DEFAULT 0,
+		after_content TEXT DEFAULT '',
+		created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		reverted_at DATETIME
+	)`)
+	_, _ = db.Exec(`ALTER TABLE file_changes ADD COLUMN before_mode INTEGER DEFAULT 0`)
+	_, _ = db.Exec(`CREATE INDEX IF NOT EXISTS idx_file_changes_task ON file_changes(task_id)`)
+	_, _ = db.Exec(`CREATE INDEX IF NOT EXISTS idx_file_changes_chat ON file_changes(channel, chat_id)`)
 
 	return &TimelineService{db: db}, nil
 }
@@ -537,8 +609,8 @@ func (s *TimelineService) CreateTask(task *AgentTask) (*AgentTask, error) {
 	}
 
 	query := `
-	INSERT INTO tasks (task_id, idempotency_key, trace_id, channel, chat_id, sender_id, message_type, status, content_in, delivery_status)
-	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	INSERT INTO tasks (task_id, idempotency_key, trace_id, channel, chat_id, sender_id, message_type, status, content_in, delivery_status, profile)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
 	// Pass NULL for empty idempotency_key to avoid UNIQUE constraint on empty strings.
 	var idempKey interface{}
@@ -556,6 +628,7 @@ func (s *TimelineService) CreateTask(task *AgentTask) (*AgentTask, error) {
 		task.Status,
 		task.ContentIn,
 		task.DeliveryStatus,
+		task.Profile,
 	)
 	if err != nil {
 		return nil, fmt.Errorf("create task: %w", err)
@@ -570,7 +643,7 @@ func (s *TimelineService) GetTask(taskID string) (*AgentTask, error) {
 	query := `SELECT id, task_id, COALESCE(idempotency_key,''), COALESCE(trace_id,''),
 		channel, chat_id, COALESCE(sender_id,''), COALESCE(message_type,''), status,
 		COALESCE(content_in,''), COALESCE(content_out,''), COALESCE(error_text,''),
-		prompt_tokens, completion_tokens, total_tokens,
+		prompt_tokens, completion_tokens, total_tokens, cost_usd, COALESCE(profile,''),
 		delivery_status, delivery_attempts, delivery_next_at,
 		created_at, updated_at, completed_at
 	FROM tasks WHERE task_id = ?`
@@ -581,7 +654,7 @@ func (s *TimelineService) GetTask(taskID string) (*AgentTask, error) {
 		&t.ID, &t.TaskID, &t.IdempotencyKey, &t.TraceID,
 		&t.Channel, &t.ChatID, &t.SenderID, &t.MessageType, &t.Status,
 		&t.ContentIn, &t.ContentOut, &t.ErrorText,
-		&t.PromptTokens, &t.CompletionTokens, &t.TotalTokens,
+		&t.PromptTokens, &t.CompletionTokens, &t.TotalTokens, &t.CostUSD, &t.Profile,
 		&t.DeliveryStatus, &t.DeliveryAttempts, &deliveryNextAt,
 		&t.CreatedAt, &t.UpdatedAt, &completedAt,
 	)
@@ -609,7 +682,7 @@ func (s *TimelineService) GetTaskByIdempotencyKey(key string) (*AgentTask, error
 	query := `SELECT id, task_id, COALESCE(idempotency_key,''), COALESCE(trace_id,''),
 		channel, chat_id, COALESCE(sender_id,''), COALESCE(message_type,''), status,
 		COALESCE(content_in,''), COALESCE(content_out,''), COALESCE(error_text,''),
-		prompt_tokens, completion_tokens, total_tokens,
+		prompt_tokens, completion_tokens, total_tokens, cost_usd, COALESCE(profile,''),
 		delivery_status, delivery_attempts, delivery_next_at,
 		created_at, updated_at, completed_at
 	FROM tasks WHERE idempotency_key = ?`
@@ -620,7 +693,7 @@ func (s *TimelineService) GetTaskByIdempotencyKey(key string) (*AgentTask, error
 		&t.ID, &t.TaskID, &t.IdempotencyKey, &t.TraceID,
 		&t.Channel, &t.ChatID, &t.SenderID, &t.MessageType, &t.Status,
 		&t.ContentIn, &t.ContentOut, &t.ErrorText,
-		&t.PromptTokens, &t.CompletionTokens, &t.TotalTokens,
+		&t.PromptTokens, &t.CompletionTokens, &t.TotalTokens, &t.CostUSD, &t.Profile,
 		&t.DeliveryStatus, &t.DeliveryAttempts, &deliveryNextAt,
 		&t.CreatedAt, &t.UpdatedAt, &completedAt,
 	)
@@ -642,7 +715,7 @@ func (s *TimelineService) GetTaskByIdempotencyKey(key string) (*AgentTask, error
 // UpdateTaskStatus updates a task's status, content_out, and error_text.
 func (s *TimelineService) UpdateTaskStatus(taskID, status, contentOut, errorText string) error {
 	query := `UPDATE tasks SET status = ?, content_out = ?, error_text = ?, updated_at = datetime('now')`
-	if status == TaskStatusCompleted || status == TaskStatusFailed {
+	if status == TaskStatusCompleted || status == TaskStatusFailed || status == TaskStatusCancelled {
 		query += `, completed_at = datetime('now')`
 	}
 	query += ` WHERE task_id = ?`
@@ -669,7 +742,7 @@ func (s *TimelineService) ListPendingDeliveries(limit int) ([]AgentTask, error)
 	query := `SELECT id, task_id, COALESCE(idempotency_key,''), COALESCE(trace_id,''),
 		channel, chat_id, COALESCE(sender_id,''), COALESCE(message_type,''), status,
 		COALESCE(content_in,''), COALESCE(content_out,''), COALESCE(error_text,''),
-		prompt_tokens, completion_tokens, total_tokens,
+		prompt_tokens, completion_tokens, total_tokens, cost_usd, COALESCE(profile,''),
 		delivery_status, delivery_attempts, delivery_next_at,
 		created_at, updated_at, completed_at
 	FROM tasks
@@ -694,7 +767,7 @@ func (s *TimelineService) ListTasks(status, channel string, limit, offset int) (
 	query := `SELECT id, task_id, COALESCE(idempotency_key,''), COALESCE(trace_id,''),
 		channel, chat_id, COALESCE(sender_id,''), COALESCE(message_type,''), status,
 		COALESCE(content_in,''), COALESCE(content_out,''), COALESCE(error_text,''),
-		prompt_tokens, completion_tokens, total_tokens,
+		prompt_tokens, completion_tokens, total_tokens, cost_usd, COALESCE(profile,''),
 		delivery_status, delivery_attempts, delivery_next_at,
 		created_at, updated_at, completed_at
 	FROM tasks WHERE 1=1`
@@ -728,7 +801,7 @@ func scanTasks(rows *sql.Rows) ([]AgentTask, error) {
 			&t.ID, &t.TaskID, &t.IdempotencyKey, &t.TraceID,
 			&t.Channel, &t.ChatID, &t.SenderID, &t.MessageType, &t.Status,
 			&t.ContentIn, &t.ContentOut, &t.ErrorText,
-			&t.PromptTokens, &t.CompletionTokens, &t.TotalTokens,
+			&t.PromptTokens, &t.CompletionTokens, &t.TotalTokens, &t.CostUSD, &t.Profile,
 			&t.DeliveryStatus, &t.DeliveryAttempts, &deliveryNextAt,
 			&t.CreatedAt, &t.UpdatedAt, &completedAt,
 		)
@@ -764,18 +837,24 @@ func (s *TimelineService) GetDailyTokenUsage() (int, error) {
 	return total, err
 }
 
+// AddTaskCost adds cost_usd to a task.
+func (s *TimelineService) AddTaskCost(taskID string, costUSD float64) error {
+	_, err := s.db.Exec(`UPDATE tasks SET cost_usd = cost_usd + ?, updated_at = datetime('now') WHERE task_id = ?`, costUSD, taskID)
+	return err
+}
+
 // LogPolicyDecision records a policy evaluation result.
 func (s *TimelineService) LogPolicyDecision(rec *PolicyDecisionRecord) error {
-	_, err := s.db.Exec(`INSERT INTO policy_decisions (trace_id, task_id, tool, tier, sender, channel, allowed, reason)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
-		rec.TraceID, rec.TaskID, rec.Tool, rec.Tier, rec.Sender, rec.Channel, rec.Allowed, rec.Reason)
+	_, err := s.db.Exec(`INSERT INTO policy_decisions (trace_id, task_id, tool, tier, sender, channel, allowed, reason, category, confidence)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		rec.TraceID, rec.TaskID, rec.Tool, rec.Tier, rec.Sender, rec.Channel, rec.Allowed, rec.Reason, rec.Category, rec.Confidence)
 	return err
 }
 
 // ListPolicyDecisions returns policy decisions matching the given trace_id.
 func (s *TimelineService) ListPolicyDecisions(traceID string) ([]PolicyDecisionRecord, error) {
 	rows, err := s.db.Query(`SELECT id, COALESCE(trace_id,''), COALESCE(task_id,''), tool, tier,
-		COALESCE(sender,''), COALESCE(channel,''), allowed, COALESCE(reason,''), created_at
+		COALESCE(sender,''), COALESCE(channel,''), allowed, COALESCE(reason,''), COALESCE(category,''), confidence, created_at
 		FROM policy_decisions WHERE trace_id = ? ORDER BY created_at ASC`, traceID)
 	if err != nil {
 		return nil, err
@@ -785,7 +864,7 @@ func (s *TimelineService) ListPolicyDecisions(traceID string) ([]PolicyDecisionR
 	for rows.Next() {
 		var r PolicyDecisionRecord
 		if err := rows.Scan(&r.ID, &r.TraceID, &r.TaskID, &r.Tool, &r.Tier,
-			&r.Sender, &r.Channel, &r.Allowed, &r.Reason, &r.CreatedAt); err != nil {
+			&r.Sender, &r.Channel, &r.Allowed, &r.Reason, &r.Category, &r.Confidence, &r.CreatedAt); err != nil {
 			return nil, err
 		}
 		out = append(out, r)
@@ -798,7 +877,7 @@ func (s *TimelineService) GetTaskByTraceID(traceID string) (*AgentTask, error) {
 	row := s.db.QueryRow(`SELECT id, task_id, COALESCE(idempotency_key,''), COALESCE(trace_id,''),
 		channel, chat_id, COALESCE(sender_id,''), status, COALESCE(content_in,''), COALESCE(content_out,''),
 		COALESCE(error_text,''), COALESCE(delivery_status,'pending'), delivery_attempts,
-		delivery_next_at, prompt_tokens, completion_tokens, total_tokens,
+		delivery_next_at, prompt_tokens, completion_tokens, total_tokens, cost_usd, COALESCE(profile,''),
 		created_at, updated_at, completed_at
 		FROM tasks WHERE trace_id = ? LIMIT 1`, traceID)
 	var t AgentTask
@@ -806,7 +885,7 @@ func (s *TimelineService) GetTaskByTraceID(traceID string) (*AgentTask, error) {
 	err := row.Scan(&t.ID, &t.TaskID, &t.IdempotencyKey, &t.TraceID,
 		&t.Channel, &t.ChatID, &t.SenderID, &t.Status, &t.ContentIn, &t.ContentOut,
 		&t.ErrorText, &t.DeliveryStatus, &t.DeliveryAttempts,
-		&nextAt, &t.PromptTokens, &t.CompletionTokens, &t.TotalTokens,
+		&nextAt, &t.PromptTokens, &t.CompletionTokens, &t.TotalTokens, &t.CostUSD, &t.Profile,
 		&t.CreatedAt, &t.UpdatedAt, &completedAt)
 	if err != nil {
 		if err.Error() == "sql: no rows in result set" {
@@ -908,6 +987,8 @@ func (s *TimelineService) GetTraceGraph(traceID string) (*TraceGraph, error) {
 			"prompt_tokens":     task.PromptTokens,
 			"completion_tokens": task.CompletionTokens,
 			"total_tokens":      task.TotalTokens,
+			"cost_usd":          task.CostUSD,
+			"profile":           task.Profile,
 			"channel":           task.Channel,
 			"created_at":        task.CreatedAt,
 			"completed_at":      task.CompletedAt,
@@ -919,11 +1000,13 @@ func (s *TimelineService) GetTraceGraph(traceID string) (*TraceGraph, error) {
 	if decisions, err := s.ListPolicyDecisions(traceID); err == nil {
 		for _, d := range decisions {
 			policyDecisions = append(policyDecisions, map[string]any{
-				"tool":    d.Tool,
-				"tier":    d.Tier,
-				"allowed": d.Allowed,
-				"reason":  d.Reason,
-				"time":    d.CreatedAt.Format("15:04:05"),
+				"tool":       d.Tool,
+				"tier":       d.Tier,
+				"allowed":    d.Allowed,
+				"reason":     d.Reason,
+				"category":   d.Category,
+				"confidence": d.Confidence,
+				"time":       d.CreatedAt.Format("15:04:05"),
 			})
 		}
 	}
@@ -2140,3 +2223,94 @@ func (s *TimelineService) GetTopicEnvelopeTypeCounts(topicName string) (map[stri
 	}
 	return out, rows.Err()
 }
+
+// --- LLM Usage & Costs ---
+
+// usageTimeFormat matches SQLite's CURRENT_TIMESTAMP so range queries
+// compare as strings.
+const usageTimeFormat = "2006-01-02 15:04:05"
+
+// RecordLLMUsage stores the usage and cost of one LLM call.
+func (s *TimelineService) RecordLLMUsage(rec *LLMUsageRecord) error {
+	if rec.CreatedAt.IsZero() {
+		rec.CreatedAt = time.Now()
+	}
+	_, err := s.db.Exec(`INSERT INTO llm_usage
+		(trace_id, task_id, channel, sender, model, provider,
+		 prompt_tokens, completion_tokens, cached_tokens, cost_usd, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		rec.TraceID, rec.TaskID, rec.Channel, rec.Sender, rec.Model, rec.Provider,
+		rec.PromptTokens, rec.CompletionTokens, rec.CachedTokens, rec.CostUSD,
+		rec.CreatedAt.UTC().Format(usageTimeFormat))
+	if err != nil {
+		return fmt.Errorf("record llm usage: %w", err)
+	}
+	return nil
+}
+
+// SpendSince returns the USD spent since the given time. Empty channel or
+// sender match all.
+func (s *TimelineService) SpendSince(since time.Time, channel, sender string) (float64, error) {
+	query := `SELECT COALESCE(SUM(cost_usd), 0) FROM llm_usage WHERE created_at >= ?`
+	args := []interface{}{since.UTC().Format(usageTimeFormat)}
+	if channel != "" {
+		query += " AND channel = ?"
+		args = append(args, channel)
+	}
+	if sender != "" {
+		query += " AND sender = ?"
+		args = append(args, sender)
+	}
+	var total float64
+	if err := s.db.QueryRow(query, args...).Scan(&total); err != nil {
+		return 0, fmt.Errorf("spend since: %w", err)
+	}
+	return total, nil
+}
+
+// GetCostReport aggregates LLM usage in [since, until) by model, channel
+// and sender, most expensive first.
+func (s *TimelineService) GetCostReport(since, until time.Time) (*CostReport, error) {
+	report := &CostReport{Since: since, Until: until}
+	from, to := since.UTC().Format(usageTimeFormat), until.UTC().Format(usageTimeFormat)
+
+	err := s.db.QueryRow(`SELECT COUNT(*), COALESCE(SUM(cost_usd), 0)
+		FROM llm_usage WHERE created_at >= ? AND created_at < ?`, from, to).
+		Scan(&report.Calls, &report.TotalUSD)
+	if err != nil {
+		return nil, fmt.Errorf("cost report: %w", err)
+	}
+
+	for _, dim := range []struct {
+		column string
+		out    *[]CostBucket
+	}{
+		{"model", &report.ByModel},
+		{"channel", &report.ByChannel},
+		{"sender", &report.BySender},
+	} {
+		rows, err := s.db.Query(`SELECT COALESCE(`+dim.column+`, ''), COUNT(*),
+			SUM(prompt_tokens), SUM(completion_tokens), SUM(cached_tokens), SUM(cost_usd)
+			FROM llm_usage WHERE created_at >= ? AND created_at < ?
+			GROUP BY 1 ORDER BY 6 DESC`, from, to)
+		if err != nil {
+			return nil, fmt.Errorf("cost report by %s: %w", dim.column, err)
+		}
+		buckets := []CostBucket{}
+		for rows.Next() {
+			var b CostBucket
+			if err := rows.Scan(&b.Key, &b.Calls, &b.PromptTokens, &b.CompletionTokens, &b.CachedTokens, &b.CostUSD); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			buckets = append(buckets, b)
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return nil, err
+		}
+		*dim.out = buckets
+	}
+	return report, nil
+}
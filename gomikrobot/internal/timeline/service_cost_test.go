@@ -0,0 +1,87 @@
+package timeline
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestAddTaskCost(t *testing.T) {
+	svc := newTestTimeline(t)
+
+	task, err := svc.CreateTask(&AgentTask{Channel: "whatsapp", ChatID: "a", ContentIn: "hi"})
+	if err != nil {
+		t.Fatalf("create task: %v", err)
+	}
+	_ = svc.AddTaskCost(task.TaskID, 0.25)
+	_ = svc.AddTaskCost(task.TaskID, 0.5)
+
+	got, err := svc.GetTask(task.TaskID)
+	if err != nil {
+		t.Fatalf("get task: %v", err)
+	}
+	if math.Abs(got.CostUSD-0.75) > 1e-9 {
+		t.Fatalf("expected cost 0.75, got %v", got.CostUSD)
+	}
+}
+
+func TestSpendSinceAndCostReport(t *testing.T) {
+	svc := newTestTimeline(t)
+	now := time.Now()
+
+	records := []LLMUsageRecord{
+		{Channel: "whatsapp", Sender: "alice", Model: "gpt-4o", PromptTokens: 100, CompletionTokens: 10, CostUSD: 1.0},
+		{Channel: "whatsapp", Sender: "bob", Model: "gpt-4o", PromptTokens: 200, CompletionTokens: 20, CostUSD: 2.0},
+		{Channel: "cli", Sender: "", Model: "claude-sonnet-4", PromptTokens: 50, CompletionTokens: 5, CachedTokens: 40, CostUSD: 0.5},
+		// Two days old: outside today's window.
+		{Channel: "whatsapp", Sender: "alice", Model: "gpt-4o", CostUSD: 10, CreatedAt: now.Add(-48 * time.Hour)},
+	}
+	for i := range records {
+		if err := svc.RecordLLMUsage(&records[i]); err != nil {
+			t.Fatalf("record usage: %v", err)
+		}
+	}
+
+	since := now.Add(-time.Hour)
+	tests := []struct {
+		channel, sender string
+		want            float64
+	}{
+		{"", "", 3.5},
+		{"whatsapp", "", 3.0},
+		{"", "alice", 1.0},
+		{"cli", "", 0.5},
+	}
+	for _, tt := range tests {
+		got, err := svc.SpendSince(since, tt.channel, tt.sender)
+		if err != nil {
+			t.Fatalf("spend since: %v", err)
+		}
+		if math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("SpendSince(%q, %q) = %v, want %v", tt.channel, tt.sender, got, tt.want)
+		}
+	}
+	if all, _ := svc.SpendSince(now.Add(-72*time.Hour), "", ""); math.Abs(all-13.5) > 1e-9 {
+		t.Fatalf("expected 13.5 over three days, got %v", all)
+	}
+
+	report, err := svc.GetCostReport(since, now.Add(time.Minute))
+	if err != nil {
+		t.Fatalf("cost report: %v", err)
+	}
+	if report.Calls != 3 || math.Abs(report.TotalUSD-3.5) > 1e-9 {
+		t.Fatalf("unexpected totals: calls=%d total=%v", report.Calls, report.TotalUSD)
+	}
+	if len(report.ByModel) != 2 || report.ByModel[0].Key != "gpt-4o" || report.ByModel[0].Calls != 2 {
+		t.Fatalf("unexpected by_model: %+v", report.ByModel)
+	}
+	if report.ByModel[1].CachedTokens != 40 {
+		t.Fatalf("expected cached tokens on claude bucket, got %+v", report.ByModel[1])
+	}
+	if len(report.ByChannel) != 2 || report.ByChannel[0].Key != "whatsapp" {
+		t.Fatalf("unexpected by_channel: %+v", report.ByChannel)
+	}
+	if len(report.BySender) != 3 || report.BySender[0].Key != "bob" {
+		t.Fatalf("unexpected by_sender: %+v", report.BySender)
+	}
+}
@@ -0,0 +1,238 @@
+package tools
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Paging limits of read_artifact.
+const (
+	defaultArtifactLines = 200
+	maxArtifactLines     = 1000
+	maxArtifactMatches   = 200
+	// defaultArtifactChars bounds one result, like the loop's spill limit.
+	defaultArtifactChars = 16000
+)
+
+var artifactIDPattern = regexp.MustCompile(`^art_[0-9a-f]{16}$`)
+
+// ArtifactStore keeps large tool outputs as scratch files so the model can
+// page through them instead of receiving them whole.
+type ArtifactStore struct {
+	dir string
+}
+
+// NewArtifactStore returns a store writing to dir (created on first save).
+func NewArtifactStore(dir string) *ArtifactStore {
+	return &ArtifactStore{dir: dir}
+}
+
+// Save writes content to a new artifact and returns its ID and path.
+func (s *ArtifactStore) Save(content string) (string, string, error) {
+	if err := os.MkdirAll(s.dir, 0o755); err != nil {
+		return "", "", fmt.Errorf("create artifact dir: %w", err)
+	}
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", fmt.Errorf("artifact id: %w", err)
+	}
+	id := "art_" + hex.EncodeToString(buf)
+	path := s.path(id)
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		return "", "", fmt.Errorf("write artifact: %w", err)
+	}
+	return id, path, nil
+}
+
+// Load returns the content of an artifact.
+func (s *ArtifactStore) Load(id string) (string, error) {
+	if !artifactIDPattern.MatchString(id) {
+		return "", fmt.Errorf("invalid artifact id: %q", id)
+	}
+	data, err := os.ReadFile(s.path(id))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", fmt.Errorf("artifact not found: %s", id)
+		}
+		return "", fmt.Errorf("read artifact: %w", err)
+	}
+	return string(data), nil
+}
+
+func (s *ArtifactStore) path(id string) string {
+	return filepath.Join(s.dir, id+".txt")
+}
+
+// Preview returns the head and tail of a large output with a note telling
+// the model how to read the rest.
+func Preview(toolName, id, content string, headLines, tailLines int) string {
+	lines := strings.Split(content, "\n")
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "[Output of %s was %d characters in %d lines and was saved as artifact %s. "+
+		"Use read_artifact with id %q to read it by line offset or search it with a pattern.]\n",
+		toolName, len(content), len(lines), id, id)
+
+	if len(lines) <= headLines+tailLines {
+		// Few but very long lines: show the first and last characters.
+		fmt.Fprintf(&sb, "--- start ---\n%s\n--- end ---\n%s", truncate(content, 2000), tail(content, 1000))
+		return sb.String()
+	}
+	fmt.Fprintf(&sb, "--- lines 1-%d ---\n", headLines)
+	for _, l := range lines[:headLines] {
+		sb.WriteString(truncate(l, 300) + "\n")
+	}
+	fmt.Fprintf(&sb, "--- %d lines omitted ---\n", len(lines)-headLines-tailLines)
+	fmt.Fprintf(&sb, "--- lines %d-%d ---\n", len(lines)-tailLines+1, len(lines))
+	for _, l := range lines[len(lines)-tailLines:] {
+		sb.WriteString(truncate(l, 300) + "\n")
+	}
+	return strings.TrimRight(sb.String(), "\n")
+}
+
+func tail(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return "..." + s[len(s)-n:]
+}
+
+// ReadArtifactTool pages through or searches a saved tool output.
+type ReadArtifactTool struct {
+	store *ArtifactStore
+	// MaxChars bounds the size of one result, so a page never brings back
+	// the output it was spilled to keep out of the context. A shorter page
+	// tells the model the offset to continue at. 0 means 16000.
+	MaxChars int
+}
+
+func NewReadArtifactTool(store *ArtifactStore) *ReadArtifactTool {
+	return &ReadArtifactTool{store: store}
+}
+
+func (t *ReadArtifactTool) Name() string { return "read_artifact" }
+func (t *ReadArtifactTool) Tier() int    { return TierReadOnly }
+
+func (t *ReadArtifactTool) Description() string {
+	return "Read a large tool output that was saved as an artifact. Page through it with offset/limit (line numbers) " +
+		"or pass a regular expression as pattern to get the matching lines."
+}
+
+func (t *ReadArtifactTool) Parameters() map[string]any {
+	return map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"id": map[string]any{
+				"type":        "string",
+				"description": "Artifact ID, e.g. art_0123456789abcdef",
+			},
+			"offset": map[string]any{
+				"type":        "integer",
+				"description": "First line to return, starting at 1 (default 1)",
+			},
+			"limit": map[string]any{
+				"type":        "integer",
+				"description": fmt.Sprintf("Number of lines to return (default %d, at most %d)", defaultArtifactLines, maxArtifactLines),
+			},
+			"pattern": map[string]any{
+				"type":        "string",
+				"description": "Regular expression; returns matching lines with their line numbers instead of a page",
+			},
+		},
+		"required": []string{"id"},
+	}
+}
+
+func (t *ReadArtifactTool) Execute(ctx context.Context, params map[string]any) (string, error) {
+	id := strings.TrimSpace(GetString(params, "id", ""))
+	if id == "" {
+		return "Error: id is required", nil
+	}
+	content, err := t.store.Load(id)
+	if err != nil {
+		return fmt.Sprintf("Error: %v", err), nil
+	}
+	lines := strings.Split(content, "\n")
+
+	if pattern := GetString(params, "pattern", ""); pattern != "" {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return fmt.Sprintf("Error: invalid pattern: %v", err), nil
+		}
+		var sb strings.Builder
+		matches := 0
+		for i, l := range lines {
+			if !re.MatchString(l) {
+				continue
+			}
+			if matches == maxArtifactMatches {
+				fmt.Fprintf(&sb, "[more than %d matches; narrow the pattern]\n", maxArtifactMatches)
+				break
+			}
+			match := fmt.Sprintf("%d: %s\n", i+1, truncate(l, 500))
+			if matches > 0 && sb.Len()+len(match) > t.maxChars() {
+				fmt.Fprintf(&sb, "[matches cut at %d characters; narrow the pattern or page from offset %d]\n", t.maxChars(), i+1)
+				break
+			}
+			sb.WriteString(match)
+			matches++
+		}
+		if matches == 0 {
+			return fmt.Sprintf("No lines in %s match %q.", id, pattern), nil
+		}
+		return strings.TrimRight(sb.String(), "\n"), nil
+	}
+
+	offset := GetInt(params, "offset", 1)
+	if offset < 1 {
+		offset = 1
+	}
+	limit := GetInt(params, "limit", defaultArtifactLines)
+	if limit <= 0 {
+		limit = defaultArtifactLines
+	}
+	if limit > maxArtifactLines {
+		limit = maxArtifactLines
+	}
+	if offset > len(lines) {
+		return fmt.Sprintf("Offset %d is past the end of %s (%d lines).", offset, id, len(lines)), nil
+	}
+	end := offset - 1 + limit
+	if end > len(lines) {
+		end = len(lines)
+	}
+
+	// Lines up to the character limit, but at least one.
+	var body strings.Builder
+	last := offset - 1
+	for last < end {
+		line := truncate(lines[last], 1000) + "\n"
+		if last >= offset && body.Len()+len(line) > t.maxChars() {
+			break
+		}
+		body.WriteString(line)
+		last++
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "[%s lines %d-%d of %d]\n", id, offset, last, len(lines))
+	sb.WriteString(body.String())
+	if last < end {
+		fmt.Fprintf(&sb, "[page cut at %d characters; continue with offset %d]", t.maxChars(), last+1)
+	} else if last < len(lines) {
+		fmt.Fprintf(&sb, "[continue with offset %d]", last+1)
+	}
+	return strings.TrimRight(sb.String(), "\n"), nil
+}
+
+func (t *ReadArtifactTool) maxChars() int {
+	if t.MaxChars > 0 {
+		return t.MaxChars
+	}
+	return defaultArtifactChars
+}
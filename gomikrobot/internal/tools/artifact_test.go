@@ -0,0 +1,77 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestArtifactSaveAndPage(t *testing.T) {
+	store := NewArtifactStore(t.TempDir())
+	var lines []string
+	for i := 1; i <= 500; i++ {
+		lines = append(lines, fmt.Sprintf("line %d", i))
+	}
+	id, _, err := store.Save(strings.Join(lines, "\n"))
+	if err != nil {
+		t.Fatalf("save: %v", err)
+	}
+
+	tool := NewReadArtifactTool(store)
+	out, _ := tool.Execute(context.Background(), map[string]any{"id": id, "offset": float64(101), "limit": float64(3)})
+	if !strings.Contains(out, "lines 101-103 of 500") || !strings.Contains(out, "line 103") || strings.Contains(out, "line 104") {
+		t.Fatalf("unexpected page: %q", out)
+	}
+
+	out, _ = tool.Execute(context.Background(), map[string]any{"id": id, "pattern": `^line 4\d\d$`})
+	if !strings.HasPrefix(out, "400: line 400") || strings.Count(out, "\n") != 99 {
+		t.Fatalf("unexpected grep result: %q", out)
+	}
+
+	out, _ = tool.Execute(context.Background(), map[string]any{"id": "../../etc/passwd"})
+	if !strings.Contains(out, "invalid artifact id") {
+		t.Fatalf("expected path traversal to be rejected, got %q", out)
+	}
+}
+
+func TestArtifactPageIsCutAtMaxChars(t *testing.T) {
+	store := NewArtifactStore(t.TempDir())
+	line := strings.Repeat("x", 990)
+	var lines []string
+	for i := 0; i < 1000; i++ {
+		lines = append(lines, line)
+	}
+	id, _, err := store.Save(strings.Join(lines, "\n"))
+	if err != nil {
+		t.Fatalf("save: %v", err)
+	}
+
+	tool := NewReadArtifactTool(store)
+	tool.MaxChars = 5000
+	out, _ := tool.Execute(context.Background(), map[string]any{"id": id, "limit": float64(1000)})
+	if len(out) > 5200 || !strings.Contains(out, "lines 1-5 of 1000") || !strings.HasSuffix(out, "continue with offset 6]") {
+		t.Fatalf("expected a page cut at 5000 characters, got %d chars: %q", len(out), out[:100])
+	}
+
+	out, _ = tool.Execute(context.Background(), map[string]any{"id": id, "pattern": "x"})
+	if len(out) > 5200 || !strings.Contains(out, "matches cut at 5000 characters") {
+		t.Fatalf("expected matches cut at 5000 characters, got %d chars", len(out))
+	}
+}
+
+func TestPreviewShowsHeadAndTail(t *testing.T) {
+	var lines []string
+	for i := 1; i <= 100; i++ {
+		lines = append(lines, fmt.Sprintf("row %d", i))
+	}
+	p := Preview("exec", "art_0123456789abcdef", strings.Join(lines, "\n"), 5, 3)
+	for _, want := range []string{"art_0123456789abcdef", "row 5\n", "92 lines omitted", "row 98", "row 100"} {
+		if !strings.Contains(p, want) {
+			t.Errorf("preview missing %q:\n%s", want, p)
+		}
+	}
+	if strings.Contains(p, "row 50\n") {
+		t.Error("preview should omit the middle")
+	}
+}
@@ -0,0 +1,74 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/kamir/gomikrobot/internal/day2day"
+)
+
+// day2dayActions maps the tool's actions to day2day chat commands.
+var day2dayActions = map[string]string{
+	"add":         "dtu",
+	"progress":    "dtp",
+	"consolidate": "dts",
+	"next":        "dtn",
+	"open":        "dta",
+	"list":        "dtl",
+	"done":        "dtd",
+	"snooze":      "dtz",
+	"reschedule":  "dtr",
+}
+
+// Day2DayTool gives access to the day2day task planner.
+type Day2DayTool struct {
+	service *day2day.Service
+}
+
+func NewDay2DayTool(service *day2day.Service) *Day2DayTool {
+	return &Day2DayTool{service: service}
+}
+
+func (t *Day2DayTool) Name() string { return "day2day" }
+func (t *Day2DayTool) Description() string {
+	return "Manage the day2day task plan: add tasks, log progress, list open tasks, suggest the next step, and mark, snooze or reschedule tasks."
+}
+func (t *Day2DayTool) Tier() int { return TierWrite }
+
+func (t *Day2DayTool) Parameters() map[string]any {
+	actions := make([]string, 0, len(day2dayActions))
+	for a := range day2dayActions {
+		actions = append(actions, a)
+	}
+	sort.Strings(actions)
+	return map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"action": map[string]any{
+				"type":        "string",
+				"enum":        actions,
+				"description": "add (one task per line in text), progress, consolidate, next, open, list (text: done|all), done (text: task id or title), snooze (text: '<id> <when>'), reschedule (text: '<id> <day>')",
+			},
+			"text": map[string]any{
+				"type":        "string",
+				"description": "Argument of the action",
+			},
+		},
+		"required": []string{"action"},
+	}
+}
+
+func (t *Day2DayTool) Execute(ctx context.Context, params map[string]any) (string, error) {
+	action := strings.ToLower(GetString(params, "action", ""))
+	kind, ok := day2dayActions[action]
+	if !ok {
+		return fmt.Sprintf("Error: unknown action %q", action), nil
+	}
+	text := strings.TrimSpace(GetString(params, "text", ""))
+	if text == "" && (kind == "dtu" || kind == "dtp" || kind == "dtd" || kind == "dtz" || kind == "dtr") {
+		return fmt.Sprintf("Error: action %s requires text", action), nil
+	}
+	return t.service.Run(ctx, day2day.Command{Kind: kind, Text: text}), nil
+}
@@ -119,6 +119,11 @@ func (t *WriteFileTool) Execute(ctx context.Context, params map[string]any) (str
 	return fmt.Sprintf("Successfully wrote %d bytes to %s", len(content), path), nil
 }
 
+// ChangedFiles returns the file the call writes.
+func (t *WriteFileTool) ChangedFiles(params map[string]any) []string {
+	return repoFile(t.workRepoRoot, params)
+}
+
 // EditFileTool replaces text in a file.
 type EditFileTool struct {
 	workRepoRoot func() string
@@ -152,6 +157,11 @@ func (t *EditFileTool) Parameters() map[string]any {
 	}
 }
 
+// ChangedFiles returns the file the call edits.
+func (t *EditFileTool) ChangedFiles(params map[string]any) []string {
+	return repoFile(t.workRepoRoot, params)
+}
+
 func (t *EditFileTool) Execute(ctx context.Context, params map[string]any) (string, error) {
 	path := GetString(params, "path", "")
 	oldText := GetString(params, "old_text", "")
@@ -341,6 +351,20 @@ func normalizeRoot(root string) string {
 	return expandPath(root)
 }
 
+// repoFile resolves the "path" parameter like the write tools do. It
+// returns nothing if the path is missing or outside the work repo.
+func repoFile(workRepoRoot func() string, params map[string]any) []string {
+	path := GetString(params, "path", "")
+	if path == "" {
+		return nil
+	}
+	path = expandPath(path)
+	if workRepoRoot != nil && !isWithin(workRepoRoot(), path) {
+		return nil
+	}
+	return []string{path}
+}
+
 func isWithin(root, path string) bool {
 	if root == "" {
 		return true
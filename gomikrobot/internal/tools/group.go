@@ -0,0 +1,54 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// SubmitFunc hands a task to the agent group and returns its task ID.
+type SubmitFunc func(ctx context.Context, description, content string) (string, error)
+
+// GroupSubmitTaskTool submits a task to the agent group.
+type GroupSubmitTaskTool struct {
+	submit SubmitFunc
+}
+
+func NewGroupSubmitTaskTool(submit SubmitFunc) *GroupSubmitTaskTool {
+	return &GroupSubmitTaskTool{submit: submit}
+}
+
+func (t *GroupSubmitTaskTool) Name() string { return "group_submit_task" }
+func (t *GroupSubmitTaskTool) Description() string {
+	return "Submit a task to the agent group; another agent picks it up and responds."
+}
+func (t *GroupSubmitTaskTool) Tier() int { return TierHighRisk }
+
+func (t *GroupSubmitTaskTool) Parameters() map[string]any {
+	return map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"description": map[string]any{
+				"type":        "string",
+				"description": "Short description of the task",
+			},
+			"content": map[string]any{
+				"type":        "string",
+				"description": "Details and inputs for the task",
+			},
+		},
+		"required": []string{"description"},
+	}
+}
+
+func (t *GroupSubmitTaskTool) Execute(ctx context.Context, params map[string]any) (string, error) {
+	description := strings.TrimSpace(GetString(params, "description", ""))
+	if description == "" {
+		return "Error: description is required", nil
+	}
+	id, err := t.submit(ctx, description, GetString(params, "content", ""))
+	if err != nil {
+		return fmt.Sprintf("Error submitting task: %v", err), nil
+	}
+	return fmt.Sprintf("Submitted group task %s", id), nil
+}
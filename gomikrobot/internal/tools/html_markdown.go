@@ -0,0 +1,299 @@
+package tools
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// HTMLToMarkdown converts an HTML document to readable markdown and
+// returns its title. Scripts, styles, forms and other non-content
+// elements are dropped; relative links are resolved against base.
+func HTMLToMarkdown(r io.Reader, base *url.URL) (title, markdown string, err error) {
+	doc, err := html.Parse(r)
+	if err != nil {
+		return "", "", fmt.Errorf("parse html: %w", err)
+	}
+	c := &mdConverter{base: base}
+	out := c.node(doc)
+	return strings.TrimSpace(c.title), tidyMarkdown(out), nil
+}
+
+type mdConverter struct {
+	base  *url.URL
+	title string
+}
+
+// skipped are elements without readable content.
+var skipped = map[atom.Atom]bool{
+	atom.Script: true, atom.Style: true, atom.Noscript: true, atom.Template: true,
+	atom.Svg: true, atom.Iframe: true, atom.Form: true, atom.Button: true,
+	atom.Select: true, atom.Input: true, atom.Textarea: true, atom.Nav: true,
+	atom.Head: true, atom.Object: true, atom.Embed: true, atom.Canvas: true,
+}
+
+// blocks are elements rendered as separate paragraphs.
+var blocks = map[atom.Atom]bool{
+	atom.P: true, atom.Div: true, atom.Section: true, atom.Article: true,
+	atom.Main: true, atom.Header: true, atom.Footer: true, atom.Aside: true,
+	atom.Figure: true, atom.Figcaption: true, atom.Dl: true, atom.Dt: true,
+	atom.Dd: true, atom.Address: true, atom.Details: true, atom.Summary: true,
+	atom.Body: true, atom.Html: true,
+}
+
+var spaceRun = regexp.MustCompile(`\s+`)
+
+func (c *mdConverter) node(n *html.Node) string {
+	switch n.Type {
+	case html.TextNode:
+		return spaceRun.ReplaceAllString(n.Data, " ")
+	case html.DocumentNode:
+		return c.children(n)
+	case html.ElementNode:
+	default:
+		return ""
+	}
+
+	if n.DataAtom == atom.Title {
+		if c.title == "" {
+			c.title = textContent(n)
+		}
+		return ""
+	}
+	if n.DataAtom == atom.Head {
+		// The title is the only content of interest in the head.
+		for ch := n.FirstChild; ch != nil; ch = ch.NextSibling {
+			if ch.DataAtom == atom.Title {
+				c.node(ch)
+			}
+		}
+		return ""
+	}
+	if skipped[n.DataAtom] || hasAttr(n, "hidden") || attr(n, "aria-hidden") == "true" {
+		return ""
+	}
+
+	switch n.DataAtom {
+	case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6:
+		level := int(n.Data[1] - '0')
+		text := oneLine(c.children(n))
+		if text == "" {
+			return ""
+		}
+		return "\n\n" + strings.Repeat("#", level) + " " + text + "\n\n"
+	case atom.Br:
+		return "\n"
+	case atom.Hr:
+		return "\n\n---\n\n"
+	case atom.A:
+		text := oneLine(c.children(n))
+		href := c.resolve(attr(n, "href"))
+		if text == "" || href == "" {
+			return text
+		}
+		return "[" + text + "](" + href + ")"
+	case atom.Img:
+		src := c.resolve(attr(n, "src"))
+		if src == "" {
+			return ""
+		}
+		return "![" + oneLine(attr(n, "alt")) + "](" + src + ")"
+	case atom.Strong, atom.B:
+		return wrapInline(c.children(n), "**")
+	case atom.Em, atom.I:
+		return wrapInline(c.children(n), "*")
+	case atom.Code, atom.Kbd, atom.Samp:
+		text := textContent(n)
+		if strings.TrimSpace(text) == "" {
+			return text
+		}
+		return "`" + strings.TrimSpace(text) + "`"
+	case atom.Pre:
+		text := strings.Trim(textContent(n), "\n")
+		return "\n\n```\n" + text + "\n```\n\n"
+	case atom.Ul, atom.Ol:
+		return "\n\n" + c.list(n) + "\n\n"
+	case atom.Blockquote:
+		inner := strings.TrimSpace(tidyMarkdown(c.children(n)))
+		if inner == "" {
+			return ""
+		}
+		return "\n\n> " + strings.ReplaceAll(inner, "\n", "\n> ") + "\n\n"
+	case atom.Table:
+		return "\n\n" + c.table(n) + "\n\n"
+	case atom.Li:
+		// A list item outside a list.
+		return "\n- " + strings.TrimSpace(c.children(n)) + "\n"
+	}
+	if blocks[n.DataAtom] {
+		return "\n\n" + strings.TrimSpace(c.children(n)) + "\n\n"
+	}
+	return c.children(n)
+}
+
+func (c *mdConverter) children(n *html.Node) string {
+	var sb strings.Builder
+	for ch := n.FirstChild; ch != nil; ch = ch.NextSibling {
+		sb.WriteString(c.node(ch))
+	}
+	return sb.String()
+}
+
+// list renders the items of a ul or ol; nested lists are indented.
+func (c *mdConverter) list(n *html.Node) string {
+	var lines []string
+	i := 0
+	for li := n.FirstChild; li != nil; li = li.NextSibling {
+		if li.Type != html.ElementNode || li.DataAtom != atom.Li {
+			continue
+		}
+		i++
+		marker := "- "
+		if n.DataAtom == atom.Ol {
+			marker = fmt.Sprintf("%d. ", i)
+		}
+		body := strings.TrimSpace(tidyMarkdown(c.children(li)))
+		body = strings.ReplaceAll(body, "\n\n", "\n")
+		body = strings.ReplaceAll(body, "\n", "\n"+strings.Repeat(" ", len(marker)))
+		lines = append(lines, marker+body)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// table renders a table as a markdown table with the first row as header.
+func (c *mdConverter) table(n *html.Node) string {
+	var rows [][]string
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		for ch := n.FirstChild; ch != nil; ch = ch.NextSibling {
+			if ch.Type != html.ElementNode {
+				continue
+			}
+			switch ch.DataAtom {
+			case atom.Tr:
+				var row []string
+				for cell := ch.FirstChild; cell != nil; cell = cell.NextSibling {
+					if cell.DataAtom == atom.Td || cell.DataAtom == atom.Th {
+						row = append(row, strings.ReplaceAll(oneLine(c.children(cell)), "|", `\|`))
+					}
+				}
+				if len(row) > 0 {
+					rows = append(rows, row)
+				}
+			case atom.Thead, atom.Tbody, atom.Tfoot:
+				walk(ch)
+			}
+		}
+	}
+	walk(n)
+	if len(rows) == 0 {
+		return ""
+	}
+	cols := 0
+	for _, r := range rows {
+		cols = max(cols, len(r))
+	}
+	var sb strings.Builder
+	for i, r := range rows {
+		for len(r) < cols {
+			r = append(r, "")
+		}
+		sb.WriteString("| " + strings.Join(r, " | ") + " |\n")
+		if i == 0 {
+			sb.WriteString("|" + strings.Repeat(" --- |", cols) + "\n")
+		}
+	}
+	return strings.TrimSuffix(sb.String(), "\n")
+}
+
+// resolve makes href absolute and drops links that lead nowhere.
+func (c *mdConverter) resolve(href string) string {
+	href = strings.TrimSpace(href)
+	if href == "" || strings.HasPrefix(href, "#") || strings.HasPrefix(strings.ToLower(href), "javascript:") {
+		return ""
+	}
+	u, err := url.Parse(href)
+	if err != nil {
+		return ""
+	}
+	if c.base != nil {
+		u = c.base.ResolveReference(u)
+	}
+	return u.String()
+}
+
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+func hasAttr(n *html.Node, key string) bool {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return true
+		}
+	}
+	return false
+}
+
+// textContent returns the raw text below n, keeping whitespace.
+func textContent(n *html.Node) string {
+	if n.Type == html.TextNode {
+		return n.Data
+	}
+	var sb strings.Builder
+	for ch := n.FirstChild; ch != nil; ch = ch.NextSibling {
+		sb.WriteString(textContent(ch))
+	}
+	return sb.String()
+}
+
+func oneLine(s string) string {
+	return strings.TrimSpace(spaceRun.ReplaceAllString(s, " "))
+}
+
+// wrapInline puts mark around s, keeping surrounding spaces outside.
+func wrapInline(s, mark string) string {
+	trimmed := strings.TrimSpace(s)
+	if trimmed == "" {
+		return s
+	}
+	lead := s[:strings.Index(s, trimmed)]
+	trail := s[len(lead)+len(trimmed):]
+	return lead + mark + trimmed + mark + trail
+}
+
+var blankLines = regexp.MustCompile(`\n{3,}`)
+
+// tidyMarkdown trims stray spaces at line ends and starts outside code
+// blocks and collapses runs of blank lines.
+func tidyMarkdown(s string) string {
+	lines := strings.Split(s, "\n")
+	inCode := false
+	for i, line := range lines {
+		if strings.HasPrefix(line, "```") {
+			inCode = !inCode
+			continue
+		}
+		if inCode {
+			continue
+		}
+		line = strings.TrimRight(line, " \t")
+		// A single leading space is left over from the text after a tag;
+		// more are the indentation of nested list items.
+		if strings.HasPrefix(line, " ") && !strings.HasPrefix(line, "  ") {
+			line = line[1:]
+		}
+		lines[i] = line
+	}
+	return strings.TrimSpace(blankLines.ReplaceAllString(strings.Join(lines, "\n"), "\n\n"))
+}
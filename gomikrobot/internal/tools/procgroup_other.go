@@ -0,0 +1,8 @@
+//go:build windows
+
+package tools
+
+import "os/exec"
+
+// startInProcessGroup is a no-op on Windows; cancellation kills the shell only.
+func startInProcessGroup(cmd *exec.Cmd) {}
@@ -0,0 +1,22 @@
+//go:build !windows
+
+package tools
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// startInProcessGroup runs cmd in its own process group and makes context
+// cancellation kill the whole group, so children of the shell (pipelines,
+// background jobs) do not outlive a cancelled or timed-out command.
+// Attributes already set on cmd (sandbox namespaces) are kept.
+func startInProcessGroup(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Setpgid = true
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+}
@@ -9,6 +9,9 @@ import (
 	"regexp"
 	"strings"
 	"time"
+
+	"github.com/kamir/gomikrobot/internal/config"
+	"github.com/kamir/gomikrobot/internal/sandbox"
 )
 
 // DenyPatterns contains regex patterns for dangerous commands.
@@ -72,6 +75,32 @@ type ExecTool struct {
 	pathRegexes         []*regexp.Regexp
 	allowRegexes        []*regexp.Regexp
 	StrictAllowList     bool
+	// Sandbox names the entry of SandboxProfiles that commands run in;
+	// empty or "none" runs them unsandboxed. WithSandbox overrides it per
+	// call.
+	Sandbox         string
+	SandboxProfiles map[string]config.SandboxProfile
+}
+
+// Default limits of a sandbox profile that leaves them unset. Memory is
+// not limited by default: without cgroups the limit is on address space,
+// which runtimes such as Node, the JVM and Go exceed at startup.
+const (
+	defaultSandboxCPUSeconds   = 60
+	defaultSandboxMaxProcesses = 256
+)
+
+type sandboxKey struct{}
+
+// WithSandbox returns a context whose exec calls run in the named sandbox
+// profile instead of the tool's default ("none" disables the sandbox).
+func WithSandbox(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, sandboxKey{}, name)
+}
+
+func sandboxFrom(ctx context.Context) (string, bool) {
+	name, ok := ctx.Value(sandboxKey{}).(string)
+	return name, ok
 }
 
 // NewExecTool creates a new ExecTool.
@@ -158,7 +187,13 @@ func (t *ExecTool) Execute(ctx context.Context, params map[string]any) (string,
 	ctx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
 
-	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	cmd, release, err := t.command(ctx, command, workingDir)
+	if err != nil {
+		return fmt.Sprintf("Error: sandbox: %v", err), nil
+	}
+	defer release()
+	startInProcessGroup(cmd)
+	cmd.WaitDelay = 2 * time.Second
 	if workingDir != "" {
 		cmd.Dir = workingDir
 	}
@@ -167,7 +202,7 @@ func (t *ExecTool) Execute(ctx context.Context, params map[string]any) (string,
 	cmd.Stdout = &stdout
 	cmd.Stderr = &stderr
 
-	err := cmd.Run()
+	err = cmd.Run()
 
 	// Build result
 	var result strings.Builder
@@ -185,6 +220,9 @@ func (t *ExecTool) Execute(ctx context.Context, params map[string]any) (string,
 	if ctx.Err() == context.DeadlineExceeded {
 		return fmt.Sprintf("Error: command timed out after %v\n%s", timeout, result.String()), nil
 	}
+	if ctx.Err() == context.Canceled {
+		return fmt.Sprintf("Error: command cancelled\n%s", result.String()), nil
+	}
 
 	if err != nil {
 		if exitErr, ok := err.(*exec.ExitError); ok {
@@ -201,6 +239,47 @@ func (t *ExecTool) Execute(ctx context.Context, params map[string]any) (string,
 	return result.String(), nil
 }
 
+// command prepares the shell for command, inside the sandbox if one is
+// configured; release frees the sandbox once the command has exited. An
+// unknown profile is an error rather than running the command
+// unsandboxed.
+func (t *ExecTool) command(ctx context.Context, command, workingDir string) (*exec.Cmd, func(), error) {
+	name := t.Sandbox
+	if override, ok := sandboxFrom(ctx); ok {
+		name = override
+	}
+	if name == "" || name == "none" {
+		return exec.CommandContext(ctx, "sh", "-c", command), func() {}, nil
+	}
+	profile, ok := t.SandboxProfiles[name]
+	if !ok {
+		return nil, nil, fmt.Errorf("unknown profile %q", name)
+	}
+
+	spec := sandbox.Spec{
+		Network:      profile.Network,
+		Dir:          workingDir,
+		MemoryBytes:  int64(profile.MemoryMB) << 20,
+		CPUSeconds:   profile.CPUSeconds,
+		MaxProcesses: profile.MaxProcesses,
+		Env:          profile.Env,
+		HostProc:     profile.HostProc,
+	}
+	if repo := t.defaultWorkDir(); repo != "" {
+		spec.Writable = append(spec.Writable, repo)
+	}
+	for _, p := range profile.Writable {
+		spec.Writable = append(spec.Writable, expandPath(p))
+	}
+	if spec.CPUSeconds == 0 {
+		spec.CPUSeconds = defaultSandboxCPUSeconds
+	}
+	if spec.MaxProcesses == 0 {
+		spec.MaxProcesses = defaultSandboxMaxProcesses
+	}
+	return sandbox.Command(ctx, spec, "sh", "-c", command)
+}
+
 func (t *ExecTool) guardCommand(command, workingDir string) error {
 	// Strict allow-list mode
 	if t.StrictAllowList {
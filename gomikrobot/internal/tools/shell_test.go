@@ -37,6 +37,29 @@ func TestExecTool_Timeout(t *testing.T) {
 	}
 }
 
+func TestExecTool_CancelKillsChildren(t *testing.T) {
+	tool := NewExecTool(30*time.Second, false, "", nil)
+	tool.StrictAllowList = false
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+
+	// The subshell's sleep keeps stdout open unless the whole group dies.
+	start := time.Now()
+	result, err := tool.Execute(ctx, map[string]any{
+		"command": "(sleep 20; echo late) & sleep 20; echo done",
+	})
+	if err != nil {
+		t.Fatalf("Execute() error: %v", err)
+	}
+	if !strings.Contains(result, "cancelled") {
+		t.Errorf("expected cancel message, got '%s'", result)
+	}
+	if d := time.Since(start); d > 1500*time.Millisecond {
+		t.Errorf("cancelled command took %v, children were not killed", d)
+	}
+}
+
 func TestExecTool_DenyPatterns(t *testing.T) {
 	tool := NewExecTool(5*time.Second, false, "", nil)
 	tool.StrictAllowList = false
@@ -116,3 +139,31 @@ func TestExecTool_ExitCode(t *testing.T) {
 		t.Errorf("expected 'Exit code: 42' in output, got '%s'", result)
 	}
 }
+
+func TestExecTool_SandboxProfile(t *testing.T) {
+	tool := NewExecTool(5*time.Second, false, "", nil)
+	tool.StrictAllowList = false
+	tool.Sandbox = "missing"
+
+	// An unknown profile fails closed.
+	result, err := tool.Execute(context.Background(), map[string]any{
+		"command": "echo hello",
+	})
+	if err != nil {
+		t.Fatalf("Execute() error: %v", err)
+	}
+	if !strings.HasPrefix(result, "Error: sandbox:") {
+		t.Errorf("expected sandbox error, got '%s'", result)
+	}
+
+	// "none" in the context disables the sandbox for the call.
+	result, err = tool.Execute(WithSandbox(context.Background(), "none"), map[string]any{
+		"command": "echo hello",
+	})
+	if err != nil {
+		t.Fatalf("Execute() error: %v", err)
+	}
+	if !strings.Contains(result, "hello") {
+		t.Errorf("expected 'hello' in output, got '%s'", result)
+	}
+}
@@ -0,0 +1,136 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/kamir/gomikrobot/internal/timeline"
+)
+
+// TimelineQueryTool searches the timeline for events and agent tasks.
+type TimelineQueryTool struct {
+	timeline *timeline.TimelineService
+}
+
+func NewTimelineQueryTool(tl *timeline.TimelineService) *TimelineQueryTool {
+	return &TimelineQueryTool{timeline: tl}
+}
+
+func (t *TimelineQueryTool) Name() string { return "timeline_query" }
+func (t *TimelineQueryTool) Description() string {
+	return "Query the timeline: recent messages and events (filter by sender, trace or time) or agent tasks (filter by status and channel)."
+}
+func (t *TimelineQueryTool) Tier() int { return TierReadOnly }
+
+func (t *TimelineQueryTool) Parameters() map[string]any {
+	return map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"kind": map[string]any{
+				"type":        "string",
+				"enum":        []string{"events", "tasks"},
+				"description": "What to query (default: events)",
+			},
+			"sender": map[string]any{
+				"type":        "string",
+				"description": "Events: sender ID",
+			},
+			"trace_id": map[string]any{
+				"type":        "string",
+				"description": "Events: trace ID",
+			},
+			"since": map[string]any{
+				"type":        "string",
+				"description": "Events: a duration like 24h or a date (2006-01-02)",
+			},
+			"status": map[string]any{
+				"type":        "string",
+				"description": "Tasks: pending, processing, completed or failed",
+			},
+			"channel": map[string]any{
+				"type":        "string",
+				"description": "Tasks: channel name",
+			},
+			"limit": map[string]any{
+				"type":        "integer",
+				"description": "Maximum number of results (default: 20, max: 100)",
+			},
+		},
+	}
+}
+
+func (t *TimelineQueryTool) Execute(ctx context.Context, params map[string]any) (string, error) {
+	limit := GetInt(params, "limit", 20)
+	if limit <= 0 || limit > 100 {
+		limit = 100
+	}
+	switch kind := GetString(params, "kind", "events"); kind {
+	case "events":
+		return t.events(params, limit), nil
+	case "tasks":
+		return t.tasks(params, limit), nil
+	default:
+		return fmt.Sprintf("Error: unknown kind %q", kind), nil
+	}
+}
+
+func (t *TimelineQueryTool) events(params map[string]any, limit int) string {
+	filter := timeline.FilterArgs{
+		SenderID: GetString(params, "sender", ""),
+		TraceID:  GetString(params, "trace_id", ""),
+		Limit:    limit,
+	}
+	if since := GetString(params, "since", ""); since != "" {
+		start, err := parseSince(since, time.Now())
+		if err != nil {
+			return "Error: " + err.Error()
+		}
+		filter.StartDate = &start
+	}
+	events, err := t.timeline.GetEvents(filter)
+	if err != nil {
+		return fmt.Sprintf("Error querying timeline: %v", err)
+	}
+	if len(events) == 0 {
+		return "No events found."
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%d events:\n", len(events))
+	for _, e := range events {
+		sender := e.SenderName
+		if sender == "" {
+			sender = e.SenderID
+		}
+		fmt.Fprintf(&sb, "- %s [%s] %s: %s\n", e.Timestamp.Local().Format("2006-01-02 15:04"), e.EventType, sender, truncate(e.ContentText, 200))
+	}
+	return sb.String()
+}
+
+func (t *TimelineQueryTool) tasks(params map[string]any, limit int) string {
+	tasks, err := t.timeline.ListTasks(GetString(params, "status", ""), GetString(params, "channel", ""), limit, 0)
+	if err != nil {
+		return fmt.Sprintf("Error listing tasks: %v", err)
+	}
+	if len(tasks) == 0 {
+		return "No tasks found."
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%d tasks:\n", len(tasks))
+	for _, task := range tasks {
+		fmt.Fprintf(&sb, "- %s %s [%s/%s] %s\n", task.CreatedAt.Local().Format("2006-01-02 15:04"), task.TaskID, task.Channel, task.Status, truncate(task.ContentIn, 200))
+	}
+	return sb.String()
+}
+
+// parseSince accepts a duration back from now or a date.
+func parseSince(s string, now time.Time) (time.Time, error) {
+	if d, err := time.ParseDuration(s); err == nil {
+		return now.Add(-d), nil
+	}
+	if d, err := time.ParseInLocation("2006-01-02", s, time.Local); err == nil {
+		return d, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid since %q (use a duration like 24h or a date like 2006-01-02)", s)
+}
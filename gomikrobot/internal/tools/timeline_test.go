@@ -0,0 +1,40 @@
+package tools
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kamir/gomikrobot/internal/timeline"
+)
+
+func TestTimelineQueryTool(t *testing.T) {
+	tl, err := timeline.NewTimelineService(filepath.Join(t.TempDir(), "timeline.db"))
+	if err != nil {
+		t.Fatalf("timeline: %v", err)
+	}
+	defer tl.Close()
+	if err := tl.AddEvent(&timeline.TimelineEvent{EventID: "e1", Timestamp: time.Now(), SenderID: "alice", EventType: "TEXT", ContentText: "hello there"}); err != nil {
+		t.Fatalf("add event: %v", err)
+	}
+	if _, err := tl.CreateTask(&timeline.AgentTask{Channel: "cli", ChatID: "c1", ContentIn: "plan the week"}); err != nil {
+		t.Fatalf("create task: %v", err)
+	}
+
+	tool := NewTimelineQueryTool(tl)
+	ctx := context.Background()
+	if out, _ := tool.Execute(ctx, map[string]any{"sender": "alice", "since": "1h"}); !strings.Contains(out, "hello there") {
+		t.Errorf("events = %q", out)
+	}
+	if out, _ := tool.Execute(ctx, map[string]any{"sender": "bob"}); out != "No events found." {
+		t.Errorf("events for bob = %q", out)
+	}
+	if out, _ := tool.Execute(ctx, map[string]any{"kind": "tasks", "channel": "cli"}); !strings.Contains(out, "plan the week") {
+		t.Errorf("tasks = %q", out)
+	}
+	if out, _ := tool.Execute(ctx, map[string]any{"since": "last week"}); !strings.HasPrefix(out, "Error:") {
+		t.Errorf("expected an error for an invalid since, got %q", out)
+	}
+}
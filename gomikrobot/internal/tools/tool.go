@@ -4,6 +4,8 @@ package tools
 import (
 	"context"
 	"fmt"
+	"strings"
+	"sync"
 )
 
 // Tool is the interface that all agent tools must implement.
@@ -28,6 +30,22 @@ type TieredTool interface {
 	Tier() int
 }
 
+// CallTieredTool is an optional interface for tools whose risk depends on
+// the arguments of a call. Tier still gives the tier for listings.
+type CallTieredTool interface {
+	TieredTool
+	CallTier(params map[string]any) int
+}
+
+// FileChanger is an optional interface for tools that modify files, so the
+// agent can journal the files before and after a call.
+type FileChanger interface {
+	Tool
+	// ChangedFiles returns the absolute paths a call with params may
+	// modify, leaving out paths the tool would refuse.
+	ChangedFiles(params map[string]any) []string
+}
+
 // Risk tier constants.
 const (
 	TierReadOnly  = 0 // Read-only internal tools
@@ -45,18 +63,30 @@ func ToolTier(t Tool) int {
 	return TierReadOnly
 }
 
+// CallTier returns the risk tier of a call of t with params: CallTier for a
+// CallTieredTool, ToolTier otherwise.
+func CallTier(t Tool, params map[string]any) int {
+	if ct, ok := t.(CallTieredTool); ok {
+		return ct.CallTier(params)
+	}
+	return ToolTier(t)
+}
+
 // DefaultToolNames returns the names of tools that are registered by default
 // in the agent loop. Used for identity announcements when a full registry is
 // not available (e.g. group manager startup).
 func DefaultToolNames() []string {
 	return []string{
 		"read_file", "write_file", "edit_file",
-		"list_dir", "resolve_path", "exec",
+		"list_dir", "resolve_path", "exec", "spawn_agent",
+		"web_search", "web_fetch",
 	}
 }
 
-// Registry manages tool registration and execution.
+// Registry manages tool registration and execution. It is safe for
+// concurrent use; MCP servers add and remove tools at runtime.
 type Registry struct {
+	mu    sync.RWMutex
 	tools map[string]Tool
 }
 
@@ -69,17 +99,30 @@ func NewRegistry() *Registry {
 
 // Register adds a tool to the registry.
 func (r *Registry) Register(tool Tool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
 	r.tools[tool.Name()] = tool
 }
 
+// Unregister removes a tool by name.
+func (r *Registry) Unregister(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.tools, name)
+}
+
 // Get returns a tool by name.
 func (r *Registry) Get(name string) (Tool, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
 	tool, ok := r.tools[name]
 	return tool, ok
 }
 
 // List returns all registered tools.
 func (r *Registry) List() []Tool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
 	result := make([]Tool, 0, len(r.tools))
 	for _, tool := range r.tools {
 		result = append(result, tool)
@@ -89,6 +132,8 @@ func (r *Registry) List() []Tool {
 
 // Definitions returns tool definitions in OpenAI format.
 func (r *Registry) Definitions() []map[string]any {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
 	result := make([]map[string]any, 0, len(r.tools))
 	for _, tool := range r.tools {
 		result = append(result, map[string]any{
@@ -105,7 +150,7 @@ func (r *Registry) Definitions() []map[string]any {
 
 // Execute runs a tool by name with the given parameters.
 func (r *Registry) Execute(ctx context.Context, name string, params map[string]any) (string, error) {
-	tool, ok := r.tools[name]
+	tool, ok := r.Get(name)
 	if !ok {
 		return "", fmt.Errorf("tool not found: %s", name)
 	}
@@ -144,3 +189,20 @@ func GetBool(params map[string]any, key string, defaultVal bool) bool {
 	}
 	return defaultVal
 }
+
+// GetStringSlice extracts a string list parameter (a JSON array of strings).
+// Non-string and blank items are skipped.
+func GetStringSlice(params map[string]any, key string) []string {
+	var out []string
+	switch v := params[key].(type) {
+	case []string:
+		out = v
+	case []any:
+		for _, item := range v {
+			if s, ok := item.(string); ok && strings.TrimSpace(s) != "" {
+				out = append(out, strings.TrimSpace(s))
+			}
+		}
+	}
+	return out
+}
@@ -0,0 +1,246 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/kamir/gomikrobot/internal/config"
+	"golang.org/x/net/html/charset"
+)
+
+// WebFetchTool downloads a web page and returns it as markdown.
+type WebFetchTool struct {
+	cfg    config.FetchConfig
+	client *http.Client
+}
+
+// NewWebFetchTool creates a fetch tool. Zero limits in cfg get defaults.
+func NewWebFetchTool(cfg config.FetchConfig) *WebFetchTool {
+	if cfg.MaxBytes <= 0 {
+		cfg.MaxBytes = 2 << 20
+	}
+	if cfg.MaxChars <= 0 {
+		cfg.MaxChars = 50000
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 30 * time.Second
+	}
+	if cfg.UserAgent == "" {
+		cfg.UserAgent = "GoMikroBot/1.0 (+web_fetch)"
+	}
+	t := &WebFetchTool{cfg: cfg}
+
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	if !cfg.AllowPrivate {
+		// Checked on the resolved address, so DNS cannot point a public
+		// name at an internal service.
+		dialer.Control = func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip != nil && isPrivateIP(ip) {
+				return fmt.Errorf("address %s is private", host)
+			}
+			return nil
+		}
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dialer.DialContext
+	transport.Proxy = nil
+	t.client = &http.Client{
+		Timeout:   cfg.Timeout,
+		Transport: transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 5 {
+				return errors.New("too many redirects")
+			}
+			return t.checkURL(req.URL)
+		},
+	}
+	return t
+}
+
+func (t *WebFetchTool) Name() string { return "web_fetch" }
+
+// Tier is TierWrite: the request leaves the machine and its URL can carry
+// data, so external senders may not trigger it.
+func (t *WebFetchTool) Tier() int { return TierWrite }
+
+func (t *WebFetchTool) Description() string {
+	return "Fetch a web page (http or https) and return its content as markdown. Also reads plain text and JSON."
+}
+
+func (t *WebFetchTool) Parameters() map[string]any {
+	return map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"url": map[string]any{
+				"type":        "string",
+				"description": "The URL to fetch",
+			},
+		},
+		"required": []string{"url"},
+	}
+}
+
+func (t *WebFetchTool) Execute(ctx context.Context, params map[string]any) (string, error) {
+	raw := strings.TrimSpace(GetString(params, "url", ""))
+	if raw == "" {
+		return "Error: url is required", nil
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return fmt.Sprintf("Error: invalid url: %v", err), nil
+	}
+	if err := t.checkURL(u); err != nil {
+		return fmt.Sprintf("Error: %v", err), nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return fmt.Sprintf("Error: %v", err), nil
+	}
+	req.Header.Set("User-Agent", t.cfg.UserAgent)
+	req.Header.Set("Accept", "text/html,application/xhtml+xml,text/plain,text/markdown,application/json;q=0.9,*/*;q=0.1")
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return fmt.Sprintf("Error: fetch failed: %v", err), nil
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return fmt.Sprintf("Error: %s returned status %d", resp.Request.URL, resp.StatusCode), nil
+	}
+
+	contentType := resp.Header.Get("Content-Type")
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	kind := contentKind(mediaType)
+	if kind == "" {
+		return fmt.Sprintf("Error: unsupported content type %q", mediaType), nil
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, t.cfg.MaxBytes+1))
+	if err != nil {
+		return fmt.Sprintf("Error: read body: %v", err), nil
+	}
+	truncatedBody := int64(len(body)) > t.cfg.MaxBytes
+	if truncatedBody {
+		body = body[:t.cfg.MaxBytes]
+	}
+	if kind == "unknown" {
+		// No or a generic content type: accept text, refuse binary data.
+		if bytes.IndexByte(body[:min(len(body), 1024)], 0) >= 0 {
+			return fmt.Sprintf("Error: unsupported content type %q (binary data)", mediaType), nil
+		}
+		kind = "text"
+		if looksLikeHTML(body) {
+			kind = "html"
+		}
+	}
+
+	reader, err := charset.NewReader(bytes.NewReader(body), contentType)
+	if err != nil {
+		reader = bytes.NewReader(body)
+	}
+	var title, content string
+	if kind == "html" {
+		title, content, err = HTMLToMarkdown(reader, resp.Request.URL)
+		if err != nil {
+			return fmt.Sprintf("Error: %v", err), nil
+		}
+	} else {
+		data, _ := io.ReadAll(reader)
+		content = string(data)
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "URL: %s\n", resp.Request.URL)
+	if title != "" {
+		fmt.Fprintf(&sb, "Title: %s\n", title)
+	}
+	if mediaType != "" {
+		fmt.Fprintf(&sb, "Content-Type: %s\n", mediaType)
+	}
+	sb.WriteString("\n")
+	if len(content) > t.cfg.MaxChars {
+		fmt.Fprintf(&sb, "%s\n\n[truncated: showing %d of %d characters]", content[:t.cfg.MaxChars], t.cfg.MaxChars, len(content))
+	} else {
+		sb.WriteString(content)
+		if truncatedBody {
+			fmt.Fprintf(&sb, "\n\n[truncated: page larger than %d bytes]", t.cfg.MaxBytes)
+		}
+	}
+	return sb.String(), nil
+}
+
+// checkURL enforces the scheme and the domain lists.
+func (t *WebFetchTool) checkURL(u *url.URL) error {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("only http and https URLs can be fetched")
+	}
+	host := strings.ToLower(strings.TrimSuffix(u.Hostname(), "."))
+	if host == "" {
+		return fmt.Errorf("url has no host")
+	}
+	for _, d := range t.cfg.DenyDomains {
+		if domainMatches(host, d) {
+			return fmt.Errorf("domain %s is denied", host)
+		}
+	}
+	if len(t.cfg.AllowDomains) > 0 {
+		for _, d := range t.cfg.AllowDomains {
+			if domainMatches(host, d) {
+				return nil
+			}
+		}
+		return fmt.Errorf("domain %s is not in the allow list", host)
+	}
+	return nil
+}
+
+// domainMatches reports whether host is domain or one of its subdomains.
+func domainMatches(host, domain string) bool {
+	domain = strings.ToLower(strings.Trim(strings.TrimSpace(domain), "."))
+	domain = strings.TrimPrefix(domain, "*.")
+	return domain != "" && (host == domain || strings.HasSuffix(host, "."+domain))
+}
+
+// contentKind sorts a media type into html, text, unknown (sniffed) or ""
+// (unsupported).
+func contentKind(mediaType string) string {
+	switch {
+	case mediaType == "text/html", mediaType == "application/xhtml+xml":
+		return "html"
+	case strings.HasPrefix(mediaType, "text/"),
+		mediaType == "application/json", strings.HasSuffix(mediaType, "+json"),
+		mediaType == "application/xml", strings.HasSuffix(mediaType, "+xml"),
+		mediaType == "application/javascript":
+		return "text"
+	case mediaType == "", mediaType == "application/octet-stream":
+		return "unknown"
+	default:
+		return ""
+	}
+}
+
+func looksLikeHTML(body []byte) bool {
+	head := strings.ToLower(string(body[:min(len(body), 512)]))
+	return strings.Contains(head, "<html") || strings.Contains(head, "<!doctype html")
+}
+
+// isPrivateIP reports addresses that must not be reached from the web
+// tools: loopback, private, link-local and unspecified ones.
+func isPrivateIP(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() || ip.IsUnspecified() || ip.IsInterfaceLocalMulticast()
+}
@@ -0,0 +1,172 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// SearchResult is one hit of a web search.
+type SearchResult struct {
+	Title       string `json:"title"`
+	URL         string `json:"url"`
+	Description string `json:"description"`
+}
+
+// SearchBackend is a web search API.
+type SearchBackend interface {
+	Name() string
+	Search(ctx context.Context, query string, count int) ([]SearchResult, error)
+}
+
+// NewSearchBackend returns the backend by name ("" or "brave").
+func NewSearchBackend(name, apiKey string) (SearchBackend, error) {
+	switch strings.ToLower(name) {
+	case "", "brave":
+		return NewBraveSearch(apiKey), nil
+	default:
+		return nil, fmt.Errorf("unknown search backend %q", name)
+	}
+}
+
+// BraveSearch queries the Brave Search API.
+type BraveSearch struct {
+	APIKey  string
+	BaseURL string // default: the public API endpoint
+	Client  *http.Client
+}
+
+const braveSearchURL = "https://api.search.brave.com/res/v1/web/search"
+
+// NewBraveSearch creates a Brave backend.
+func NewBraveSearch(apiKey string) *BraveSearch {
+	return &BraveSearch{APIKey: apiKey, BaseURL: braveSearchURL, Client: &http.Client{Timeout: 20 * time.Second}}
+}
+
+func (b *BraveSearch) Name() string { return "brave" }
+
+func (b *BraveSearch) Search(ctx context.Context, query string, count int) ([]SearchResult, error) {
+	q := url.Values{"q": {query}, "count": {fmt.Sprint(count)}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, b.BaseURL+"?"+q.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("X-Subscription-Token", b.APIKey)
+
+	resp, err := b.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("brave search: %w", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 4<<20))
+	if err != nil {
+		return nil, fmt.Errorf("brave search: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("brave search: status %d: %s", resp.StatusCode, strings.TrimSpace(string(body[:min(len(body), 200)])))
+	}
+
+	var parsed struct {
+		Web struct {
+			Results []SearchResult `json:"results"`
+		} `json:"web"`
+	}
+	if err := json.Unmarshal(body, &parsed); err != nil {
+		return nil, fmt.Errorf("brave search: decode response: %w", err)
+	}
+	results := parsed.Web.Results
+	for i := range results {
+		results[i].Title = stripTags(results[i].Title)
+		results[i].Description = stripTags(results[i].Description)
+	}
+	return results, nil
+}
+
+var tagPattern = regexp.MustCompile(`<[^>]*>`)
+
+// stripTags removes the highlighting markup search APIs put in snippets.
+func stripTags(s string) string {
+	s = tagPattern.ReplaceAllString(s, "")
+	r := strings.NewReplacer("&amp;", "&", "&lt;", "<", "&gt;", ">", "&quot;", `"`, "&#39;", "'", "&#x27;", "'")
+	return r.Replace(s)
+}
+
+// WebSearchTool searches the web.
+type WebSearchTool struct {
+	backend    SearchBackend
+	maxResults int
+}
+
+// NewWebSearchTool creates a search tool; maxResults bounds the results
+// per call (0 = 10).
+func NewWebSearchTool(backend SearchBackend, maxResults int) *WebSearchTool {
+	if maxResults <= 0 {
+		maxResults = 10
+	}
+	return &WebSearchTool{backend: backend, maxResults: maxResults}
+}
+
+func (t *WebSearchTool) Name() string { return "web_search" }
+
+// Tier is TierWrite: the query leaves the machine, so external senders
+// may not trigger it.
+func (t *WebSearchTool) Tier() int { return TierWrite }
+
+func (t *WebSearchTool) Description() string {
+	return "Search the web. Returns titles, URLs and snippets; use web_fetch to read a result."
+}
+
+func (t *WebSearchTool) Parameters() map[string]any {
+	return map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"query": map[string]any{
+				"type":        "string",
+				"description": "The search query",
+			},
+			"count": map[string]any{
+				"type":        "integer",
+				"description": fmt.Sprintf("Number of results (1-%d)", t.maxResults),
+			},
+		},
+		"required": []string{"query"},
+	}
+}
+
+func (t *WebSearchTool) Execute(ctx context.Context, params map[string]any) (string, error) {
+	query := strings.TrimSpace(GetString(params, "query", ""))
+	if query == "" {
+		return "Error: query is required", nil
+	}
+	count := GetInt(params, "count", t.maxResults)
+	if count <= 0 || count > t.maxResults {
+		count = t.maxResults
+	}
+
+	results, err := t.backend.Search(ctx, query, count)
+	if err != nil {
+		return fmt.Sprintf("Error: %v", err), nil
+	}
+	if len(results) == 0 {
+		return fmt.Sprintf("No results for %q.", query), nil
+	}
+	if len(results) > count {
+		results = results[:count]
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Results for %q:\n", query)
+	for i, r := range results {
+		fmt.Fprintf(&sb, "\n%d. %s\n   %s\n", i+1, r.Title, r.URL)
+		if r.Description != "" {
+			fmt.Fprintf(&sb, "   %s\n", r.Description)
+		}
+	}
+	return sb.String(), nil
+}
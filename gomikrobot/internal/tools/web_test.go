@@ -0,0 +1,165 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/kamir/gomikrobot/internal/config"
+)
+
+func TestHTMLToMarkdown(t *testing.T) {
+	page := `<!DOCTYPE html><html><head><title>Release  Notes</title><style>p{}</style></head>
+<body><nav><a href="/">Home</a></nav>
+<h1>Version <b>2.0</b></h1>
+<p>See the <a href="docs/upgrade.html">upgrade guide</a> and <em>read</em> it.</p>
+<script>alert("x")</script>
+<ul><li>faster</li><li>smaller<ul><li>by 20%</li></ul></li></ul>
+<pre>go build ./...
+go test ./...</pre>
+<table><tr><th>Name</th><th>Value</th></tr><tr><td>a</td><td>1</td></tr></table>
+<div hidden>secret</div>
+</body></html>`
+	base, _ := url.Parse("https://example.com/releases/")
+	title, md, err := HTMLToMarkdown(strings.NewReader(page), base)
+	if err != nil {
+		t.Fatalf("convert: %v", err)
+	}
+	if title != "Release  Notes" {
+		t.Errorf("title = %q", title)
+	}
+	for _, want := range []string{
+		"# Version **2.0**",
+		"See the [upgrade guide](https://example.com/releases/docs/upgrade.html) and *read* it.",
+		"- faster\n- smaller\n  - by 20%",
+		"```\ngo build ./...\ngo test ./...\n```",
+		"| Name | Value |\n| --- | --- |\n| a | 1 |",
+	} {
+		if !strings.Contains(md, want) {
+			t.Errorf("markdown missing %q:\n%s", want, md)
+		}
+	}
+	for _, unwanted := range []string{"alert", "Home", "secret", "p{}"} {
+		if strings.Contains(md, unwanted) {
+			t.Errorf("markdown should not contain %q:\n%s", unwanted, md)
+		}
+	}
+}
+
+func TestWebSearchBrave(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Subscription-Token") != "key" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Query().Get("q") != "golang sqlite" || r.URL.Query().Get("count") != "2" {
+			t.Errorf("unexpected query %q", r.URL.RawQuery)
+		}
+		fmt.Fprint(w, `{"web":{"results":[
+			{"title":"<strong>SQLite</strong> in Go","url":"https://a.example/1","description":"Pure Go &amp; fast"},
+			{"title":"Second","url":"https://b.example/2","description":""}]}}`)
+	}))
+	defer srv.Close()
+
+	backend := NewBraveSearch("key")
+	backend.BaseURL = srv.URL
+	tool := NewWebSearchTool(backend, 5)
+	out, err := tool.Execute(context.Background(), map[string]any{"query": "golang sqlite", "count": float64(2)})
+	if err != nil {
+		t.Fatalf("execute: %v", err)
+	}
+	for _, want := range []string{"1. SQLite in Go\n   https://a.example/1\n   Pure Go & fast", "2. Second\n   https://b.example/2"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("result missing %q:\n%s", want, out)
+		}
+	}
+
+	backend.APIKey = "wrong"
+	out, _ = tool.Execute(context.Background(), map[string]any{"query": "golang sqlite", "count": float64(2)})
+	if !strings.Contains(out, "status 401") {
+		t.Errorf("expected API error, got %q", out)
+	}
+	if _, err := NewSearchBackend("altavista", "key"); err == nil {
+		t.Error("expected unknown backend to be rejected")
+	}
+}
+
+func TestWebFetch(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/page", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprint(w, `<html><head><title>Hello</title></head><body><p>Café <a href="/next">next</a></p></body></html>`)
+	})
+	mux.HandleFunc("/moved", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/page", http.StatusFound)
+	})
+	mux.HandleFunc("/data.json", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"ok":true}`)
+	})
+	mux.HandleFunc("/image.png", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		w.Write([]byte{0x89, 'P', 'N', 'G'})
+	})
+	mux.HandleFunc("/big", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		fmt.Fprint(w, strings.Repeat("x", 5000))
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+	ctx := context.Background()
+
+	tool := NewWebFetchTool(config.FetchConfig{AllowPrivate: true, MaxChars: 1000})
+	out, _ := tool.Execute(ctx, map[string]any{"url": srv.URL + "/moved"})
+	for _, want := range []string{"URL: " + srv.URL + "/page", "Title: Hello", "Café [next](" + srv.URL + "/next)"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("fetch missing %q:\n%s", want, out)
+		}
+	}
+
+	out, _ = tool.Execute(ctx, map[string]any{"url": srv.URL + "/data.json"})
+	if !strings.HasSuffix(out, `{"ok":true}`) {
+		t.Errorf("expected JSON body, got %q", out)
+	}
+	out, _ = tool.Execute(ctx, map[string]any{"url": srv.URL + "/image.png"})
+	if !strings.Contains(out, `unsupported content type "image/png"`) {
+		t.Errorf("expected unsupported content type, got %q", out)
+	}
+	out, _ = tool.Execute(ctx, map[string]any{"url": srv.URL + "/big"})
+	if !strings.Contains(out, "[truncated: showing 1000 of 5000 characters]") {
+		t.Errorf("expected truncation note, got %q", out[max(0, len(out)-100):])
+	}
+	out, _ = tool.Execute(ctx, map[string]any{"url": "file:///etc/passwd"})
+	if !strings.Contains(out, "only http and https") {
+		t.Errorf("expected scheme to be rejected, got %q", out)
+	}
+
+	// Private addresses are refused by default.
+	strict := NewWebFetchTool(config.FetchConfig{})
+	out, _ = strict.Execute(ctx, map[string]any{"url": srv.URL + "/page"})
+	if !strings.Contains(out, "is private") {
+		t.Errorf("expected private address to be refused, got %q", out)
+	}
+
+	// Domain lists apply to the host and its subdomains.
+	listed := NewWebFetchTool(config.FetchConfig{
+		AllowDomains: []string{"example.com"},
+		DenyDomains:  []string{"ads.example.com"},
+	})
+	for raw, want := range map[string]string{
+		"https://tracker.ads.example.com/x": "domain tracker.ads.example.com is denied",
+		"https://example.org/":              "not in the allow list",
+	} {
+		out, _ = listed.Execute(ctx, map[string]any{"url": raw})
+		if !strings.Contains(out, want) {
+			t.Errorf("%s: expected %q, got %q", raw, want, out)
+		}
+	}
+	if u, _ := url.Parse("https://docs.example.com/"); listed.checkURL(u) != nil {
+		t.Error("subdomain of an allowed domain should be allowed")
+	}
+}